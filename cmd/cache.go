@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/kris-hansen/comanda/utils/cache"
+	"github.com/spf13/cobra"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the model response cache",
+	Long: `Inspect or clear the on-disk cache of model responses.
+
+Responses are cached for steps that set cache, or for every step when a workflow
+is run with --cache. The cache directory can be changed with COMANDA_CACHE_DIR.`,
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show response cache statistics",
+	Long:  `Display the number, size and age of cached responses, broken down by model`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stats, err := cache.Open(cache.DefaultDir()).Stats()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Cache directory: %s\n", stats.Dir)
+		fmt.Printf("Entries: %d\n", stats.Entries)
+		fmt.Printf("Size: %s\n", formatBytes(stats.Bytes))
+		if stats.Entries == 0 {
+			return nil
+		}
+		fmt.Printf("Oldest entry: %s\n", stats.Oldest.Format("2006-01-02 15:04:05"))
+		fmt.Printf("Newest entry: %s\n", stats.Newest.Format("2006-01-02 15:04:05"))
+		fmt.Println("\nEntries by model:")
+		for _, model := range stats.SortedModels() {
+			fmt.Printf("  %s: %d\n", model, stats.ByModel[model])
+		}
+		return nil
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all cached responses",
+	Long:  `Delete every cached model response`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store := cache.Open(cache.DefaultDir())
+		removed, err := store.Clear()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d cached response(s) from %s\n", removed, store.Dir())
+		return nil
+	},
+}
+
+// formatBytes formats a byte count for display
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheStatsCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
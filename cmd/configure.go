@@ -3,10 +3,7 @@ package cmd
 import (
 	"bufio"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -16,6 +13,7 @@ import (
 
 	"github.com/kris-hansen/comanda/utils/config"
 	"github.com/kris-hansen/comanda/utils/database"
+	"github.com/kris-hansen/comanda/utils/discovery"
 	"github.com/kris-hansen/comanda/utils/models"
 	openai "github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
@@ -61,12 +59,6 @@ var unsupportedModelPatterns = []string{
 	"davinci-002", // Older completion models
 }
 
-type OllamaModel struct {
-	Name    string `json:"name"`
-	ModTime string `json:"modified_at"`
-	Size    int64  `json:"size"`
-}
-
 // isUnsupportedModel checks if a model should be excluded from selection
 func isUnsupportedModel(modelName string) bool {
 	modelName = strings.ToLower(modelName)
@@ -231,26 +223,20 @@ func getGoogleModels() []string {
 	}
 }
 
-func getOllamaModels() ([]OllamaModel, error) {
-	resp, err := http.Get("http://localhost:11434/api/tags")
+// getOllamaModels returns the models available on the Ollama servers of the configuration
+func getOllamaModels(envConfig *config.EnvConfig) ([]string, error) {
+	hosts, _, err := envConfig.OllamaHosts()
 	if err != nil {
-		return nil, fmt.Errorf("error connecting to Ollama API: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Ollama API error (status %d): %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	var models struct {
-		Models []OllamaModel `json:"models"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
-		return nil, fmt.Errorf("error decoding Ollama response: %v", err)
+		return nil, err
 	}
+	return discovery.GetOllamaHostsModels(hosts)
+}
 
-	return models.Models, nil
+// usesLocalOllama reports whether the configuration sends Ollama requests to this machine's
+// default server, the only case where the ollama CLI is needed
+func usesLocalOllama(envConfig *config.EnvConfig) bool {
+	hosts, _, err := envConfig.OllamaHosts()
+	return err == nil && len(hosts) == 1 && hosts[0].BaseURL == config.DefaultOllamaURL
 }
 
 func checkOllamaInstalled() bool {
@@ -321,7 +307,7 @@ func configureDatabase(reader *bufio.Reader, envConfig *config.EnvConfig) error
 	if strings.TrimSpace(strings.ToLower(testConn)) == "y" {
 		// Create a database handler and test the connection
 		dbHandler := database.NewHandler(envConfig)
-		if err := dbHandler.TestConnection(dbName); err != nil {
+		if err := dbHandler.TestConnection(context.Background(), dbName); err != nil {
 			return fmt.Errorf("connection test failed: %v", err)
 		}
 		fmt.Printf("%s Database connection successful!\n", greenCheckmark)
@@ -752,7 +738,7 @@ var configureCmd = &cobra.Command{
 			}
 
 			// Special handling for ollama provider
-			if provider == "ollama" {
+			if provider == "ollama" && usesLocalOllama(envConfig) {
 				if !checkOllamaInstalled() {
 					fmt.Println("Error: Ollama is not installed or not running. Please install ollama and try again.")
 					return
@@ -850,15 +836,11 @@ var configureCmd = &cobra.Command{
 				}
 
 			case "ollama":
-				models, err := getOllamaModels()
+				modelNames, err := getOllamaModels(envConfig)
 				if err != nil {
 					fmt.Printf("Error fetching Ollama models: %v\n", err)
 					return
 				}
-				modelNames := make([]string, len(models))
-				for i, model := range models {
-					modelNames[i] = model.Name
-				}
 				if len(modelNames) == 0 {
 					fmt.Println("No models found. Please pull a model first using 'ollama pull <model>'")
 					return
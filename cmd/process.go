@@ -6,23 +6,67 @@ import (
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 
 	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
 	"github.com/kris-hansen/comanda/utils/processor"
 )
 
 // Runtime directory flag
 var runtimeDir string
 
+// Checkpointing flags
+var (
+	resumeRunID  string
+	stateDir     string
+	noCheckpoint bool
+	keepRuns     int
+)
+
+// Response cache flags
+var (
+	useCache bool
+	cacheTTL time.Duration
+	noCache  bool
+)
+
+// Workflow parameter flags
+var (
+	paramValues []string
+	paramsFile  string
+)
+
+// Budget flag
+var maxCost float64
+
 var processCmd = &cobra.Command{
 	Use:   "process [files...]",
 	Short: "Process YAML workflow files",
-	Long:  `Process one or more workflow files and execute the specified actions.`,
-	Args:  cobra.MinimumNArgs(1),
+	Long: `Process one or more workflow files and execute the specified actions.
+
+The result of every completed step is saved under the run state directory, which
+keeps the most recent runs (see --keep-runs). If a run fails, resume it with
+--resume <run-id> to skip the steps whose configuration and inputs are unchanged.
+
+Workflows that declare params take their values from --params-file and --set,
+which override the file:
+
+  comanda process report.yaml --set region=emea --set max_items=20`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		// When resuming, the workflow file defaults to the one the run was started with
+		if resumeRunID != "" {
+			return cobra.MaximumNArgs(1)(cmd, args)
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		// Get environment file path
 		envPath := config.GetEnvPath()
@@ -36,6 +80,12 @@ var processCmd = &cobra.Command{
 		if err != nil {
 			log.Fatalf("Error loading environment configuration: %v", err)
 		}
+		if err := models.RegisterOpenAICompatibleProviders(envConfig); err != nil {
+			log.Fatalf("Error loading environment configuration: %v", err)
+		}
+		if err := models.RegisterModelAliases(envConfig); err != nil {
+			log.Fatalf("Error loading environment configuration: %v", err)
+		}
 
 		if verbose {
 			fmt.Println("[DEBUG] Environment configuration loaded successfully")
@@ -61,7 +111,32 @@ var processCmd = &cobra.Command{
 			stdinData = builder.String()
 		}
 
+		params, err := loadParams(paramsFile, paramValues)
+		if err != nil {
+			log.Fatalf("Error reading workflow parameters: %v", err)
+		}
+
+		// Cancel running workflows on Ctrl+C or SIGTERM
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// Load the state of the run being resumed
+		var resumed *processor.Checkpointer
+		if resumeRunID != "" {
+			resumed, err = processor.LoadCheckpointer(stateDir, resumeRunID)
+			if err != nil {
+				log.Fatalf("Error loading run %s: %v", resumeRunID, err)
+			}
+			if len(args) == 0 {
+				args = []string{resumed.Workflow()}
+			}
+			fmt.Printf("Resuming run %s\n", resumed.RunID())
+		}
+
 		for _, file := range args {
+			if ctx.Err() != nil {
+				break
+			}
 			fmt.Printf("\nProcessing workflow file: %s\n", file)
 
 			// Read YAML file
@@ -74,75 +149,13 @@ var processCmd = &cobra.Command{
 				continue
 			}
 
-			// Parse YAML while preserving order
-			var node yaml.Node
-			err = yaml.Unmarshal(yamlFile, &node)
+			// Parse YAML while preserving step order
+			dslConfig, err := processor.ParseDSL(yamlFile)
 			if err != nil {
 				log.Printf("Error parsing YAML file %s: %v\n", file, err)
 				continue
 			}
 
-			// Convert YAML nodes to Steps slice preserving order
-			var dslConfig processor.DSLConfig
-			dslConfig.ParallelSteps = make(map[string][]processor.Step)
-
-			// The document node should have one child which is the mapping
-			if len(node.Content) > 0 && node.Content[0].Kind == yaml.MappingNode {
-				mapping := node.Content[0]
-				// Each pair of nodes in the mapping represents a key and its value
-				for i := 0; i < len(mapping.Content); i += 2 {
-					name := mapping.Content[i].Value
-
-					// Check if this is a parallel-process block
-					if name == "parallel-process" {
-						if verbose {
-							fmt.Printf("[DEBUG] Found parallel-process block\n")
-						}
-
-						// This is a parallel process block, parse its steps
-						if mapping.Content[i+1].Kind == yaml.MappingNode {
-							parallelMapping := mapping.Content[i+1]
-							var parallelSteps []processor.Step
-
-							// Parse each step in the parallel-process block
-							for j := 0; j < len(parallelMapping.Content); j += 2 {
-								parallelStepName := parallelMapping.Content[j].Value
-								var config processor.StepConfig
-								err = parallelMapping.Content[j+1].Decode(&config)
-								if err != nil {
-									log.Printf("Error decoding parallel step %s in %s: %v\n", parallelStepName, file, err)
-									continue
-								}
-
-								parallelSteps = append(parallelSteps, processor.Step{
-									Name:   parallelStepName,
-									Config: config,
-								})
-
-								if verbose {
-									fmt.Printf("[DEBUG] Added parallel step: %s\n", parallelStepName)
-								}
-							}
-
-							// Add the parallel steps to the map with a key of "parallel-process"
-							dslConfig.ParallelSteps["parallel-process"] = parallelSteps
-						}
-					} else {
-						// This is a regular step
-						var config processor.StepConfig
-						err = mapping.Content[i+1].Decode(&config)
-						if err != nil {
-							log.Printf("Error decoding step %s in %s: %v\n", name, file, err)
-							continue
-						}
-						dslConfig.Steps = append(dslConfig.Steps, processor.Step{
-							Name:   name,
-							Config: config,
-						})
-					}
-				}
-			}
-
 			// Create processor
 			if verbose {
 				fmt.Printf("[DEBUG] Creating processor for %s\n", file)
@@ -151,7 +164,30 @@ var processCmd = &cobra.Command{
 			serverConfig := &config.ServerConfig{
 				Enabled: false, // Disable server mode for CLI processing
 			}
-			proc := processor.NewProcessor(&dslConfig, envConfig, serverConfig, verbose, runtimeDir)
+			proc := processor.NewProcessor(dslConfig, envConfig, serverConfig, verbose, runtimeDir)
+			if err := proc.SetParams(params); err != nil {
+				log.Printf("Error in workflow file %s: %v\n", file, err)
+				continue
+			}
+
+			// Save each completed step so that a failed run can be resumed
+			checkpointer := resumed
+			if checkpointer == nil && !noCheckpoint {
+				checkpointer, err = processor.NewCheckpointer(stateDir, file)
+				if err != nil {
+					log.Printf("Warning: checkpointing disabled for %s: %v\n", file, err)
+				} else if err := processor.PruneRuns(stateDir, keepRuns); err != nil {
+					log.Printf("Warning: failed to remove old run state: %v\n", err)
+				}
+			}
+			proc.SetCacheOptions(processor.CacheOptions{Enabled: useCache, TTL: cacheTTL, Disabled: noCache})
+			if maxCost > 0 {
+				proc.SetMaxCost(maxCost)
+			}
+			if checkpointer != nil {
+				proc.SetCheckpointer(checkpointer)
+				fmt.Printf("Run ID: %s\n", checkpointer.RunID())
+			}
 
 			// If we have STDIN data, set it as initial output
 			if stdinData != "" {
@@ -161,68 +197,173 @@ var processCmd = &cobra.Command{
 			// Print configuration summary before processing
 			fmt.Println("\nConfiguration:")
 
-			// Print parallel steps if any
-			for groupName, parallelSteps := range dslConfig.ParallelSteps {
-				fmt.Printf("\nParallel Process Group: %s\n", groupName)
-				for _, step := range parallelSteps {
-					fmt.Printf("\n  Parallel Step: %s\n", step.Name)
-					inputs := proc.NormalizeStringSlice(step.Config.Input)
-					if len(inputs) > 0 && inputs[0] != "NA" {
-						fmt.Printf("  - Input: %v\n", inputs)
-					}
-					fmt.Printf("  - Model: %v\n", proc.NormalizeStringSlice(step.Config.Model))
-
-					// Display instructions for openai-responses type steps, otherwise display action
-					if step.Config.Type == "openai-responses" && step.Config.Instructions != "" {
-						fmt.Printf("  - Instructions: %v\n", step.Config.Instructions)
-					} else {
-						fmt.Printf("  - Action: %v\n", proc.NormalizeStringSlice(step.Config.Action))
-					}
-
-					fmt.Printf("  - Output: %v\n", proc.NormalizeStringSlice(step.Config.Output))
-					nextActions := proc.NormalizeStringSlice(step.Config.NextAction)
-					if len(nextActions) > 0 {
-						fmt.Printf("  - Next Action: %v\n", nextActions)
+			if len(dslConfig.Params) > 0 {
+				fmt.Println("\nParameters:")
+				for _, name := range sortedKeys(dslConfig.Params) {
+					fmt.Printf("  - %s = %q", name, proc.Variable(name))
+					if description := dslConfig.Params[name].Description; description != "" {
+						fmt.Printf(" (%s)", description)
 					}
+					fmt.Println()
 				}
 			}
 
-			// Print sequential steps
-			for _, step := range dslConfig.Steps {
-				fmt.Printf("\nStep: %s\n", step.Name)
-				inputs := proc.NormalizeStringSlice(step.Config.Input)
-				if len(inputs) > 0 && inputs[0] != "NA" {
-					fmt.Printf("- Input: %v\n", inputs)
-				}
-				fmt.Printf("- Model: %v\n", proc.NormalizeStringSlice(step.Config.Model))
-
-				// Display instructions for openai-responses type steps, otherwise display action
-				if step.Config.Type == "openai-responses" && step.Config.Instructions != "" {
-					fmt.Printf("- Instructions: %v\n", step.Config.Instructions)
-				} else {
-					fmt.Printf("- Action: %v\n", proc.NormalizeStringSlice(step.Config.Action))
+			// Print steps and parallel groups in file order
+			for _, name := range dslConfig.Order {
+				if parallelSteps, ok := dslConfig.ParallelSteps[name]; ok {
+					fmt.Printf("\nParallel Process Group: %s\n", name)
+					for _, step := range parallelSteps {
+						fmt.Printf("\n  Parallel Step: %s\n", step.Name)
+						printStepSummary(proc, step, "  ")
+					}
+					continue
 				}
-
-				fmt.Printf("- Output: %v\n", proc.NormalizeStringSlice(step.Config.Output))
-				nextActions := proc.NormalizeStringSlice(step.Config.NextAction)
-				if len(nextActions) > 0 {
-					fmt.Printf("- Next Action: %v\n", nextActions)
+				for _, step := range dslConfig.Steps {
+					if step.Name == name {
+						fmt.Printf("\nStep: %s\n", step.Name)
+						printStepSummary(proc, step, "")
+					}
 				}
 			}
 			fmt.Println()
 
 			// Run processor
-			if err := proc.Process(); err != nil {
+			err = proc.ProcessWithContext(ctx)
+			printUsageSummary(proc, dslConfig)
+			if err != nil {
 				log.Printf("Error processing workflow file %s: %v\n", file, err)
+				if checkpointer != nil {
+					fmt.Printf("To resume this run: comanda process --resume %s %s\n", checkpointer.RunID(), file)
+				}
 				continue
 			}
 		}
 	},
 }
 
+// loadParams reads workflow parameters from a YAML or JSON params file and from
+// key=value assignments, which take precedence over the file
+func loadParams(file string, assignments []string) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read params file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &params); err != nil {
+			return nil, fmt.Errorf("failed to parse params file %s: %w", file, err)
+		}
+	}
+	for _, assignment := range assignments {
+		key, value, ok := strings.Cut(assignment, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid --set value '%s': expected key=value", assignment)
+		}
+		params[strings.TrimSpace(key)] = value
+	}
+	return params, nil
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// printStepSummary prints the configuration of a single step
+func printStepSummary(proc *processor.Processor, step processor.Step, indent string) {
+	inputs := proc.NormalizeStringSlice(step.Config.Input)
+	if len(inputs) > 0 && inputs[0] != "NA" {
+		fmt.Printf("%s- Input: %v\n", indent, inputs)
+	}
+	fmt.Printf("%s- Model: %v\n", indent, proc.NormalizeStringSlice(step.Config.Model))
+	if step.Config.ModelStrategy != "" {
+		fmt.Printf("%s- Model Strategy: %s\n", indent, step.Config.ModelStrategy)
+	}
+
+	// Display instructions for openai-responses type steps, otherwise display action
+	if step.Config.Type == "openai-responses" && step.Config.Instructions != "" {
+		fmt.Printf("%s- Instructions: %v\n", indent, step.Config.Instructions)
+	} else {
+		fmt.Printf("%s- Action: %v\n", indent, proc.NormalizeStringSlice(step.Config.Action))
+	}
+
+	if dependsOn := proc.NormalizeStringSlice(step.Config.DependsOn); len(dependsOn) > 0 {
+		fmt.Printf("%s- Depends On: %v\n", indent, dependsOn)
+	}
+	if step.Config.When != "" {
+		fmt.Printf("%s- When: %s\n", indent, step.Config.When)
+	}
+	fmt.Printf("%s- Output: %v\n", indent, proc.NormalizeStringSlice(step.Config.Output))
+	nextActions := proc.NormalizeStringSlice(step.Config.NextAction)
+	if len(nextActions) > 0 {
+		fmt.Printf("%s- Next Action: %v\n", indent, nextActions)
+	}
+}
+
+// printUsageSummary prints the token usage and cost of each step and of the whole run
+func printUsageSummary(proc *processor.Processor, dslConfig *processor.DSLConfig) {
+	total := proc.Usage()
+	if total.Calls == 0 {
+		return
+	}
+
+	fmt.Println("\nUsage:")
+	var stepNames []string
+	for _, name := range dslConfig.Order {
+		if parallelSteps, ok := dslConfig.ParallelSteps[name]; ok {
+			for _, step := range parallelSteps {
+				stepNames = append(stepNames, step.Name)
+			}
+			continue
+		}
+		stepNames = append(stepNames, name)
+	}
+	for _, name := range stepNames {
+		if usage := proc.StepUsage(name); usage != nil {
+			fmt.Printf("  %s: %s\n", name, formatUsage(*usage))
+		}
+	}
+	fmt.Printf("  Total: %s\n", formatUsage(total))
+	if len(total.Unpriced) > 0 {
+		fmt.Printf("  No price configured for: %s\n", strings.Join(total.Unpriced, ", "))
+	}
+}
+
+// formatUsage returns a one-line description of token usage and cost
+func formatUsage(usage processor.UsageReport) string {
+	text := fmt.Sprintf("%d input tokens", usage.InputTokens)
+	if usage.CachedTokens > 0 {
+		text += fmt.Sprintf(" (%d cached)", usage.CachedTokens)
+	}
+	return text + fmt.Sprintf(", %d output tokens, $%.4f", usage.OutputTokens, usage.Cost)
+}
+
 func init() {
 	rootCmd.AddCommand(processCmd)
 
 	// Add runtime directory flag
 	processCmd.Flags().StringVar(&runtimeDir, "runtime-dir", "", "Runtime directory for file operations (relative to data directory)")
+
+	// Add checkpointing flags
+	processCmd.Flags().StringVar(&resumeRunID, "resume", "", "Resume a failed run, skipping steps whose configuration and inputs are unchanged")
+	processCmd.Flags().StringVar(&stateDir, "state-dir", processor.DefaultRunStateDir, "Directory where run state is saved for resuming")
+	processCmd.Flags().BoolVar(&noCheckpoint, "no-checkpoint", false, "Do not save run state")
+	processCmd.Flags().IntVar(&keepRuns, "keep-runs", processor.DefaultKeepRuns, "Number of most recent runs whose state is kept")
+
+	// Add response cache flags
+	processCmd.Flags().BoolVar(&useCache, "cache", false, "Reuse cached model responses for every step that does not set cache")
+	processCmd.Flags().DurationVar(&cacheTTL, "cache-ttl", 0, "Maximum age of cached responses reused by --cache (0 for no limit)")
+	processCmd.Flags().BoolVar(&noCache, "no-cache", false, "Never use cached responses, even for steps that set cache")
+
+	// Add workflow parameter flags
+	processCmd.Flags().StringArrayVar(&paramValues, "set", nil, "Set a workflow parameter (key=value, repeatable)")
+	processCmd.Flags().StringVar(&paramsFile, "params-file", "", "YAML or JSON file of workflow parameters")
+
+	// Add budget flag
+	processCmd.Flags().Float64Var(&maxCost, "max-cost", 0, "Abort the run before it spends more than this many US dollars (overrides max_cost)")
 }
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadParams(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "params.yaml")
+	if err := os.WriteFile(file, []byte("region: emea\nmax_items: 10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := loadParams(file, []string{"region=apac", "query=a=b"})
+	if err != nil {
+		t.Fatalf("loadParams() error: %v", err)
+	}
+	expected := map[string]interface{}{"region": "apac", "max_items": 10, "query": "a=b"}
+	for key, value := range expected {
+		if params[key] != value {
+			t.Errorf("params[%q] = %v, want %v", key, params[key], value)
+		}
+	}
+
+	if _, err := loadParams("", []string{"region"}); err == nil {
+		t.Error("expected error for --set without '='")
+	}
+	if _, err := loadParams(filepath.Join(t.TempDir(), "missing.yaml"), nil); err == nil {
+		t.Error("expected error for a missing params file")
+	}
+}
@@ -55,6 +55,12 @@ You can optionally specify a model to use for generation, otherwise the default_
 		if err != nil {
 			return fmt.Errorf("error loading configuration: %w", err)
 		}
+		if err := models.RegisterOpenAICompatibleProviders(envConfig); err != nil {
+			return fmt.Errorf("error loading configuration: %w", err)
+		}
+		if err := models.RegisterModelAliases(envConfig); err != nil {
+			return fmt.Errorf("error loading configuration: %w", err)
+		}
 
 		modelForGeneration := generateModelName // From flag
 		if modelForGeneration == "" {
@@ -63,6 +69,7 @@ You can optionally specify a model to use for generation, otherwise the default_
 		if modelForGeneration == "" {
 			return fmt.Errorf("no model specified for generation and no default_generation_model configured. Use --model or configure a default")
 		}
+		modelForGeneration = envConfig.ResolveModel(modelForGeneration)
 
 		fmt.Printf("Generating workflow using model: %s\n", modelForGeneration)
 		fmt.Printf("Output file: %s\n", outputFilename)
@@ -105,7 +112,7 @@ CRITICAL INSTRUCTION: Your entire response must be valid YAML syntax that can be
 
 		// Call the LLM
 		// The SendPrompt method is part of the models.Provider interface.
-		generatedResponse, err := provider.SendPrompt(modelForGeneration, fullPrompt)
+		generatedResponse, err := provider.SendPrompt(cmd.Context(), modelForGeneration, fullPrompt)
 		if err != nil {
 			return fmt.Errorf("LLM execution failed for model '%s': %w", modelForGeneration, err)
 		}
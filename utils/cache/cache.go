@@ -0,0 +1,237 @@
+// Package cache stores model responses on disk so identical requests are not paid for twice.
+// Entries are content addressed: each is saved under the SHA-256 of the request that produced it.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Key identifies a model request. Requests with equal keys are expected to produce
+// interchangeable responses.
+type Key struct {
+	Provider string            `json:"provider"`
+	Model    string            `json:"model"`
+	Prompt   string            `json:"prompt"`
+	Files    []string          `json:"files,omitempty"`   // SHA-256 of each attached file's contents
+	Options  map[string]string `json:"options,omitempty"` // Sampling parameters such as temperature
+}
+
+// Hash returns the hex encoded SHA-256 of the key
+func (k Key) Hash() string {
+	// encoding/json sorts map keys, so equal keys always encode identically
+	data, _ := json.Marshal(k)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Entry is a cached response
+type Entry struct {
+	Provider  string    `json:"provider"`
+	Model     string    `json:"model"`
+	Response  string    `json:"response"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Stats summarizes the contents of a cache
+type Stats struct {
+	Dir     string
+	Entries int
+	Bytes   int64
+	Oldest  time.Time
+	Newest  time.Time
+	ByModel map[string]int // Number of entries per "provider/model"
+}
+
+// Store is an on-disk response cache
+type Store struct {
+	dir string
+}
+
+// DefaultDir returns the cache directory: $COMANDA_CACHE_DIR if set, otherwise a
+// comanda directory in the user's cache directory
+func DefaultDir() string {
+	if dir := os.Getenv("COMANDA_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "comanda", "responses")
+	}
+	return filepath.Join(".comanda", "cache")
+}
+
+// Open returns a store that keeps its entries in dir. The directory is created on first write.
+func Open(dir string) *Store {
+	if dir == "" {
+		dir = DefaultDir()
+	}
+	return &Store{dir: dir}
+}
+
+// Dir returns the directory holding the store's entries
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// path returns the file an entry with the given hash is stored in
+func (s *Store) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash+".json")
+}
+
+// Get returns the cached response for key. Entries older than ttl are ignored;
+// a ttl of zero accepts entries of any age.
+func (s *Store) Get(key Key, ttl time.Duration) (string, bool) {
+	data, err := os.ReadFile(s.path(key.Hash()))
+	if err != nil {
+		return "", false
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return "", false
+	}
+	if ttl > 0 && time.Since(entry.CreatedAt) > ttl {
+		return "", false
+	}
+	return entry.Response, true
+}
+
+// Put saves a response for key, replacing any existing entry
+func (s *Store) Put(key Key, response string) error {
+	path := s.path(key.Hash())
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	data, err := json.Marshal(Entry{
+		Provider:  key.Provider,
+		Model:     key.Model,
+		Response:  response,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+
+	// Write to a temporary file first so concurrent readers never see a partial entry
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".entry-*")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
+
+// Stats reports the number, size and age of the cached entries
+func (s *Store) Stats() (Stats, error) {
+	stats := Stats{Dir: s.dir, ByModel: make(map[string]int)}
+	err := s.walkEntries(func(path string, info fs.FileInfo) error {
+		stats.Entries++
+		stats.Bytes += info.Size()
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil
+		}
+		stats.ByModel[entry.Provider+"/"+entry.Model]++
+		if stats.Oldest.IsZero() || entry.CreatedAt.Before(stats.Oldest) {
+			stats.Oldest = entry.CreatedAt
+		}
+		if entry.CreatedAt.After(stats.Newest) {
+			stats.Newest = entry.CreatedAt
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// Clear removes every cached entry and returns how many were removed
+func (s *Store) Clear() (int, error) {
+	var paths []string
+	err := s.walkEntries(func(path string, info fs.FileInfo) error {
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("failed to remove cache entry: %w", err)
+		}
+		removed++
+	}
+
+	// Remove the now empty shard directories
+	if shards, err := os.ReadDir(s.dir); err == nil {
+		for _, shard := range shards {
+			if shard.IsDir() {
+				os.Remove(filepath.Join(s.dir, shard.Name()))
+			}
+		}
+	}
+	return removed, nil
+}
+
+// walkEntries calls fn for every entry file in the store. A missing store has no entries.
+func (s *Store) walkEntries(fn func(path string, info fs.FileInfo) error) error {
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == s.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(path, info)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory '%s': %w", s.dir, err)
+	}
+	return nil
+}
+
+// SortedModels returns the "provider/model" names in stats, most used first
+func (s Stats) SortedModels() []string {
+	names := make([]string, 0, len(s.ByModel))
+	for name := range s.ByModel {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if s.ByModel[names[i]] != s.ByModel[names[j]] {
+			return s.ByModel[names[i]] > s.ByModel[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
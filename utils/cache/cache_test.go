@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreGetPut(t *testing.T) {
+	store := Open(t.TempDir())
+	key := Key{Provider: "openai", Model: "gpt-4o", Prompt: "hello"}
+
+	if _, ok := store.Get(key, 0); ok {
+		t.Fatal("expected a miss on an empty cache")
+	}
+	if err := store.Put(key, "hi there"); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	if response, ok := store.Get(key, 0); !ok || response != "hi there" {
+		t.Errorf("Get() = %q, %v, want %q, true", response, ok, "hi there")
+	}
+
+	other := key
+	other.Files = []string{"abc123"}
+	if _, ok := store.Get(other, 0); ok {
+		t.Error("expected a miss for a key with different files")
+	}
+	withOptions := key
+	withOptions.Options = map[string]string{"temperature": "0.2"}
+	if _, ok := store.Get(withOptions, 0); ok {
+		t.Error("expected a miss for a key with different options")
+	}
+}
+
+func TestStoreTTL(t *testing.T) {
+	store := Open(t.TempDir())
+	key := Key{Provider: "openai", Model: "gpt-4o", Prompt: "hello"}
+	if err := store.Put(key, "hi"); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := store.Get(key, 10*time.Millisecond); ok {
+		t.Error("expected an expired entry to be ignored")
+	}
+	if _, ok := store.Get(key, time.Hour); !ok {
+		t.Error("expected a fresh entry to be returned")
+	}
+}
+
+func TestStoreStatsAndClear(t *testing.T) {
+	store := Open(t.TempDir())
+	for _, prompt := range []string{"a", "b"} {
+		if err := store.Put(Key{Provider: "openai", Model: "gpt-4o", Prompt: prompt}, "response"); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+	}
+	if err := store.Put(Key{Provider: "anthropic", Model: "claude-3-5-haiku-latest", Prompt: "a"}, "response"); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+
+	stats, err := store.Stats()
+	if err != nil {
+		t.Fatalf("Stats() error: %v", err)
+	}
+	if stats.Entries != 3 || stats.Bytes == 0 {
+		t.Errorf("Stats() = %d entries, %d bytes", stats.Entries, stats.Bytes)
+	}
+	if models := stats.SortedModels(); len(models) != 2 || models[0] != "openai/gpt-4o" {
+		t.Errorf("SortedModels() = %v", models)
+	}
+
+	removed, err := store.Clear()
+	if err != nil || removed != 3 {
+		t.Fatalf("Clear() = %d, %v, want 3, nil", removed, err)
+	}
+	if stats, _ := store.Stats(); stats.Entries != 0 {
+		t.Errorf("expected an empty cache after Clear(), got %d entries", stats.Entries)
+	}
+}
+
+func TestStoreMissingDirectory(t *testing.T) {
+	store := Open(t.TempDir() + "/missing")
+	stats, err := store.Stats()
+	if err != nil || stats.Entries != 0 {
+		t.Errorf("Stats() = %+v, %v", stats, err)
+	}
+	if removed, err := store.Clear(); err != nil || removed != 0 {
+		t.Errorf("Clear() = %d, %v", removed, err)
+	}
+}
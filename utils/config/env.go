@@ -10,6 +10,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
 
@@ -46,15 +47,100 @@ type DatabaseConfig struct {
 
 // Model represents a single model configuration
 type Model struct {
-	Name  string      `yaml:"name"`
-	Type  string      `yaml:"type"`
-	Modes []ModelMode `yaml:"modes"`
+	Name     string       `yaml:"name"`
+	Type     string       `yaml:"type"`
+	Modes    []ModelMode  `yaml:"modes"`
+	Defaults *ModelParams `yaml:"defaults,omitempty"` // Parameters for steps that do not set their own
+	Alias    string       `yaml:"alias,omitempty"`    // Name workflows use for the model instead of Name
+}
+
+// ModelParams are request parameters for a model. Unset fields leave the choice to the
+// provider or the model.
+type ModelParams struct {
+	Temperature *float64 `yaml:"temperature,omitempty"`
+	MaxTokens   *int     `yaml:"max_tokens,omitempty"`
+	TopP        *float64 `yaml:"top_p,omitempty"`
+	Stop        []string `yaml:"stop,omitempty"`
+	Seed        *int     `yaml:"seed,omitempty"`
+	System      string   `yaml:"system,omitempty"`
 }
 
 // Provider represents a provider's configuration
 type Provider struct {
-	APIKey string  `yaml:"api_key"`
-	Models []Model `yaml:"models"`
+	Type        string            `yaml:"type,omitempty"` // Implementation of a provider not named after a built-in one: openai-compatible
+	APIKey      string            `yaml:"api_key"`
+	Models      []Model           `yaml:"models"`
+	ModelPrefix string            `yaml:"model_prefix,omitempty"` // Models named with this prefix are routed to the provider without it
+	BaseURL     string            `yaml:"base_url,omitempty"`     // API endpoint, for Ollama and openai-compatible providers
+	Headers     map[string]string `yaml:"headers,omitempty"`      // Headers sent with every request, e.g. for authentication
+	Hosts       []Host            `yaml:"hosts,omitempty"`        // Named Ollama servers to spread requests across, instead of BaseURL
+	Routing     string            `yaml:"routing,omitempty"`      // How requests are spread across hosts: round_robin (default) or least_loaded
+}
+
+// OpenAICompatible is the provider type of endpoints that implement the OpenAI chat completions API
+const OpenAICompatible = "openai-compatible"
+
+// DefaultOllamaURL is the address of an Ollama server on this machine
+const DefaultOllamaURL = "http://localhost:11434"
+
+// Routing strategies for providers with several hosts
+const (
+	RoundRobin  = "round_robin"
+	LeastLoaded = "least_loaded"
+)
+
+// Host is a named endpoint of a provider
+type Host struct {
+	Name    string            `yaml:"name"`
+	BaseURL string            `yaml:"base_url"`
+	Headers map[string]string `yaml:"headers,omitempty"` // Sent in addition to the provider's headers
+}
+
+// Endpoints returns the hosts the provider's requests can be sent to, with the provider's
+// headers merged into each. A provider without hosts has a single one named "default" at
+// its base URL, or at defaultURL if it has none.
+func (p *Provider) Endpoints(defaultURL string) []Host {
+	if len(p.Hosts) == 0 {
+		baseURL := p.BaseURL
+		if baseURL == "" {
+			baseURL = defaultURL
+		}
+		return []Host{{Name: "default", BaseURL: strings.TrimRight(baseURL, "/"), Headers: p.Headers}}
+	}
+
+	hosts := make([]Host, len(p.Hosts))
+	for i, host := range p.Hosts {
+		headers := make(map[string]string, len(p.Headers)+len(host.Headers))
+		for k, v := range p.Headers {
+			headers[k] = v
+		}
+		for k, v := range host.Headers {
+			headers[k] = v
+		}
+		hosts[i] = Host{Name: host.Name, BaseURL: strings.TrimRight(host.BaseURL, "/"), Headers: headers}
+	}
+	return hosts
+}
+
+// ValidateHosts checks the hosts and routing strategy of the provider
+func (p *Provider) ValidateHosts() error {
+	if p.Routing != "" && p.Routing != RoundRobin && p.Routing != LeastLoaded {
+		return fmt.Errorf("unknown routing '%s' (expected %s or %s)", p.Routing, RoundRobin, LeastLoaded)
+	}
+	names := make(map[string]bool)
+	for i, host := range p.Hosts {
+		if host.Name == "" {
+			return fmt.Errorf("host %d has no name", i+1)
+		}
+		if names[host.Name] {
+			return fmt.Errorf("duplicate host name '%s'", host.Name)
+		}
+		names[host.Name] = true
+		if host.BaseURL == "" {
+			return fmt.Errorf("host '%s' has no base_url", host.Name)
+		}
+	}
+	return nil
 }
 
 // EnvConfig represents the complete environment configuration
@@ -63,6 +149,25 @@ type EnvConfig struct {
 	Server                 *ServerConfig             `yaml:"server,omitempty"`
 	Databases              map[string]DatabaseConfig `yaml:"databases,omitempty"` // Added database configurations
 	DefaultGenerationModel string                    `yaml:"default_generation_model,omitempty"`
+	Pricing                map[string]ModelPrice     `yaml:"pricing,omitempty"` // Model prices keyed by model name or "prefix*"
+	Aliases                map[string]string         `yaml:"aliases,omitempty"` // Names workflows use for models, e.g. fast or smart
+	Environments           map[string]*Environment   `yaml:"environments,omitempty"`
+}
+
+// Environment holds settings that override those of the env file when it is selected with
+// COMANDA_ENVIRONMENT, e.g. so that CI maps an alias to a local model
+type Environment struct {
+	Aliases map[string]string `yaml:"aliases,omitempty"` // Replace or add to the env file's aliases
+}
+
+// EnvironmentVar is the environment variable that selects an environment of the env file
+const EnvironmentVar = "COMANDA_ENVIRONMENT"
+
+// ModelPrice is the price of a model in US dollars per million tokens
+type ModelPrice struct {
+	Input       float64 `yaml:"input"`
+	Output      float64 `yaml:"output"`
+	CachedInput float64 `yaml:"cached_input,omitempty"` // Price of prompt cache hits (defaults to input)
 }
 
 // Verbose indicates whether verbose logging is enabled
@@ -382,6 +487,7 @@ func (c *EnvConfig) UpdateServerConfig(serverConfig ServerConfig) {
 	c.Server.Enabled = serverConfig.Enabled
 	c.Server.DataDir = serverConfig.DataDir
 	c.Server.CORS = serverConfig.CORS
+	c.Server.AllowLocalTools = serverConfig.AllowLocalTools
 }
 
 // GetProviderConfig retrieves configuration for a specific provider
@@ -396,6 +502,45 @@ func (c *EnvConfig) GetProviderConfig(providerName string) (*Provider, error) {
 	return provider, nil
 }
 
+// FindModel returns the model a workflow's model name refers to: the model with that name or
+// alias or, for a name that starts with the provider's model prefix, the model named by the
+// rest of it. Names and prefixes are compared ignoring case, as the provider registry does.
+// Prefixed names that are not listed are text models, with the case they were given in.
+func (p *Provider) FindModel(modelName string) (*Model, bool) {
+	for i := range p.Models {
+		if strings.EqualFold(p.Models[i].Name, modelName) || (p.Models[i].Alias != "" && strings.EqualFold(p.Models[i].Alias, modelName)) {
+			model := p.Models[i]
+			return &model, true
+		}
+	}
+	prefix := p.ModelPrefix
+	if prefix == "" || len(modelName) <= len(prefix) || !strings.EqualFold(modelName[:len(prefix)], prefix) {
+		return nil, false
+	}
+	name := modelName[len(prefix):]
+	for i := range p.Models {
+		if strings.EqualFold(p.Models[i].Name, name) {
+			model := p.Models[i]
+			return &model, true
+		}
+	}
+	return &Model{Name: name, Type: "external", Modes: []ModelMode{TextMode}}, true
+}
+
+// OllamaHosts returns the Ollama servers of the configuration and how requests are routed
+// across them. Without an ollama provider, the only host is the local server.
+func (c *EnvConfig) OllamaHosts() ([]Host, string, error) {
+	if c != nil {
+		if provider, ok := c.Providers["ollama"]; ok && provider != nil {
+			if err := provider.ValidateHosts(); err != nil {
+				return nil, "", fmt.Errorf("invalid ollama configuration: %w", err)
+			}
+			return provider.Endpoints(DefaultOllamaURL), provider.Routing, nil
+		}
+	}
+	return []Host{{Name: "default", BaseURL: DefaultOllamaURL}}, "", nil
+}
+
 // AddProvider adds or updates a provider configuration
 func (c *EnvConfig) AddProvider(name string, provider Provider) {
 	if c.Providers == nil {
@@ -454,15 +599,110 @@ func (c *EnvConfig) GetModelConfig(providerName, modelName string) (*Model, erro
 		return nil, err
 	}
 
-	for _, model := range provider.Models {
-		if model.Name == modelName {
-			return &model, nil
-		}
+	if model, ok := provider.FindModel(modelName); ok {
+		return model, nil
 	}
 
 	return nil, fmt.Errorf("model %s not found for provider %s", modelName, providerName)
 }
 
+// GetModelPrice returns the price of a model. An entry for the exact model name wins over
+// entries ending in "*", which match model names by prefix; the longest prefix is used.
+func (c *EnvConfig) GetModelPrice(modelName string) (ModelPrice, bool) {
+	if price, ok := c.Pricing[modelName]; ok {
+		return price, true
+	}
+	var best ModelPrice
+	bestLen := -1
+	for pattern, price := range c.Pricing {
+		prefix, isPrefix := strings.CutSuffix(pattern, "*")
+		if isPrefix && strings.HasPrefix(modelName, prefix) && len(prefix) > bestLen {
+			best, bestLen = price, len(prefix)
+		}
+	}
+	return best, bestLen >= 0
+}
+
+// ActiveEnvironment returns the name of the environment selected with COMANDA_ENVIRONMENT,
+// or "" if none is
+func ActiveEnvironment() string {
+	return strings.TrimSpace(os.Getenv(EnvironmentVar))
+}
+
+// ModelAliases returns the env file's aliases with those of the selected environment applied
+func (c *EnvConfig) ModelAliases() map[string]string {
+	if c == nil {
+		return nil
+	}
+	aliases := make(map[string]string, len(c.Aliases))
+	for alias, model := range c.Aliases {
+		aliases[alias] = model
+	}
+	if name := ActiveEnvironment(); name != "" && c.Environments[name] != nil {
+		for alias, model := range c.Environments[name].Aliases {
+			aliases[alias] = model
+		}
+	}
+	return aliases
+}
+
+// ResolveModel returns the model an alias stands for in the selected environment. Names
+// that are not aliases are returned unchanged.
+func (c *EnvConfig) ResolveModel(name string) string {
+	return ResolveAlias(c.ModelAliases(), name)
+}
+
+// ResolveAlias returns the model an alias stands for, following aliases of other aliases
+func ResolveAlias(aliases map[string]string, name string) string {
+	seen := make(map[string]bool)
+	for !seen[name] {
+		model, ok := aliases[name]
+		if !ok {
+			return name
+		}
+		seen[name] = true
+		name = model
+	}
+	return name
+}
+
+// ValidateAliases checks that the selected environment is defined and that every alias
+// stands for a model without referring back to itself
+func (c *EnvConfig) ValidateAliases() error {
+	if c == nil {
+		return nil
+	}
+	if name := ActiveEnvironment(); name != "" && c.Environments[name] == nil {
+		return fmt.Errorf("environment '%s' selected by %s is not defined in the env file", name, EnvironmentVar)
+	}
+
+	aliases := c.ModelAliases()
+	names := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	for _, alias := range names {
+		if strings.TrimSpace(aliases[alias]) == "" {
+			return fmt.Errorf("alias '%s' has no model", alias)
+		}
+		seen := map[string]bool{alias: true}
+		model := aliases[alias]
+		for {
+			next, isAlias := aliases[model]
+			if !isAlias {
+				break
+			}
+			if seen[model] {
+				return fmt.Errorf("alias '%s' refers back to itself through '%s'", alias, model)
+			}
+			seen[model] = true
+			model = next
+		}
+	}
+	return nil
+}
+
 // UpdateAPIKey updates the API key for a specific provider
 func (c *EnvConfig) UpdateAPIKey(providerName, apiKey string) error {
 	provider, exists := c.Providers[providerName]
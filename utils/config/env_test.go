@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -242,3 +243,207 @@ func TestLoadEnvConfigWithPassword(t *testing.T) {
 		t.Error("Loading invalid YAML should fail")
 	}
 }
+
+func TestGetModelPrice(t *testing.T) {
+	cfg := &EnvConfig{Pricing: map[string]ModelPrice{
+		"gpt-4o":      {Input: 2.5, Output: 10},
+		"gpt-4o*":     {Input: 5, Output: 15},
+		"gpt-4o-mini": {Input: 0.15, Output: 0.6},
+		"claude-*":    {Input: 3, Output: 15},
+		"claude-3-5*": {Input: 0.8, Output: 4},
+	}}
+	tests := []struct {
+		model string
+		want  float64
+		found bool
+	}{
+		{"gpt-4o", 2.5, true},
+		{"gpt-4o-mini", 0.15, true},
+		{"gpt-4o-2024-08-06", 5, true},
+		{"claude-3-5-haiku-latest", 0.8, true},
+		{"claude-sonnet-4", 3, true},
+		{"llama3", 0, false},
+	}
+	for _, tt := range tests {
+		price, found := cfg.GetModelPrice(tt.model)
+		if found != tt.found || price.Input != tt.want {
+			t.Errorf("GetModelPrice(%q) = %v, %v, want input %v, %v", tt.model, price, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestOllamaHosts(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    []Host
+		routing string
+		wantErr bool
+	}{
+		{
+			name: "no ollama provider",
+			yaml: "providers: {}\n",
+			want: []Host{{Name: "default", BaseURL: DefaultOllamaURL}},
+		},
+		{
+			name: "base url with headers",
+			yaml: "providers:\n  ollama:\n    api_key: LOCAL\n    base_url: http://gpu:11434/\n    headers: {Authorization: Bearer x}\n",
+			want: []Host{{Name: "default", BaseURL: "http://gpu:11434", Headers: map[string]string{"Authorization": "Bearer x"}}},
+		},
+		{
+			name: "hosts inherit provider headers",
+			yaml: "providers:\n  ollama:\n    headers: {Authorization: Bearer x, X-Team: ml}\n    routing: least_loaded\n    hosts:\n" +
+				"      - {name: gpu, base_url: 'http://gpu:11434', headers: {Authorization: Bearer y}}\n" +
+				"      - {name: laptop, base_url: 'http://localhost:11434'}\n",
+			want: []Host{
+				{Name: "gpu", BaseURL: "http://gpu:11434", Headers: map[string]string{"Authorization": "Bearer y", "X-Team": "ml"}},
+				{Name: "laptop", BaseURL: "http://localhost:11434", Headers: map[string]string{"Authorization": "Bearer x", "X-Team": "ml"}},
+			},
+			routing: LeastLoaded,
+		},
+		{
+			name:    "unknown routing",
+			yaml:    "providers:\n  ollama:\n    routing: random\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate host names",
+			yaml:    "providers:\n  ollama:\n    hosts:\n      - {name: gpu, base_url: 'http://a'}\n      - {name: gpu, base_url: 'http://b'}\n",
+			wantErr: true,
+		},
+		{
+			name:    "host without base url",
+			yaml:    "providers:\n  ollama:\n    hosts:\n      - {name: gpu}\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg EnvConfig
+			if err := yaml.Unmarshal([]byte(tt.yaml), &cfg); err != nil {
+				t.Fatalf("yaml.Unmarshal() error: %v", err)
+			}
+			hosts, routing, err := cfg.OllamaHosts()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("OllamaHosts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(hosts, tt.want) || routing != tt.routing {
+				t.Errorf("OllamaHosts() = %+v, %q, want %+v, %q", hosts, routing, tt.want, tt.routing)
+			}
+		})
+	}
+}
+
+func TestFindModel(t *testing.T) {
+	provider := &Provider{
+		Type:        OpenAICompatible,
+		ModelPrefix: "vllm/",
+		Models: []Model{
+			{Name: "meta-llama/Llama-3-8B", Alias: "llama3-8b", Modes: []ModelMode{TextMode}},
+			{Name: "llava", Modes: []ModelMode{TextMode, VisionMode}},
+		},
+	}
+	tests := []struct {
+		model string
+		want  string
+		modes []ModelMode
+		found bool
+	}{
+		{"meta-llama/Llama-3-8B", "meta-llama/Llama-3-8B", []ModelMode{TextMode}, true},
+		{"llama3-8b", "meta-llama/Llama-3-8B", []ModelMode{TextMode}, true},
+		{"vllm/llava", "llava", []ModelMode{TextMode, VisionMode}, true},
+		{"vllm/qwen2-7b", "qwen2-7b", []ModelMode{TextMode}, true},
+		{"Llama3-8B", "meta-llama/Llama-3-8B", []ModelMode{TextMode}, true},
+		{"VLLM/LLaVA", "llava", []ModelMode{TextMode, VisionMode}, true},
+		{"VLLM/Qwen2-7B", "Qwen2-7B", []ModelMode{TextMode}, true},
+		{"vllm/", "", nil, false},
+		{"qwen2-7b", "", nil, false},
+	}
+	for _, tt := range tests {
+		model, found := provider.FindModel(tt.model)
+		if found != tt.found {
+			t.Errorf("FindModel(%q) found = %v, want %v", tt.model, found, tt.found)
+			continue
+		}
+		if found && (model.Name != tt.want || !reflect.DeepEqual(model.Modes, tt.modes)) {
+			t.Errorf("FindModel(%q) = %+v, want %s with modes %v", tt.model, model, tt.want, tt.modes)
+		}
+	}
+}
+
+func TestResolveModel(t *testing.T) {
+	envConfig := &EnvConfig{
+		Aliases: map[string]string{
+			"fast":        "gpt-4o-mini",
+			"smart":       "claude-3-5-sonnet-latest",
+			"cheap-local": "llama3.2",
+			"default":     "smart",
+		},
+		Environments: map[string]*Environment{
+			"ci": {Aliases: map[string]string{"smart": "cheap-local", "vision": "llava"}},
+		},
+	}
+	tests := []struct {
+		environment string
+		model       string
+		want        string
+	}{
+		{"", "fast", "gpt-4o-mini"},
+		{"", "smart", "claude-3-5-sonnet-latest"},
+		{"", "default", "claude-3-5-sonnet-latest"},
+		{"", "gpt-4o", "gpt-4o"},
+		{"", "vision", "vision"},
+		{"ci", "smart", "llama3.2"},
+		{"ci", "default", "llama3.2"},
+		{"ci", "vision", "llava"},
+		{"ci", "fast", "gpt-4o-mini"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.environment+"/"+tt.model, func(t *testing.T) {
+			t.Setenv(EnvironmentVar, tt.environment)
+			if got := envConfig.ResolveModel(tt.model); got != tt.want {
+				t.Errorf("ResolveModel(%q) = %q, want %q", tt.model, got, tt.want)
+			}
+		})
+	}
+
+	var empty *EnvConfig
+	if got := empty.ResolveModel("fast"); got != "fast" {
+		t.Errorf("ResolveModel() on a nil config = %q, want fast", got)
+	}
+}
+
+func TestValidateAliases(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment string
+		aliases     map[string]string
+		wantErr     string
+	}{
+		{"valid", "", map[string]string{"fast": "gpt-4o-mini", "default": "fast"}, ""},
+		{"valid environment", "ci", map[string]string{"fast": "gpt-4o-mini"}, ""},
+		{"unknown environment", "staging", nil, "environment 'staging'"},
+		{"empty model", "", map[string]string{"fast": ""}, "alias 'fast' has no model"},
+		{"cycle", "", map[string]string{"a": "b", "b": "a"}, "refers back to itself"},
+		{"self reference", "", map[string]string{"a": "a"}, "refers back to itself"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvironmentVar, tt.environment)
+			envConfig := &EnvConfig{Aliases: tt.aliases, Environments: map[string]*Environment{"ci": {}}}
+			err := envConfig.ValidateAliases()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateAliases() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateAliases() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
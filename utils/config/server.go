@@ -8,6 +8,9 @@ type ServerConfig struct {
 	Enabled     bool   `yaml:"enabled"`
 	BearerToken string `yaml:"bearerToken"`
 	CORS        CORS   `yaml:"cors"`
+	// AllowLocalTools lets workflows run by the server use shell and database tools, which
+	// run processes and queries on the server's host
+	AllowLocalTools bool `yaml:"allowLocalTools"`
 }
 
 // CORS holds Cross-Origin Resource Sharing settings
@@ -1,10 +1,12 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"regexp"
 	"strings"
+	"unicode"
 
 	"github.com/kris-hansen/comanda/utils/config"
 	_ "github.com/lib/pq"
@@ -59,14 +61,14 @@ func (h *Handler) ValidateOperation(sql string, operation Operation) error {
 }
 
 // TestConnection attempts to establish a connection to the database and verify it works
-func (h *Handler) TestConnection(dbName string) error {
-	db, err := h.getConnection(dbName)
+func (h *Handler) TestConnection(ctx context.Context, dbName string) error {
+	db, err := h.getConnection(ctx, dbName)
 	if err != nil {
 		return fmt.Errorf("connection test failed: %w", err)
 	}
 
 	// Test the connection with a simple query
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
 		return fmt.Errorf("ping test failed: %w", err)
 	}
 
@@ -74,10 +76,10 @@ func (h *Handler) TestConnection(dbName string) error {
 }
 
 // getConnection gets or creates a database connection
-func (h *Handler) getConnection(dbName string) (*sql.DB, error) {
+func (h *Handler) getConnection(ctx context.Context, dbName string) (*sql.DB, error) {
 	// Check if connection already exists
 	if db, exists := h.dbs[dbName]; exists {
-		if err := db.Ping(); err == nil {
+		if err := db.PingContext(ctx); err == nil {
 			return db, nil
 		}
 		// Connection is stale, remove it
@@ -97,7 +99,7 @@ func (h *Handler) getConnection(dbName string) (*sql.DB, error) {
 	}
 
 	// Test connection
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
@@ -107,24 +109,227 @@ func (h *Handler) getConnection(dbName string) (*sql.DB, error) {
 	return db, nil
 }
 
-// ExecuteRead executes a read operation (SELECT) and returns the results
-func (h *Handler) ExecuteRead(dbName string, query string) ([]map[string]interface{}, error) {
+// ExecuteRead executes a read operation (SELECT) with the arguments of its placeholders and
+// returns the results
+func (h *Handler) ExecuteRead(ctx context.Context, dbName string, query string, args ...interface{}) ([]map[string]interface{}, error) {
 	if err := h.ValidateOperation(query, ReadOperation); err != nil {
 		return nil, err
 	}
 
-	db, err := h.getConnection(dbName)
+	db, err := h.getConnection(ctx, dbName)
 	if err != nil {
 		return nil, err
 	}
 
 	// Execute query
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
 	defer rows.Close()
 
+	return scanRows(rows)
+}
+
+// ExecuteWriteBatch executes a write operation once for each set of arguments, in a single
+// transaction, so that either every execution is applied or none is. It returns the total
+// number of affected rows.
+func (h *Handler) ExecuteWriteBatch(ctx context.Context, dbName string, query string, argSets [][]interface{}) (int64, error) {
+	if err := h.ValidateOperation(query, WriteOperation); err != nil {
+		return 0, err
+	}
+
+	db, err := h.getConnection(ctx, dbName)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare query: %w", err)
+	}
+	defer stmt.Close()
+
+	var affected int64
+	for i, args := range argSets {
+		result, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return 0, fmt.Errorf("failed to execute query for row %d: %w", i+1, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		affected += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return affected, nil
+}
+
+// ExecuteReadOnly executes a single SELECT statement in a read-only transaction, so that the
+// database rejects any write the statement attempts, and returns the results
+func (h *Handler) ExecuteReadOnly(ctx context.Context, dbName string, query string) ([]map[string]interface{}, error) {
+	if err := h.ValidateOperation(query, ReadOperation); err != nil {
+		return nil, err
+	}
+	if err := validateSingleStatement(query); err != nil {
+		return nil, err
+	}
+
+	db, err := h.getConnection(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin read-only transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// A prepared statement goes through the extended query protocol, which refuses several
+	// statements, so a statement such as COMMIT can't end the read-only transaction
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare query: %w", err)
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRows(rows)
+}
+
+// validateSingleStatement returns an error if query holds more than one statement. The query
+// is split both with and without backslash escapes in string literals, since which applies
+// depends on the server's settings.
+func validateSingleStatement(query string) error {
+	if statementCount(query, false) > 1 || statementCount(query, true) > 1 {
+		return fmt.Errorf("expected a single statement, got several separated by semicolons")
+	}
+	return nil
+}
+
+// dollarQuoteRegex matches the opening tag of a dollar-quoted string, such as $$ or $body$
+var dollarQuoteRegex = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// statementCount returns the number of statements in query. Semicolons in string literals,
+// quoted identifiers, dollar-quoted strings and comments don't separate statements, and empty
+// statements aren't counted. When backslashEscapes is set, a backslash in a string literal
+// escapes the next character.
+func statementCount(query string, backslashEscapes bool) int {
+	count := 0
+	inStatement := false
+	for i := 0; i < len(query); {
+		rest := query[i:]
+		switch {
+		case strings.HasPrefix(rest, "--"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				return count
+			}
+			i += end + 1
+			continue
+		case strings.HasPrefix(rest, "/*"):
+			i += blockCommentLength(rest)
+			continue
+		case rest[0] == ';':
+			inStatement = false
+			i++
+			continue
+		case unicode.IsSpace(rune(rest[0])):
+			i++
+			continue
+		}
+
+		if !inStatement {
+			count++
+			inStatement = true
+		}
+		switch tag := dollarQuoteRegex.FindString(rest); {
+		case rest[0] == '\'':
+			i += quotedLength(rest, backslashEscapes)
+		case rest[0] == '"':
+			i += quotedLength(rest, false)
+		case tag != "":
+			end := strings.Index(rest[len(tag):], tag)
+			if end < 0 {
+				return count
+			}
+			i += len(tag) + end + len(tag)
+		case isWordByte(rest[0]):
+			// Words are skipped whole, since a dollar sign within one doesn't start a quote
+			j := 1
+			for j < len(rest) && (isWordByte(rest[j]) || rest[j] == '$') {
+				j++
+			}
+			i += j
+		default:
+			i++
+		}
+	}
+	return count
+}
+
+// isWordByte reports whether b can be part of a keyword, identifier or number
+func isWordByte(b byte) bool {
+	return b == '_' || b >= 0x80 || unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b))
+}
+
+// quotedLength returns the length of the quoted string or identifier at the start of s, in
+// which a doubled quote stands for the quote itself
+func quotedLength(s string, backslashEscapes bool) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case backslashEscapes && s[i] == '\\':
+			i++
+		case s[i] == quote:
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// blockCommentLength returns the length of the block comment at the start of s. Block
+// comments nest.
+func blockCommentLength(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "/*"):
+			depth++
+			i++
+		case strings.HasPrefix(s[i:], "*/"):
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(s)
+}
+
+// scanRows reads the rows of a query result into maps keyed by column name
+func scanRows(rows *sql.Rows) ([]map[string]interface{}, error) {
 	// Get column names
 	columns, err := rows.Columns()
 	if err != nil {
@@ -168,19 +373,20 @@ func (h *Handler) ExecuteRead(dbName string, query string) ([]map[string]interfa
 	return result, nil
 }
 
-// ExecuteWrite executes a write operation (INSERT/UPDATE/DELETE) and returns affected rows
-func (h *Handler) ExecuteWrite(dbName string, query string) (int64, error) {
+// ExecuteWrite executes a write operation (INSERT/UPDATE/DELETE) with the arguments of its
+// placeholders ($1, $2, ...) and returns affected rows
+func (h *Handler) ExecuteWrite(ctx context.Context, dbName string, query string, args ...interface{}) (int64, error) {
 	if err := h.ValidateOperation(query, WriteOperation); err != nil {
 		return 0, err
 	}
 
-	db, err := h.getConnection(dbName)
+	db, err := h.getConnection(ctx, dbName)
 	if err != nil {
 		return 0, err
 	}
 
 	// Execute query
-	result, err := db.Exec(query)
+	result, err := db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return 0, fmt.Errorf("failed to execute query: %w", err)
 	}
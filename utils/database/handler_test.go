@@ -0,0 +1,35 @@
+package database
+
+import "testing"
+
+func TestValidateSingleStatement(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+	}{
+		{"single statement", "SELECT * FROM users", false},
+		{"trailing semicolon", "SELECT * FROM users;  \n", false},
+		{"trailing comment", "SELECT 1; -- done", false},
+		{"semicolon in string", "SELECT * FROM users WHERE name = 'a;b'", false},
+		{"doubled quote in string", "SELECT 'it''s; fine'", false},
+		{"semicolon in identifier", `SELECT "a;b" FROM t`, false},
+		{"semicolon in comments", "SELECT 1 /* a; /* nested; */ b; */ -- c;\nFROM t", false},
+		{"semicolon in dollar quote", "SELECT $tag$a; b$tag$", false},
+		{"dollar in identifier", "SELECT a$b FROM t", false},
+		{"placeholder", "SELECT * FROM t WHERE id = $1", false},
+		{"stacked statements", "SELECT 1; COMMIT; DELETE FROM t", true},
+		{"stacked without spaces", "SELECT 1;DELETE FROM t", true},
+		{"statement after comment", "SELECT 1; /* c */ DELETE FROM t", true},
+		{"backslash escape hides separator", `SELECT 'a\'; DELETE FROM t; --'`, true},
+		{"backslash escape reveals separator", `SELECT '\' '; DELETE FROM t; SELECT '`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSingleStatement(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateSingleStatement(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/kris-hansen/comanda/utils/config"
 	openai "github.com/sashabaranov/go-openai"
 )
 
@@ -274,9 +275,36 @@ func GetOllamaModels() ([]OllamaModel, error) {
 		return models, nil
 	}
 
-	resp, err := http.Get("http://localhost:11434/api/tags")
+	models, err := GetOllamaHostModels(config.Host{Name: "default", BaseURL: config.DefaultOllamaURL})
 	if err != nil {
-		return nil, fmt.Errorf("error connecting to Ollama API: %v", err)
+		return nil, err
+	}
+
+	// Cache the model names
+	var modelNames []string
+	for _, model := range models {
+		modelNames = append(modelNames, model.Name)
+	}
+	setCachedModels(cacheKey, modelNames)
+
+	return models, nil
+}
+
+// GetOllamaHostModels fetches the models available on an Ollama server, sending the host's
+// headers. The result is not cached, so it reflects models pulled since the last call.
+func GetOllamaHostModels(host config.Host) ([]OllamaModel, error) {
+	req, err := http.NewRequest("GET", host.BaseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Ollama request: %v", err)
+	}
+	for k, v := range host.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to Ollama API at %s: %v", host.BaseURL, err)
 	}
 	defer resp.Body.Close()
 
@@ -291,15 +319,42 @@ func GetOllamaModels() ([]OllamaModel, error) {
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		return nil, fmt.Errorf("error decoding Ollama response: %v", err)
 	}
+	return response.Models, nil
+}
 
-	// Cache the model names
-	var modelNames []string
-	for _, model := range response.Models {
-		modelNames = append(modelNames, model.Name)
+// GetOllamaHostsModels returns the names of the models available on any of the Ollama
+// servers, in the order they are first found. Servers that cannot be reached are skipped
+// unless none can be.
+func GetOllamaHostsModels(hosts []config.Host) ([]string, error) {
+	var names []string
+	seen := make(map[string]bool)
+	var errs []string
+	for _, host := range hosts {
+		cacheKey := "ollama_" + host.BaseURL
+		cached, found := getCachedModels(cacheKey)
+		if !found {
+			models, err := GetOllamaHostModels(host)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", host.Name, err))
+				continue
+			}
+			cached = make([]string, len(models))
+			for i, model := range models {
+				cached[i] = model.Name
+			}
+			setCachedModels(cacheKey, cached)
+		}
+		for _, name := range cached {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
 	}
-	setCachedModels(cacheKey, modelNames)
-
-	return response.Models, nil
+	if len(errs) == len(hosts) && len(errs) > 0 {
+		return nil, fmt.Errorf("no Ollama host could be reached: %s", strings.Join(errs, "; "))
+	}
+	return names, nil
 }
 
 // GetAvailableModels retrieves the list of available models for a given provider.
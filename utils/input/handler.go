@@ -484,6 +484,16 @@ func (h *Handler) processScreenshot() error {
 	return nil
 }
 
+// AddText adds text that does not come from a file, such as one chunk of a larger input
+func (h *Handler) AddText(name string, content string) {
+	h.inputs = append(h.inputs, &Input{
+		Path:     name,
+		Type:     StdinInput,
+		Contents: []byte(content),
+		MimeType: "text/plain",
+	})
+}
+
 // GetInputs returns all processed inputs
 func (h *Handler) GetInputs() []*Input {
 	return h.inputs
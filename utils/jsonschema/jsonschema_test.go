@@ -0,0 +1,118 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const personSchema = `{
+  "type": "object",
+  "required": ["name", "age"],
+  "additionalProperties": false,
+  "properties": {
+    "name": {"type": "string", "minLength": 1},
+    "age": {"type": "integer", "minimum": 0},
+    "role": {"enum": ["admin", "user"]},
+    "email": {"type": ["string", "null"], "pattern": "@"},
+    "tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}}
+  }
+}`
+
+func TestValidate(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(personSchema), &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		value    string
+		expected []string
+	}{
+		{
+			name:  "valid",
+			value: `{"name": "Ada", "age": 36, "role": "admin", "email": null, "tags": ["math"]}`,
+		},
+		{
+			name:     "wrong root type",
+			value:    `["Ada"]`,
+			expected: []string{"$: expected object, got array"},
+		},
+		{
+			name:     "missing required",
+			value:    `{"name": "Ada"}`,
+			expected: []string{`$: missing required property "age"`},
+		},
+		{
+			name:  "nested violations",
+			value: `{"name": "", "age": 3.5, "role": "owner", "email": "none", "tags": ["a", 2, "c"], "extra": true}`,
+			expected: []string{
+				"$.age: expected integer, got number",
+				`$.email: value "none" does not match pattern @`,
+				`$: unexpected property "extra"`,
+				"$.name: expected at least 1 characters, got 0",
+				`$.role: value "owner" is not one of ["admin","user"]`,
+				"$.tags: expected at most 2 items, got 3",
+				"$.tags[1]: expected string, got number",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			got := Validate(schema, value)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Validate() =\n%q\nwant\n%q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateCombinators(t *testing.T) {
+	schema := map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "integer"},
+			map[string]interface{}{"type": "number", "minimum": float64(10)},
+		},
+	}
+	tests := []struct {
+		value float64
+		valid bool
+	}{
+		{value: 5, valid: true},    // integer only
+		{value: 10.5, valid: true}, // number >= 10 only
+		{value: 12, valid: false},  // both
+		{value: 2.5, valid: false}, // neither
+	}
+	for _, tt := range tests {
+		if errs := Validate(schema, tt.value); (len(errs) == 0) != tt.valid {
+			t.Errorf("Validate(%v) = %q, want valid=%v", tt.value, errs, tt.valid)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	// Schemas decoded from YAML use int and map[string]interface{} values
+	schema, err := Normalize(map[string]interface{}{
+		"type":     "array",
+		"maxItems": 2,
+	})
+	if err != nil {
+		t.Fatalf("Normalize() error: %v", err)
+	}
+	if schema["maxItems"] != float64(2) {
+		t.Errorf("maxItems = %#v, want float64(2)", schema["maxItems"])
+	}
+	if errs := Validate(schema, []interface{}{"a", "b", "c"}); len(errs) != 1 {
+		t.Errorf("expected one error, got %q", errs)
+	}
+
+	if _, err := Normalize("not an object"); err == nil {
+		t.Error("expected error for a schema that is not an object")
+	}
+}
@@ -1,7 +1,9 @@
 package models
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -68,9 +70,14 @@ type anthropicMessage struct {
 }
 
 type anthropicContent struct {
-	Type   string           `json:"type"`
-	Text   string           `json:"text,omitempty"`
-	Source *anthropicSource `json:"source,omitempty"`
+	Type      string           `json:"type"`
+	Text      string           `json:"text,omitempty"`
+	Source    *anthropicSource `json:"source,omitempty"`
+	ID        string           `json:"id,omitempty"`          // tool_use blocks
+	Name      string           `json:"name,omitempty"`        // tool_use blocks
+	Input     json.RawMessage  `json:"input,omitempty"`       // tool_use blocks
+	ToolUseID string           `json:"tool_use_id,omitempty"` // tool_result blocks
+	Content   string           `json:"content,omitempty"`     // tool_result blocks
 }
 
 type anthropicSource struct {
@@ -80,24 +87,69 @@ type anthropicSource struct {
 }
 
 type anthropicRequest struct {
-	Model       string             `json:"model"`
-	Messages    []anthropicMessage `json:"messages"`
-	MaxTokens   int                `json:"max_tokens"`
-	Temperature float64            `json:"temperature"`
-	TopP        float64            `json:"top_p"`
+	Model         string             `json:"model"`
+	Messages      []anthropicMessage `json:"messages"`
+	System        string             `json:"system,omitempty"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   float64            `json:"temperature"`
+	TopP          float64            `json:"top_p"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+// newRequest creates a request for a single user message with the provider's configuration
+// and the model parameters carried by ctx. Anthropic has no seed parameter.
+func (a *AnthropicProvider) newRequest(ctx context.Context, modelName string, content []anthropicContent) anthropicRequest {
+	cfg := RequestOptionsFromContext(ctx).modelConfig(a.config)
+	return anthropicRequest{
+		Model: modelName,
+		Messages: []anthropicMessage{
+			{
+				Role:    "user",
+				Content: content,
+			},
+		},
+		System:        cfg.System,
+		MaxTokens:     cfg.MaxTokens,
+		Temperature:   cfg.Temperature,
+		TopP:          cfg.TopP,
+		StopSequences: cfg.Stop,
+	}
 }
 
 type anthropicResponse struct {
-	Content []struct {
-		Text string `json:"text"`
-	} `json:"content"`
-	Error *struct {
+	Content []anthropicContent `json:"content"`
+	Error   *struct {
 		Message string `json:"message"`
 	} `json:"error,omitempty"`
+	Usage anthropicUsage `json:"usage"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// usage converts the response usage, whose input_tokens leave out prompt cache reads and writes
+func (u anthropicUsage) usage() Usage {
+	return Usage{
+		InputTokens:  u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		OutputTokens: u.OutputTokens,
+		CachedTokens: u.CacheReadInputTokens,
+	}
 }
 
 // SendPrompt sends a prompt to the specified model and returns the response
-func (a *AnthropicProvider) SendPrompt(modelName string, prompt string) (string, error) {
+func (a *AnthropicProvider) SendPrompt(ctx context.Context, modelName string, prompt string) (string, error) {
 	a.debugf("Preparing to send prompt to model: %s", modelName)
 	a.debugf("Prompt length: %d characters", len(prompt))
 
@@ -113,75 +165,51 @@ func (a *AnthropicProvider) SendPrompt(modelName string, prompt string) (string,
 	a.debugf("Using configuration: Temperature=%.2f, MaxTokens=%d, TopP=%.2f",
 		a.config.Temperature, a.config.MaxTokens, a.config.TopP)
 
-	reqBody := anthropicRequest{
-		Model: modelName,
-		Messages: []anthropicMessage{
-			{
-				Role: "user",
-				Content: []anthropicContent{
-					{
-						Type: "text",
-						Text: prompt,
-					},
-				},
-			},
+	reqBody := a.newRequest(ctx, modelName, []anthropicContent{
+		{
+			Type: "text",
+			Text: prompt,
 		},
-		MaxTokens:   a.config.MaxTokens,
-		Temperature: a.config.Temperature,
-		TopP:        a.config.TopP,
-	}
+	})
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %v", err)
+	return a.send(ctx, modelName, reqBody, "")
+}
+
+// SendPromptStream sends a prompt to the specified model and streams the response
+func (a *AnthropicProvider) SendPromptStream(ctx context.Context, modelName string, prompt string, onDelta func(delta string)) (string, error) {
+	if a.apiKey == "" {
+		return "", fmt.Errorf("Anthropic provider not configured: missing API key")
 	}
 
-	req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+	if !a.ValidateModel(modelName) {
+		return "", fmt.Errorf("invalid Anthropic model: %s", modelName)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", a.apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+	a.debugf("Streaming prompt to model: %s", modelName)
+	reqBody := a.newRequest(ctx, modelName, []anthropicContent{
+		{
+			Type: "text",
+			Text: prompt,
+		},
+	})
+	reqBody.Stream = true
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := a.post(ctx, reqBody, "")
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %v", err)
+		return "", err
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	response, err := readAnthropicStream(ctx, modelName, resp.Body, onDelta)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %v", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var response anthropicResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %v", err)
+		return "", err
 	}
-
-	if response.Error != nil {
-		return "", fmt.Errorf("API error: %s", response.Error.Message)
-	}
-
-	if len(response.Content) == 0 {
-		return "", fmt.Errorf("no response content returned from Anthropic")
-	}
-
-	result := response.Content[0].Text
-	a.debugf("API call completed, response length: %d characters", len(result))
-
-	return result, nil
+	a.debugf("Stream completed, response length: %d characters", len(response))
+	return response, nil
 }
 
 // SendPromptWithFile sends a prompt along with a file to the specified model and returns the response
-func (a *AnthropicProvider) SendPromptWithFile(modelName string, prompt string, file FileInput) (string, error) {
+func (a *AnthropicProvider) SendPromptWithFile(ctx context.Context, modelName string, prompt string, file FileInput) (string, error) {
 	a.debugf("Preparing to send prompt with file to model: %s", modelName)
 	a.debugf("File path: %s", file.Path)
 
@@ -248,71 +276,250 @@ func (a *AnthropicProvider) SendPromptWithFile(modelName string, prompt string,
 		}
 	}
 
-	reqBody := anthropicRequest{
-		Model: modelName,
-		Messages: []anthropicMessage{
-			{
-				Role:    "user",
-				Content: content,
-			},
-		},
-		MaxTokens:   a.config.MaxTokens,
-		Temperature: a.config.Temperature,
-		TopP:        a.config.TopP,
+	reqBody := a.newRequest(ctx, modelName, content)
+
+	// Add beta header for PDF support when sending PDF files
+	beta := ""
+	if file.MimeType == "application/pdf" {
+		beta = "pdfs-2024-09-25"
 	}
+	return a.send(ctx, modelName, reqBody, beta)
+}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %v", err)
+// SendMessages sends a conversation to the specified model and returns the response
+func (a *AnthropicProvider) SendMessages(ctx context.Context, modelName string, messages []Message) (string, error) {
+	reply, err := a.SendMessagesWithTools(ctx, modelName, messages, nil)
+	return reply.Content, err
+}
+
+// SendMessagesWithTools sends a conversation with the tools the model may call and returns its
+// reply. System messages are sent as the request's system prompt.
+func (a *AnthropicProvider) SendMessagesWithTools(ctx context.Context, modelName string, messages []Message, tools []Tool) (Message, error) {
+	a.debugf("Preparing to send %d messages to model: %s", len(messages), modelName)
+
+	if a.apiKey == "" {
+		return Message{}, fmt.Errorf("Anthropic provider not configured: missing API key")
+	}
+
+	if !a.ValidateModel(modelName) {
+		return Message{}, fmt.Errorf("invalid Anthropic model: %s", modelName)
+	}
+
+	if err := validateMessages(messages); err != nil {
+		return Message{}, err
 	}
 
-	req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
+	system, turns := splitSystem(messages)
+	reqBody := a.newRequest(ctx, modelName, nil)
+	reqBody.Messages = anthropicMessages(turns)
+	if system != "" {
+		reqBody.System = system
+	}
+	for _, tool := range tools {
+		reqBody.Tools = append(reqBody.Tools, anthropicTool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: toolParameters(tool),
+		})
+	}
+
+	response, err := a.do(ctx, modelName, reqBody, "")
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+		return Message{}, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", a.apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+	reply := Message{Role: RoleAssistant}
+	for _, block := range response.Content {
+		switch block.Type {
+		case "text":
+			reply.Content += block.Text
+		case "tool_use":
+			reply.ToolCalls = append(reply.ToolCalls, ToolCall{ID: block.ID, Name: block.Name, Arguments: string(block.Input)})
+		}
+	}
+	a.debugf("API call completed, response length: %d characters, tool calls: %d", len(reply.Content), len(reply.ToolCalls))
 
-	// Add beta header for PDF support when sending PDF files
-	if file.MimeType == "application/pdf" {
-		req.Header.Set("anthropic-beta", "pdfs-2024-09-25")
+	return reply, nil
+}
+
+// anthropicMessages converts the turns of a conversation. Tool calls become tool_use blocks of
+// the assistant's message, and consecutive tool results are sent together in one user message.
+func anthropicMessages(turns []Message) []anthropicMessage {
+	var converted []anthropicMessage
+	for _, msg := range turns {
+		switch msg.Role {
+		case RoleTool:
+			block := anthropicContent{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content}
+			if last := len(converted) - 1; last >= 0 && converted[last].Role == RoleUser && converted[last].Content[0].Type == "tool_result" {
+				converted[last].Content = append(converted[last].Content, block)
+				continue
+			}
+			converted = append(converted, anthropicMessage{Role: RoleUser, Content: []anthropicContent{block}})
+		default:
+			var content []anthropicContent
+			if msg.Content != "" || len(msg.ToolCalls) == 0 {
+				content = append(content, anthropicContent{Type: "text", Text: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				content = append(content, anthropicContent{Type: "tool_use", ID: call.ID, Name: call.Name, Input: toolArguments(call)})
+			}
+			converted = append(converted, anthropicMessage{Role: msg.Role, Content: content})
+		}
 	}
+	return converted
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// send posts a request to the Messages API and returns the text of the response. A non-empty
+// beta enables a beta feature with the anthropic-beta header.
+func (a *AnthropicProvider) send(ctx context.Context, modelName string, reqBody anthropicRequest, beta string) (string, error) {
+	response, err := a.do(ctx, modelName, reqBody, beta)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %v", err)
+		return "", err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	if len(response.Content) == 0 {
+		return "", fmt.Errorf("no response content returned from Anthropic")
+	}
+
+	result := response.Content[0].Text
+	a.debugf("API call completed, response length: %d characters", len(result))
+
+	return result, nil
+}
+
+// do posts a request to the Messages API and returns the decoded response
+func (a *AnthropicProvider) do(ctx context.Context, modelName string, reqBody anthropicRequest, beta string) (*anthropicResponse, error) {
+	resp, err := a.post(ctx, reqBody, beta)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %v", err)
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
 	}
 
 	var response anthropicResponse
 	if err := json.Unmarshal(body, &response); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %v", err)
+		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
 	}
 
 	if response.Error != nil {
-		return "", fmt.Errorf("API error: %s", response.Error.Message)
+		return nil, fmt.Errorf("API error: %s", response.Error.Message)
 	}
+	ReportUsage(ctx, modelName, response.Usage.usage())
 
-	if len(response.Content) == 0 {
-		return "", fmt.Errorf("no response content returned from Anthropic")
+	return &response, nil
+}
+
+// post posts a request to the Messages API and returns the response if its status is OK
+func (a *AnthropicProvider) post(ctx context.Context, reqBody anthropicRequest, beta string) (*http.Response, error) {
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
-	result := response.Content[0].Text
-	a.debugf("API call completed, response length: %d characters", len(result))
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
 
-	return result, nil
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", a.apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+	if beta != "" {
+		req.Header.Set("anthropic-beta", beta)
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, wrapRequestError(a.Name(), err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, newHTTPError(a.Name(), resp.StatusCode, resp.Header, string(body))
+	}
+	return resp, nil
+}
+
+// anthropicStreamEvent is an event of a streamed Messages API response
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"` // message_start events
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"` // content_block_delta events
+	Usage anthropicUsage `json:"usage"` // message_delta events
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"` // error events
+}
+
+// readAnthropicStream reads the server-sent events of a streamed response, passing the text
+// deltas to onDelta, and returns the whole text. The input usage arrives with message_start
+// and the output usage with message_delta.
+func readAnthropicStream(ctx context.Context, modelName string, body io.Reader, onDelta func(delta string)) (string, error) {
+	var response strings.Builder
+	var usage anthropicUsage
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return "", fmt.Errorf("failed to decode stream event: %v", err)
+		}
+		switch event.Type {
+		case "message_start":
+			usage = event.Message.Usage
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+				response.WriteString(event.Delta.Text)
+				onDelta(event.Delta.Text)
+			}
+		case "message_delta":
+			usage.OutputTokens = event.Usage.OutputTokens
+		case "error":
+			if event.Error == nil {
+				return "", fmt.Errorf("API error in stream")
+			}
+			return "", &ProviderError{Provider: "anthropic", Kind: anthropicErrorKind(event.Error.Type), Message: event.Error.Message}
+		case "message_stop":
+			ReportUsage(ctx, modelName, usage.usage())
+			return response.String(), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read stream: %v", err)
+	}
+	return "", fmt.Errorf("stream ended before the response was complete")
+}
+
+// anthropicErrorKind classifies the type of an error event, which arrives after the
+// response's status has been sent
+func anthropicErrorKind(errorType string) ErrorKind {
+	switch errorType {
+	case "rate_limit_error":
+		return ErrorRateLimit
+	case "overloaded_error", "api_error":
+		return ErrorOverloaded
+	case "authentication_error", "permission_error":
+		return ErrorAuth
+	case "invalid_request_error", "not_found_error", "request_too_large":
+		return ErrorInvalidRequest
+	}
+	return ErrorUnknown
 }
 
 // ValidateModel checks if the specific Anthropic model variant is valid
@@ -397,6 +604,15 @@ func init() {
 			Version:       "1.0.0",
 			ModelPrefixes: []string{"claude-"},
 			Priority:      90, // High priority for claude- models
+			CharsPerToken: 3.5,
+			ModelLimits: []ModelLimits{
+				{Prefix: "claude-", ContextWindow: 200000, MaxOutputTokens: 4096},
+				{Prefix: "claude-3-5-sonnet", ContextWindow: 200000, MaxOutputTokens: 8192},
+				{Prefix: "claude-3-5-haiku", ContextWindow: 200000, MaxOutputTokens: 8192},
+				{Prefix: "claude-3-7-sonnet", ContextWindow: 200000, MaxOutputTokens: 64000},
+				{Prefix: "claude-sonnet-4", ContextWindow: 200000, MaxOutputTokens: 64000},
+				{Prefix: "claude-opus-4", ContextWindow: 200000, MaxOutputTokens: 32000},
+			},
 		},
 	)
 	RegisterProvider("anthropic", factory)
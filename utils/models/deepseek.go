@@ -77,24 +77,27 @@ func (d *DeepseekProvider) Configure(apiKey string) error {
 }
 
 // createChatCompletionRequest creates a ChatCompletionRequest with the appropriate parameters
-func (d *DeepseekProvider) createChatCompletionRequest(modelName string, messages []openai.ChatCompletionMessage) openai.ChatCompletionRequest {
+// and the model parameters carried by ctx
+func (d *DeepseekProvider) createChatCompletionRequest(ctx context.Context, modelName string, messages []openai.ChatCompletionMessage) openai.ChatCompletionRequest {
+	cfg := RequestOptionsFromContext(ctx).modelConfig(d.config)
 	req := openai.ChatCompletionRequest{
 		Model:    modelName,
-		Messages: messages,
+		Messages: withSystemMessage(cfg.System, messages),
+		Stop:     cfg.Stop,
 	}
 
 	// deepseek-reasoner doesn't support temperature parameter
 	if !strings.HasSuffix(modelName, "reasoner") {
-		req.MaxTokens = d.config.MaxTokens
-		req.Temperature = float32(d.config.Temperature)
-		req.TopP = float32(d.config.TopP)
+		req.MaxTokens = cfg.MaxTokens
+		req.Temperature = chatTemperature(cfg.Temperature)
+		req.TopP = float32(cfg.TopP)
 	}
 
 	return req
 }
 
 // SendPrompt sends a prompt to the specified model and returns the response
-func (d *DeepseekProvider) SendPrompt(modelName string, prompt string) (string, error) {
+func (d *DeepseekProvider) SendPrompt(ctx context.Context, modelName string, prompt string) (string, error) {
 	d.debugf("Preparing to send prompt to model: %s", modelName)
 	d.debugf("Prompt length: %d characters", len(prompt))
 
@@ -119,12 +122,13 @@ func (d *DeepseekProvider) SendPrompt(modelName string, prompt string) (string,
 		},
 	}
 
-	req := d.createChatCompletionRequest(modelName, messages)
-	resp, err := client.CreateChatCompletion(context.Background(), req)
+	req := d.createChatCompletionRequest(ctx, modelName, messages)
+	resp, err := client.CreateChatCompletion(ctx, req)
 
 	if err != nil {
-		return "", fmt.Errorf("Deepseek API error: %v", err)
+		return "", wrapRequestError(d.Name(), err)
 	}
+	reportChatUsage(ctx, modelName, resp.Usage)
 
 	if len(resp.Choices) == 0 {
 		return "", fmt.Errorf("no response choices returned from Deepseek")
@@ -136,8 +140,36 @@ func (d *DeepseekProvider) SendPrompt(modelName string, prompt string) (string,
 	return response, nil
 }
 
+// SendPromptStream sends a prompt to the specified model and streams the response
+func (d *DeepseekProvider) SendPromptStream(ctx context.Context, modelName string, prompt string, onDelta func(delta string)) (string, error) {
+	if d.apiKey == "" {
+		return "", fmt.Errorf("Deepseek provider not configured: missing API key")
+	}
+
+	if !d.SupportsModel(modelName) {
+		return "", fmt.Errorf("invalid Deepseek model: %s", modelName)
+	}
+
+	d.debugf("Streaming prompt to model: %s", modelName)
+	config := openai.DefaultConfig(d.apiKey)
+	config.BaseURL = "https://api.deepseek.com/v1"
+
+	req := d.createChatCompletionRequest(ctx, modelName, []openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleUser,
+			Content: prompt,
+		},
+	})
+	response, err := streamChatCompletion(ctx, openai.NewClientWithConfig(config), d.Name(), modelName, req, onDelta)
+	if err != nil {
+		return "", err
+	}
+	d.debugf("Stream completed, response length: %d characters", len(response))
+	return response, nil
+}
+
 // SendPromptWithFile sends a prompt along with a file to the specified model and returns the response
-func (d *DeepseekProvider) SendPromptWithFile(modelName string, prompt string, file FileInput) (string, error) {
+func (d *DeepseekProvider) SendPromptWithFile(ctx context.Context, modelName string, prompt string, file FileInput) (string, error) {
 	d.debugf("Preparing to send prompt with file to model: %s", modelName)
 	d.debugf("File path: %s", file.Path)
 
@@ -161,7 +193,7 @@ func (d *DeepseekProvider) SendPromptWithFile(modelName string, prompt string, f
 
 	// For image files, handle them using vision capabilities
 	if strings.HasPrefix(file.MimeType, "image/") {
-		return d.handleFileAsVision(client, prompt, fileData, file.MimeType, modelName)
+		return d.handleFileAsVision(ctx, client, prompt, fileData, file.MimeType, modelName)
 	}
 
 	// For other files, include the content as part of the prompt
@@ -175,12 +207,13 @@ func (d *DeepseekProvider) SendPromptWithFile(modelName string, prompt string, f
 		},
 	}
 
-	req := d.createChatCompletionRequest(modelName, messages)
-	resp, err := client.CreateChatCompletion(context.Background(), req)
+	req := d.createChatCompletionRequest(ctx, modelName, messages)
+	resp, err := client.CreateChatCompletion(ctx, req)
 
 	if err != nil {
-		return "", fmt.Errorf("Deepseek API error: %v", err)
+		return "", wrapRequestError(d.Name(), err)
 	}
+	reportChatUsage(ctx, modelName, resp.Usage)
 
 	if len(resp.Choices) == 0 {
 		return "", fmt.Errorf("no response choices returned from Deepseek")
@@ -192,8 +225,53 @@ func (d *DeepseekProvider) SendPromptWithFile(modelName string, prompt string, f
 	return response, nil
 }
 
+// SendMessages sends a conversation to the specified model and returns the response
+func (d *DeepseekProvider) SendMessages(ctx context.Context, modelName string, messages []Message) (string, error) {
+	reply, err := d.SendMessagesWithTools(ctx, modelName, messages, nil)
+	return reply.Content, err
+}
+
+// SendMessagesWithTools sends a conversation with the tools the model may call and returns its reply
+func (d *DeepseekProvider) SendMessagesWithTools(ctx context.Context, modelName string, messages []Message, tools []Tool) (Message, error) {
+	d.debugf("Preparing to send %d messages to model: %s", len(messages), modelName)
+
+	if d.apiKey == "" {
+		return Message{}, fmt.Errorf("Deepseek provider not configured: missing API key")
+	}
+
+	if !d.SupportsModel(modelName) {
+		return Message{}, fmt.Errorf("invalid Deepseek model: %s", modelName)
+	}
+
+	if err := validateMessages(messages); err != nil {
+		return Message{}, err
+	}
+
+	config := openai.DefaultConfig(d.apiKey)
+	config.BaseURL = "https://api.deepseek.com/v1"
+	client := openai.NewClientWithConfig(config)
+
+	req := d.createChatCompletionRequest(ctx, modelName, chatMessages(messages))
+	req.Tools = chatTools(tools)
+	resp, err := client.CreateChatCompletion(ctx, req)
+
+	if err != nil {
+		return Message{}, wrapRequestError(d.Name(), err)
+	}
+	reportChatUsage(ctx, modelName, resp.Usage)
+
+	if len(resp.Choices) == 0 {
+		return Message{}, fmt.Errorf("no response choices returned from Deepseek")
+	}
+
+	reply := chatReply(resp.Choices[0].Message)
+	d.debugf("API call completed, response length: %d characters, tool calls: %d", len(reply.Content), len(reply.ToolCalls))
+
+	return reply, nil
+}
+
 // handleFileAsVision processes a file as a vision model request
-func (d *DeepseekProvider) handleFileAsVision(client *openai.Client, prompt string, fileData []byte, mimeType string, modelName string) (string, error) {
+func (d *DeepseekProvider) handleFileAsVision(ctx context.Context, client *openai.Client, prompt string, fileData []byte, mimeType string, modelName string) (string, error) {
 	// Convert file data to base64 string with proper data URI prefix
 	base64Data := fmt.Sprintf("data:%s;base64,%s", mimeType, string(fileData))
 
@@ -218,12 +296,13 @@ func (d *DeepseekProvider) handleFileAsVision(client *openai.Client, prompt stri
 		},
 	}
 
-	req := d.createChatCompletionRequest(modelName, messages)
-	resp, err := client.CreateChatCompletion(context.Background(), req)
+	req := d.createChatCompletionRequest(ctx, modelName, messages)
+	resp, err := client.CreateChatCompletion(ctx, req)
 
 	if err != nil {
-		return "", fmt.Errorf("Deepseek Vision API error: %v", err)
+		return "", wrapRequestError(d.Name(), err)
 	}
+	reportChatUsage(ctx, modelName, resp.Usage)
 
 	if len(resp.Choices) == 0 {
 		return "", fmt.Errorf("no response choices returned from Deepseek Vision")
@@ -267,6 +346,10 @@ func init() {
 			Version:       "1.0.0",
 			ModelPrefixes: []string{"deepseek-"},
 			Priority:      70, // Medium priority for Deepseek models
+			CharsPerToken: 3.5,
+			ModelLimits: []ModelLimits{
+				{Prefix: "deepseek-", ContextWindow: 64000, MaxOutputTokens: 8192},
+			},
 		},
 	)
 	RegisterProvider("deepseek", factory)
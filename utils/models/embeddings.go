@@ -0,0 +1,71 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Embed returns the embeddings of texts from provider, in the same order. Providers without
+// an embeddings API return an error.
+func Embed(ctx context.Context, provider Provider, modelName string, texts []string) ([][]float32, error) {
+	embedder, ok := provider.(EmbeddingProvider)
+	if !ok {
+		return nil, fmt.Errorf("provider %s does not support embeddings", provider.Name())
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	return embedder.Embed(ctx, modelName, texts)
+}
+
+// embedBatchSize is the most texts sent in one embeddings request. The Gemini API accepts
+// 100, and OpenAI limits both the inputs and the tokens of a request.
+const embedBatchSize = 100
+
+// embedInBatches embeds texts with requests of at most embedBatchSize texts each, and returns
+// the embeddings of all of them in order
+func embedInBatches(texts []string, embed func(batch []string) ([][]float32, error)) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += embedBatchSize {
+		batch, err := embed(texts[start:min(start+embedBatchSize, len(texts))])
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, batch...)
+	}
+	return embeddings, nil
+}
+
+// createEmbeddings sends texts to an OpenAI-compatible embeddings API and returns their
+// embeddings in the order of texts. apiModel is the name the API knows the model by.
+func createEmbeddings(ctx context.Context, client *openai.Client, providerName string, modelName string, apiModel string, texts []string) ([][]float32, error) {
+	return embedInBatches(texts, func(batch []string) ([][]float32, error) {
+		return createEmbeddingBatch(ctx, client, providerName, modelName, apiModel, batch)
+	})
+}
+
+// createEmbeddingBatch sends one embeddings request for texts
+func createEmbeddingBatch(ctx context.Context, client *openai.Client, providerName string, modelName string, apiModel string, texts []string) ([][]float32, error) {
+	resp, err := client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input: texts,
+		Model: openai.EmbeddingModel(apiModel),
+	})
+	if err != nil {
+		return nil, wrapRequestError(providerName, err)
+	}
+	ReportUsage(ctx, modelName, Usage{InputTokens: resp.Usage.PromptTokens})
+
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("%s returned %d embeddings for %d texts", providerName, len(resp.Data), len(texts))
+	}
+	embeddings := make([][]float32, len(texts))
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(texts) || embeddings[data.Index] != nil {
+			return nil, fmt.Errorf("%s returned an embedding with unexpected index %d", providerName, data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+	return embeddings, nil
+}
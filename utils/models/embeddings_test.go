@@ -0,0 +1,167 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestOllamaEmbed(t *testing.T) {
+	var request OllamaEmbedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/embed" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		json.NewEncoder(w).Encode(OllamaEmbedResponse{Embeddings: [][]float32{{1, 0}, {0, 1}}, PromptEvalCount: 6})
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider()
+	if err := provider.SetHosts([]config.Host{{Name: "local", BaseURL: server.URL}}, ""); err != nil {
+		t.Fatalf("SetHosts() error: %v", err)
+	}
+
+	ctx, usage := recordUsage()
+	got, err := Embed(ctx, provider, "nomic-embed-text", []string{"cats", "dogs"})
+	if err != nil {
+		t.Fatalf("Embed() error: %v", err)
+	}
+	if want := [][]float32{{1, 0}, {0, 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Embed() = %v, want %v", got, want)
+	}
+	if request.Model != "nomic-embed-text" || !reflect.DeepEqual(request.Input, []string{"cats", "dogs"}) {
+		t.Errorf("request = %+v", request)
+	}
+	if want := []Usage{{InputTokens: 6}}; !reflect.DeepEqual(*usage, want) {
+		t.Errorf("usage = %+v, want %+v", *usage, want)
+	}
+}
+
+func TestOpenAICompatibleEmbed(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []openai.Embedding
+		want    [][]float32
+		wantErr bool
+	}{
+		{"ordered by index", []openai.Embedding{{Index: 1, Embedding: []float32{0, 1}}, {Index: 0, Embedding: []float32{1, 0}}}, [][]float32{{1, 0}, {0, 1}}, false},
+		{"missing embedding", []openai.Embedding{{Index: 0, Embedding: []float32{1, 0}}}, nil, true},
+		{"duplicate index", []openai.Embedding{{Index: 0, Embedding: []float32{1, 0}}, {Index: 0, Embedding: []float32{0, 1}}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request openai.EmbeddingRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&request)
+				json.NewEncoder(w).Encode(openai.EmbeddingResponse{Data: tt.data, Usage: openai.Usage{PromptTokens: 4}})
+			}))
+			defer server.Close()
+
+			provider := NewOpenAICompatibleProvider("vllm", config.Provider{
+				Type:        config.OpenAICompatible,
+				BaseURL:     server.URL,
+				ModelPrefix: "vllm/",
+			})
+			got, err := Embed(context.Background(), provider, "vllm/bge-m3", []string{"cats", "dogs"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Embed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Embed() = %v, want %v", got, tt.want)
+			}
+			if request.Model != "bge-m3" {
+				t.Errorf("request model = %q, want bge-m3", request.Model)
+			}
+		})
+	}
+}
+
+func TestEmbedBatches(t *testing.T) {
+	texts := make([]string, 250)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("text %d", i)
+	}
+	// Each text's embedding holds the number in the text, so the order can be checked
+	embedding := func(text string) []float32 {
+		var n int
+		fmt.Sscanf(text, "text %d", &n)
+		return []float32{float32(n)}
+	}
+
+	var ollamaBatches, openaiBatches []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/embed":
+			var request OllamaEmbedRequest
+			json.NewDecoder(r.Body).Decode(&request)
+			ollamaBatches = append(ollamaBatches, len(request.Input))
+			var resp OllamaEmbedResponse
+			for _, text := range request.Input {
+				resp.Embeddings = append(resp.Embeddings, embedding(text))
+			}
+			json.NewEncoder(w).Encode(resp)
+		case "/embeddings":
+			var request struct {
+				Input []string `json:"input"`
+			}
+			json.NewDecoder(r.Body).Decode(&request)
+			openaiBatches = append(openaiBatches, len(request.Input))
+			var resp openai.EmbeddingResponse
+			for i, text := range request.Input {
+				resp.Data = append(resp.Data, openai.Embedding{Index: i, Embedding: embedding(text)})
+			}
+			json.NewEncoder(w).Encode(resp)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ollama := NewOllamaProvider()
+	if err := ollama.SetHosts([]config.Host{{Name: "local", BaseURL: server.URL}}, ""); err != nil {
+		t.Fatalf("SetHosts() error: %v", err)
+	}
+	compatible := NewOpenAICompatibleProvider("vllm", config.Provider{Type: config.OpenAICompatible, BaseURL: server.URL, ModelPrefix: "vllm/"})
+
+	for _, tt := range []struct {
+		name     string
+		provider Provider
+		model    string
+		batches  *[]int
+	}{
+		{"ollama", ollama, "nomic-embed-text", &ollamaBatches},
+		{"openai-compatible", compatible, "vllm/bge-m3", &openaiBatches},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Embed(context.Background(), tt.provider, tt.model, texts)
+			if err != nil {
+				t.Fatalf("Embed() error: %v", err)
+			}
+			if want := []int{100, 100, 50}; !reflect.DeepEqual(*tt.batches, want) {
+				t.Errorf("batch sizes = %v, want %v", *tt.batches, want)
+			}
+			for i, text := range texts {
+				if !reflect.DeepEqual(got[i], embedding(text)) {
+					t.Fatalf("embedding %d = %v, want %v", i, got[i], embedding(text))
+				}
+			}
+		})
+	}
+}
+
+func TestEmbedUnsupportedProvider(t *testing.T) {
+	_, err := Embed(context.Background(), NewAnthropicProvider(), "claude-3-5-haiku-latest", []string{"cats"})
+	if err == nil || !strings.Contains(err.Error(), "does not support embeddings") {
+		t.Errorf("Embed() error = %v, want unsupported", err)
+	}
+}
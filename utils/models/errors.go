@@ -0,0 +1,270 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorKind classifies provider failures so callers can decide whether to retry
+type ErrorKind int
+
+const (
+	ErrorUnknown        ErrorKind = iota // Unclassified failure
+	ErrorRateLimit                       // Too many requests (HTTP 429)
+	ErrorOverloaded                      // Provider unavailable or overloaded (HTTP 5xx, 529)
+	ErrorTimeout                         // Request timed out
+	ErrorNetwork                         // Connection failed before a response was received
+	ErrorAuth                            // Missing or invalid credentials (HTTP 401, 403)
+	ErrorInvalidRequest                  // Request rejected by the provider (other HTTP 4xx)
+)
+
+// Sentinel errors for use with errors.Is. A *ProviderError matches the sentinel of its kind.
+var (
+	ErrRateLimit      = errors.New("rate limited")
+	ErrOverloaded     = errors.New("provider overloaded")
+	ErrTimeout        = errors.New("request timed out")
+	ErrNetwork        = errors.New("network error")
+	ErrAuth           = errors.New("authentication failed")
+	ErrInvalidRequest = errors.New("invalid request")
+)
+
+// String returns the name used for the kind in configuration and messages
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorRateLimit:
+		return "rate_limit"
+	case ErrorOverloaded:
+		return "overloaded"
+	case ErrorTimeout:
+		return "timeout"
+	case ErrorNetwork:
+		return "network"
+	case ErrorAuth:
+		return "auth"
+	case ErrorInvalidRequest:
+		return "invalid_request"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseErrorKind converts a kind name (as returned by String) into an ErrorKind
+func ParseErrorKind(name string) (ErrorKind, error) {
+	for k := ErrorUnknown; k <= ErrorInvalidRequest; k++ {
+		if k.String() == strings.ToLower(strings.TrimSpace(name)) {
+			return k, nil
+		}
+	}
+	return ErrorUnknown, fmt.Errorf("unknown error kind '%s'", name)
+}
+
+// Retryable reports whether errors of this kind are usually transient
+func (k ErrorKind) Retryable() bool {
+	switch k {
+	case ErrorRateLimit, ErrorOverloaded, ErrorTimeout, ErrorNetwork:
+		return true
+	default:
+		return false
+	}
+}
+
+// ProviderError is returned by providers when a model API call fails
+type ProviderError struct {
+	Provider   string        // Provider name, e.g. "openai"
+	Kind       ErrorKind     // Classification of the failure
+	StatusCode int           // HTTP status code, if the provider returned one
+	Message    string        // Error message from the provider
+	RetryAfter time.Duration // Delay requested by the provider, if any
+	Err        error         // Underlying error, if any
+}
+
+// Error implements the error interface
+func (e *ProviderError) Error() string {
+	msg := e.Message
+	if msg == "" && e.Err != nil {
+		msg = e.Err.Error()
+	}
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s API error (%s, status %d): %s", e.Provider, e.Kind, e.StatusCode, msg)
+	}
+	return fmt.Sprintf("%s API error (%s): %s", e.Provider, e.Kind, msg)
+}
+
+// Unwrap returns the underlying error
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the sentinel error for the error's kind
+func (e *ProviderError) Is(target error) bool {
+	switch target {
+	case ErrRateLimit:
+		return e.Kind == ErrorRateLimit
+	case ErrOverloaded:
+		return e.Kind == ErrorOverloaded
+	case ErrTimeout:
+		return e.Kind == ErrorTimeout
+	case ErrNetwork:
+		return e.Kind == ErrorNetwork
+	case ErrAuth:
+		return e.Kind == ErrorAuth
+	case ErrInvalidRequest:
+		return e.Kind == ErrorInvalidRequest
+	}
+	return false
+}
+
+// Retryable reports whether the failed call is worth retrying
+func (e *ProviderError) Retryable() bool {
+	return e.Kind.Retryable()
+}
+
+// ErrorKindOf returns the kind of a provider error, or ErrorUnknown if err is not one
+func ErrorKindOf(err error) ErrorKind {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.Kind
+	}
+	return ErrorUnknown
+}
+
+// IsRetryable reports whether err is a provider error of a retryable kind
+func IsRetryable(err error) bool {
+	return ErrorKindOf(err).Retryable()
+}
+
+// RetryAfterOf returns the delay requested by the provider, or zero if there is none
+func RetryAfterOf(err error) time.Duration {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.RetryAfter
+	}
+	return 0
+}
+
+// classifyStatus maps an HTTP status code to an error kind
+func classifyStatus(statusCode int) ErrorKind {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return ErrorRateLimit
+	case statusCode == http.StatusRequestTimeout || statusCode == http.StatusGatewayTimeout:
+		return ErrorTimeout
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrorAuth
+	case statusCode >= 500:
+		// Includes Anthropic's 529 overloaded status
+		return ErrorOverloaded
+	case statusCode >= 400:
+		return ErrorInvalidRequest
+	default:
+		return ErrorUnknown
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(header http.Header) time.Duration {
+	if header == nil {
+		return 0
+	}
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// newHTTPError creates a provider error from a non-2xx HTTP response
+func newHTTPError(provider string, statusCode int, header http.Header, body string) *ProviderError {
+	return &ProviderError{
+		Provider:   provider,
+		Kind:       classifyStatus(statusCode),
+		StatusCode: statusCode,
+		Message:    strings.TrimSpace(body),
+		RetryAfter: parseRetryAfter(header),
+	}
+}
+
+// wrapRequestError classifies an error from sending a request or calling a client library.
+// Errors that cannot be classified are still wrapped so the provider name is kept.
+func wrapRequestError(provider string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return err
+	}
+
+	// OpenAI-compatible APIs (OpenAI, X.AI, Deepseek)
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return &ProviderError{Provider: provider, Kind: classifyStatus(apiErr.HTTPStatusCode), StatusCode: apiErr.HTTPStatusCode, Message: apiErr.Message, Err: err}
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return &ProviderError{Provider: provider, Kind: classifyStatus(reqErr.HTTPStatusCode), StatusCode: reqErr.HTTPStatusCode, Err: err}
+	}
+
+	// Cancellation is not a provider failure, so it is passed through unclassified
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &ProviderError{Provider: provider, Kind: ErrorTimeout, Err: err}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		kind := ErrorNetwork
+		if netErr.Timeout() {
+			kind = ErrorTimeout
+		}
+		return &ProviderError{Provider: provider, Kind: kind, Err: err}
+	}
+
+	// Google AI returns API errors that carry an HTTP or gRPC status
+	var httpErr interface{ HTTPCode() int }
+	if errors.As(err, &httpErr) && httpErr.HTTPCode() > 0 {
+		return &ProviderError{Provider: provider, Kind: classifyStatus(httpErr.HTTPCode()), StatusCode: httpErr.HTTPCode(), Err: err}
+	}
+	if st, ok := status.FromError(err); ok && st.Code() != codes.Unknown {
+		return &ProviderError{Provider: provider, Kind: classifyGRPCCode(st.Code()), Message: st.Message(), Err: err}
+	}
+
+	return &ProviderError{Provider: provider, Kind: ErrorUnknown, Err: err}
+}
+
+// classifyGRPCCode maps a gRPC status code to an error kind
+func classifyGRPCCode(code codes.Code) ErrorKind {
+	switch code {
+	case codes.ResourceExhausted:
+		return ErrorRateLimit
+	case codes.Unavailable, codes.Internal, codes.Aborted:
+		return ErrorOverloaded
+	case codes.DeadlineExceeded:
+		return ErrorTimeout
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return ErrorAuth
+	case codes.InvalidArgument, codes.NotFound, codes.FailedPrecondition, codes.OutOfRange:
+		return ErrorInvalidRequest
+	default:
+		return ErrorUnknown
+	}
+}
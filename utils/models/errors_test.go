@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewHTTPErrorClassification(t *testing.T) {
+	tests := []struct {
+		status    int
+		kind      ErrorKind
+		sentinel  error
+		retryable bool
+	}{
+		{http.StatusTooManyRequests, ErrorRateLimit, ErrRateLimit, true},
+		{http.StatusInternalServerError, ErrorOverloaded, ErrOverloaded, true},
+		{http.StatusServiceUnavailable, ErrorOverloaded, ErrOverloaded, true},
+		{529, ErrorOverloaded, ErrOverloaded, true},
+		{http.StatusGatewayTimeout, ErrorTimeout, ErrTimeout, true},
+		{http.StatusUnauthorized, ErrorAuth, ErrAuth, false},
+		{http.StatusForbidden, ErrorAuth, ErrAuth, false},
+		{http.StatusBadRequest, ErrorInvalidRequest, ErrInvalidRequest, false},
+		{http.StatusNotFound, ErrorInvalidRequest, ErrInvalidRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("status %d", tt.status), func(t *testing.T) {
+			err := fmt.Errorf("wrapped: %w", newHTTPError("anthropic", tt.status, nil, "body"))
+			if got := ErrorKindOf(err); got != tt.kind {
+				t.Errorf("ErrorKindOf() = %v, want %v", got, tt.kind)
+			}
+			if !errors.Is(err, tt.sentinel) {
+				t.Errorf("expected errors.Is(err, %v)", tt.sentinel)
+			}
+			if IsRetryable(err) != tt.retryable {
+				t.Errorf("IsRetryable() = %v, want %v", IsRetryable(err), tt.retryable)
+			}
+		})
+	}
+}
+
+func TestNewHTTPErrorRetryAfter(t *testing.T) {
+	header := http.Header{}
+	header.Set("Retry-After", "7")
+	err := newHTTPError("openai", http.StatusTooManyRequests, header, "slow down")
+	if RetryAfterOf(err) != 7*time.Second {
+		t.Errorf("RetryAfterOf() = %v, want 7s", RetryAfterOf(err))
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestWrapRequestError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		kind ErrorKind
+	}{
+		{"openai API error", &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests, Message: "rate limit"}, ErrorRateLimit},
+		{"openai request error", &openai.RequestError{HTTPStatusCode: http.StatusBadGateway, Err: errors.New("bad gateway")}, ErrorOverloaded},
+		{"deadline exceeded", fmt.Errorf("call: %w", context.DeadlineExceeded), ErrorTimeout},
+		{"network timeout", timeoutError{}, ErrorTimeout},
+		{"gRPC resource exhausted", status.Error(codes.ResourceExhausted, "quota"), ErrorRateLimit},
+		{"gRPC unauthenticated", status.Error(codes.Unauthenticated, "bad key"), ErrorAuth},
+		{"unclassified", errors.New("something odd"), ErrorUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := wrapRequestError("openai", tt.err)
+			var providerErr *ProviderError
+			if !errors.As(err, &providerErr) {
+				t.Fatalf("expected a *ProviderError, got %T", err)
+			}
+			if providerErr.Kind != tt.kind {
+				t.Errorf("Kind = %v, want %v", providerErr.Kind, tt.kind)
+			}
+			if providerErr.Provider != "openai" {
+				t.Errorf("Provider = %q, want %q", providerErr.Provider, "openai")
+			}
+		})
+	}
+}
+
+func TestParseErrorKind(t *testing.T) {
+	for k := ErrorUnknown; k <= ErrorInvalidRequest; k++ {
+		parsed, err := ParseErrorKind(k.String())
+		if err != nil || parsed != k {
+			t.Errorf("ParseErrorKind(%q) = %v, %v", k.String(), parsed, err)
+		}
+	}
+	if _, err := ParseErrorKind("nope"); err == nil {
+		t.Error("expected error for unknown kind")
+	}
+}
+
+func TestWrapRequestErrorCancelled(t *testing.T) {
+	err := wrapRequestError("openai", fmt.Errorf("call: %w", context.Canceled))
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		t.Fatalf("expected cancellation to pass through unclassified, got %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected error to wrap context.Canceled, got %v", err)
+	}
+}
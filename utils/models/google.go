@@ -2,11 +2,13 @@ package models
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 
 	"github.com/google/generative-ai-go/genai"
 	"github.com/kris-hansen/comanda/utils/fileutil"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
@@ -55,6 +57,8 @@ func (g *GoogleProvider) ValidateModel(modelName string) bool {
 		"gemini-2.5-pro-preview-03-25", // Added new model
 		"gemini-2.5-pro-preview-05-06", // Added new model
 		"gemini-embedding-exp",
+		"gemini-embedding-001",
+		"text-embedding-004",
 
 		// Existing models not explicitly in user list but kept for compatibility/completeness
 		"gemini-1.0-pro",
@@ -96,7 +100,7 @@ func (g *GoogleProvider) Configure(apiKey string) error {
 }
 
 // SendPrompt sends a prompt to the specified model and returns the response
-func (g *GoogleProvider) SendPrompt(modelName string, prompt string) (string, error) {
+func (g *GoogleProvider) SendPrompt(ctx context.Context, modelName string, prompt string) (string, error) {
 	g.debugf("Preparing to send prompt to model: %s", modelName)
 	g.debugf("Prompt length: %d characters", len(prompt))
 
@@ -112,7 +116,6 @@ func (g *GoogleProvider) SendPrompt(modelName string, prompt string) (string, er
 	g.debugf("Using configuration: Temperature=%.2f, MaxTokens=%d, TopP=%.2f",
 		g.config.Temperature, g.config.MaxTokens, g.config.TopP)
 
-	ctx := context.Background()
 	client, err := genai.NewClient(ctx, option.WithAPIKey(g.apiKey))
 	if err != nil {
 		return "", fmt.Errorf("failed to create Google AI client: %v", err)
@@ -120,17 +123,16 @@ func (g *GoogleProvider) SendPrompt(modelName string, prompt string) (string, er
 	defer client.Close()
 
 	// Initialize the model
-	model := client.GenerativeModel(modelName)
-	model.SetTemperature(float32(g.config.Temperature))
-	model.SetTopP(float32(g.config.TopP))
-	model.SetMaxOutputTokens(int32(g.config.MaxTokens))
+	model := g.configureModel(ctx, client, modelName)
 
 	// Generate content
 	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
 	if err != nil {
-		return "", fmt.Errorf("Google AI API error: %v", err)
+		return "", wrapRequestError(g.Name(), err)
 	}
 
+	reportGeminiUsage(ctx, modelName, resp.UsageMetadata)
+
 	if len(resp.Candidates) == 0 {
 		return "", fmt.Errorf("no response candidates returned from Google AI")
 	}
@@ -148,8 +150,58 @@ func (g *GoogleProvider) SendPrompt(modelName string, prompt string) (string, er
 	return response, nil
 }
 
+// SendPromptStream sends a prompt to the specified model and streams the response
+func (g *GoogleProvider) SendPromptStream(ctx context.Context, modelName string, prompt string, onDelta func(delta string)) (string, error) {
+	if g.apiKey == "" {
+		return "", fmt.Errorf("Google provider not configured: missing API key")
+	}
+
+	if !g.ValidateModel(modelName) {
+		return "", fmt.Errorf("invalid Google model: %s", modelName)
+	}
+
+	g.debugf("Streaming prompt to model: %s", modelName)
+	client, err := genai.NewClient(ctx, option.WithAPIKey(g.apiKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to create Google AI client: %v", err)
+	}
+	defer client.Close()
+
+	model := g.configureModel(ctx, client, modelName)
+	iter := model.GenerateContentStream(ctx, genai.Text(prompt))
+
+	var response strings.Builder
+	var usage *genai.UsageMetadata
+	for {
+		resp, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return "", wrapRequestError(g.Name(), err)
+		}
+		// Each chunk reports the usage so far
+		if resp.UsageMetadata != nil {
+			usage = resp.UsageMetadata
+		}
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			continue
+		}
+		for _, part := range resp.Candidates[0].Content.Parts {
+			if text, ok := part.(genai.Text); ok && text != "" {
+				response.WriteString(string(text))
+				onDelta(string(text))
+			}
+		}
+	}
+	reportGeminiUsage(ctx, modelName, usage)
+
+	g.debugf("Stream completed, response length: %d characters", response.Len())
+	return response.String(), nil
+}
+
 // SendPromptWithFile sends a prompt along with a file to the specified model and returns the response
-func (g *GoogleProvider) SendPromptWithFile(modelName string, prompt string, file FileInput) (string, error) {
+func (g *GoogleProvider) SendPromptWithFile(ctx context.Context, modelName string, prompt string, file FileInput) (string, error) {
 	g.debugf("Preparing to send prompt with file to model: %s", modelName)
 	g.debugf("File path: %s", file.Path)
 
@@ -161,7 +213,6 @@ func (g *GoogleProvider) SendPromptWithFile(modelName string, prompt string, fil
 		return "", fmt.Errorf("invalid Google model: %s", modelName)
 	}
 
-	ctx := context.Background()
 	client, err := genai.NewClient(ctx, option.WithAPIKey(g.apiKey))
 	if err != nil {
 		return "", fmt.Errorf("failed to create Google AI client: %v", err)
@@ -175,10 +226,7 @@ func (g *GoogleProvider) SendPromptWithFile(modelName string, prompt string, fil
 	}
 
 	// Initialize the model
-	model := client.GenerativeModel(modelName)
-	model.SetTemperature(float32(g.config.Temperature))
-	model.SetTopP(float32(g.config.TopP))
-	model.SetMaxOutputTokens(int32(g.config.MaxTokens))
+	model := g.configureModel(ctx, client, modelName)
 
 	// Generate content with file
 	resp, err := model.GenerateContent(ctx,
@@ -192,9 +240,11 @@ func (g *GoogleProvider) SendPromptWithFile(modelName string, prompt string, fil
 		if strings.Contains(err.Error(), "invalid UTF-8") {
 			return "", fmt.Errorf("encoding error in file %s: invalid UTF-8 characters detected", file.Path)
 		}
-		return "", fmt.Errorf("Google AI API error: %v", err)
+		return "", wrapRequestError(g.Name(), err)
 	}
 
+	reportGeminiUsage(ctx, modelName, resp.UsageMetadata)
+
 	if len(resp.Candidates) == 0 {
 		return "", fmt.Errorf("no response candidates returned from Google AI")
 	}
@@ -212,11 +262,242 @@ func (g *GoogleProvider) SendPromptWithFile(modelName string, prompt string, fil
 	return response, nil
 }
 
+// SendMessages sends a conversation to the specified model and returns the response
+func (g *GoogleProvider) SendMessages(ctx context.Context, modelName string, messages []Message) (string, error) {
+	reply, err := g.SendMessagesWithTools(ctx, modelName, messages, nil)
+	return reply.Content, err
+}
+
+// SendMessagesWithTools sends a conversation with the tools the model may call and returns its
+// reply. System messages are sent as the model's system instruction. Gemini does not identify
+// function calls, so the calls in the reply use the function name as their ID.
+func (g *GoogleProvider) SendMessagesWithTools(ctx context.Context, modelName string, messages []Message, tools []Tool) (Message, error) {
+	g.debugf("Preparing to send %d messages to model: %s", len(messages), modelName)
+
+	if g.apiKey == "" {
+		return Message{}, fmt.Errorf("Google provider not configured: missing API key")
+	}
+
+	if !g.ValidateModel(modelName) {
+		return Message{}, fmt.Errorf("invalid Google model: %s", modelName)
+	}
+
+	if err := validateMessages(messages); err != nil {
+		return Message{}, err
+	}
+
+	client, err := genai.NewClient(ctx, option.WithAPIKey(g.apiKey))
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to create Google AI client: %v", err)
+	}
+	defer client.Close()
+
+	model := g.configureModel(ctx, client, modelName)
+	system, turns := splitSystem(messages)
+	if system != "" {
+		model.SystemInstruction = genai.NewUserContent(genai.Text(system))
+	}
+	if len(tools) > 0 {
+		declarations := make([]*genai.FunctionDeclaration, len(tools))
+		for i, tool := range tools {
+			declarations[i] = &genai.FunctionDeclaration{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  geminiSchema(toolParameters(tool)),
+			}
+		}
+		model.Tools = []*genai.Tool{{FunctionDeclarations: declarations}}
+	}
+
+	// The last content is the user turn, or the function responses, to send
+	contents, err := geminiContents(turns)
+	if err != nil {
+		return Message{}, err
+	}
+	session := model.StartChat()
+	session.History = contents[:len(contents)-1]
+
+	resp, err := session.SendMessage(ctx, contents[len(contents)-1].Parts...)
+	if err != nil {
+		return Message{}, wrapRequestError(g.Name(), err)
+	}
+
+	reportGeminiUsage(ctx, modelName, resp.UsageMetadata)
+
+	if len(resp.Candidates) == 0 {
+		return Message{}, fmt.Errorf("no response candidates returned from Google AI")
+	}
+
+	reply := Message{Role: RoleAssistant}
+	if resp.Candidates[0].Content != nil {
+		for _, part := range resp.Candidates[0].Content.Parts {
+			switch part := part.(type) {
+			case genai.Text:
+				reply.Content += string(part)
+			case genai.FunctionCall:
+				arguments, err := json.Marshal(part.Args)
+				if err != nil {
+					return Message{}, fmt.Errorf("failed to encode arguments of function call %s: %v", part.Name, err)
+				}
+				reply.ToolCalls = append(reply.ToolCalls, ToolCall{ID: part.Name, Name: part.Name, Arguments: string(arguments)})
+			}
+		}
+	}
+
+	g.debugf("API call completed, response length: %d characters, tool calls: %d", len(reply.Content), len(reply.ToolCalls))
+
+	return reply, nil
+}
+
+// geminiContents converts the turns of a conversation. Gemini calls the assistant "model";
+// tool results are sent as function responses, and consecutive turns of the same role are merged.
+func geminiContents(turns []Message) ([]*genai.Content, error) {
+	names := toolCallNames(turns)
+	var contents []*genai.Content
+	for _, msg := range turns {
+		role := "user"
+		var parts []genai.Part
+		switch msg.Role {
+		case RoleAssistant:
+			role = "model"
+			if msg.Content != "" {
+				parts = append(parts, genai.Text(msg.Content))
+			}
+			for _, call := range msg.ToolCalls {
+				var args map[string]any
+				if err := json.Unmarshal(toolArguments(call), &args); err != nil {
+					return nil, fmt.Errorf("invalid arguments for function call %s: %v", call.Name, err)
+				}
+				parts = append(parts, genai.FunctionCall{Name: call.Name, Args: args})
+			}
+		case RoleTool:
+			name := names[msg.ToolCallID]
+			if name == "" {
+				name = msg.ToolCallID
+			}
+			parts = append(parts, genai.FunctionResponse{Name: name, Response: map[string]any{"result": msg.Content}})
+		default:
+			parts = append(parts, genai.Text(msg.Content))
+		}
+
+		if last := len(contents) - 1; last >= 0 && contents[last].Role == role {
+			contents[last].Parts = append(contents[last].Parts, parts...)
+			continue
+		}
+		contents = append(contents, &genai.Content{Role: role, Parts: parts})
+	}
+	return contents, nil
+}
+
+// geminiSchema converts a JSON Schema to the OpenAPI subset that Gemini function declarations accept
+func geminiSchema(schema map[string]interface{}) *genai.Schema {
+	converted := &genai.Schema{}
+	switch t := schema["type"].(type) {
+	case string:
+		converted.Type = geminiType(t)
+	case []interface{}:
+		// A list of types such as ["string", "null"] becomes a nullable type
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				if name == "null" {
+					converted.Nullable = true
+				} else if converted.Type == genai.TypeUnspecified {
+					converted.Type = geminiType(name)
+				}
+			}
+		}
+	}
+	converted.Description, _ = schema["description"].(string)
+	converted.Format, _ = schema["format"].(string)
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		for _, value := range enum {
+			converted.Enum = append(converted.Enum, fmt.Sprint(value))
+		}
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		converted.Items = geminiSchema(items)
+	}
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		converted.Properties = make(map[string]*genai.Schema, len(properties))
+		for name, property := range properties {
+			if property, ok := property.(map[string]interface{}); ok {
+				converted.Properties[name] = geminiSchema(property)
+			}
+		}
+	}
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				converted.Required = append(converted.Required, name)
+			}
+		}
+	}
+	return converted
+}
+
+// geminiType converts a JSON Schema type name
+func geminiType(name string) genai.Type {
+	switch name {
+	case "string":
+		return genai.TypeString
+	case "number":
+		return genai.TypeNumber
+	case "integer":
+		return genai.TypeInteger
+	case "boolean":
+		return genai.TypeBoolean
+	case "array":
+		return genai.TypeArray
+	case "object":
+		return genai.TypeObject
+	}
+	return genai.TypeUnspecified
+}
+
 // SetVerbose enables or disables verbose mode
 func (g *GoogleProvider) SetVerbose(verbose bool) {
 	g.verbose = verbose
 }
 
+// Embed returns the embeddings of texts from an embedding model such as text-embedding-004.
+// The Gemini API does not report the tokens used for embeddings.
+func (g *GoogleProvider) Embed(ctx context.Context, modelName string, texts []string) ([][]float32, error) {
+	if g.apiKey == "" {
+		return nil, fmt.Errorf("Google provider not configured: missing API key")
+	}
+
+	if !g.ValidateModel(modelName) {
+		return nil, fmt.Errorf("invalid Google model: %s", modelName)
+	}
+
+	client, err := genai.NewClient(ctx, option.WithAPIKey(g.apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google AI client: %v", err)
+	}
+	defer client.Close()
+
+	g.debugf("Embedding %d texts with model: %s", len(texts), modelName)
+	model := client.EmbeddingModel(modelName)
+	return embedInBatches(texts, func(texts []string) ([][]float32, error) {
+		batch := model.NewBatch()
+		for _, text := range texts {
+			batch.AddContent(genai.Text(text))
+		}
+		resp, err := model.BatchEmbedContents(ctx, batch)
+		if err != nil {
+			return nil, wrapRequestError(g.Name(), err)
+		}
+		if len(resp.Embeddings) != len(texts) {
+			return nil, fmt.Errorf("google returned %d embeddings for %d texts", len(resp.Embeddings), len(texts))
+		}
+		embeddings := make([][]float32, len(texts))
+		for i, embedding := range resp.Embeddings {
+			embeddings[i] = embedding.Values
+		}
+		return embeddings, nil
+	})
+}
+
 // ListModels returns the list of available Google models
 func (g *GoogleProvider) ListModels() ([]string, error) {
 	return ListModelsForProvider(g.Name(), g.apiKey)
@@ -231,8 +512,49 @@ func init() {
 			Description:   "Google Gemini models (gemini-pro, gemini-1.5-pro, gemini-2.0-flash, etc.)",
 			Version:       "1.0.0",
 			ModelPrefixes: []string{"gemini-"},
+			ModelNames:    []string{"text-embedding-004"},
 			Priority:      80, // High priority for Gemini models
+			CharsPerToken: 4,
+			ModelLimits: []ModelLimits{
+				{Prefix: "gemini-1.0-pro", ContextWindow: 32760, MaxOutputTokens: 8192},
+				{Prefix: "gemini-1.5-flash", ContextWindow: 1048576, MaxOutputTokens: 8192},
+				{Prefix: "gemini-1.5-pro", ContextWindow: 2097152, MaxOutputTokens: 8192},
+				{Prefix: "gemini-2.0-flash", ContextWindow: 1048576, MaxOutputTokens: 8192},
+				{Prefix: "gemini-2.0-pro", ContextWindow: 2097152, MaxOutputTokens: 8192},
+				{Prefix: "gemini-2.5", ContextWindow: 1048576, MaxOutputTokens: 65536},
+			},
 		},
 	)
 	RegisterProvider("google", factory)
 }
+
+// configureModel returns the model with the provider's configuration and the request options
+// carried by ctx. The Gemini client has no seed parameter.
+func (g *GoogleProvider) configureModel(ctx context.Context, client *genai.Client, modelName string) *genai.GenerativeModel {
+	opts := RequestOptionsFromContext(ctx)
+	cfg := opts.modelConfig(g.config)
+	model := client.GenerativeModel(modelName)
+	model.SetTemperature(float32(cfg.Temperature))
+	model.SetTopP(float32(cfg.TopP))
+	model.SetMaxOutputTokens(int32(cfg.MaxTokens))
+	model.StopSequences = cfg.Stop
+	if cfg.System != "" {
+		model.SystemInstruction = genai.NewUserContent(genai.Text(cfg.System))
+	}
+	if opts.JSON {
+		model.ResponseMIMEType = "application/json"
+	}
+	return model
+}
+
+// reportGeminiUsage reports the usage metadata of a Gemini response
+func reportGeminiUsage(ctx context.Context, modelName string, metadata *genai.UsageMetadata) {
+	if metadata == nil {
+		return
+	}
+	ReportUsage(ctx, modelName, Usage{
+		InputTokens:  int(metadata.PromptTokenCount),
+		OutputTokens: int(metadata.CandidatesTokenCount),
+		CachedTokens: int(metadata.CachedContentTokenCount),
+	})
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Roles of the messages in a conversation
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool" // The result of a tool call
+)
+
+// Message is one turn of a conversation sent with SendMessages
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // Tools the assistant asked to call
+	ToolCallID string     `json:"tool_call_id,omitempty"` // Call that a tool message answers
+}
+
+// validateMessages checks that a conversation uses known roles and ends with a user turn or
+// with tool results
+func validateMessages(messages []Message) error {
+	if len(messages) == 0 {
+		return fmt.Errorf("no messages to send")
+	}
+	for _, msg := range messages {
+		switch msg.Role {
+		case RoleSystem, RoleUser, RoleAssistant, RoleTool:
+		default:
+			return fmt.Errorf("unknown message role: %q", msg.Role)
+		}
+	}
+	if last := messages[len(messages)-1].Role; last != RoleUser && last != RoleTool {
+		return fmt.Errorf("the last message must be a user message or a tool result")
+	}
+	return nil
+}
+
+// splitSystem returns the content of the system messages, joined by blank lines, and the
+// remaining messages, for APIs that take the system prompt apart from the conversation
+func splitSystem(messages []Message) (string, []Message) {
+	var system []string
+	var rest []Message
+	for _, msg := range messages {
+		if msg.Role == RoleSystem {
+			system = append(system, msg.Content)
+			continue
+		}
+		rest = append(rest, msg)
+	}
+	return strings.Join(system, "\n\n"), rest
+}
+
+// MessagesText returns the content of messages joined by newlines, for estimating their size
+func MessagesText(messages []Message) string {
+	contents := make([]string, len(messages))
+	for i, msg := range messages {
+		contents[i] = msg.Content
+	}
+	return strings.Join(contents, "\n")
+}
+
+// chatMessages converts messages for an OpenAI-compatible chat completion request
+func chatMessages(messages []Message) []openai.ChatCompletionMessage {
+	converted := make([]openai.ChatCompletionMessage, len(messages))
+	for i, msg := range messages {
+		converted[i] = openai.ChatCompletionMessage{Role: msg.Role, Content: msg.Content, ToolCallID: msg.ToolCallID}
+		for _, call := range msg.ToolCalls {
+			converted[i].ToolCalls = append(converted[i].ToolCalls, openai.ToolCall{
+				ID:       call.ID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: call.Name, Arguments: call.Arguments},
+			})
+		}
+	}
+	return converted
+}
+
+// chatReply converts the message of an OpenAI-compatible chat completion choice
+func chatReply(msg openai.ChatCompletionMessage) Message {
+	reply := Message{Role: RoleAssistant, Content: msg.Content}
+	for _, call := range msg.ToolCalls {
+		reply.ToolCalls = append(reply.ToolCalls, ToolCall{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+	}
+	return reply
+}
+
+// toolCallNames maps the IDs of the tool calls in messages to the names of their tools, for
+// APIs that identify tool results by name
+func toolCallNames(messages []Message) map[string]string {
+	names := make(map[string]string)
+	for _, msg := range messages {
+		for _, call := range msg.ToolCalls {
+			names[call.ID] = call.Name
+		}
+	}
+	return names
+}
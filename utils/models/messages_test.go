@@ -0,0 +1,55 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestValidateMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []Message
+		wantErr  bool
+	}{
+		{"single user turn", []Message{{Role: RoleUser, Content: "hi"}}, false},
+		{"full history", []Message{{Role: RoleSystem, Content: "s"}, {Role: RoleUser, Content: "a"}, {Role: RoleAssistant, Content: "b"}, {Role: RoleUser, Content: "c"}}, false},
+		{"empty", nil, true},
+		{"ends with the assistant", []Message{{Role: RoleUser, Content: "a"}, {Role: RoleAssistant, Content: "b"}}, true},
+		{"ends with a tool result", []Message{{Role: RoleUser, Content: "a"}, {Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "1", Name: "f"}}}, {Role: RoleTool, ToolCallID: "1", Content: "b"}}, false},
+		{"unknown role", []Message{{Role: "function", Content: "a"}, {Role: RoleUser, Content: "b"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateMessages(tt.messages); (err != nil) != tt.wantErr {
+				t.Errorf("validateMessages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSplitSystem(t *testing.T) {
+	system, rest := splitSystem([]Message{
+		{Role: RoleSystem, Content: "one"},
+		{Role: RoleUser, Content: "question"},
+		{Role: RoleSystem, Content: "two"},
+	})
+	if system != "one\n\ntwo" {
+		t.Errorf("system = %q", system)
+	}
+	if want := []Message{{Role: RoleUser, Content: "question"}}; !reflect.DeepEqual(rest, want) {
+		t.Errorf("rest = %+v", rest)
+	}
+}
+
+func TestWithSystemMessageKeepsConversationSystem(t *testing.T) {
+	messages := chatMessages([]Message{{Role: RoleSystem, Content: "history"}, {Role: RoleUser, Content: "hi"}})
+	if got := withSystemMessage("step", messages); len(got) != 2 || got[0].Content != "history" {
+		t.Errorf("withSystemMessage() = %+v", got)
+	}
+	got := withSystemMessage("step", chatMessages([]Message{{Role: RoleUser, Content: "hi"}}))
+	if len(got) != 2 || got[0].Role != openai.ChatMessageRoleSystem || got[0].Content != "step" {
+		t.Errorf("withSystemMessage() = %+v", got)
+	}
+}
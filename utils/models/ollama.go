@@ -2,37 +2,107 @@ package models
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/discovery"
 	"github.com/kris-hansen/comanda/utils/fileutil"
+	openai "github.com/sashabaranov/go-openai"
 )
 
 // OllamaProvider handles Ollama family of models
 type OllamaProvider struct {
 	verbose bool
+	hosts   []*ollamaHost
+	routing string
+	next    atomic.Uint64 // Round-robin counter
+	mu      sync.Mutex    // Guards the model lists of the hosts
+}
+
+// ollamaHost is an Ollama server the provider sends requests to
+type ollamaHost struct {
+	config.Host
+	inFlight atomic.Int64    // Requests being handled, for least_loaded routing
+	models   map[string]bool // Models the server has, nil until listed
 }
 
 // OllamaRequest represents the request structure for Ollama API
 type OllamaRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
-	Stream bool   `json:"stream"`
+	Model   string                 `json:"model"`
+	Prompt  string                 `json:"prompt"`
+	System  string                 `json:"system,omitempty"`
+	Stream  bool                   `json:"stream"`
+	Format  json.RawMessage        `json:"format,omitempty"`  // "json" or a JSON Schema for structured output
+	Options map[string]interface{} `json:"options,omitempty"` // Model parameters such as temperature
 }
 
 // OllamaResponse represents the response structure from Ollama API
 type OllamaResponse struct {
-	Response string `json:"response"`
-	Done     bool   `json:"done"`
+	Response        string `json:"response"`
+	Done            bool   `json:"done"`
+	PromptEvalCount int    `json:"prompt_eval_count"` // Prompt tokens, reported with the final chunk
+	EvalCount       int    `json:"eval_count"`        // Response tokens, reported with the final chunk
+}
+
+// OllamaChatRequest represents the request structure for the Ollama chat API
+type OllamaChatRequest struct {
+	Model    string                 `json:"model"`
+	Messages []OllamaMessage        `json:"messages"`
+	Tools    []openai.Tool          `json:"tools,omitempty"` // Same format as OpenAI function tools
+	Stream   bool                   `json:"stream"`
+	Format   json.RawMessage        `json:"format,omitempty"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+}
+
+// OllamaMessage represents a message of the Ollama chat API
+type OllamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"` // Tool whose result a tool message holds
+}
+
+// OllamaToolCall represents a tool call of the Ollama chat API, whose arguments are an object
+type OllamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// OllamaChatResponse represents the response structure from the Ollama chat API
+type OllamaChatResponse struct {
+	Message         OllamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+// OllamaEmbedRequest represents the request structure for the Ollama embed API
+type OllamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// OllamaEmbedResponse represents the response structure from the Ollama embed API
+type OllamaEmbedResponse struct {
+	Embeddings      [][]float32 `json:"embeddings"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
 }
 
 // NewOllamaProvider creates a new Ollama provider instance
 func NewOllamaProvider() *OllamaProvider {
-	return &OllamaProvider{}
+	return &OllamaProvider{
+		hosts: []*ollamaHost{{Host: config.Host{Name: "default", BaseURL: config.DefaultOllamaURL}}},
+	}
 }
 
 // Name returns the provider name
@@ -78,41 +148,179 @@ func (o *OllamaProvider) Configure(apiKey string) error {
 	return nil
 }
 
-// SendPrompt sends a prompt to the specified model and returns the response
-func (o *OllamaProvider) SendPrompt(modelName string, prompt string) (string, error) {
-	o.debugf("Preparing to send prompt to model: %s", modelName)
-	o.debugf("Prompt length: %d characters", len(prompt))
+// SetHosts sets the Ollama servers requests are sent to and how they are spread across them:
+// round_robin (the default) takes turns, and least_loaded picks the server with the fewest
+// requests in flight from this provider. When there are several servers, a model's requests
+// only go to the servers that have it.
+func (o *OllamaProvider) SetHosts(hosts []config.Host, routing string) error {
+	if len(hosts) == 0 {
+		return fmt.Errorf("at least one Ollama host is required")
+	}
+	if routing != "" && routing != config.RoundRobin && routing != config.LeastLoaded {
+		return fmt.Errorf("unknown Ollama routing '%s'", routing)
+	}
+	o.hosts = make([]*ollamaHost, len(hosts))
+	for i, host := range hosts {
+		o.hosts[i] = &ollamaHost{Host: host}
+	}
+	o.routing = routing
+	return nil
+}
+
+// hostsFor returns the hosts that have a model. The models of hosts not yet listed are listed
+// in parallel without holding the lock, and a host that cannot be listed is tried again on the
+// next request. If no host is known to have the model, all hosts are returned and the
+// request's error will tell.
+func (o *OllamaProvider) hostsFor(modelName string) []*ollamaHost {
+	if len(o.hosts) == 1 {
+		return o.hosts
+	}
+
+	o.mu.Lock()
+	var unlisted []*ollamaHost
+	for _, host := range o.hosts {
+		if host.models == nil {
+			unlisted = append(unlisted, host)
+		}
+	}
+	o.mu.Unlock()
 
-	reqBody := OllamaRequest{
-		Model:  modelName,
-		Prompt: prompt,
-		Stream: false,
+	listed := make([]map[string]bool, len(unlisted))
+	var wg sync.WaitGroup
+	for i, host := range unlisted {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			models, err := discovery.GetOllamaHostModels(host.Host)
+			if err != nil {
+				o.debugf("Could not list the models of host %s: %v", host.Name, err)
+				return
+			}
+			listed[i] = make(map[string]bool, len(models))
+			for _, model := range models {
+				listed[i][strings.ToLower(model.Name)] = true
+			}
+		}()
 	}
+	wg.Wait()
 
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, host := range unlisted {
+		if listed[i] != nil && host.models == nil {
+			host.models = listed[i]
+		}
+	}
+	var candidates []*ollamaHost
+	for _, host := range o.hosts {
+		if host.models[strings.ToLower(modelName)] {
+			candidates = append(candidates, host)
+		}
+	}
+	if len(candidates) == 0 {
+		return o.hosts
+	}
+	return candidates
+}
+
+// pickHost chooses the host for a request to a model
+func (o *OllamaProvider) pickHost(modelName string) *ollamaHost {
+	candidates := o.hostsFor(modelName)
+	start := int((o.next.Add(1) - 1) % uint64(len(candidates)))
+	if o.routing != config.LeastLoaded {
+		return candidates[start]
+	}
+
+	// Start from the round-robin position so that ties take turns
+	best := candidates[start]
+	for i := 1; i < len(candidates); i++ {
+		host := candidates[(start+i)%len(candidates)]
+		if host.inFlight.Load() < best.inFlight.Load() {
+			best = host
+		}
+	}
+	return best
+}
+
+// post sends a request to an API path of the host chosen for the model. On success the
+// caller must call done once it has read the response.
+func (o *OllamaProvider) post(ctx context.Context, modelName string, path string, reqBody interface{}) (resp *http.Response, done func(), err error) {
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("error marshaling request: %v", err)
+		return nil, nil, fmt.Errorf("error marshaling request: %v", err)
+	}
+
+	host := o.pickHost(modelName)
+	o.debugf("Sending request to Ollama host %s (%s): %s", host.Name, host.BaseURL, string(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", host.BaseURL+path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range host.Headers {
+		req.Header.Set(k, v)
 	}
 
-	o.debugf("Sending request to Ollama API: %s", string(jsonData))
+	host.inFlight.Add(1)
 	client := &http.Client{Timeout: 30 * time.Second} // Add a 30-second timeout
-	resp, err := client.Post("http://localhost:11434/api/generate", "application/json", bytes.NewBuffer(jsonData))
+	resp, err = client.Do(req)
 	if err != nil {
+		host.inFlight.Add(-1)
 		o.debugf("Error calling Ollama API: %v", err)
-		return "", fmt.Errorf("error calling Ollama API: %v (is Ollama running?)", err)
+		return nil, nil, wrapRequestError(o.Name(), fmt.Errorf("%w (is Ollama running at %s?)", err, host.BaseURL))
+	}
+	done = func() {
+		resp.Body.Close()
+		host.inFlight.Add(-1)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
+		done()
 		o.debugf("Ollama API returned non-200 status: %d, body: %s", resp.StatusCode, string(bodyBytes))
-		return "", fmt.Errorf("Ollama API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return nil, nil, newHTTPError(o.Name(), resp.StatusCode, resp.Header, string(bodyBytes))
 	}
+	return resp, done, nil
+}
+
+// SendPrompt sends a prompt to the specified model and returns the response
+func (o *OllamaProvider) SendPrompt(ctx context.Context, modelName string, prompt string) (string, error) {
+	o.debugf("Preparing to send prompt to model: %s", modelName)
+	o.debugf("Prompt length: %d characters", len(prompt))
+
+	reqBody := newOllamaRequest(ctx, modelName, prompt)
+
+	resp, done, err := o.post(ctx, modelName, "/api/generate", reqBody)
+	if err != nil {
+		return "", err
+	}
+	defer done()
 	o.debugf("Ollama API request successful, reading response")
 
-	// Read and accumulate all responses
+	return o.readResponses(ctx, modelName, resp.Body, nil)
+}
+
+// SendPromptStream sends a prompt to the specified model and streams the response
+func (o *OllamaProvider) SendPromptStream(ctx context.Context, modelName string, prompt string, onDelta func(delta string)) (string, error) {
+	o.debugf("Streaming prompt to model: %s", modelName)
+
+	reqBody := newOllamaRequest(ctx, modelName, prompt)
+	reqBody.Stream = true
+
+	resp, done, err := o.post(ctx, modelName, "/api/generate", reqBody)
+	if err != nil {
+		return "", err
+	}
+	defer done()
+
+	return o.readResponses(ctx, modelName, resp.Body, onDelta)
+}
+
+// readResponses reads the response chunks of the generate API, passing each to onDelta
+// when it is not nil, and returns the whole response
+func (o *OllamaProvider) readResponses(ctx context.Context, modelName string, body io.Reader, onDelta func(delta string)) (string, error) {
 	var fullResponse strings.Builder
-	decoder := json.NewDecoder(resp.Body)
+	decoder := json.NewDecoder(body)
 	for {
 		var ollamaResp OllamaResponse
 		if err := decoder.Decode(&ollamaResp); err != nil {
@@ -124,7 +332,11 @@ func (o *OllamaProvider) SendPrompt(modelName string, prompt string) (string, er
 		}
 		o.debugf("Received response chunk: done=%v length=%d", ollamaResp.Done, len(ollamaResp.Response))
 		fullResponse.WriteString(ollamaResp.Response)
+		if onDelta != nil && ollamaResp.Response != "" {
+			onDelta(ollamaResp.Response)
+		}
 		if ollamaResp.Done {
+			ReportUsage(ctx, modelName, Usage{InputTokens: ollamaResp.PromptEvalCount, OutputTokens: ollamaResp.EvalCount})
 			break
 		}
 	}
@@ -135,7 +347,7 @@ func (o *OllamaProvider) SendPrompt(modelName string, prompt string) (string, er
 }
 
 // SendPromptWithFile sends a prompt along with a file to the specified model and returns the response
-func (o *OllamaProvider) SendPromptWithFile(modelName string, prompt string, file FileInput) (string, error) {
+func (o *OllamaProvider) SendPromptWithFile(ctx context.Context, modelName string, prompt string, file FileInput) (string, error) {
 	o.debugf("Preparing to send prompt with file to model: %s", modelName)
 	o.debugf("File path: %s", file.Path)
 
@@ -149,49 +361,110 @@ func (o *OllamaProvider) SendPromptWithFile(modelName string, prompt string, fil
 	fileContent := string(fileData)
 	combinedPrompt := fmt.Sprintf("File content:\n%s\n\nUser prompt: %s", fileContent, prompt)
 
-	reqBody := OllamaRequest{
-		Model:  modelName,
-		Prompt: combinedPrompt,
-		Stream: false,
+	reqBody := newOllamaRequest(ctx, modelName, combinedPrompt)
+
+	resp, done, err := o.post(ctx, modelName, "/api/generate", reqBody)
+	if err != nil {
+		return "", err
 	}
+	defer done()
 
-	jsonData, err := json.Marshal(reqBody)
+	return o.readResponses(ctx, modelName, resp.Body, nil)
+}
+
+// SendMessages sends a conversation to the specified model through the chat API and returns the response
+func (o *OllamaProvider) SendMessages(ctx context.Context, modelName string, messages []Message) (string, error) {
+	reply, err := o.SendMessagesWithTools(ctx, modelName, messages, nil)
+	return reply.Content, err
+}
+
+// SendMessagesWithTools sends a conversation with the tools the model may call and returns its
+// reply. Ollama does not identify tool calls, so the calls in the reply use the tool name as their ID.
+func (o *OllamaProvider) SendMessagesWithTools(ctx context.Context, modelName string, messages []Message, tools []Tool) (Message, error) {
+	o.debugf("Preparing to send %d messages to model: %s", len(messages), modelName)
+
+	if err := validateMessages(messages); err != nil {
+		return Message{}, err
+	}
+
+	opts := RequestOptionsFromContext(ctx)
+	if system, _ := splitSystem(messages); system == "" && opts.System != "" {
+		messages = append([]Message{{Role: RoleSystem, Content: opts.System}}, messages...)
+	}
+	reqBody := OllamaChatRequest{
+		Model:    modelName,
+		Messages: ollamaMessages(messages),
+		Tools:    chatTools(tools),
+		Stream:   false,
+		Format:   ollamaFormat(ctx),
+		Options:  ollamaOptions(opts),
+	}
+
+	resp, done, err := o.post(ctx, modelName, "/api/chat", reqBody)
 	if err != nil {
-		return "", fmt.Errorf("error marshaling request: %v", err)
+		return Message{}, err
 	}
+	defer done()
 
-	client := &http.Client{Timeout: 30 * time.Second} // Add a 30-second timeout
-	resp, err := client.Post("http://localhost:11434/api/generate", "application/json", bytes.NewBuffer(jsonData))
+	var chatResp OllamaChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return Message{}, fmt.Errorf("error decoding response: %v", err)
+	}
+	ReportUsage(ctx, modelName, Usage{InputTokens: chatResp.PromptEvalCount, OutputTokens: chatResp.EvalCount})
+
+	reply := Message{Role: RoleAssistant, Content: chatResp.Message.Content}
+	for _, call := range chatResp.Message.ToolCalls {
+		reply.ToolCalls = append(reply.ToolCalls, ToolCall{ID: call.Function.Name, Name: call.Function.Name, Arguments: string(call.Function.Arguments)})
+	}
+	o.debugf("API call completed, response length: %d characters, tool calls: %d", len(reply.Content), len(reply.ToolCalls))
+	return reply, nil
+}
+
+// Embed returns the embeddings of texts from an embedding model such as nomic-embed-text
+func (o *OllamaProvider) Embed(ctx context.Context, modelName string, texts []string) ([][]float32, error) {
+	o.debugf("Embedding %d texts with model: %s", len(texts), modelName)
+	return embedInBatches(texts, func(batch []string) ([][]float32, error) {
+		return o.embedBatch(ctx, modelName, batch)
+	})
+}
+
+// embedBatch sends one embed request for texts
+func (o *OllamaProvider) embedBatch(ctx context.Context, modelName string, texts []string) ([][]float32, error) {
+	resp, done, err := o.post(ctx, modelName, "/api/embed", OllamaEmbedRequest{Model: modelName, Input: texts})
 	if err != nil {
-		return "", fmt.Errorf("error calling Ollama API: %v", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	defer done()
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Ollama API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+	var embedResp OllamaEmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embedResp); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
 	}
+	ReportUsage(ctx, modelName, Usage{InputTokens: embedResp.PromptEvalCount})
 
-	// Read and accumulate all responses
-	var fullResponse strings.Builder
-	decoder := json.NewDecoder(resp.Body)
-	for {
-		var ollamaResp OllamaResponse
-		if err := decoder.Decode(&ollamaResp); err != nil {
-			if err == io.EOF {
-				break
-			}
-			return "", fmt.Errorf("error decoding response: %v", err)
+	if len(embedResp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("ollama returned %d embeddings for %d texts", len(embedResp.Embeddings), len(texts))
+	}
+	return embedResp.Embeddings, nil
+}
+
+// ollamaMessages converts the messages of a conversation for the chat API
+func ollamaMessages(messages []Message) []OllamaMessage {
+	names := toolCallNames(messages)
+	converted := make([]OllamaMessage, len(messages))
+	for i, msg := range messages {
+		converted[i] = OllamaMessage{Role: msg.Role, Content: msg.Content}
+		if msg.Role == RoleTool {
+			converted[i].ToolName = names[msg.ToolCallID]
 		}
-		fullResponse.WriteString(ollamaResp.Response)
-		if ollamaResp.Done {
-			break
+		for _, call := range msg.ToolCalls {
+			var toolCall OllamaToolCall
+			toolCall.Function.Name = call.Name
+			toolCall.Function.Arguments = toolArguments(call)
+			converted[i].ToolCalls = append(converted[i].ToolCalls, toolCall)
 		}
 	}
-
-	result := fullResponse.String()
-	o.debugf("API call completed, response length: %d characters", len(result))
-	return result, nil
+	return converted
 }
 
 // SetVerbose enables or disables verbose mode
@@ -199,9 +472,13 @@ func (o *OllamaProvider) SetVerbose(verbose bool) {
 	o.verbose = verbose
 }
 
-// ListModels returns the list of available Ollama models
+// ListModels returns the models available on any of the provider's Ollama servers
 func (o *OllamaProvider) ListModels() ([]string, error) {
-	return ListModelsForProvider(o.Name(), "") // Ollama doesn't need an API key
+	hosts := make([]config.Host, len(o.hosts))
+	for i, host := range o.hosts {
+		hosts[i] = host.Host
+	}
+	return discovery.GetOllamaHostsModels(hosts)
 }
 
 // Register the Ollama provider on package initialization
@@ -218,3 +495,53 @@ func init() {
 	)
 	RegisterProvider("ollama", factory)
 }
+
+// newOllamaRequest creates a request with the request options carried by ctx. Parameters that
+// are not set are left to the model's own defaults.
+func newOllamaRequest(ctx context.Context, modelName string, prompt string) OllamaRequest {
+	opts := RequestOptionsFromContext(ctx)
+	return OllamaRequest{
+		Model:   modelName,
+		Prompt:  prompt,
+		System:  opts.System,
+		Stream:  false,
+		Format:  ollamaFormat(ctx),
+		Options: ollamaOptions(opts),
+	}
+}
+
+// ollamaOptions returns the model parameters of the request options, or nil if none are set
+func ollamaOptions(opts RequestOptions) map[string]interface{} {
+	options := make(map[string]interface{})
+	if opts.Temperature != nil {
+		options["temperature"] = *opts.Temperature
+	}
+	if opts.MaxTokens != nil {
+		options["num_predict"] = *opts.MaxTokens
+	}
+	if opts.TopP != nil {
+		options["top_p"] = *opts.TopP
+	}
+	if len(opts.Stop) > 0 {
+		options["stop"] = opts.Stop
+	}
+	if opts.Seed != nil {
+		options["seed"] = *opts.Seed
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	return options
+}
+
+// ollamaFormat returns the format field for the request options carried by ctx
+func ollamaFormat(ctx context.Context) json.RawMessage {
+	opts := RequestOptionsFromContext(ctx)
+	if schema := opts.schemaJSON(); schema != nil {
+		return schema
+	}
+	if opts.JSON {
+		return json.RawMessage(`"json"`)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// newOllamaServer starts a fake Ollama server with models, recording the Authorization
+// header of each generate request
+func newOllamaServer(t *testing.T, reply string, models ...string) (*httptest.Server, *[]string) {
+	var mu sync.Mutex
+	var auth []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			var tags struct {
+				Models []map[string]string `json:"models"`
+			}
+			for _, name := range models {
+				tags.Models = append(tags.Models, map[string]string{"name": name})
+			}
+			json.NewEncoder(w).Encode(tags)
+		case "/api/generate":
+			mu.Lock()
+			auth = append(auth, r.Header.Get("Authorization"))
+			mu.Unlock()
+			json.NewEncoder(w).Encode(OllamaResponse{Response: reply, Done: true})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &auth
+}
+
+func TestOllamaRoundRobin(t *testing.T) {
+	gpu, gpuAuth := newOllamaServer(t, "gpu", "llama3")
+	laptop, laptopAuth := newOllamaServer(t, "laptop", "llama3")
+
+	provider := NewOllamaProvider()
+	err := provider.SetHosts([]config.Host{
+		{Name: "gpu", BaseURL: gpu.URL, Headers: map[string]string{"Authorization": "Bearer gpu"}},
+		{Name: "laptop", BaseURL: laptop.URL},
+	}, config.RoundRobin)
+	if err != nil {
+		t.Fatalf("SetHosts() error: %v", err)
+	}
+
+	var replies []string
+	for i := 0; i < 4; i++ {
+		reply, err := provider.SendPrompt(context.Background(), "llama3", "hi")
+		if err != nil {
+			t.Fatalf("SendPrompt() error: %v", err)
+		}
+		replies = append(replies, reply)
+	}
+	if want := []string{"gpu", "laptop", "gpu", "laptop"}; !reflect.DeepEqual(replies, want) {
+		t.Errorf("replies = %v, want %v", replies, want)
+	}
+	if want := []string{"Bearer gpu", "Bearer gpu"}; !reflect.DeepEqual(*gpuAuth, want) {
+		t.Errorf("gpu Authorization headers = %v, want %v", *gpuAuth, want)
+	}
+	if want := []string{"", ""}; !reflect.DeepEqual(*laptopAuth, want) {
+		t.Errorf("laptop Authorization headers = %v, want %v", *laptopAuth, want)
+	}
+}
+
+func TestOllamaRoutesToHostsWithModel(t *testing.T) {
+	gpu, _ := newOllamaServer(t, "gpu", "llama3:70b", "llama3")
+	laptop, _ := newOllamaServer(t, "laptop", "llama3")
+
+	provider := NewOllamaProvider()
+	if err := provider.SetHosts([]config.Host{{Name: "laptop", BaseURL: laptop.URL}, {Name: "gpu", BaseURL: gpu.URL}}, ""); err != nil {
+		t.Fatalf("SetHosts() error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		reply, err := provider.SendPrompt(context.Background(), "llama3:70b", "hi")
+		if err != nil {
+			t.Fatalf("SendPrompt() error: %v", err)
+		}
+		if reply != "gpu" {
+			t.Errorf("request %d went to %s, want gpu", i, reply)
+		}
+	}
+
+	models, err := provider.ListModels()
+	if err != nil {
+		t.Fatalf("ListModels() error: %v", err)
+	}
+	if want := []string{"llama3", "llama3:70b"}; !reflect.DeepEqual(models, want) {
+		t.Errorf("ListModels() = %v, want %v", models, want)
+	}
+}
+
+func TestOllamaRetriesHostsThatFailedListing(t *testing.T) {
+	laptop, _ := newOllamaServer(t, "laptop", "llama3")
+	gpu, _ := newOllamaServer(t, "gpu", "llama3:70b")
+	var down atomic.Bool
+	down.Store(true)
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		gpu.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(flaky.Close)
+
+	provider := NewOllamaProvider()
+	if err := provider.SetHosts([]config.Host{{Name: "laptop", BaseURL: laptop.URL}, {Name: "gpu", BaseURL: flaky.URL}}, ""); err != nil {
+		t.Fatalf("SetHosts() error: %v", err)
+	}
+	if hosts := provider.hostsFor("llama3:70b"); len(hosts) != 2 {
+		t.Errorf("hostsFor() while gpu is down = %d hosts, want all 2", len(hosts))
+	}
+
+	down.Store(false)
+	if hosts := provider.hostsFor("llama3:70b"); len(hosts) != 1 || hosts[0].Name != "gpu" {
+		t.Errorf("hostsFor() after gpu is up = %v, want gpu", hosts)
+	}
+}
+
+func TestOllamaLeastLoaded(t *testing.T) {
+	provider := NewOllamaProvider()
+	hosts := []config.Host{{Name: "a", BaseURL: "http://a"}, {Name: "b", BaseURL: "http://b"}, {Name: "c", BaseURL: "http://c"}}
+	if err := provider.SetHosts(hosts, config.LeastLoaded); err != nil {
+		t.Fatalf("SetHosts() error: %v", err)
+	}
+	// Every host has the model, so that picking a host does not list them
+	for _, host := range provider.hosts {
+		host.models = map[string]bool{"llama3": true}
+	}
+	provider.hosts[0].inFlight.Store(2)
+	provider.hosts[1].inFlight.Store(1)
+	provider.hosts[2].inFlight.Store(1)
+
+	picked := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		picked[provider.pickHost("llama3").Name]++
+	}
+	if picked["a"] != 0 || picked["b"] == 0 || picked["c"] == 0 {
+		t.Errorf("picked hosts = %v, want b and c in turn", picked)
+	}
+}
+
+func TestOllamaSetHostsRejectsUnknownRouting(t *testing.T) {
+	provider := NewOllamaProvider()
+	if err := provider.SetHosts([]config.Host{{Name: "a", BaseURL: "http://a"}}, "random"); err == nil {
+		t.Error("SetHosts() with unknown routing should fail")
+	}
+	if err := provider.SetHosts(nil, ""); err == nil {
+		t.Error("SetHosts() without hosts should fail")
+	}
+}
@@ -54,12 +54,14 @@ func (o *OpenAIProvider) SupportsModel(modelName string) bool {
 
 	// Accept any model name that starts with our known prefixes
 	validPrefixes := []string{
-		"gpt-",    // Standard GPT models
-		"o1",      // To cover o1, o1-pro, o1-mini
-		"o3",      // To cover o3, o3-pro, o3-mini
-		"o4-",     // Support for o4-mini series
-		"gpt-4o",  // Support for gpt-4o variants
-		"gpt-4.1", // To cover gpt-4.1 and potential gpt-4.1-variants
+		"gpt-",                // Standard GPT models
+		"o1",                  // To cover o1, o1-pro, o1-mini
+		"o3",                  // To cover o3, o3-pro, o3-mini
+		"o4-",                 // Support for o4-mini series
+		"gpt-4o",              // Support for gpt-4o variants
+		"gpt-4.1",             // To cover gpt-4.1 and potential gpt-4.1-variants
+		"text-embedding-3-",   // Embedding models
+		"text-embedding-ada-", // Legacy embedding model
 	}
 
 	for _, prefix := range validPrefixes {
@@ -93,34 +95,71 @@ func (o *OpenAIProvider) isNewModelSeries(modelName string) bool {
 		strings.HasPrefix(modelName, "o4-") // Covers o4-mini series
 }
 
+// isReasoningModel checks if the model is a reasoning model (o1, o3, o4), which rejects
+// sampling parameters and stop sequences
+func (o *OpenAIProvider) isReasoningModel(modelName string) bool {
+	modelName = strings.ToLower(modelName)
+	return strings.HasPrefix(modelName, "o1") || strings.HasPrefix(modelName, "o3") || strings.HasPrefix(modelName, "o4-")
+}
+
 // createChatCompletionRequest creates a ChatCompletionRequest with the appropriate parameters
-func (o *OpenAIProvider) createChatCompletionRequest(modelName string, messages []openai.ChatCompletionMessage) openai.ChatCompletionRequest {
+// and the request options carried by ctx
+func (o *OpenAIProvider) createChatCompletionRequest(ctx context.Context, modelName string, messages []openai.ChatCompletionMessage) openai.ChatCompletionRequest {
+	opts := RequestOptionsFromContext(ctx)
+	cfg := opts.modelConfig(o.config)
 	req := openai.ChatCompletionRequest{
 		Model:    modelName,
-		Messages: messages,
+		Messages: withSystemMessage(cfg.System, messages),
+		Seed:     cfg.Seed,
 	}
 
 	if o.isNewModelSeries(modelName) {
 		// New model series (4o and o1) have fixed parameters
-		req.MaxCompletionTokens = o.config.MaxCompletionTokens
+		req.MaxCompletionTokens = cfg.MaxCompletionTokens
 		req.Temperature = 1.0
 		req.TopP = 1.0
 		req.PresencePenalty = 0.0
 		req.FrequencyPenalty = 0.0
 		o.debugf("Using fixed parameters for new model series: Temperature=1.0, TopP=1.0, PresencePenalty=0.0, FrequencyPenalty=0.0")
+
+		// Reasoning models only accept the fixed parameters; gpt-4o takes the ones set for the request
+		if !o.isReasoningModel(modelName) {
+			if opts.Temperature != nil {
+				req.Temperature = chatTemperature(cfg.Temperature)
+			}
+			if opts.TopP != nil {
+				req.TopP = float32(cfg.TopP)
+			}
+			req.Stop = cfg.Stop
+		}
 	} else {
 		// Legacy models use configurable parameters
-		req.MaxTokens = o.config.MaxTokens
-		req.Temperature = float32(o.config.Temperature)
-		req.TopP = float32(o.config.TopP)
-		o.debugf("Using configured parameters for legacy model: Temperature=%.2f, TopP=%.2f", o.config.Temperature, o.config.TopP)
+		req.MaxTokens = cfg.MaxTokens
+		req.Temperature = chatTemperature(cfg.Temperature)
+		req.TopP = float32(cfg.TopP)
+		req.Stop = cfg.Stop
+		o.debugf("Using configured parameters for legacy model: Temperature=%.2f, TopP=%.2f", cfg.Temperature, cfg.TopP)
+	}
+
+	if schema := opts.schemaJSON(); schema != nil {
+		req.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   "output",
+				Schema: schema,
+			},
+		}
+		o.debugf("Requesting JSON output matching the step's schema")
+	} else if opts.JSON {
+		req.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+		o.debugf("Requesting JSON output")
 	}
 
 	return req
 }
 
 // SendPrompt sends a prompt to the specified model and returns the response
-func (o *OpenAIProvider) SendPrompt(modelName string, prompt string) (string, error) {
+func (o *OpenAIProvider) SendPrompt(ctx context.Context, modelName string, prompt string) (string, error) {
 	o.debugf("Preparing to send prompt to model: %s", modelName)
 	o.debugf("Prompt length: %d characters", len(prompt))
 
@@ -138,7 +177,7 @@ func (o *OpenAIProvider) SendPrompt(modelName string, prompt string) (string, er
 
 	// Check if this is a vision input by looking for base64 image data
 	if strings.HasPrefix(modelName, "gpt-4") && strings.Contains(prompt, ";base64,") {
-		return o.handleVisionPrompt(client, prompt, modelName)
+		return o.handleVisionPrompt(ctx, client, prompt, modelName)
 	}
 
 	messages := []openai.ChatCompletionMessage{
@@ -148,12 +187,13 @@ func (o *OpenAIProvider) SendPrompt(modelName string, prompt string) (string, er
 		},
 	}
 
-	req := o.createChatCompletionRequest(modelName, messages)
-	resp, err := client.CreateChatCompletion(context.Background(), req)
+	req := o.createChatCompletionRequest(ctx, modelName, messages)
+	resp, err := client.CreateChatCompletion(ctx, req)
 
 	if err != nil {
-		return "", fmt.Errorf("OpenAI API error: %v", err)
+		return "", wrapRequestError(o.Name(), err)
 	}
+	reportChatUsage(ctx, modelName, resp.Usage)
 
 	if len(resp.Choices) == 0 {
 		return "", fmt.Errorf("no response choices returned from OpenAI")
@@ -165,8 +205,42 @@ func (o *OpenAIProvider) SendPrompt(modelName string, prompt string) (string, er
 	return response, nil
 }
 
+// SendPromptStream sends a prompt to the specified model and streams the response
+func (o *OpenAIProvider) SendPromptStream(ctx context.Context, modelName string, prompt string, onDelta func(delta string)) (string, error) {
+	if o.apiKey == "" {
+		return "", fmt.Errorf("OpenAI provider not configured: missing API key")
+	}
+
+	if !o.SupportsModel(modelName) {
+		return "", fmt.Errorf("invalid OpenAI model: %s", modelName)
+	}
+
+	// Vision prompts are answered whole
+	if strings.HasPrefix(modelName, "gpt-4") && strings.Contains(prompt, ";base64,") {
+		response, err := o.SendPrompt(ctx, modelName, prompt)
+		if err == nil {
+			onDelta(response)
+		}
+		return response, err
+	}
+
+	o.debugf("Streaming prompt to model: %s", modelName)
+	req := o.createChatCompletionRequest(ctx, modelName, []openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleUser,
+			Content: prompt,
+		},
+	})
+	response, err := streamChatCompletion(ctx, openai.NewClient(o.apiKey), o.Name(), modelName, req, onDelta)
+	if err != nil {
+		return "", err
+	}
+	o.debugf("Stream completed, response length: %d characters", len(response))
+	return response, nil
+}
+
 // SendPromptWithFile sends a prompt along with a file to the specified model and returns the response
-func (o *OpenAIProvider) SendPromptWithFile(modelName string, prompt string, file FileInput) (string, error) {
+func (o *OpenAIProvider) SendPromptWithFile(ctx context.Context, modelName string, prompt string, file FileInput) (string, error) {
 	o.debugf("Preparing to send prompt with file to model: %s", modelName)
 	o.debugf("File path: %s", file.Path)
 
@@ -188,7 +262,7 @@ func (o *OpenAIProvider) SendPromptWithFile(modelName string, prompt string, fil
 
 	// For GPT-4 Vision, handle image files
 	if strings.HasPrefix(modelName, "gpt-4") && strings.HasPrefix(file.MimeType, "image/") {
-		return o.handleFileAsVision(client, prompt, fileData, file.MimeType, modelName)
+		return o.handleFileAsVision(ctx, client, prompt, fileData, file.MimeType, modelName)
 	}
 
 	// For other files, include the content as part of the prompt
@@ -202,12 +276,13 @@ func (o *OpenAIProvider) SendPromptWithFile(modelName string, prompt string, fil
 		},
 	}
 
-	req := o.createChatCompletionRequest(modelName, messages)
-	resp, err := client.CreateChatCompletion(context.Background(), req)
+	req := o.createChatCompletionRequest(ctx, modelName, messages)
+	resp, err := client.CreateChatCompletion(ctx, req)
 
 	if err != nil {
-		return "", fmt.Errorf("OpenAI API error: %v", err)
+		return "", wrapRequestError(o.Name(), err)
 	}
+	reportChatUsage(ctx, modelName, resp.Usage)
 
 	if len(resp.Choices) == 0 {
 		return "", fmt.Errorf("no response choices returned from OpenAI")
@@ -219,8 +294,50 @@ func (o *OpenAIProvider) SendPromptWithFile(modelName string, prompt string, fil
 	return response, nil
 }
 
+// SendMessages sends a conversation to the specified model and returns the response
+func (o *OpenAIProvider) SendMessages(ctx context.Context, modelName string, messages []Message) (string, error) {
+	reply, err := o.SendMessagesWithTools(ctx, modelName, messages, nil)
+	return reply.Content, err
+}
+
+// SendMessagesWithTools sends a conversation with the tools the model may call and returns its reply
+func (o *OpenAIProvider) SendMessagesWithTools(ctx context.Context, modelName string, messages []Message, tools []Tool) (Message, error) {
+	o.debugf("Preparing to send %d messages to model: %s", len(messages), modelName)
+
+	if o.apiKey == "" {
+		return Message{}, fmt.Errorf("OpenAI provider not configured: missing API key")
+	}
+
+	if !o.SupportsModel(modelName) {
+		return Message{}, fmt.Errorf("invalid OpenAI model: %s", modelName)
+	}
+
+	if err := validateMessages(messages); err != nil {
+		return Message{}, err
+	}
+
+	client := openai.NewClient(o.apiKey)
+	req := o.createChatCompletionRequest(ctx, modelName, chatMessages(messages))
+	req.Tools = chatTools(tools)
+	resp, err := client.CreateChatCompletion(ctx, req)
+
+	if err != nil {
+		return Message{}, wrapRequestError(o.Name(), err)
+	}
+	reportChatUsage(ctx, modelName, resp.Usage)
+
+	if len(resp.Choices) == 0 {
+		return Message{}, fmt.Errorf("no response choices returned from OpenAI")
+	}
+
+	reply := chatReply(resp.Choices[0].Message)
+	o.debugf("API call completed, response length: %d characters, tool calls: %d", len(reply.Content), len(reply.ToolCalls))
+
+	return reply, nil
+}
+
 // handleFileAsVision processes a file as a vision model request
-func (o *OpenAIProvider) handleFileAsVision(client *openai.Client, prompt string, fileData []byte, mimeType string, modelName string) (string, error) {
+func (o *OpenAIProvider) handleFileAsVision(ctx context.Context, client *openai.Client, prompt string, fileData []byte, mimeType string, modelName string) (string, error) {
 	// Convert file data to base64 string with proper data URI prefix
 	base64Data := fmt.Sprintf("data:%s;base64,%s", mimeType, string(fileData))
 
@@ -245,12 +362,13 @@ func (o *OpenAIProvider) handleFileAsVision(client *openai.Client, prompt string
 		},
 	}
 
-	req := o.createChatCompletionRequest(modelName, messages)
-	resp, err := client.CreateChatCompletion(context.Background(), req)
+	req := o.createChatCompletionRequest(ctx, modelName, messages)
+	resp, err := client.CreateChatCompletion(ctx, req)
 
 	if err != nil {
-		return "", fmt.Errorf("OpenAI Vision API error: %v", err)
+		return "", wrapRequestError(o.Name(), err)
 	}
+	reportChatUsage(ctx, modelName, resp.Usage)
 
 	if len(resp.Choices) == 0 {
 		return "", fmt.Errorf("no response choices returned from OpenAI Vision")
@@ -260,7 +378,7 @@ func (o *OpenAIProvider) handleFileAsVision(client *openai.Client, prompt string
 }
 
 // handleVisionPrompt processes a vision model request with image data
-func (o *OpenAIProvider) handleVisionPrompt(client *openai.Client, prompt string, modelName string) (string, error) {
+func (o *OpenAIProvider) handleVisionPrompt(ctx context.Context, client *openai.Client, prompt string, modelName string) (string, error) {
 	// Split the prompt into text and base64 image data
 	parts := strings.Split(prompt, "Action: ")
 	if len(parts) != 2 {
@@ -305,12 +423,13 @@ func (o *OpenAIProvider) handleVisionPrompt(client *openai.Client, prompt string
 		},
 	}
 
-	req := o.createChatCompletionRequest(modelName, messages)
-	resp, err := client.CreateChatCompletion(context.Background(), req)
+	req := o.createChatCompletionRequest(ctx, modelName, messages)
+	resp, err := client.CreateChatCompletion(ctx, req)
 
 	if err != nil {
-		return "", fmt.Errorf("OpenAI Vision API error: %v", err)
+		return "", wrapRequestError(o.Name(), err)
 	}
+	reportChatUsage(ctx, modelName, resp.Usage)
 
 	if len(resp.Choices) == 0 {
 		return "", fmt.Errorf("no response choices returned from OpenAI Vision")
@@ -324,6 +443,20 @@ func (o *OpenAIProvider) ValidateModel(modelName string) bool {
 	return o.SupportsModel(modelName)
 }
 
+// Embed returns the embeddings of texts from an embedding model such as text-embedding-3-small
+func (o *OpenAIProvider) Embed(ctx context.Context, modelName string, texts []string) ([][]float32, error) {
+	if o.apiKey == "" {
+		return nil, fmt.Errorf("OpenAI provider not configured: missing API key")
+	}
+
+	if !o.SupportsModel(modelName) {
+		return nil, fmt.Errorf("invalid OpenAI model: %s", modelName)
+	}
+
+	o.debugf("Embedding %d texts with model: %s", len(texts), modelName)
+	return createEmbeddings(ctx, openai.NewClient(o.apiKey), o.Name(), modelName, modelName, texts)
+}
+
 // SetConfig updates the provider configuration
 func (o *OpenAIProvider) SetConfig(config ModelConfig) {
 	o.debugf("Updating provider configuration")
@@ -480,7 +613,7 @@ func (o *OpenAIProvider) prepareResponsesRequestBody(config ResponsesConfig) (ma
 }
 
 // SendPromptWithResponses sends a prompt using the OpenAI Responses API
-func (o *OpenAIProvider) SendPromptWithResponses(config ResponsesConfig) (string, error) {
+func (o *OpenAIProvider) SendPromptWithResponses(ctx context.Context, config ResponsesConfig) (string, error) {
 	o.debugf("Preparing to send prompt using Responses API with model: %s", config.Model)
 
 	if o.apiKey == "" {
@@ -511,7 +644,7 @@ func (o *OpenAIProvider) SendPromptWithResponses(config ResponsesConfig) (string
 		strings.HasPrefix(config.Model, "o4") {
 		timeout = 10 * time.Minute
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/responses", bytes.NewBuffer(jsonData))
@@ -540,7 +673,7 @@ func (o *OpenAIProvider) SendPromptWithResponses(config ResponsesConfig) (string
 		client := &http.Client{}
 		resp, err := client.Do(req)
 		if err != nil {
-			lastErr = fmt.Errorf("failed to send HTTP request (attempt %d/%d): %w", attempt+1, maxRetries, err)
+			lastErr = fmt.Errorf("failed to send HTTP request (attempt %d/%d): %w", attempt+1, maxRetries, wrapRequestError(o.Name(), err))
 			continue // Retry
 		}
 
@@ -556,11 +689,11 @@ func (o *OpenAIProvider) SendPromptWithResponses(config ResponsesConfig) (string
 		if resp.StatusCode != http.StatusOK {
 			// Don't retry on 4xx errors (client errors)
 			if resp.StatusCode >= 400 && resp.StatusCode < 500 {
-				return "", fmt.Errorf("OpenAI API error: %s (status code: %d)", string(body), resp.StatusCode)
+				return "", newHTTPError(o.Name(), resp.StatusCode, resp.Header, string(body))
 			}
 
-			lastErr = fmt.Errorf("OpenAI API error (attempt %d/%d): %s (status code: %d)",
-				attempt+1, maxRetries, string(body), resp.StatusCode)
+			lastErr = fmt.Errorf("attempt %d/%d: %w", attempt+1, maxRetries,
+				newHTTPError(o.Name(), resp.StatusCode, resp.Header, string(body)))
 			continue // Retry on 5xx errors
 		}
 
@@ -579,6 +712,8 @@ func (o *OpenAIProvider) SendPromptWithResponses(config ResponsesConfig) (string
 		return "", fmt.Errorf("all retry attempts failed: %w", lastErr)
 	}
 
+	reportResponsesUsage(ctx, config.Model, responseData)
+
 	// Extract output text
 	output, err := o.extractOutputText(responseData)
 	if err != nil {
@@ -591,7 +726,7 @@ func (o *OpenAIProvider) SendPromptWithResponses(config ResponsesConfig) (string
 }
 
 // SendPromptWithResponsesStream sends a prompt using the OpenAI Responses API with streaming
-func (o *OpenAIProvider) SendPromptWithResponsesStream(config ResponsesConfig, handler ResponsesStreamHandler) error {
+func (o *OpenAIProvider) SendPromptWithResponsesStream(ctx context.Context, config ResponsesConfig, handler ResponsesStreamHandler) error {
 	o.debugf("Preparing to send prompt using Responses API with streaming for model: %s", config.Model)
 
 	if o.apiKey == "" {
@@ -625,7 +760,7 @@ func (o *OpenAIProvider) SendPromptWithResponsesStream(config ResponsesConfig, h
 		strings.HasPrefix(config.Model, "o4") {
 		timeout = 10 * time.Minute
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/responses", bytes.NewBuffer(jsonData))
@@ -642,14 +777,14 @@ func (o *OpenAIProvider) SendPromptWithResponsesStream(config ResponsesConfig, h
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send HTTP request: %w", err)
+		return wrapRequestError(o.Name(), err)
 	}
 	defer resp.Body.Close()
 
 	// Check for error status code
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("OpenAI API error: %s (status code: %d)", string(body), resp.StatusCode)
+		return newHTTPError(o.Name(), resp.StatusCode, resp.Header, string(body))
 	}
 
 	// Process the stream using a scanner
@@ -704,6 +839,7 @@ func (o *OpenAIProvider) SendPromptWithResponsesStream(config ResponsesConfig, h
 			handler.OnOutputTextDelta(itemID, int(index), int(contentIndex), delta)
 		case "response.completed":
 			if resp, ok := event["response"].(map[string]interface{}); ok {
+				reportResponsesUsage(ctx, config.Model, resp)
 				handler.OnResponseCompleted(resp)
 			}
 			return nil // End streaming
@@ -910,8 +1046,21 @@ func init() {
 			Name:          "openai",
 			Description:   "OpenAI GPT models (gpt-4, gpt-3.5-turbo, o1-, o3-, etc.)",
 			Version:       "1.0.0",
-			ModelPrefixes: []string{"gpt-", "o1-", "o3-"},
+			ModelPrefixes: []string{"gpt-", "o1-", "o3-", "text-embedding-3-", "text-embedding-ada-"},
 			Priority:      85, // High priority for GPT models
+			CharsPerToken: 4,
+			ModelLimits: []ModelLimits{
+				{Prefix: "gpt-3.5-turbo", ContextWindow: 16385, MaxOutputTokens: 4096},
+				{Prefix: "gpt-4", ContextWindow: 8192, MaxOutputTokens: 8192},
+				{Prefix: "gpt-4-turbo", ContextWindow: 128000, MaxOutputTokens: 4096},
+				{Prefix: "gpt-4o", ContextWindow: 128000, MaxOutputTokens: 16384},
+				{Prefix: "gpt-4.1", ContextWindow: 1047576, MaxOutputTokens: 32768},
+				{Prefix: "gpt-4.5", ContextWindow: 128000, MaxOutputTokens: 16384},
+				{Prefix: "o1", ContextWindow: 200000, MaxOutputTokens: 100000},
+				{Prefix: "o1-preview", ContextWindow: 128000, MaxOutputTokens: 32768},
+				{Prefix: "o1-mini", ContextWindow: 128000, MaxOutputTokens: 65536},
+				{Prefix: "o3", ContextWindow: 200000, MaxOutputTokens: 100000},
+			},
 		},
 	)
 	RegisterProvider("openai", factory)
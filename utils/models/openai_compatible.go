@@ -0,0 +1,293 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/fileutil"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// OpenAICompatibleProvider handles models served by an endpoint that implements the OpenAI chat
+// completions API, such as vLLM, LM Studio, llama.cpp's server or LiteLLM. Each endpoint is a
+// provider of the env file with type openai-compatible.
+type OpenAICompatibleProvider struct {
+	name     string
+	endpoint config.Provider
+	apiKey   string
+	verbose  bool
+}
+
+// NewOpenAICompatibleProvider creates a provider for a named endpoint of the env file
+func NewOpenAICompatibleProvider(name string, endpoint config.Provider) *OpenAICompatibleProvider {
+	return &OpenAICompatibleProvider{name: name, endpoint: endpoint, apiKey: endpoint.APIKey}
+}
+
+// Name returns the name of the endpoint
+func (c *OpenAICompatibleProvider) Name() string {
+	return c.name
+}
+
+// debugf prints debug information if verbose mode is enabled
+func (c *OpenAICompatibleProvider) debugf(format string, args ...interface{}) {
+	if c.verbose {
+		fmt.Printf("[DEBUG][%s] "+format+"\n", append([]interface{}{c.name}, args...)...)
+	}
+}
+
+// SupportsModel checks if a model is listed for the endpoint, by name or alias, or is named
+// with its model prefix
+func (c *OpenAICompatibleProvider) SupportsModel(modelName string) bool {
+	_, ok := c.endpoint.FindModel(modelName)
+	return ok
+}
+
+// Configure sets the API key. Endpoints that do not check keys may have none.
+func (c *OpenAICompatibleProvider) Configure(apiKey string) error {
+	c.debugf("Configuring OpenAI-compatible endpoint %s", c.endpoint.BaseURL)
+	c.apiKey = apiKey
+	return nil
+}
+
+// apiModel returns the name the endpoint knows a model by
+func (c *OpenAICompatibleProvider) apiModel(modelName string) (string, error) {
+	model, ok := c.endpoint.FindModel(modelName)
+	if !ok {
+		return "", fmt.Errorf("model %s is not served by %s", modelName, c.name)
+	}
+	return model.Name, nil
+}
+
+// client returns a client for the endpoint that sends its headers with every request
+func (c *OpenAICompatibleProvider) client() *openai.Client {
+	cfg := openai.DefaultConfig(c.apiKey)
+	cfg.BaseURL = strings.TrimRight(c.endpoint.BaseURL, "/")
+	if len(c.endpoint.Headers) > 0 {
+		cfg.HTTPClient = &http.Client{Transport: &headerTransport{headers: c.endpoint.Headers, base: http.DefaultTransport}}
+	}
+	return openai.NewClientWithConfig(cfg)
+}
+
+// headerTransport adds headers to the requests it sends
+type headerTransport struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+// RoundTrip sends the request with the headers
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// createChatCompletionRequest creates a request with the request options carried by ctx.
+// Backends differ in their defaults, so parameters that are not set are left to them.
+func (c *OpenAICompatibleProvider) createChatCompletionRequest(ctx context.Context, apiModel string, messages []openai.ChatCompletionMessage) openai.ChatCompletionRequest {
+	opts := RequestOptionsFromContext(ctx)
+	req := openai.ChatCompletionRequest{
+		Model:    apiModel,
+		Messages: withSystemMessage(opts.System, messages),
+		Stop:     opts.Stop,
+		Seed:     opts.Seed,
+	}
+	if opts.Temperature != nil {
+		req.Temperature = chatTemperature(*opts.Temperature)
+	}
+	if opts.MaxTokens != nil {
+		req.MaxTokens = *opts.MaxTokens
+	}
+	if opts.TopP != nil {
+		req.TopP = float32(*opts.TopP)
+	}
+
+	if schema := opts.schemaJSON(); schema != nil {
+		req.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   "output",
+				Schema: schema,
+			},
+		}
+	} else if opts.JSON {
+		req.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	}
+	return req
+}
+
+// complete sends a chat request for a model and returns the reply
+func (c *OpenAICompatibleProvider) complete(ctx context.Context, modelName string, messages []openai.ChatCompletionMessage, tools []Tool) (Message, error) {
+	apiModel, err := c.apiModel(modelName)
+	if err != nil {
+		return Message{}, err
+	}
+	c.debugf("Sending %d messages to model %s at %s", len(messages), apiModel, c.endpoint.BaseURL)
+
+	req := c.createChatCompletionRequest(ctx, apiModel, messages)
+	req.Tools = chatTools(tools)
+	resp, err := c.client().CreateChatCompletion(ctx, req)
+	if err != nil {
+		return Message{}, wrapRequestError(c.Name(), err)
+	}
+	reportChatUsage(ctx, modelName, resp.Usage)
+
+	if len(resp.Choices) == 0 {
+		return Message{}, fmt.Errorf("no response choices returned from %s", c.name)
+	}
+
+	reply := chatReply(resp.Choices[0].Message)
+	c.debugf("API call completed, response length: %d characters, tool calls: %d", len(reply.Content), len(reply.ToolCalls))
+	return reply, nil
+}
+
+// SendPrompt sends a prompt to the specified model and returns the response
+func (c *OpenAICompatibleProvider) SendPrompt(ctx context.Context, modelName string, prompt string) (string, error) {
+	reply, err := c.complete(ctx, modelName, []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}}, nil)
+	return reply.Content, err
+}
+
+// SendPromptStream sends a prompt to the specified model and streams the response
+func (c *OpenAICompatibleProvider) SendPromptStream(ctx context.Context, modelName string, prompt string, onDelta func(delta string)) (string, error) {
+	apiModel, err := c.apiModel(modelName)
+	if err != nil {
+		return "", err
+	}
+	c.debugf("Streaming prompt to model %s at %s", apiModel, c.endpoint.BaseURL)
+
+	req := c.createChatCompletionRequest(ctx, apiModel, []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}})
+	return streamChatCompletion(ctx, c.client(), c.Name(), modelName, req, onDelta)
+}
+
+// SendPromptWithFile sends a prompt along with a file to the specified model and returns the
+// response. Images are sent as image parts, for endpoints serving vision models; other files
+// are included in the prompt as text.
+func (c *OpenAICompatibleProvider) SendPromptWithFile(ctx context.Context, modelName string, prompt string, file FileInput) (string, error) {
+	fileData, err := fileutil.SafeReadFile(file.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser}
+	if strings.HasPrefix(file.MimeType, "image/") {
+		message.MultiContent = []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: prompt},
+			{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{
+				URL: fmt.Sprintf("data:%s;base64,%s", file.MimeType, base64.StdEncoding.EncodeToString(fileData)),
+			}},
+		}
+	} else {
+		message.Content = fmt.Sprintf("File content:\n%s\n\nUser prompt: %s", string(fileData), prompt)
+	}
+
+	reply, err := c.complete(ctx, modelName, []openai.ChatCompletionMessage{message}, nil)
+	return reply.Content, err
+}
+
+// SendMessages sends a conversation to the specified model and returns the response
+func (c *OpenAICompatibleProvider) SendMessages(ctx context.Context, modelName string, messages []Message) (string, error) {
+	reply, err := c.SendMessagesWithTools(ctx, modelName, messages, nil)
+	return reply.Content, err
+}
+
+// SendMessagesWithTools sends a conversation with the tools the model may call and returns its reply
+func (c *OpenAICompatibleProvider) SendMessagesWithTools(ctx context.Context, modelName string, messages []Message, tools []Tool) (Message, error) {
+	if err := validateMessages(messages); err != nil {
+		return Message{}, err
+	}
+	return c.complete(ctx, modelName, chatMessages(messages), tools)
+}
+
+// Embed returns the embeddings of texts from the endpoint's embeddings API
+func (c *OpenAICompatibleProvider) Embed(ctx context.Context, modelName string, texts []string) ([][]float32, error) {
+	apiModel, err := c.apiModel(modelName)
+	if err != nil {
+		return nil, err
+	}
+	c.debugf("Embedding %d texts with model %s at %s", len(texts), apiModel, c.endpoint.BaseURL)
+	return createEmbeddings(ctx, c.client(), c.Name(), modelName, apiModel, texts)
+}
+
+// SetVerbose enables or disables verbose mode
+func (c *OpenAICompatibleProvider) SetVerbose(verbose bool) {
+	c.verbose = verbose
+}
+
+// ListModels returns the models the endpoint serves, named with its model prefix
+func (c *OpenAICompatibleProvider) ListModels() ([]string, error) {
+	list, err := c.client().ListModels(context.Background())
+	if err != nil {
+		return nil, wrapRequestError(c.Name(), err)
+	}
+	names := make([]string, len(list.Models))
+	for i, model := range list.Models {
+		names[i] = c.endpoint.ModelPrefix + model.ID
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// RegisterOpenAICompatibleProviders registers a provider for each openai-compatible entry of
+// the env file's providers, replacing those registered from an earlier configuration. A
+// model is routed to an endpoint that lists it by name or alias, or by the endpoint's model
+// prefix. Endpoints take priority over the built-in providers.
+func RegisterOpenAICompatibleProviders(envConfig *config.EnvConfig) error {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	for name := range registry.endpoints {
+		delete(registry.factories, name)
+	}
+	registry.endpoints = make(map[string]bool)
+	if envConfig == nil {
+		return nil
+	}
+
+	for name, endpoint := range envConfig.Providers {
+		if endpoint == nil || endpoint.Type == "" {
+			continue
+		}
+		if endpoint.Type != config.OpenAICompatible {
+			return fmt.Errorf("provider %s has unknown type '%s'", name, endpoint.Type)
+		}
+		if _, exists := registry.factories[name]; exists {
+			return fmt.Errorf("provider %s is built in and cannot be %s", name, config.OpenAICompatible)
+		}
+		if endpoint.BaseURL == "" {
+			return fmt.Errorf("provider %s has no base_url", name)
+		}
+
+		var prefixes, names []string
+		if endpoint.ModelPrefix != "" {
+			prefixes = append(prefixes, strings.ToLower(endpoint.ModelPrefix))
+		}
+		for _, model := range endpoint.Models {
+			names = append(names, strings.ToLower(model.Name))
+			if model.Alias != "" {
+				names = append(names, strings.ToLower(model.Alias))
+			}
+		}
+
+		endpoint := *endpoint
+		registry.factories[name] = NewProviderFactory(
+			func() Provider { return NewOpenAICompatibleProvider(name, endpoint) },
+			ProviderMetadata{
+				Name:          name,
+				Description:   "OpenAI-compatible endpoint at " + endpoint.BaseURL,
+				Version:       "1.0.0",
+				ModelPrefixes: prefixes,
+				ModelNames:    names,
+				Priority:      100, // Configured endpoints win over the built-in providers
+			},
+		)
+		registry.endpoints[name] = true
+		config.DebugLog("[Registry] Registered OpenAI-compatible provider: %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// registerEndpoints registers the openai-compatible providers of envConfig until the test ends
+func registerEndpoints(t *testing.T, envConfig *config.EnvConfig) {
+	t.Helper()
+	if err := RegisterOpenAICompatibleProviders(envConfig); err != nil {
+		t.Fatalf("RegisterOpenAICompatibleProviders() error: %v", err)
+	}
+	t.Cleanup(func() { RegisterOpenAICompatibleProviders(nil) })
+}
+
+func TestOpenAICompatibleRouting(t *testing.T) {
+	registerEndpoints(t, &config.EnvConfig{Providers: map[string]*config.Provider{
+		"vllm": {
+			Type:        config.OpenAICompatible,
+			BaseURL:     "http://gpu:8000/v1",
+			ModelPrefix: "vllm/",
+			Models:      []config.Model{{Name: "meta-llama/Llama-3-8B", Alias: "llama3-8b"}},
+		},
+		"gateway": {
+			Type:    config.OpenAICompatible,
+			BaseURL: "http://gateway/v1",
+			Models:  []config.Model{{Name: "gpt-4o"}},
+		},
+		"openai": {APIKey: "key"},
+	}})
+
+	tests := []struct {
+		model    string
+		provider string
+	}{
+		{"vllm/qwen2-7b", "vllm"},
+		{"llama3-8b", "vllm"},
+		{"meta-llama/Llama-3-8B", "vllm"},
+		{"LLAMA3-8B", "vllm"},
+		{"VLLM/Qwen2-7B", "vllm"},
+		{"gpt-4o", "gateway"},
+		{"gpt-4o-mini", "openai"},
+		{"claude-3-5-sonnet-latest", "anthropic"},
+	}
+	for _, tt := range tests {
+		provider := DetectProvider(tt.model)
+		if provider == nil || provider.Name() != tt.provider {
+			t.Errorf("DetectProvider(%q) = %v, want %s", tt.model, provider, tt.provider)
+		} else if !provider.SupportsModel(tt.model) {
+			t.Errorf("%s routed %q but does not support it", tt.provider, tt.model)
+		}
+	}
+
+	// Registering again replaces the endpoints
+	registerEndpoints(t, &config.EnvConfig{})
+	if provider := DetectProvider("gpt-4o"); provider == nil || provider.Name() != "openai" {
+		t.Errorf("DetectProvider(gpt-4o) after re-registering = %v, want openai", provider)
+	}
+	if provider := DetectProvider("vllm/qwen2-7b"); provider != nil && provider.Name() == "vllm" {
+		t.Error("DetectProvider(vllm/qwen2-7b) still routes to a removed endpoint")
+	}
+}
+
+func TestModelAliasRouting(t *testing.T) {
+	registerEndpoints(t, &config.EnvConfig{Providers: map[string]*config.Provider{
+		"vllm": {Type: config.OpenAICompatible, BaseURL: "http://gpu:8000/v1", ModelPrefix: "vllm/"},
+	}})
+	envConfig := &config.EnvConfig{
+		Aliases:      map[string]string{"fast": "gpt-4o-mini", "smart": "claude-3-5-sonnet-latest"},
+		Environments: map[string]*config.Environment{"ci": {Aliases: map[string]string{"smart": "vllm/qwen2-7b"}}},
+	}
+	t.Cleanup(func() { RegisterModelAliases(nil) })
+
+	tests := []struct {
+		environment string
+		model       string
+		provider    string
+	}{
+		{"", "fast", "openai"},
+		{"", "smart", "anthropic"},
+		{"ci", "smart", "vllm"},
+		{"ci", "fast", "openai"},
+	}
+	for _, tt := range tests {
+		t.Setenv(config.EnvironmentVar, tt.environment)
+		if err := RegisterModelAliases(envConfig); err != nil {
+			t.Fatalf("RegisterModelAliases() error: %v", err)
+		}
+		if provider := DetectProvider(tt.model); provider == nil || provider.Name() != tt.provider {
+			t.Errorf("DetectProvider(%q) in environment %q = %v, want %s", tt.model, tt.environment, provider, tt.provider)
+		}
+	}
+}
+
+func TestRegisterOpenAICompatibleProvidersErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider *config.Provider
+	}{
+		{"openai", &config.Provider{Type: config.OpenAICompatible, BaseURL: "http://gateway/v1"}},
+		{"vllm", &config.Provider{Type: "openai-ish", BaseURL: "http://gpu:8000/v1"}},
+		{"vllm", &config.Provider{Type: config.OpenAICompatible}},
+	}
+	for _, tt := range tests {
+		err := RegisterOpenAICompatibleProviders(&config.EnvConfig{Providers: map[string]*config.Provider{tt.name: tt.provider}})
+		if err == nil {
+			t.Errorf("RegisterOpenAICompatibleProviders(%s: %+v) should fail", tt.name, tt.provider)
+		}
+	}
+	RegisterOpenAICompatibleProviders(nil)
+}
+
+func TestOpenAICompatibleProvider(t *testing.T) {
+	var request openai.ChatCompletionRequest
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		switch r.URL.Path {
+		case "/v1/chat/completions":
+			json.NewDecoder(r.Body).Decode(&request)
+			json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "hello"}}},
+				Usage:   openai.Usage{PromptTokens: 3, CompletionTokens: 1},
+			})
+		case "/v1/models":
+			json.NewEncoder(w).Encode(openai.ModelsList{Models: []openai.Model{{ID: "qwen2-7b"}, {ID: "llama3"}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewOpenAICompatibleProvider("vllm", config.Provider{
+		Type:        config.OpenAICompatible,
+		BaseURL:     server.URL + "/v1/",
+		ModelPrefix: "vllm/",
+		Headers:     map[string]string{"X-Team": "ml"},
+		Models:      []config.Model{{Name: "meta-llama/Llama-3-8B", Alias: "llama3-8b"}},
+	})
+	if err := provider.Configure("secret"); err != nil {
+		t.Fatalf("Configure() error: %v", err)
+	}
+
+	var usage Usage
+	ctx := WithUsageRecorder(context.Background(), func(modelName string, u Usage) { usage = u })
+	temperature := 0.2
+	ctx = WithRequestOptions(ctx, RequestOptions{Temperature: &temperature, System: "Be terse."})
+
+	tests := []struct {
+		model    string
+		apiModel string
+	}{
+		{"llama3-8b", "meta-llama/Llama-3-8B"},
+		{"vllm/qwen2-7b", "qwen2-7b"},
+	}
+	for _, tt := range tests {
+		reply, err := provider.SendPrompt(ctx, tt.model, "hi")
+		if err != nil {
+			t.Fatalf("SendPrompt(%s) error: %v", tt.model, err)
+		}
+		if reply != "hello" {
+			t.Errorf("SendPrompt(%s) = %q, want hello", tt.model, reply)
+		}
+		if request.Model != tt.apiModel {
+			t.Errorf("SendPrompt(%s) requested model %q, want %q", tt.model, request.Model, tt.apiModel)
+		}
+	}
+	if len(request.Messages) != 2 || request.Messages[0].Content != "Be terse." || request.Temperature != 0.2 || request.MaxTokens != 0 {
+		t.Errorf("request = %+v", request)
+	}
+	if header.Get("Authorization") != "Bearer secret" || header.Get("X-Team") != "ml" {
+		t.Errorf("request headers = %v", header)
+	}
+	if usage.InputTokens != 3 || usage.OutputTokens != 1 {
+		t.Errorf("reported usage = %+v", usage)
+	}
+
+	if _, err := provider.SendPrompt(ctx, "gpt-4o", "hi"); err == nil {
+		t.Error("SendPrompt() with a model the endpoint does not serve should fail")
+	}
+
+	models, err := provider.ListModels()
+	if err != nil {
+		t.Fatalf("ListModels() error: %v", err)
+	}
+	if want := []string{"vllm/llama3", "vllm/qwen2-7b"}; !reflect.DeepEqual(models, want) {
+		t.Errorf("ListModels() = %v, want %v", models, want)
+	}
+}
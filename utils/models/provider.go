@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"strings"
 
 	"github.com/kris-hansen/comanda/utils/config"
@@ -13,6 +14,9 @@ type ModelConfig struct {
 	MaxTokens           int
 	MaxCompletionTokens int
 	TopP                float64
+	Stop                []string // Sequences that end the response
+	Seed                *int     // Seed for reproducible sampling, where the provider supports one
+	System              string   // System prompt sent before the user's prompt
 }
 
 // FileInput represents a file to be processed by the model
@@ -39,8 +43,12 @@ type ResponsesConfig struct {
 type Provider interface {
 	Name() string
 	SupportsModel(modelName string) bool
-	SendPrompt(modelName string, prompt string) (string, error)
-	SendPromptWithFile(modelName string, prompt string, file FileInput) (string, error)
+	SendPrompt(ctx context.Context, modelName string, prompt string) (string, error)
+	SendPromptWithFile(ctx context.Context, modelName string, prompt string, file FileInput) (string, error)
+	// SendMessages sends a multi-turn conversation and returns the reply
+	SendMessages(ctx context.Context, modelName string, messages []Message) (string, error)
+	// SendMessagesWithTools sends a conversation that the model may answer with calls to tools
+	SendMessagesWithTools(ctx context.Context, modelName string, messages []Message, tools []Tool) (Message, error)
 	Configure(apiKey string) error
 	SetVerbose(verbose bool)
 	ListModels() ([]string, error) // Dynamic model listing when supported
@@ -59,8 +67,23 @@ type ResponsesStreamHandler interface {
 // ResponsesProvider extends Provider with Responses API capabilities
 type ResponsesProvider interface {
 	Provider
-	SendPromptWithResponses(config ResponsesConfig) (string, error)
-	SendPromptWithResponsesStream(config ResponsesConfig, handler ResponsesStreamHandler) error
+	SendPromptWithResponses(ctx context.Context, config ResponsesConfig) (string, error)
+	SendPromptWithResponsesStream(ctx context.Context, config ResponsesConfig, handler ResponsesStreamHandler) error
+}
+
+// StreamProvider extends Provider with responses streamed as they are generated
+type StreamProvider interface {
+	Provider
+	// SendPromptStream sends a prompt, calls onDelta with each piece of the response as it
+	// arrives and returns the whole response
+	SendPromptStream(ctx context.Context, modelName string, prompt string, onDelta func(delta string)) (string, error)
+}
+
+// EmbeddingProvider extends Provider with vector embeddings of text
+type EmbeddingProvider interface {
+	Provider
+	// Embed returns the embeddings of texts, in the same order
+	Embed(ctx context.Context, modelName string, texts []string) ([][]float32, error)
 }
 
 // ListModelsForProvider is a generic function that all providers can use to list their models
@@ -80,6 +103,10 @@ var DetectProvider DetectProviderFunc = defaultDetectProvider
 // defaultDetectProvider is the default implementation of DetectProvider
 func defaultDetectProvider(modelName string) Provider {
 	config.DebugLog("[Provider] Attempting to detect provider for model: %s", modelName)
+	if resolved := ResolveModelAlias(modelName); resolved != modelName {
+		config.DebugLog("[Provider] Resolved alias %s to model %s", modelName, resolved)
+		modelName = resolved
+	}
 
 	provider := registry.FindProvider(modelName)
 	if provider != nil {
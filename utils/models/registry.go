@@ -17,6 +17,8 @@ var registry = &ProviderRegistry{
 // ProviderRegistry manages registered provider factories
 type ProviderRegistry struct {
 	factories map[string]Factory
+	endpoints map[string]bool   // Providers registered from the env file
+	aliases   map[string]string // Model aliases from the env file
 	mutex     sync.RWMutex
 }
 
@@ -55,8 +57,11 @@ type ProviderMetadata struct {
 	Name          string
 	Description   string
 	Version       string
-	ModelPrefixes []string // e.g., ["claude-", "gpt-"]
-	Priority      int      // Higher priority = checked first
+	ModelPrefixes []string      // e.g., ["claude-", "gpt-"]
+	ModelNames    []string      // Model names the provider handles exactly
+	Priority      int           // Higher priority = checked first
+	CharsPerToken float64       // Average characters per token of the provider's tokenizer, for estimates
+	ModelLimits   []ModelLimits // Context window and output limits of the provider's models
 }
 
 // RegisterProvider adds a provider factory to the registry
@@ -73,6 +78,26 @@ func RegisterProvider(name string, factory Factory) error {
 	return nil
 }
 
+// RegisterModelAliases makes DetectProvider resolve the model aliases of the env file, in the
+// environment selected with COMANDA_ENVIRONMENT, replacing those registered earlier
+func RegisterModelAliases(envConfig *config.EnvConfig) error {
+	if err := envConfig.ValidateAliases(); err != nil {
+		return err
+	}
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.aliases = envConfig.ModelAliases()
+	return nil
+}
+
+// ResolveModelAlias returns the model a registered alias stands for, or modelName if it is
+// not an alias
+func ResolveModelAlias(modelName string) string {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	return config.ResolveAlias(registry.aliases, modelName)
+}
+
 // FindProvider detects appropriate provider for model
 func (r *ProviderRegistry) FindProvider(modelName string) Provider {
 	r.mutex.RLock()
@@ -80,6 +105,31 @@ func (r *ProviderRegistry) FindProvider(modelName string) Provider {
 
 	config.DebugLog("[Registry] Finding provider for model: %s", modelName)
 
+	if factory := r.findFactory(modelName); factory != nil {
+		metadata := factory.GetMetadata()
+		config.DebugLog("[Registry] Selected provider %s for model %s (priority: %d)",
+			metadata.Name, modelName, metadata.Priority)
+		return factory.CreateProvider()
+	}
+
+	config.DebugLog("[Registry] No provider found for model %s", modelName)
+	return nil
+}
+
+// metadataFor returns the metadata of the provider that handles a model
+func (r *ProviderRegistry) metadataFor(modelName string) (ProviderMetadata, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if factory := r.findFactory(modelName); factory != nil {
+		return factory.GetMetadata(), true
+	}
+	return ProviderMetadata{}, false
+}
+
+// findFactory returns the highest priority factory whose model names or prefixes match the model.
+// The caller must hold the registry lock.
+func (r *ProviderRegistry) findFactory(modelName string) Factory {
 	// Get all factories and sort by priority
 	type providerCandidate struct {
 		factory  Factory
@@ -91,34 +141,45 @@ func (r *ProviderRegistry) FindProvider(modelName string) Provider {
 	for _, factory := range r.factories {
 		metadata := factory.GetMetadata()
 		// Check if this provider supports the model
-		for _, prefix := range metadata.ModelPrefixes {
-			if strings.HasPrefix(strings.ToLower(modelName), prefix) {
-				candidates = append(candidates, providerCandidate{
-					factory:  factory,
-					metadata: metadata,
-				})
-				config.DebugLog("[Registry] Provider %s matches model %s (prefix: %s)",
-					metadata.Name, modelName, prefix)
-				break
-			}
+		if match, ok := metadata.matches(modelName); ok {
+			candidates = append(candidates, providerCandidate{
+				factory:  factory,
+				metadata: metadata,
+			})
+			config.DebugLog("[Registry] Provider %s matches model %s (%s)",
+				metadata.Name, modelName, match)
 		}
 	}
 
 	// Sort by priority (higher priority first)
 	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].metadata.Priority == candidates[j].metadata.Priority {
+			return candidates[i].metadata.Name < candidates[j].metadata.Name
+		}
 		return candidates[i].metadata.Priority > candidates[j].metadata.Priority
 	})
 
-	// Return first match
-	if len(candidates) > 0 {
-		selected := candidates[0]
-		config.DebugLog("[Registry] Selected provider %s for model %s (priority: %d)",
-			selected.metadata.Name, modelName, selected.metadata.Priority)
-		return selected.factory.CreateProvider()
+	if len(candidates) == 0 {
+		return nil
 	}
+	return candidates[0].factory
+}
 
-	config.DebugLog("[Registry] No provider found for model %s", modelName)
-	return nil
+// matches reports whether a model is one of the provider's model names or starts with one of
+// its prefixes, and which
+func (m ProviderMetadata) matches(modelName string) (string, bool) {
+	modelName = strings.ToLower(modelName)
+	for _, name := range m.ModelNames {
+		if modelName == name {
+			return "name: " + name, true
+		}
+	}
+	for _, prefix := range m.ModelPrefixes {
+		if strings.HasPrefix(modelName, prefix) {
+			return "prefix: " + prefix, true
+		}
+	}
+	return "", false
 }
 
 // GetAvailableProviders returns list of registered providers
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// RequestOptions are per-request settings passed to providers through the context.
+// Providers apply the options they support and ignore the rest.
+type RequestOptions struct {
+	JSON       bool                   // Ask for a response that is a single JSON value
+	JSONSchema map[string]interface{} // JSON Schema the response must match, when the provider can enforce one
+
+	// Model parameters that override the provider's ModelConfig. Nil or empty values leave
+	// the provider's default in place.
+	Temperature *float64
+	MaxTokens   *int
+	TopP        *float64
+	Stop        []string
+	Seed        *int
+	System      string
+}
+
+// requestOptionsKey is the context key for RequestOptions
+type requestOptionsKey struct{}
+
+// WithRequestOptions returns a context carrying opts for the requests made with it
+func WithRequestOptions(ctx context.Context, opts RequestOptions) context.Context {
+	return context.WithValue(ctx, requestOptionsKey{}, opts)
+}
+
+// RequestOptionsFromContext returns the options carried by ctx, or the zero value if there are none
+func RequestOptionsFromContext(ctx context.Context) RequestOptions {
+	opts, _ := ctx.Value(requestOptionsKey{}).(RequestOptions)
+	return opts
+}
+
+// schemaJSON returns the options' JSON Schema encoded as JSON, or nil if there is none
+func (o RequestOptions) schemaJSON() json.RawMessage {
+	if o.JSONSchema == nil {
+		return nil
+	}
+	data, err := json.Marshal(o.JSONSchema)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// modelConfig returns config with the options' model parameters applied
+func (o RequestOptions) modelConfig(config ModelConfig) ModelConfig {
+	if o.Temperature != nil {
+		config.Temperature = *o.Temperature
+	}
+	if o.MaxTokens != nil {
+		config.MaxTokens = *o.MaxTokens
+		config.MaxCompletionTokens = *o.MaxTokens
+	}
+	if o.TopP != nil {
+		config.TopP = *o.TopP
+	}
+	if len(o.Stop) > 0 {
+		config.Stop = o.Stop
+	}
+	if o.Seed != nil {
+		config.Seed = o.Seed
+	}
+	if o.System != "" {
+		config.System = o.System
+	}
+	return config
+}
+
+// chatTemperature converts a temperature for an OpenAI-compatible request. The client omits
+// zero values, so a temperature of 0 is sent as the smallest positive value instead.
+func chatTemperature(temperature float64) float32 {
+	if temperature == 0 {
+		return math.SmallestNonzeroFloat32
+	}
+	return float32(temperature)
+}
+
+// withSystemMessage returns messages preceded by a system message, if there is a system prompt
+// and the messages do not already start with their own
+func withSystemMessage(system string, messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	if system == "" || (len(messages) > 0 && messages[0].Role == openai.ChatMessageRoleSystem) {
+		return messages
+	}
+	return append([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: system}}, messages...)
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestRequestOptionsApplied(t *testing.T) {
+	schema := map[string]interface{}{"type": "object"}
+	tests := []struct {
+		name         string
+		opts         *RequestOptions
+		expectedType openai.ChatCompletionResponseFormatType
+		ollamaFormat string
+	}{
+		{name: "no options"},
+		{name: "json", opts: &RequestOptions{JSON: true}, expectedType: openai.ChatCompletionResponseFormatTypeJSONObject, ollamaFormat: `"json"`},
+		{name: "schema", opts: &RequestOptions{JSON: true, JSONSchema: schema}, expectedType: openai.ChatCompletionResponseFormatTypeJSONSchema, ollamaFormat: `{"type":"object"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.opts != nil {
+				ctx = WithRequestOptions(ctx, *tt.opts)
+			}
+
+			req := NewOpenAIProvider().createChatCompletionRequest(ctx, "gpt-4o-mini", nil)
+			var gotType openai.ChatCompletionResponseFormatType
+			if req.ResponseFormat != nil {
+				gotType = req.ResponseFormat.Type
+			}
+			if gotType != tt.expectedType {
+				t.Errorf("OpenAI response format = %q, want %q", gotType, tt.expectedType)
+			}
+
+			if got := string(ollamaFormat(ctx)); got != tt.ollamaFormat {
+				t.Errorf("Ollama format = %q, want %q", got, tt.ollamaFormat)
+			}
+		})
+	}
+}
+
+func TestModelParamsApplied(t *testing.T) {
+	temperature, maxTokens, seed := 0.0, 300, 7
+	ctx := WithRequestOptions(context.Background(), RequestOptions{
+		Temperature: &temperature,
+		MaxTokens:   &maxTokens,
+		Stop:        []string{"END"},
+		Seed:        &seed,
+		System:      "Be terse.",
+	})
+	user := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}}
+
+	t.Run("openai legacy model", func(t *testing.T) {
+		req := NewOpenAIProvider().createChatCompletionRequest(ctx, "gpt-4", user)
+		if req.MaxTokens != 300 || req.Temperature == 0 || req.Temperature > 0.001 || len(req.Stop) != 1 || *req.Seed != 7 {
+			t.Errorf("request = %+v", req)
+		}
+		if len(req.Messages) != 2 || req.Messages[0].Role != openai.ChatMessageRoleSystem || req.Messages[0].Content != "Be terse." {
+			t.Errorf("messages = %+v", req.Messages)
+		}
+	})
+
+	t.Run("openai gpt-4o", func(t *testing.T) {
+		req := NewOpenAIProvider().createChatCompletionRequest(ctx, "gpt-4o", user)
+		if req.MaxCompletionTokens != 300 || req.Temperature > 0.001 || len(req.Stop) != 1 {
+			t.Errorf("request = %+v", req)
+		}
+	})
+
+	t.Run("openai reasoning model", func(t *testing.T) {
+		req := NewOpenAIProvider().createChatCompletionRequest(ctx, "o1-mini", user)
+		if req.MaxCompletionTokens != 300 || req.Temperature != 1.0 || req.Stop != nil {
+			t.Errorf("request = %+v", req)
+		}
+	})
+
+	t.Run("openai without options", func(t *testing.T) {
+		req := NewOpenAIProvider().createChatCompletionRequest(context.Background(), "gpt-4o", user)
+		if req.MaxCompletionTokens != 2000 || req.Temperature != 1.0 || len(req.Messages) != 1 || req.Seed != nil {
+			t.Errorf("request = %+v", req)
+		}
+	})
+
+	t.Run("anthropic", func(t *testing.T) {
+		req := NewAnthropicProvider().newRequest(ctx, "claude-3-5-sonnet-latest", nil)
+		if req.System != "Be terse." || req.MaxTokens != 300 || req.Temperature != 0 || len(req.StopSequences) != 1 || req.TopP != 1.0 {
+			t.Errorf("request = %+v", req)
+		}
+	})
+
+	t.Run("ollama", func(t *testing.T) {
+		req := newOllamaRequest(ctx, "llama3", "hi")
+		want := map[string]interface{}{"temperature": 0.0, "num_predict": 300, "stop": []string{"END"}, "seed": 7}
+		if req.System != "Be terse." || len(req.Options) != len(want) || req.Options["num_predict"] != 300 || req.Options["seed"] != 7 {
+			t.Errorf("request = %+v", req)
+		}
+		if plain := newOllamaRequest(context.Background(), "llama3", "hi"); plain.Options != nil {
+			t.Errorf("options without parameters = %v", plain.Options)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// SendPromptStream sends a prompt through provider, streaming the response if the provider
+// supports it. Other providers answer the prompt whole, and onDelta receives the response
+// in one piece.
+func SendPromptStream(ctx context.Context, provider Provider, modelName string, prompt string, onDelta func(delta string)) (string, error) {
+	if streamer, ok := provider.(StreamProvider); ok {
+		return streamer.SendPromptStream(ctx, modelName, prompt, onDelta)
+	}
+	response, err := provider.SendPrompt(ctx, modelName, prompt)
+	if err == nil && response != "" {
+		onDelta(response)
+	}
+	return response, err
+}
+
+// streamChatCompletion sends a request to a chat completions API with streaming enabled,
+// passes the content of each chunk to onDelta and returns the whole response. The usage
+// arrives in the last chunk.
+func streamChatCompletion(ctx context.Context, client *openai.Client, providerName string, modelName string, req openai.ChatCompletionRequest, onDelta func(delta string)) (string, error) {
+	req.Stream = true
+	req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	stream, err := client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return "", wrapRequestError(providerName, err)
+	}
+	defer stream.Close()
+
+	var response strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", wrapRequestError(providerName, err)
+		}
+		if chunk.Usage != nil {
+			reportChatUsage(ctx, modelName, *chunk.Usage)
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			delta := chunk.Choices[0].Delta.Content
+			response.WriteString(delta)
+			onDelta(delta)
+		}
+	}
+	return response.String(), nil
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestReadAnthropicStream(t *testing.T) {
+	events := []string{
+		`event: message_start`,
+		`data: {"type":"message_start","message":{"usage":{"input_tokens":12,"output_tokens":1,"cache_read_input_tokens":4}}}`,
+		``,
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`data: {"type":"ping"}`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" there"}}`,
+		`data: {"type":"content_block_stop","index":0}`,
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":7}}`,
+		`data: {"type":"message_stop"}`,
+	}
+
+	tests := []struct {
+		name     string
+		events   []string
+		want     string
+		deltas   []string
+		usage    []Usage
+		wantKind ErrorKind
+		wantErr  bool
+	}{
+		{"complete response", events, "Hello there", []string{"Hello", " there"}, []Usage{{InputTokens: 16, OutputTokens: 7, CachedTokens: 4}}, ErrorUnknown, false},
+		{"error event", append(events[:6:6], `data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`), "", []string{"Hello"}, nil, ErrorOverloaded, true},
+		{"truncated stream", events[:6], "", []string{"Hello"}, nil, ErrorUnknown, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, usage := recordUsage()
+			var deltas []string
+			got, err := readAnthropicStream(ctx, "claude-3-5-haiku-latest", strings.NewReader(strings.Join(tt.events, "\n")), func(delta string) {
+				deltas = append(deltas, delta)
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readAnthropicStream() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ErrorKindOf(err) != tt.wantKind {
+				t.Errorf("error kind = %v, want %v", ErrorKindOf(err), tt.wantKind)
+			}
+			if got != tt.want || !reflect.DeepEqual(deltas, tt.deltas) || !reflect.DeepEqual(*usage, tt.usage) {
+				t.Errorf("readAnthropicStream() = %q, deltas %q, usage %+v", got, deltas, *usage)
+			}
+		})
+	}
+}
+
+func TestOllamaSendPromptStream(t *testing.T) {
+	var request OllamaRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		encoder := json.NewEncoder(w)
+		encoder.Encode(OllamaResponse{Response: "Hello"})
+		encoder.Encode(OllamaResponse{Response: " there"})
+		encoder.Encode(OllamaResponse{Done: true, PromptEvalCount: 5, EvalCount: 2})
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider()
+	if err := provider.SetHosts([]config.Host{{Name: "local", BaseURL: server.URL}}, ""); err != nil {
+		t.Fatalf("SetHosts() error: %v", err)
+	}
+
+	ctx, usage := recordUsage()
+	var deltas []string
+	got, err := provider.SendPromptStream(ctx, "llama3", "hi", func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("SendPromptStream() error: %v", err)
+	}
+	if got != "Hello there" || !reflect.DeepEqual(deltas, []string{"Hello", " there"}) || !request.Stream {
+		t.Errorf("SendPromptStream() = %q, deltas %q, stream requested %v", got, deltas, request.Stream)
+	}
+	if want := []Usage{{InputTokens: 5, OutputTokens: 2}}; !reflect.DeepEqual(*usage, want) {
+		t.Errorf("usage = %+v, want %+v", *usage, want)
+	}
+}
+
+func TestOpenAICompatibleSendPromptStream(t *testing.T) {
+	var request openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"choices":[{"index":0,"delta":{"role":"assistant"}}]}`,
+			`{"choices":[{"index":0,"delta":{"content":"Hello"}}]}`,
+			`{"choices":[{"index":0,"delta":{"content":" there"}}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":4,"completion_tokens":2}}`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	provider := NewOpenAICompatibleProvider("vllm", config.Provider{
+		Type:        config.OpenAICompatible,
+		BaseURL:     server.URL,
+		ModelPrefix: "vllm/",
+	})
+
+	ctx, usage := recordUsage()
+	var deltas []string
+	got, err := SendPromptStream(ctx, provider, "vllm/qwen2-7b", "hi", func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("SendPromptStream() error: %v", err)
+	}
+	if got != "Hello there" || !reflect.DeepEqual(deltas, []string{"Hello", " there"}) {
+		t.Errorf("SendPromptStream() = %q, deltas %q", got, deltas)
+	}
+	if !request.Stream || request.StreamOptions == nil || !request.StreamOptions.IncludeUsage || request.Model != "qwen2-7b" {
+		t.Errorf("request = %+v", request)
+	}
+	if want := []Usage{{InputTokens: 4, OutputTokens: 2}}; !reflect.DeepEqual(*usage, want) {
+		t.Errorf("usage = %+v, want %+v", *usage, want)
+	}
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultCharsPerToken is used for models whose provider does not give a ratio
+const defaultCharsPerToken = 4.0
+
+// ModelLimits describes the token limits of the models whose names start with Prefix
+type ModelLimits struct {
+	Prefix          string // Model name prefix, the longest matching prefix wins
+	ContextWindow   int    // Maximum tokens of prompt and response together
+	MaxOutputTokens int    // Maximum tokens in a response (0 if unknown)
+}
+
+// EstimateTokens estimates the number of tokens text takes up for a model. It uses the
+// characters-per-token ratio of the model's provider, calibrated on English prose and code,
+// and counts each CJK character as a token of its own. Other non-ASCII characters count
+// double, so estimates for non-English text err on the high side.
+func EstimateTokens(modelName string, text string) int {
+	chars, tokens := 0, 0
+	for _, r := range text {
+		switch {
+		case r < utf8.RuneSelf:
+			chars++
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			tokens++
+		default:
+			chars += 2
+		}
+	}
+	return tokens + int(math.Ceil(float64(chars)/charsPerToken(modelName)))
+}
+
+// EstimateTokensForSize estimates the number of tokens of a file of size bytes, for files
+// whose content is not read, such as the attachments of a prompt
+func EstimateTokensForSize(modelName string, size int64) int {
+	return int(math.Ceil(float64(size) / charsPerToken(modelName)))
+}
+
+// charsPerToken returns the characters-per-token ratio of the model's provider
+func charsPerToken(modelName string) float64 {
+	if metadata, ok := registry.metadataFor(modelName); ok && metadata.CharsPerToken > 0 {
+		return metadata.CharsPerToken
+	}
+	return defaultCharsPerToken
+}
+
+// LookupModelLimits returns the token limits that the provider serving a model registers for it
+func LookupModelLimits(modelName string) (ModelLimits, bool) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	factory := registry.findFactory(modelName)
+	if factory == nil {
+		return ModelLimits{}, false
+	}
+	name := strings.ToLower(modelName)
+	var best ModelLimits
+	found := false
+	for _, limits := range factory.GetMetadata().ModelLimits {
+		if strings.HasPrefix(name, limits.Prefix) && (!found || len(limits.Prefix) > len(best.Prefix)) {
+			best = limits
+			found = true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    string
+		text     string
+		expected int
+	}{
+		{name: "empty", model: "gpt-4o", text: "", expected: 0},
+		{name: "openai ratio", model: "gpt-4o", text: "abcdefgh", expected: 2},
+		{name: "rounds up", model: "gpt-4o", text: "abcdefghi", expected: 3},
+		{name: "anthropic ratio", model: "claude-3-5-sonnet-latest", text: "abcdefg", expected: 2},
+		{name: "cjk", model: "gpt-4o", text: "你好世界", expected: 4},
+		{name: "accented", model: "gpt-4o", text: "café", expected: 2},
+		{name: "unknown model", model: "some-local-model", text: "abcdefgh", expected: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateTokens(tt.model, tt.text); got != tt.expected {
+				t.Errorf("EstimateTokens(%q, %q) = %d, want %d", tt.model, tt.text, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLookupModelLimits(t *testing.T) {
+	tests := []struct {
+		model         string
+		contextWindow int
+		found         bool
+	}{
+		{model: "gpt-4o-mini", contextWindow: 128000, found: true},
+		{model: "gpt-4", contextWindow: 8192, found: true},
+		{model: "gpt-4.1-nano", contextWindow: 1047576, found: true},
+		{model: "claude-sonnet-4-20250514", contextWindow: 200000, found: true},
+		{model: "gemini-1.5-pro", contextWindow: 2097152, found: true},
+		{model: "llama3.2", found: false},
+	}
+	for _, tt := range tests {
+		limits, found := LookupModelLimits(tt.model)
+		if found != tt.found || limits.ContextWindow != tt.contextWindow {
+			t.Errorf("LookupModelLimits(%q) = %d, %v; want %d, %v", tt.model, limits.ContextWindow, found, tt.contextWindow, tt.found)
+		}
+	}
+}
+
+func TestLookupModelLimitsUsesServingProvider(t *testing.T) {
+	// A local model named like an OpenAI one does not get OpenAI's limits
+	registerEndpoints(t, &config.EnvConfig{Providers: map[string]*config.Provider{
+		"vllm": {Type: config.OpenAICompatible, BaseURL: "http://gpu:8000/v1", Models: []config.Model{{Name: "gpt-4o-distilled"}}},
+	}})
+	if limits, found := LookupModelLimits("gpt-4o-distilled"); found {
+		t.Errorf("LookupModelLimits(gpt-4o-distilled) = %d, want no limits", limits.ContextWindow)
+	}
+	if _, found := LookupModelLimits("gpt-4o"); !found {
+		t.Error("LookupModelLimits(gpt-4o) found no limits")
+	}
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"encoding/json"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Tool describes a function that a model can ask to call while answering
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"` // JSON Schema of the arguments object
+}
+
+// ToolCall is a model's request to call a tool. Providers whose APIs do not identify calls
+// use the tool's name as the ID.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // Arguments as a JSON object
+}
+
+// toolParameters returns the parameters schema of a tool, defaulting to an object with no properties
+func toolParameters(tool Tool) map[string]interface{} {
+	if tool.Parameters == nil {
+		return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	return tool.Parameters
+}
+
+// toolArguments returns the arguments of a call as a JSON object, treating empty arguments as {}
+func toolArguments(call ToolCall) json.RawMessage {
+	if call.Arguments == "" {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(call.Arguments)
+}
+
+// chatTools converts tools for an OpenAI-compatible chat completion request
+func chatTools(tools []Tool) []openai.Tool {
+	var converted []openai.Tool
+	for _, tool := range tools {
+		converted = append(converted, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  toolParameters(tool),
+			},
+		})
+	}
+	return converted
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// toolConversation is a conversation in which the assistant called two tools
+var toolConversation = []Message{
+	{Role: RoleUser, Content: "Compare the files."},
+	{Role: RoleAssistant, Content: "Reading both.", ToolCalls: []ToolCall{
+		{ID: "call_1", Name: "read_file", Arguments: `{"path":"a.txt"}`},
+		{ID: "call_2", Name: "read_file", Arguments: `{"path":"b.txt"}`},
+	}},
+	{Role: RoleTool, ToolCallID: "call_1", Content: "alpha"},
+	{Role: RoleTool, ToolCallID: "call_2", Content: "beta"},
+}
+
+func TestChatMessagesWithToolCalls(t *testing.T) {
+	converted := chatMessages(toolConversation)
+	if len(converted) != 4 {
+		t.Fatalf("expected 4 messages, got %d", len(converted))
+	}
+	calls := converted[1].ToolCalls
+	if len(calls) != 2 || calls[1].ID != "call_2" || calls[1].Type != openai.ToolTypeFunction || calls[1].Function.Arguments != `{"path":"b.txt"}` {
+		t.Errorf("assistant tool calls = %+v", calls)
+	}
+	if converted[3].ToolCallID != "call_2" || converted[3].Role != openai.ChatMessageRoleTool {
+		t.Errorf("tool result = %+v", converted[3])
+	}
+
+	reply := chatReply(converted[1])
+	if !reflect.DeepEqual(reply, toolConversation[1]) {
+		t.Errorf("chatReply() = %+v, want %+v", reply, toolConversation[1])
+	}
+}
+
+func TestAnthropicMessagesGroupToolResults(t *testing.T) {
+	converted := anthropicMessages(toolConversation)
+	if len(converted) != 3 {
+		t.Fatalf("expected 3 messages, got %d: %+v", len(converted), converted)
+	}
+	assistant := converted[1].Content
+	if len(assistant) != 3 || assistant[0].Text != "Reading both." || assistant[1].Type != "tool_use" || string(assistant[2].Input) != `{"path":"b.txt"}` {
+		t.Errorf("assistant content = %+v", assistant)
+	}
+	results := converted[2]
+	if results.Role != RoleUser || len(results.Content) != 2 || results.Content[0].ToolUseID != "call_1" || results.Content[1].Content != "beta" {
+		t.Errorf("tool results = %+v", results)
+	}
+}
+
+func TestGeminiContents(t *testing.T) {
+	contents, err := geminiContents(toolConversation)
+	if err != nil {
+		t.Fatalf("geminiContents() error: %v", err)
+	}
+	if len(contents) != 3 || contents[1].Role != "model" || contents[2].Role != "user" {
+		t.Fatalf("contents = %+v", contents)
+	}
+	call, ok := contents[1].Parts[1].(genai.FunctionCall)
+	if !ok || call.Name != "read_file" || call.Args["path"] != "a.txt" {
+		t.Errorf("function call = %#v", contents[1].Parts[1])
+	}
+	response, ok := contents[2].Parts[1].(genai.FunctionResponse)
+	if !ok || response.Name != "read_file" || response.Response["result"] != "beta" {
+		t.Errorf("function response = %#v", contents[2].Parts[1])
+	}
+}
+
+func TestGeminiSchema(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"city": {"type": "string", "description": "City name"},
+			"days": {"type": ["integer", "null"]},
+			"units": {"type": "string", "enum": ["metric", "imperial"]},
+			"tags": {"type": "array", "items": {"type": "string"}}
+		},
+		"required": ["city"]
+	}`), &schema); err != nil {
+		t.Fatal(err)
+	}
+	converted := geminiSchema(schema)
+	if converted.Type != genai.TypeObject || !reflect.DeepEqual(converted.Required, []string{"city"}) {
+		t.Errorf("schema = %+v", converted)
+	}
+	if city := converted.Properties["city"]; city.Type != genai.TypeString || city.Description != "City name" {
+		t.Errorf("city = %+v", city)
+	}
+	if days := converted.Properties["days"]; days.Type != genai.TypeInteger || !days.Nullable {
+		t.Errorf("days = %+v", days)
+	}
+	if units := converted.Properties["units"]; !reflect.DeepEqual(units.Enum, []string{"metric", "imperial"}) {
+		t.Errorf("units = %+v", units)
+	}
+	if tags := converted.Properties["tags"]; tags.Type != genai.TypeArray || tags.Items.Type != genai.TypeString {
+		t.Errorf("tags = %+v", tags)
+	}
+}
+
+func TestOllamaMessagesWithToolCalls(t *testing.T) {
+	converted := ollamaMessages(toolConversation)
+	if string(converted[1].ToolCalls[0].Function.Arguments) != `{"path":"a.txt"}` {
+		t.Errorf("tool call = %+v", converted[1].ToolCalls[0])
+	}
+	if converted[2].ToolName != "read_file" {
+		t.Errorf("tool result = %+v", converted[2])
+	}
+}
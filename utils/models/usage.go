@@ -0,0 +1,66 @@
+package models
+
+import (
+	"context"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Usage is the token usage of one or more model calls
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`  // Prompt tokens, including cached ones
+	OutputTokens int `json:"output_tokens"` // Response tokens
+	CachedTokens int `json:"cached_tokens"` // Prompt tokens served from the provider's prompt cache
+}
+
+// Add adds the usage of other to u
+func (u *Usage) Add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CachedTokens += other.CachedTokens
+}
+
+// UsageRecorder receives the token usage of each model call
+type UsageRecorder func(modelName string, usage Usage)
+
+// usageRecorderKey is the context key for the UsageRecorder
+type usageRecorderKey struct{}
+
+// WithUsageRecorder returns a context whose model calls report their token usage to recorder
+func WithUsageRecorder(ctx context.Context, recorder UsageRecorder) context.Context {
+	return context.WithValue(ctx, usageRecorderKey{}, recorder)
+}
+
+// ReportUsage passes the token usage of a model call to the context's recorder, if it has one.
+// Providers call it once per API response.
+func ReportUsage(ctx context.Context, modelName string, usage Usage) {
+	if recorder, ok := ctx.Value(usageRecorderKey{}).(UsageRecorder); ok && recorder != nil {
+		recorder(modelName, usage)
+	}
+}
+
+// reportChatUsage reports the usage of an OpenAI-compatible chat completion
+func reportChatUsage(ctx context.Context, modelName string, usage openai.Usage) {
+	reported := Usage{InputTokens: usage.PromptTokens, OutputTokens: usage.CompletionTokens}
+	if usage.PromptTokensDetails != nil {
+		reported.CachedTokens = usage.PromptTokensDetails.CachedTokens
+	}
+	ReportUsage(ctx, modelName, reported)
+}
+
+// reportResponsesUsage reports the usage of a Responses API response
+func reportResponsesUsage(ctx context.Context, modelName string, response map[string]interface{}) {
+	usage, ok := response["usage"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	number := func(m map[string]interface{}, key string) int {
+		n, _ := m[key].(float64)
+		return int(n)
+	}
+	reported := Usage{InputTokens: number(usage, "input_tokens"), OutputTokens: number(usage, "output_tokens")}
+	if details, ok := usage["input_tokens_details"].(map[string]interface{}); ok {
+		reported.CachedTokens = number(details, "cached_tokens")
+	}
+	ReportUsage(ctx, modelName, reported)
+}
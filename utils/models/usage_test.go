@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// recordUsage returns a context that records reported usage in the returned slice
+func recordUsage() (context.Context, *[]Usage) {
+	var reported []Usage
+	ctx := WithUsageRecorder(context.Background(), func(modelName string, usage Usage) {
+		reported = append(reported, usage)
+	})
+	return ctx, &reported
+}
+
+func TestReportUsage(t *testing.T) {
+	// Without a recorder, reporting is a no-op
+	ReportUsage(context.Background(), "gpt-4o", Usage{InputTokens: 1})
+
+	tests := []struct {
+		name   string
+		report func(ctx context.Context)
+		want   Usage
+	}{
+		{
+			name: "chat completion",
+			report: func(ctx context.Context) {
+				reportChatUsage(ctx, "gpt-4o", openai.Usage{
+					PromptTokens:        100,
+					CompletionTokens:    20,
+					PromptTokensDetails: &openai.PromptTokensDetails{CachedTokens: 64},
+				})
+			},
+			want: Usage{InputTokens: 100, OutputTokens: 20, CachedTokens: 64},
+		},
+		{
+			name: "responses api",
+			report: func(ctx context.Context) {
+				reportResponsesUsage(ctx, "gpt-4o", map[string]interface{}{
+					"usage": map[string]interface{}{
+						"input_tokens":         float64(50),
+						"output_tokens":        float64(10),
+						"input_tokens_details": map[string]interface{}{"cached_tokens": float64(32)},
+					},
+				})
+			},
+			want: Usage{InputTokens: 50, OutputTokens: 10, CachedTokens: 32},
+		},
+		{
+			name: "anthropic prompt cache",
+			report: func(ctx context.Context) {
+				ReportUsage(ctx, "claude-3-5-sonnet-latest", anthropicUsage{
+					InputTokens:              10,
+					OutputTokens:             5,
+					CacheCreationInputTokens: 100,
+					CacheReadInputTokens:     200,
+				}.usage())
+			},
+			want: Usage{InputTokens: 310, OutputTokens: 5, CachedTokens: 200},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, reported := recordUsage()
+			tt.report(ctx)
+			if len(*reported) != 1 || (*reported)[0] != tt.want {
+				t.Errorf("reported %+v, want %+v", *reported, tt.want)
+			}
+		})
+	}
+}
@@ -19,10 +19,7 @@ type XAIProvider struct {
 
 // Default configuration values
 const (
-	defaultTimeout  = 30 * time.Second
-	maxPromptTokens = 4000
-	// Rough approximation of tokens to characters ratio (1 token ≈ 4 characters)
-	tokensToCharsRatio = 4
+	defaultTimeout = 30 * time.Second
 )
 
 // NewXAIProvider creates a new X.AI provider instance
@@ -80,13 +77,36 @@ func (x *XAIProvider) Configure(apiKey string) error {
 	return nil
 }
 
-// estimateTokenCount provides a rough estimate of token count from character count
-func (x *XAIProvider) estimateTokenCount(text string) int {
-	return len(text) / tokensToCharsRatio
+// checkPromptSize fails when a prompt cannot fit in the model's context window
+func (x *XAIProvider) checkPromptSize(modelName string, prompt string) error {
+	limits, ok := LookupModelLimits(modelName)
+	if !ok {
+		return nil
+	}
+	if estimatedTokens := EstimateTokens(modelName, prompt); estimatedTokens > limits.ContextWindow {
+		return fmt.Errorf("prompt likely exceeds the %d token context window of %s (estimated tokens: %d)",
+			limits.ContextWindow, modelName, estimatedTokens)
+	}
+	return nil
+}
+
+// createChatCompletionRequest creates a ChatCompletionRequest with the provider's configuration
+// and the model parameters carried by ctx
+func (x *XAIProvider) createChatCompletionRequest(ctx context.Context, modelName string, messages []openai.ChatCompletionMessage) openai.ChatCompletionRequest {
+	cfg := RequestOptionsFromContext(ctx).modelConfig(x.config)
+	return openai.ChatCompletionRequest{
+		Model:       modelName,
+		Messages:    withSystemMessage(cfg.System, messages),
+		Temperature: chatTemperature(cfg.Temperature),
+		MaxTokens:   cfg.MaxTokens,
+		TopP:        float32(cfg.TopP),
+		Stop:        cfg.Stop,
+		Seed:        cfg.Seed,
+	}
 }
 
 // SendPrompt sends a prompt to the specified model and returns the response
-func (x *XAIProvider) SendPrompt(modelName string, prompt string) (string, error) {
+func (x *XAIProvider) SendPrompt(ctx context.Context, modelName string, prompt string) (string, error) {
 	x.debugf("Preparing to send prompt to model: %s", modelName)
 	x.debugf("Prompt length: %d characters", len(prompt))
 
@@ -99,9 +119,8 @@ func (x *XAIProvider) SendPrompt(modelName string, prompt string) (string, error
 	}
 
 	// Check estimated token count
-	estimatedTokens := x.estimateTokenCount(prompt)
-	if estimatedTokens > maxPromptTokens {
-		return "", fmt.Errorf("prompt likely exceeds maximum token limit of %d (estimated tokens: %d)", maxPromptTokens, estimatedTokens)
+	if err := x.checkPromptSize(modelName, prompt); err != nil {
+		return "", err
 	}
 
 	x.debugf("Model validation passed, preparing API call")
@@ -113,31 +132,26 @@ func (x *XAIProvider) SendPrompt(modelName string, prompt string) (string, error
 	client := openai.NewClientWithConfig(config)
 
 	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
 	resp, err := client.CreateChatCompletion(
 		ctx,
-		openai.ChatCompletionRequest{
-			Model: modelName,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
+		x.createChatCompletionRequest(ctx, modelName, []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt,
 			},
-			Temperature: float32(x.config.Temperature),
-			MaxTokens:   x.config.MaxTokens,
-			TopP:        float32(x.config.TopP),
-		},
+		}),
 	)
 
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("request timed out after %v", defaultTimeout)
+			return "", &ProviderError{Provider: x.Name(), Kind: ErrorTimeout, Message: fmt.Sprintf("request timed out after %v", defaultTimeout), Err: err}
 		}
-		return "", fmt.Errorf("X.AI API error: %v", err)
+		return "", wrapRequestError(x.Name(), err)
 	}
+	reportChatUsage(ctx, modelName, resp.Usage)
 
 	if len(resp.Choices) == 0 {
 		return "", fmt.Errorf("no response choices returned from X.AI")
@@ -149,8 +163,46 @@ func (x *XAIProvider) SendPrompt(modelName string, prompt string) (string, error
 	return response, nil
 }
 
+// SendPromptStream sends a prompt to the specified model and streams the response
+func (x *XAIProvider) SendPromptStream(ctx context.Context, modelName string, prompt string, onDelta func(delta string)) (string, error) {
+	if x.apiKey == "" {
+		return "", fmt.Errorf("X.AI provider not configured: missing API key")
+	}
+
+	if !x.SupportsModel(modelName) {
+		return "", fmt.Errorf("invalid X.AI model: %s", modelName)
+	}
+
+	if err := x.checkPromptSize(modelName, prompt); err != nil {
+		return "", err
+	}
+
+	x.debugf("Streaming prompt to model: %s", modelName)
+	config := openai.DefaultConfig(x.apiKey)
+	config.BaseURL = "https://api.x.ai/v1"
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	req := x.createChatCompletionRequest(ctx, modelName, []openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleUser,
+			Content: prompt,
+		},
+	})
+	response, err := streamChatCompletion(ctx, openai.NewClientWithConfig(config), x.Name(), modelName, req, onDelta)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", &ProviderError{Provider: x.Name(), Kind: ErrorTimeout, Message: fmt.Sprintf("request timed out after %v", defaultTimeout), Err: err}
+		}
+		return "", err
+	}
+	x.debugf("Stream completed, response length: %d characters", len(response))
+	return response, nil
+}
+
 // SendPromptWithFile sends a prompt along with a file to the specified model and returns the response
-func (x *XAIProvider) SendPromptWithFile(modelName string, prompt string, file FileInput) (string, error) {
+func (x *XAIProvider) SendPromptWithFile(ctx context.Context, modelName string, prompt string, file FileInput) (string, error) {
 	x.debugf("Preparing to send prompt with file to model: %s", modelName)
 	x.debugf("File path: %s", file.Path)
 
@@ -173,7 +225,7 @@ func (x *XAIProvider) SendPromptWithFile(modelName string, prompt string, file F
 	client := openai.NewClientWithConfig(config)
 
 	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
 	// For image files, use MultiContent approach similar to OpenAI
@@ -194,24 +246,21 @@ func (x *XAIProvider) SendPromptWithFile(modelName string, prompt string, file F
 
 		resp, err := client.CreateChatCompletion(
 			ctx,
-			openai.ChatCompletionRequest{
-				Model: modelName,
-				Messages: []openai.ChatCompletionMessage{
-					{
-						Role:         openai.ChatMessageRoleUser,
-						MultiContent: content,
-					},
+			x.createChatCompletionRequest(ctx, modelName, []openai.ChatCompletionMessage{
+				{
+					Role:         openai.ChatMessageRoleUser,
+					MultiContent: content,
 				},
-				MaxTokens: x.config.MaxTokens,
-			},
+			}),
 		)
 
 		if err != nil {
 			if ctx.Err() == context.DeadlineExceeded {
-				return "", fmt.Errorf("request timed out after %v", defaultTimeout)
+				return "", &ProviderError{Provider: x.Name(), Kind: ErrorTimeout, Message: fmt.Sprintf("request timed out after %v", defaultTimeout), Err: err}
 			}
-			return "", fmt.Errorf("X.AI API error: %v", err)
+			return "", wrapRequestError(x.Name(), err)
 		}
+		reportChatUsage(ctx, modelName, resp.Usage)
 
 		if len(resp.Choices) == 0 {
 			return "", fmt.Errorf("no response choices returned from X.AI")
@@ -228,33 +277,27 @@ func (x *XAIProvider) SendPromptWithFile(modelName string, prompt string, file F
 	combinedPrompt := fmt.Sprintf("File content:\n%s\n\nUser prompt: %s", fileContent, prompt)
 
 	// Check estimated token count for combined prompt
-	estimatedTokens := x.estimateTokenCount(combinedPrompt)
-	if estimatedTokens > maxPromptTokens {
-		return "", fmt.Errorf("combined prompt likely exceeds maximum token limit of %d (estimated tokens: %d)", maxPromptTokens, estimatedTokens)
+	if err := x.checkPromptSize(modelName, combinedPrompt); err != nil {
+		return "", err
 	}
 
 	resp, err := client.CreateChatCompletion(
 		ctx,
-		openai.ChatCompletionRequest{
-			Model: modelName,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: combinedPrompt,
-				},
+		x.createChatCompletionRequest(ctx, modelName, []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: combinedPrompt,
 			},
-			Temperature: float32(x.config.Temperature),
-			MaxTokens:   x.config.MaxTokens,
-			TopP:        float32(x.config.TopP),
-		},
+		}),
 	)
 
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("request timed out after %v", defaultTimeout)
+			return "", &ProviderError{Provider: x.Name(), Kind: ErrorTimeout, Message: fmt.Sprintf("request timed out after %v", defaultTimeout), Err: err}
 		}
-		return "", fmt.Errorf("X.AI API error: %v", err)
+		return "", wrapRequestError(x.Name(), err)
 	}
+	reportChatUsage(ctx, modelName, resp.Usage)
 
 	if len(resp.Choices) == 0 {
 		return "", fmt.Errorf("no response choices returned from X.AI")
@@ -266,6 +309,63 @@ func (x *XAIProvider) SendPromptWithFile(modelName string, prompt string, file F
 	return response, nil
 }
 
+// SendMessages sends a conversation to the specified model and returns the response
+func (x *XAIProvider) SendMessages(ctx context.Context, modelName string, messages []Message) (string, error) {
+	reply, err := x.SendMessagesWithTools(ctx, modelName, messages, nil)
+	return reply.Content, err
+}
+
+// SendMessagesWithTools sends a conversation with the tools the model may call and returns its reply
+func (x *XAIProvider) SendMessagesWithTools(ctx context.Context, modelName string, messages []Message, tools []Tool) (Message, error) {
+	x.debugf("Preparing to send %d messages to model: %s", len(messages), modelName)
+
+	if x.apiKey == "" {
+		return Message{}, fmt.Errorf("X.AI provider not configured: missing API key")
+	}
+
+	if !x.SupportsModel(modelName) {
+		return Message{}, fmt.Errorf("invalid X.AI model: %s", modelName)
+	}
+
+	if err := validateMessages(messages); err != nil {
+		return Message{}, err
+	}
+
+	// Check estimated token count of the whole conversation
+	if err := x.checkPromptSize(modelName, MessagesText(messages)); err != nil {
+		return Message{}, err
+	}
+
+	config := openai.DefaultConfig(x.apiKey)
+	config.BaseURL = "https://api.x.ai/v1"
+	client := openai.NewClientWithConfig(config)
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	req := x.createChatCompletionRequest(ctx, modelName, chatMessages(messages))
+	req.Tools = chatTools(tools)
+
+	resp, err := client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return Message{}, &ProviderError{Provider: x.Name(), Kind: ErrorTimeout, Message: fmt.Sprintf("request timed out after %v", defaultTimeout), Err: err}
+		}
+		return Message{}, wrapRequestError(x.Name(), err)
+	}
+	reportChatUsage(ctx, modelName, resp.Usage)
+
+	if len(resp.Choices) == 0 {
+		return Message{}, fmt.Errorf("no response choices returned from X.AI")
+	}
+
+	reply := chatReply(resp.Choices[0].Message)
+	x.debugf("API call completed, response length: %d characters, tool calls: %d", len(reply.Content), len(reply.ToolCalls))
+
+	return reply, nil
+}
+
 // ValidateModel checks if the specific X.AI model variant is valid
 func (x *XAIProvider) ValidateModel(modelName string) bool {
 	return x.SupportsModel(modelName)
@@ -306,6 +406,11 @@ func init() {
 			Version:       "1.0.0",
 			ModelPrefixes: []string{"grok-"},
 			Priority:      75, // Medium-high priority for Grok models
+			CharsPerToken: 4,
+			ModelLimits: []ModelLimits{
+				{Prefix: "grok-", ContextWindow: 131072},
+				{Prefix: "grok-2-vision", ContextWindow: 32768},
+			},
 		},
 	)
 	RegisterProvider("xai", factory)
@@ -10,6 +10,22 @@ import (
 	"github.com/kris-hansen/comanda/utils/scraper"
 )
 
+// configuredProviderFor returns the configured provider instance for a model
+func (p *Processor) configuredProviderFor(modelName string) (models.Provider, error) {
+	// Get provider by detecting it from the model name
+	provider := models.DetectProvider(modelName)
+	if provider == nil {
+		return nil, fmt.Errorf("provider not found for model: %s", modelName)
+	}
+
+	// Use the configured provider instance
+	configuredProvider := p.providers[provider.Name()]
+	if configuredProvider == nil {
+		return nil, fmt.Errorf("provider %s not configured", provider.Name())
+	}
+	return configuredProvider, nil
+}
+
 // processActions handles the action section of the DSL
 func (p *Processor) processActions(modelNames []string, actions []string) (string, error) {
 	if len(modelNames) == 0 {
@@ -17,7 +33,7 @@ func (p *Processor) processActions(modelNames []string, actions []string) (strin
 	}
 
 	// For now, use the first model specified
-	modelName := modelNames[0]
+	modelName := p.envConfig.ResolveModel(modelNames[0])
 
 	// Special case: if model is NA, return the input content directly
 	if modelName == "NA" {
@@ -35,17 +51,11 @@ func (p *Processor) processActions(modelNames []string, actions []string) (strin
 		return strings.Join(contents, "\n"), nil
 	}
 
-	// Get provider by detecting it from the model name
-	provider := models.DetectProvider(modelName)
-	if provider == nil {
-		return "", fmt.Errorf("provider not found for model: %s", modelName)
-	}
-
-	// Use the configured provider instance
-	configuredProvider := p.providers[provider.Name()]
-	if configuredProvider == nil {
-		return "", fmt.Errorf("provider %s not configured", provider.Name())
+	configuredProvider, err := p.configuredProviderFor(modelName)
+	if err != nil {
+		return "", err
 	}
+	configuredProvider = p.withStream(p.stepProvider(configuredProvider))
 
 	p.debugf("Using model %s with provider %s", modelName, configuredProvider.Name())
 	p.debugf("Processing %d action(s)", len(actions))
@@ -66,7 +76,10 @@ func (p *Processor) processActions(modelNames []string, actions []string) (strin
 		inputs := p.handler.GetInputs()
 		if len(inputs) == 0 {
 			// If there are no inputs, just send the action directly
-			return configuredProvider.SendPrompt(modelName, action)
+			if p.usesMessages() {
+				return p.sendMessage(configuredProvider, modelName, action)
+			}
+			return configuredProvider.SendPrompt(p.ctx, modelName, action)
 		}
 
 		// Process inputs based on their type
@@ -99,7 +112,7 @@ func (p *Processor) processActions(modelNames []string, actions []string) (strin
 						scraper.SetCustomHeaders(headerMap)
 					}
 				}
-				scrapedData, err := scraper.Scrape(inputItem.Path)
+				scrapedData, err := scraper.Scrape(p.ctx, inputItem.Path)
 				if err != nil {
 					return "", fmt.Errorf("failed to scrape URL %s: %w", inputItem.Path, err)
 				}
@@ -115,10 +128,19 @@ func (p *Processor) processActions(modelNames []string, actions []string) (strin
 			}
 		}
 
+		// Conversation and tool steps send their inputs as text in a user message
+		if p.usesMessages() {
+			prompt, err := messagePrompt(action, fileInputs, nonFileInputs)
+			if err != nil {
+				return "", err
+			}
+			return p.sendMessage(configuredProvider, modelName, prompt)
+		}
+
 		// If we have file inputs, use SendPromptWithFile
 		if len(fileInputs) > 0 {
 			if len(fileInputs) == 1 {
-				return configuredProvider.SendPromptWithFile(modelName, action, fileInputs[0])
+				return configuredProvider.SendPromptWithFile(p.ctx, modelName, action, fileInputs[0])
 			}
 
 			// Check if we should use combined or individual processing mode
@@ -140,7 +162,7 @@ func (p *Processor) processActions(modelNames []string, actions []string) (strin
 					combinedPrompt += fmt.Sprintf("File %d (%s):\n%s\n\n", i+1, file.Path, string(content))
 				}
 				combinedPrompt += fmt.Sprintf("\nAction: %s", action)
-				return configuredProvider.SendPrompt(modelName, combinedPrompt)
+				return configuredProvider.SendPrompt(p.ctx, modelName, combinedPrompt)
 			}
 
 			// Default to individual processing mode (safer)
@@ -152,7 +174,7 @@ func (p *Processor) processActions(modelNames []string, actions []string) (strin
 				p.debugf("Processing file %d/%d: %s", i+1, len(fileInputs), file.Path)
 
 				// Try to process each file individually
-				result, err := configuredProvider.SendPromptWithFile(modelName,
+				result, err := configuredProvider.SendPromptWithFile(p.ctx, modelName,
 					fmt.Sprintf("For this file: %s", action), file)
 
 				if err != nil {
@@ -189,7 +211,7 @@ func (p *Processor) processActions(modelNames []string, actions []string) (strin
 		// If we have non-file inputs, combine them and use SendPrompt
 		if len(nonFileInputs) > 0 {
 			combinedInput := strings.Join(nonFileInputs, "\n\n")
-			return configuredProvider.SendPrompt(modelName, fmt.Sprintf("Input:\n%s\n\nAction: %s", combinedInput, action))
+			return configuredProvider.SendPrompt(p.ctx, modelName, fmt.Sprintf("Input:\n%s\n\nAction: %s", combinedInput, action))
 		}
 	}
 
@@ -0,0 +1,229 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/cache"
+	"github.com/kris-hansen/comanda/utils/models"
+	"gopkg.in/yaml.v3"
+)
+
+// CacheConfig controls whether a step reuses cached model responses:
+//
+//	cache: true    # reuse cached responses of any age
+//	cache: false   # always call the model, even when caching is enabled globally
+//	cache: 24h     # reuse cached responses up to 24 hours old
+type CacheConfig struct {
+	Enabled bool
+	TTL     time.Duration // Maximum age of a reused response (0 for no limit)
+}
+
+// UnmarshalYAML accepts a boolean or a duration
+func (c *CacheConfig) UnmarshalYAML(value *yaml.Node) error {
+	var enabled bool
+	if err := value.Decode(&enabled); err == nil {
+		*c = CacheConfig{Enabled: enabled}
+		return nil
+	}
+	var ttl time.Duration
+	if err := value.Decode(&ttl); err != nil || ttl <= 0 {
+		return fmt.Errorf("cache must be true, false or a positive duration such as 24h, got '%s'", value.Value)
+	}
+	*c = CacheConfig{Enabled: true, TTL: ttl}
+	return nil
+}
+
+// CacheOptions configures response caching for a whole workflow
+type CacheOptions struct {
+	Store    *cache.Store  // Where responses are cached (nil for the default directory)
+	Enabled  bool          // Cache steps that do not set cache themselves
+	TTL      time.Duration // Maximum age of reused responses for those steps
+	Disabled bool          // Never use the cache, even for steps that set cache
+}
+
+// SetCacheOptions configures response caching for the workflow
+func (p *Processor) SetCacheOptions(opts CacheOptions) {
+	p.cacheOptions = opts
+}
+
+// stepCacheConfig returns the cache settings for the current step, or nil if it is not cached
+func (p *Processor) stepCacheConfig() *CacheConfig {
+	if p.cacheOptions.Disabled {
+		return nil
+	}
+	if p.currentStep != nil && p.currentStep.Config.Cache != nil {
+		if !p.currentStep.Config.Cache.Enabled {
+			return nil
+		}
+		return p.currentStep.Config.Cache
+	}
+	if p.cacheOptions.Enabled {
+		return &CacheConfig{Enabled: true, TTL: p.cacheOptions.TTL}
+	}
+	return nil
+}
+
+// cachingProvider answers prompts from the response cache when it can, and caches
+// successful responses from the wrapped provider
+type cachingProvider struct {
+	models.Provider
+	processor *Processor
+	store     *cache.Store
+	ttl       time.Duration
+}
+
+// SendPrompt returns a cached response or sends the prompt
+func (c *cachingProvider) SendPrompt(ctx context.Context, modelName string, prompt string) (string, error) {
+	key := cache.Key{Provider: c.Name(), Model: modelName, Prompt: prompt, Options: requestCacheOptions(ctx)}
+	return c.cached(key, func() (string, error) {
+		return c.Provider.SendPrompt(ctx, modelName, prompt)
+	})
+}
+
+// SendPromptStream returns a cached response, streamed in one piece, or streams the prompt
+func (c *cachingProvider) SendPromptStream(ctx context.Context, modelName string, prompt string, onDelta func(delta string)) (string, error) {
+	key := cache.Key{Provider: c.Name(), Model: modelName, Prompt: prompt, Options: requestCacheOptions(ctx)}
+	if response, ok := c.store.Get(key, c.ttl); ok {
+		c.processor.debugf("Using cached response for model %s", key.Model)
+		onDelta(response)
+		return response, nil
+	}
+	return c.cached(key, func() (string, error) {
+		return models.SendPromptStream(ctx, c.Provider, modelName, prompt, onDelta)
+	})
+}
+
+// SendPromptWithFile returns a cached response or sends the prompt with the file
+func (c *cachingProvider) SendPromptWithFile(ctx context.Context, modelName string, prompt string, file models.FileInput) (string, error) {
+	call := func() (string, error) {
+		return c.Provider.SendPromptWithFile(ctx, modelName, prompt, file)
+	}
+	sum, err := hashFile(file.Path)
+	if err != nil {
+		// Let the provider report unreadable files
+		return call()
+	}
+	key := cache.Key{Provider: c.Name(), Model: modelName, Prompt: prompt, Files: []string{sum}, Options: requestCacheOptions(ctx)}
+	return c.cached(key, call)
+}
+
+// SendMessages returns a cached response or sends the conversation
+func (c *cachingProvider) SendMessages(ctx context.Context, modelName string, messages []models.Message) (string, error) {
+	call := func() (string, error) {
+		return c.Provider.SendMessages(ctx, modelName, messages)
+	}
+	conversation, err := json.Marshal(messages)
+	if err != nil {
+		return call()
+	}
+	key := cache.Key{Provider: c.Name(), Model: modelName, Prompt: string(conversation), Options: requestCacheOptions(ctx)}
+	return c.cached(key, call)
+}
+
+// SendMessagesWithTools returns a cached reply or sends the conversation with the tools. The
+// tool results are part of the conversation, so calls made after a tool ran are cached apart.
+func (c *cachingProvider) SendMessagesWithTools(ctx context.Context, modelName string, messages []models.Message, tools []models.Tool) (models.Message, error) {
+	conversation, err := json.Marshal(messages)
+	toolSchemas, toolsErr := json.Marshal(tools)
+	if err != nil || toolsErr != nil {
+		return c.Provider.SendMessagesWithTools(ctx, modelName, messages, tools)
+	}
+	options := requestCacheOptions(ctx)
+	if options == nil {
+		options = make(map[string]string)
+	}
+	options["tools"] = string(toolSchemas)
+
+	key := cache.Key{Provider: c.Name(), Model: modelName, Prompt: string(conversation), Options: options}
+	response, err := c.cached(key, func() (string, error) {
+		reply, err := c.Provider.SendMessagesWithTools(ctx, modelName, messages, tools)
+		if err != nil {
+			return "", err
+		}
+		encoded, err := json.Marshal(reply)
+		return string(encoded), err
+	})
+	if err != nil {
+		return models.Message{}, err
+	}
+	var reply models.Message
+	if err := json.Unmarshal([]byte(response), &reply); err != nil {
+		return models.Message{}, fmt.Errorf("failed to decode cached reply: %w", err)
+	}
+	return reply, nil
+}
+
+// requestCacheOptions returns the request options that change a model's response, for use in cache keys
+func requestCacheOptions(ctx context.Context) map[string]string {
+	opts := models.RequestOptionsFromContext(ctx)
+	options := make(map[string]string)
+	if opts.JSON {
+		options["json"] = "true"
+	}
+	if opts.JSONSchema != nil {
+		schema, _ := json.Marshal(opts.JSONSchema)
+		options["json_schema"] = string(schema)
+	}
+	if opts.Temperature != nil {
+		options["temperature"] = strconv.FormatFloat(*opts.Temperature, 'g', -1, 64)
+	}
+	if opts.MaxTokens != nil {
+		options["max_tokens"] = strconv.Itoa(*opts.MaxTokens)
+	}
+	if opts.TopP != nil {
+		options["top_p"] = strconv.FormatFloat(*opts.TopP, 'g', -1, 64)
+	}
+	if len(opts.Stop) > 0 {
+		stop, _ := json.Marshal(opts.Stop)
+		options["stop"] = string(stop)
+	}
+	if opts.Seed != nil {
+		options["seed"] = strconv.Itoa(*opts.Seed)
+	}
+	if opts.System != "" {
+		options["system"] = opts.System
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	return options
+}
+
+// cached looks key up in the store, running call and caching its result on a miss
+func (c *cachingProvider) cached(key cache.Key, call func() (string, error)) (string, error) {
+	if response, ok := c.store.Get(key, c.ttl); ok {
+		c.processor.debugf("Using cached response for model %s", key.Model)
+		return response, nil
+	}
+	response, err := call()
+	if err != nil {
+		return "", err
+	}
+	if err := c.store.Put(key, response); err != nil {
+		c.processor.debugf("Warning: failed to cache response for model %s: %v", key.Model, err)
+	}
+	return response, nil
+}
+
+// withStepCache wraps a provider so that calls made for the current step use the response
+// cache when the step, or the workflow, enables it
+func (p *Processor) withStepCache(provider models.Provider) models.Provider {
+	cfg := p.stepCacheConfig()
+	if cfg == nil {
+		return provider
+	}
+	store := p.cacheOptions.Store
+	if store == nil {
+		store = cache.Open(cache.DefaultDir())
+	}
+	return &cachingProvider{
+		Provider:  provider,
+		processor: p,
+		store:     store,
+		ttl:       cfg.TTL,
+	}
+}
@@ -0,0 +1,114 @@
+package processor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/cache"
+	"github.com/kris-hansen/comanda/utils/models"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCacheConfigUnmarshal(t *testing.T) {
+	tests := []struct {
+		yaml     string
+		expected CacheConfig
+		wantErr  bool
+	}{
+		{yaml: "cache: true", expected: CacheConfig{Enabled: true}},
+		{yaml: "cache: false", expected: CacheConfig{}},
+		{yaml: "cache: 24h", expected: CacheConfig{Enabled: true, TTL: 24 * time.Hour}},
+		{yaml: "cache: later", wantErr: true},
+		{yaml: "cache: -1h", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.yaml, func(t *testing.T) {
+			var config StepConfig
+			err := yaml.Unmarshal([]byte(tt.yaml), &config)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *config.Cache != tt.expected {
+				t.Errorf("Cache = %+v, want %+v", *config.Cache, tt.expected)
+			}
+		})
+	}
+}
+
+func TestStepResponseCache(t *testing.T) {
+	tests := []struct {
+		name     string
+		step     *CacheConfig
+		options  CacheOptions
+		wantHits bool
+	}{
+		{name: "step enables the cache", step: &CacheConfig{Enabled: true}, wantHits: true},
+		{name: "global flag enables the cache", options: CacheOptions{Enabled: true}, wantHits: true},
+		{name: "step opts out of the global cache", step: &CacheConfig{}, options: CacheOptions{Enabled: true}},
+		{name: "no-cache overrides the step", step: &CacheConfig{Enabled: true}, options: CacheOptions{Disabled: true}},
+		{name: "caching is off by default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.options.Store = cache.Open(t.TempDir())
+			run := func(provider *scriptedProvider) string {
+				useScriptedProvider(t, provider)
+				dslConfig := &DSLConfig{Steps: []Step{{
+					Name:   "summarize",
+					Config: StepConfig{Input: "NA", Model: "gpt-4o-mini", Action: "summarize", Output: "STDOUT", Cache: tt.step},
+				}}}
+				processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+				processor.SetCacheOptions(tt.options)
+				if err := processor.Process(); err != nil {
+					t.Fatalf("Process() returned unexpected error: %v", err)
+				}
+				return processor.LastOutput()
+			}
+
+			run(newScriptedProvider("first"))
+			second := newScriptedProvider("second")
+			output := run(second)
+
+			if tt.wantHits {
+				if output != "first" || len(second.prompts) != 0 {
+					t.Errorf("expected the cached response without a model call, got %q after %d call(s)", output, len(second.prompts))
+				}
+			} else if output != "second" {
+				t.Errorf("expected a fresh response, got %q", output)
+			}
+		})
+	}
+}
+
+func TestRequestCacheOptionsIncludeModelParams(t *testing.T) {
+	base := requestCacheOptions(models.WithRequestOptions(context.Background(), models.RequestOptions{Temperature: floatPtr(0.2)}))
+	tests := []struct {
+		name string
+		opts models.RequestOptions
+		same bool
+	}{
+		{"same temperature", models.RequestOptions{Temperature: floatPtr(0.2)}, true},
+		{"different temperature", models.RequestOptions{Temperature: floatPtr(0.8)}, false},
+		{"added system prompt", models.RequestOptions{Temperature: floatPtr(0.2), System: "Be terse."}, false},
+		{"added stop sequence", models.RequestOptions{Temperature: floatPtr(0.2), Stop: []string{"END"}}, false},
+		{"added seed", models.RequestOptions{Temperature: floatPtr(0.2), Seed: intPtr(1)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := requestCacheOptions(models.WithRequestOptions(context.Background(), tt.opts))
+			if reflect.DeepEqual(options, base) != tt.same {
+				t.Errorf("requestCacheOptions() = %v, base %v, want same = %v", options, base, tt.same)
+			}
+		})
+	}
+}
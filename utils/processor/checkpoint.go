@@ -0,0 +1,373 @@
+package processor
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/models"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultRunStateDir is the directory run state is saved to when none is configured
+const DefaultRunStateDir = ".comanda/runs"
+
+// DefaultKeepRuns is the number of most recent runs whose state is kept when a new run starts
+const DefaultKeepRuns = 20
+
+// runStateFile is the name of the file holding a run's state within its directory
+const runStateFile = "state.json"
+
+// RunState is the saved state of a workflow run. It records the result of every completed
+// step so that a failed run can be resumed without repeating those steps.
+type RunState struct {
+	RunID     string                     `json:"run_id"`
+	Workflow  string                     `json:"workflow"` // Path of the workflow file
+	CreatedAt time.Time                  `json:"created_at"`
+	UpdatedAt time.Time                  `json:"updated_at"`
+	Steps     map[string]*StepCheckpoint `json:"steps"`
+}
+
+// StepCheckpoint is the saved result of a completed step
+type StepCheckpoint struct {
+	Hash        string            `json:"hash"`                  // Hash of the step's configuration and inputs
+	Output      string            `json:"output"`                // Output passed on to dependent steps
+	Model       string            `json:"model,omitempty"`       // Model that produced the output
+	ResponseID  string            `json:"response_id,omitempty"` // Response ID of openai-responses steps
+	Variables   map[string]string `json:"variables,omitempty"`   // Variables set or changed by the step
+	Files       []FileCheckpoint  `json:"files,omitempty"`       // Files written by the step
+	Turns       []models.Message  `json:"turns,omitempty"`       // Messages the step added to its conversation
+	CompletedAt time.Time         `json:"completed_at"`
+}
+
+// FileCheckpoint records a file written by a step and the hash of its contents
+type FileCheckpoint struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// Checkpointer saves the result of each completed step to a run state directory
+type Checkpointer struct {
+	dir   string // Directory holding this run's state
+	state *RunState
+}
+
+// NewCheckpointer starts a new run with a fresh run ID. Its state is saved in a
+// directory named after the run ID within baseDir.
+func NewCheckpointer(baseDir, workflow string) (*Checkpointer, error) {
+	if baseDir == "" {
+		baseDir = DefaultRunStateDir
+	}
+	runID, err := newRunID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create run ID: %w", err)
+	}
+	now := time.Now()
+	c := &Checkpointer{
+		dir: filepath.Join(baseDir, runID),
+		state: &RunState{
+			RunID:     runID,
+			Workflow:  workflow,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Steps:     make(map[string]*StepCheckpoint),
+		},
+	}
+	if err := c.save(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadCheckpointer loads the state of an earlier run so that it can be resumed
+func LoadCheckpointer(baseDir, runID string) (*Checkpointer, error) {
+	if baseDir == "" {
+		baseDir = DefaultRunStateDir
+	}
+	if runID == "" || strings.ContainsAny(runID, `/\`) || runID == "." || runID == ".." {
+		return nil, fmt.Errorf("invalid run ID '%s'", runID)
+	}
+
+	dir := filepath.Join(baseDir, runID)
+	data, err := os.ReadFile(filepath.Join(dir, runStateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("run '%s' not found in %s", runID, baseDir)
+		}
+		return nil, fmt.Errorf("failed to read state of run '%s': %w", runID, err)
+	}
+	var state RunState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state of run '%s': %w", runID, err)
+	}
+	if state.Steps == nil {
+		state.Steps = make(map[string]*StepCheckpoint)
+	}
+	return &Checkpointer{dir: dir, state: &state}, nil
+}
+
+// RunID returns the ID of the run
+func (c *Checkpointer) RunID() string {
+	return c.state.RunID
+}
+
+// Workflow returns the path of the workflow file the run was started with
+func (c *Checkpointer) Workflow() string {
+	return c.state.Workflow
+}
+
+// Dir returns the directory the run's state is saved in
+func (c *Checkpointer) Dir() string {
+	return c.dir
+}
+
+// lookup returns the checkpoint of a step if the step completed with the same hash and
+// the files it wrote are unchanged
+func (c *Checkpointer) lookup(stepName, hash string) (*StepCheckpoint, bool) {
+	checkpoint, ok := c.state.Steps[stepName]
+	if !ok || checkpoint.Hash != hash {
+		return nil, false
+	}
+	for _, file := range checkpoint.Files {
+		sum, err := hashFile(file.Path)
+		if err != nil || sum != file.SHA256 {
+			return nil, false
+		}
+	}
+	return checkpoint, true
+}
+
+// record saves the result of a completed step
+func (c *Checkpointer) record(stepName, hash string, result *StepResult, variables map[string]string, files []string, turns []models.Message) error {
+	checkpoint := &StepCheckpoint{
+		Hash:        hash,
+		Output:      result.Output,
+		Model:       result.Model,
+		ResponseID:  result.ResponseID,
+		Variables:   variables,
+		Turns:       turns,
+		CompletedAt: time.Now(),
+	}
+	seen := make(map[string]bool)
+	for _, path := range files {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		sum, err := hashFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to hash output file '%s': %w", path, err)
+		}
+		checkpoint.Files = append(checkpoint.Files, FileCheckpoint{Path: path, SHA256: sum})
+	}
+
+	c.state.Steps[stepName] = checkpoint
+	c.state.UpdatedAt = checkpoint.CompletedAt
+	return c.save()
+}
+
+// save writes the run state, replacing the previous file atomically
+func (c *Checkpointer) save() error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create run state directory '%s': %w", c.dir, err)
+	}
+	data, err := json.MarshalIndent(c.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run state: %w", err)
+	}
+	tmp := filepath.Join(c.dir, runStateFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write run state: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(c.dir, runStateFile)); err != nil {
+		return fmt.Errorf("failed to write run state: %w", err)
+	}
+	return nil
+}
+
+// PruneRuns removes the state of all but the keep most recent runs in baseDir. Run IDs sort
+// by start time, and directories without a run state file are left alone.
+func PruneRuns(baseDir string, keep int) error {
+	if baseDir == "" {
+		baseDir = DefaultRunStateDir
+	}
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to list runs in %s: %w", baseDir, err)
+	}
+
+	var runs []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(baseDir, entry.Name(), runStateFile)); err == nil {
+			runs = append(runs, entry.Name())
+		}
+	}
+	sort.Strings(runs)
+	for _, runID := range runs[:max(len(runs)-max(keep, 0), 0)] {
+		if err := os.RemoveAll(filepath.Join(baseDir, runID)); err != nil {
+			return fmt.Errorf("failed to remove state of run '%s': %w", runID, err)
+		}
+	}
+	return nil
+}
+
+// newRunID returns a sortable, unique ID such as 20250102-150405-a1b2c3
+func newRunID() (string, error) {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix), nil
+}
+
+// SetCheckpointer enables checkpointing. Completed steps are saved as the workflow runs,
+// and steps already saved with an unchanged hash are restored instead of run again.
+func (p *Processor) SetCheckpointer(c *Checkpointer) {
+	p.checkpoint = c
+}
+
+// stepHash identifies a step run by its configuration and everything it reads: STDIN, the
+// current variables, the history of its conversation, the contents of its input files and,
+// for sub-workflow steps, the workflow file. URLs and database inputs are identified by their
+// address only.
+func (p *Processor) stepHash(step Step) (string, error) {
+	h := sha256.New()
+	config, err := yaml.Marshal(step.Config)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode step configuration: %w", err)
+	}
+	fmt.Fprintf(h, "step %q\n%s\nstdin %d\n%s\n", step.Name, config, len(p.lastOutput), p.lastOutput)
+
+	names := make([]string, 0, len(p.variables))
+	for name := range p.variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "var %q=%q\n", name, p.variables[name])
+	}
+
+	if id := step.Config.Conversation; id != "" {
+		for _, message := range p.conversations.messages(id) {
+			fmt.Fprintf(h, "message %q %q\n", message.Role, message.Content)
+		}
+	}
+
+	// Outputs of earlier steps the step refers to by name
+	stepNames := make([]string, 0, len(p.stepResults))
+	for name := range p.stepResults {
+		stepNames = append(stepNames, name)
+	}
+	sort.Strings(stepNames)
+	for _, name := range stepNames {
+		if bytes.Contains(config, []byte("steps."+name)) {
+			fmt.Fprintf(h, "step output %q=%q\n", name, p.stepResults[name].Output)
+		}
+	}
+
+	var inputs []string
+	for _, input := range p.NormalizeStringSlice(step.Config.Input) {
+		input, _ = p.parseVariableAssignment(p.substituteVariables(input))
+		inputs = append(inputs, input)
+	}
+	if step.Config.ForEach != nil {
+		items, err := p.resolveForEachItems(step.Config.ForEach)
+		if err != nil {
+			return "", err
+		}
+		for _, item := range items {
+			fmt.Fprintf(h, "item %q\n", item.value)
+			inputs = append(inputs, item.value)
+		}
+	}
+	if step.Config.Process != nil {
+		inputs = append(inputs, step.Config.Process.WorkflowFile)
+	}
+
+	for _, input := range inputs {
+		if err := p.hashInput(h, input); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashInput adds the contents of the files an input refers to. Inputs that are not local
+// files are left to the configuration hash.
+func (p *Processor) hashInput(w io.Writer, input string) error {
+	if input == "" || p.isSpecialInput(input) || p.isURL(input) {
+		return nil
+	}
+
+	paths := []string{p.resolveDataPath(input)}
+	if strings.ContainsAny(input, "*?[") {
+		matches, err := filepath.Glob(paths[0])
+		if err != nil {
+			return nil
+		}
+		paths = matches
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			if err := hashInputFile(w, path); err != nil {
+				return err
+			}
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			return hashInputFile(w, file)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to hash input directory '%s': %w", path, err)
+		}
+	}
+	return nil
+}
+
+// hashInputFile adds a file's path and content hash
+func hashInputFile(w io.Writer, path string) error {
+	sum, err := hashFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to hash input file '%s': %w", path, err)
+	}
+	fmt.Fprintf(w, "file %q %s\n", path, sum)
+	return nil
+}
+
+// hashFile returns the SHA-256 of a file's contents
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,201 @@
+package processor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// checkpointWorkflow drafts a file in one step and summarizes it in the next
+func checkpointWorkflow(dir, draftAction string) *DSLConfig {
+	draftFile := filepath.Join(dir, "draft.txt")
+	return &DSLConfig{Steps: []Step{
+		{Name: "draft", Config: StepConfig{Input: "NA", Model: "gpt-4o-mini", Action: draftAction, Output: draftFile}},
+		{Name: "summarize", Config: StepConfig{Input: draftFile, Model: "gpt-4o-mini", Action: "summarize", Output: "STDOUT"}},
+	}}
+}
+
+func runCheckpointed(t *testing.T, dslConfig *DSLConfig, checkpointer *Checkpointer, provider *scriptedProvider) (*Processor, error) {
+	t.Helper()
+	useScriptedProvider(t, provider)
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+	processor.SetCheckpointer(checkpointer)
+	return processor, processor.Process()
+}
+
+// failedRun runs the workflow once with the second step failing and returns the run ID
+func failedRun(t *testing.T, stateDir, workDir string) string {
+	t.Helper()
+	checkpointer, err := NewCheckpointer(stateDir, "workflow.yaml")
+	if err != nil {
+		t.Fatalf("NewCheckpointer() error: %v", err)
+	}
+	provider := newScriptedProvider("draft text", "")
+	provider.errs = []error{nil, errors.New("provider down")}
+	if _, err := runCheckpointed(t, checkpointWorkflow(workDir, "write a draft"), checkpointer, provider); err == nil {
+		t.Fatal("expected the first run to fail")
+	}
+	return checkpointer.RunID()
+}
+
+func TestCheckpointResumeSkipsCompletedSteps(t *testing.T) {
+	stateDir, workDir := t.TempDir(), t.TempDir()
+	runID := failedRun(t, stateDir, workDir)
+
+	checkpointer, err := LoadCheckpointer(stateDir, runID)
+	if err != nil {
+		t.Fatalf("LoadCheckpointer() error: %v", err)
+	}
+	if checkpointer.Workflow() != "workflow.yaml" {
+		t.Errorf("Workflow() = %q, want %q", checkpointer.Workflow(), "workflow.yaml")
+	}
+
+	provider := newScriptedProvider("summary")
+	processor, err := runCheckpointed(t, checkpointWorkflow(workDir, "write a draft"), checkpointer, provider)
+	if err != nil {
+		t.Fatalf("resumed run failed: %v", err)
+	}
+	if len(provider.prompts) != 1 || !strings.Contains(provider.prompts[0], "summarize") {
+		t.Errorf("expected only the summarize step to run, got prompts %q", provider.prompts)
+	}
+	if processor.LastOutput() != "summary" {
+		t.Errorf("LastOutput() = %q, want %q", processor.LastOutput(), "summary")
+	}
+}
+
+func TestCheckpointResumeRerunsChangedSteps(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		setup  func(t *testing.T, workDir string)
+	}{
+		{
+			name:   "changed configuration",
+			action: "write a longer draft",
+		},
+		{
+			name:   "changed output file",
+			action: "write a draft",
+			setup: func(t *testing.T, workDir string) {
+				if err := os.WriteFile(filepath.Join(workDir, "draft.txt"), []byte("edited"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:   "missing output file",
+			action: "write a draft",
+			setup: func(t *testing.T, workDir string) {
+				if err := os.Remove(filepath.Join(workDir, "draft.txt")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stateDir, workDir := t.TempDir(), t.TempDir()
+			runID := failedRun(t, stateDir, workDir)
+			if tt.setup != nil {
+				tt.setup(t, workDir)
+			}
+
+			checkpointer, err := LoadCheckpointer(stateDir, runID)
+			if err != nil {
+				t.Fatalf("LoadCheckpointer() error: %v", err)
+			}
+			provider := newScriptedProvider("new draft", "summary")
+			if _, err := runCheckpointed(t, checkpointWorkflow(workDir, tt.action), checkpointer, provider); err != nil {
+				t.Fatalf("resumed run failed: %v", err)
+			}
+			if len(provider.prompts) != 2 {
+				t.Errorf("expected both steps to run, got %d prompts", len(provider.prompts))
+			}
+		})
+	}
+}
+
+func TestCheckpointResumeRestoresConversation(t *testing.T) {
+	stateDir := t.TempDir()
+	dslConfig := &DSLConfig{Steps: []Step{
+		{Name: "introduce", Config: StepConfig{Input: "NA", Model: "gpt-4o-mini", Action: "My name is Ada.", Output: "STDOUT", Conversation: "chat"}},
+		{Name: "recall", Config: StepConfig{Input: "NA", Model: "gpt-4o-mini", Action: "What is my name?", Output: "STDOUT", Conversation: "chat"}},
+	}}
+
+	checkpointer, err := NewCheckpointer(stateDir, "workflow.yaml")
+	if err != nil {
+		t.Fatalf("NewCheckpointer() error: %v", err)
+	}
+	provider := newScriptedProvider("Hello, Ada.", "")
+	provider.errs = []error{nil, errors.New("provider down")}
+	if _, err := runCheckpointed(t, dslConfig, checkpointer, provider); err == nil {
+		t.Fatal("expected the first run to fail")
+	}
+
+	checkpointer, err = LoadCheckpointer(stateDir, checkpointer.RunID())
+	if err != nil {
+		t.Fatalf("LoadCheckpointer() error: %v", err)
+	}
+	provider = newScriptedProvider("Your name is Ada.")
+	if _, err := runCheckpointed(t, dslConfig, checkpointer, provider); err != nil {
+		t.Fatalf("resumed run failed: %v", err)
+	}
+	want := []models.Message{
+		{Role: models.RoleUser, Content: "My name is Ada."},
+		{Role: models.RoleAssistant, Content: "Hello, Ada."},
+		{Role: models.RoleUser, Content: "What is my name?"},
+	}
+	if len(provider.messages) != 1 || !reflect.DeepEqual(provider.messages[0], want) {
+		t.Errorf("resumed conversation messages = %+v, want %+v", provider.messages, want)
+	}
+}
+
+func TestPruneRuns(t *testing.T) {
+	stateDir := t.TempDir()
+	runs := []string{"20250101-000000-aaaaaa", "20250102-000000-bbbbbb", "20250103-000000-cccccc"}
+	for _, runID := range runs {
+		if err := os.MkdirAll(filepath.Join(stateDir, runID), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(stateDir, runID, runStateFile), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(stateDir, "notes"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PruneRuns(stateDir, 2); err != nil {
+		t.Fatalf("PruneRuns() error: %v", err)
+	}
+	entries, err := os.ReadDir(stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+	if want := []string{runs[1], runs[2], "notes"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("remaining entries = %q, want %q", got, want)
+	}
+
+	if err := PruneRuns(filepath.Join(stateDir, "missing"), 2); err != nil {
+		t.Errorf("PruneRuns() of a missing directory error: %v", err)
+	}
+}
+
+func TestLoadCheckpointerErrors(t *testing.T) {
+	stateDir := t.TempDir()
+	for _, runID := range []string{"", "..", "../other", "missing"} {
+		if _, err := LoadCheckpointer(stateDir, runID); err == nil {
+			t.Errorf("LoadCheckpointer(%q) expected error", runID)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kris-hansen/comanda/utils/input"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// Chunk size units
+const (
+	ChunkUnitTokens = "tokens" // Estimated tokens (default)
+	ChunkUnitChars  = "chars"  // Characters
+)
+
+// Chunk boundaries decide where a chunk may end
+const (
+	ChunkBoundaryParagraph = "paragraph" // Between paragraphs (default)
+	ChunkBoundaryLine      = "line"      // Between lines
+	ChunkBoundaryHeading   = "heading"   // Before markdown headings
+)
+
+// ChunkingConfig splits a step's input into chunks that are processed one at a time
+type ChunkingConfig struct {
+	Size     int    `yaml:"size"`     // Maximum size of a chunk
+	Unit     string `yaml:"unit"`     // Unit of size and overlap: tokens (default) or chars
+	Overlap  int    `yaml:"overlap"`  // Text repeated from the end of the previous chunk
+	Boundary string `yaml:"boundary"` // Where chunks end: paragraph (default), line or heading
+}
+
+// measure returns the function that measures text in the unit of size and overlap, with
+// tokens estimated for the model
+func (c *ChunkingConfig) measure(modelName string) func(string) int {
+	if c.Unit == ChunkUnitChars {
+		return utf8.RuneCountInString
+	}
+	return func(text string) int {
+		return models.EstimateTokens(modelName, text)
+	}
+}
+
+// validateChunking checks the chunking, reduce_action and reduce_model fields of a step
+func validateChunking(config StepConfig) error {
+	if config.Chunking == nil {
+		if config.ReduceAction != nil {
+			return fmt.Errorf("reduce_action requires chunking")
+		}
+		if config.ReduceModel != nil {
+			return fmt.Errorf("reduce_model requires chunking")
+		}
+		return nil
+	}
+
+	c := config.Chunking
+	if config.Type == "openai-responses" || config.Generate != nil || config.Process != nil {
+		return fmt.Errorf("chunking is only supported on standard steps")
+	}
+	if c.Size <= 0 {
+		return fmt.Errorf("chunking size must be greater than 0")
+	}
+	if c.Overlap < 0 || c.Overlap >= c.Size {
+		return fmt.Errorf("chunking overlap must be at least 0 and less than size")
+	}
+	switch c.Unit {
+	case "", ChunkUnitTokens, ChunkUnitChars:
+	default:
+		return fmt.Errorf("invalid chunking unit '%s': must be %s or %s", c.Unit, ChunkUnitTokens, ChunkUnitChars)
+	}
+	switch c.Boundary {
+	case "", ChunkBoundaryParagraph, ChunkBoundaryLine, ChunkBoundaryHeading:
+	default:
+		return fmt.Errorf("invalid chunking boundary '%s': must be one of %s, %s or %s",
+			c.Boundary, ChunkBoundaryParagraph, ChunkBoundaryLine, ChunkBoundaryHeading)
+	}
+	if config.ReduceModel != nil && config.ReduceAction == nil {
+		return fmt.Errorf("reduce_model requires reduce_action")
+	}
+	if config.OutputSchema != nil && config.ReduceAction == nil {
+		return fmt.Errorf("output_schema on a chunked step requires reduce_action")
+	}
+	return nil
+}
+
+// headingPattern matches a markdown heading line
+var headingPattern = regexp.MustCompile(`^#{1,6}\s`)
+
+// paragraphBreakPattern matches the blank lines between paragraphs
+var paragraphBreakPattern = regexp.MustCompile(`\n[ \t]*\n\s*`)
+
+// splitIntoChunks splits text into chunks of at most the configured size, as measured by
+// measure. Chunks end at the configured boundary where possible, falling back to smaller
+// boundaries and finally to a hard cut for text that has none. Each chunk after the first
+// starts with the overlap.
+func splitIntoChunks(text string, config *ChunkingConfig, measure func(string) int) []string {
+	maxLen := config.Size
+	overlap := config.Overlap
+
+	var chunks []string
+	var current string
+	currentLen := 0
+	for _, segment := range splitSegments(text, boundaryLevel(config.Boundary), maxLen, measure) {
+		segmentLen := measure(segment)
+		if current != "" && currentLen+segmentLen > maxLen {
+			if strings.TrimSpace(current) != "" {
+				chunks = append(chunks, strings.TrimSpace(current))
+			}
+			current = overlapTail(current, min(overlap, maxLen-segmentLen), measure)
+			currentLen = measure(current)
+		}
+		current += segment
+		currentLen += segmentLen
+	}
+	if strings.TrimSpace(current) != "" {
+		chunks = append(chunks, strings.TrimSpace(current))
+	}
+	return chunks
+}
+
+// Boundary levels, from the largest segments to the smallest
+const (
+	levelHeading = iota
+	levelParagraph
+	levelLine
+	levelHard
+)
+
+func boundaryLevel(boundary string) int {
+	switch boundary {
+	case ChunkBoundaryHeading:
+		return levelHeading
+	case ChunkBoundaryLine:
+		return levelLine
+	default:
+		return levelParagraph
+	}
+}
+
+// splitSegments splits text at the boundaries of a level. Segments longer than maxLen are
+// split again at the next level. Joining the segments gives back the text.
+func splitSegments(text string, level int, maxLen int, measure func(string) int) []string {
+	if measure(text) <= maxLen {
+		return []string{text}
+	}
+
+	var pieces []string
+	switch level {
+	case levelHeading:
+		start, pos := 0, 0
+		for _, line := range strings.SplitAfter(text, "\n") {
+			if headingPattern.MatchString(line) && pos > start {
+				pieces = append(pieces, text[start:pos])
+				start = pos
+			}
+			pos += len(line)
+		}
+		pieces = append(pieces, text[start:])
+	case levelParagraph:
+		start := 0
+		for _, match := range paragraphBreakPattern.FindAllStringIndex(text, -1) {
+			pieces = append(pieces, text[start:match[1]])
+			start = match[1]
+		}
+		pieces = append(pieces, text[start:])
+	case levelLine:
+		pieces = strings.SplitAfter(text, "\n")
+	default:
+		runes := []rune(text)
+		for len(runes) > 0 {
+			// The longest prefix that fits, and at least one character
+			n := sort.Search(len(runes), func(i int) bool {
+				return measure(string(runes[:i+1])) > maxLen
+			})
+			n = max(n, 1)
+			pieces = append(pieces, string(runes[:n]))
+			runes = runes[n:]
+		}
+		return pieces
+	}
+
+	var segments []string
+	for _, piece := range pieces {
+		if piece == "" {
+			continue
+		}
+		segments = append(segments, splitSegments(piece, level+1, maxLen, measure)...)
+	}
+	return segments
+}
+
+// overlapTail returns about the last n units of text, as measured by measure, starting at
+// a word boundary
+func overlapTail(text string, n int, measure func(string) int) string {
+	runes := []rune(text)
+	if n <= 0 {
+		return ""
+	}
+	if measure(text) <= n {
+		return text
+	}
+	// The number of characters in the longest suffix that fits
+	k := sort.Search(len(runes), func(i int) bool {
+		return measure(string(runes[len(runes)-i-1:])) > n
+	})
+	if k == 0 {
+		return ""
+	}
+	tail := runes[len(runes)-k:]
+	if !unicode.IsSpace(runes[len(runes)-k-1]) {
+		for i, r := range tail {
+			if unicode.IsSpace(r) {
+				tail = tail[i+1:]
+				break
+			}
+		}
+	}
+	return strings.TrimLeftFunc(string(tail), unicode.IsSpace)
+}
+
+// chunkableText returns the combined text of the step's inputs
+func (p *Processor) chunkableText() (string, error) {
+	var texts []string
+	for _, item := range p.handler.GetInputs() {
+		switch item.Type {
+		case input.ImageInput, input.ScreenshotInput, input.WebScrapeInput:
+			return "", fmt.Errorf("input '%s' is not text and cannot be chunked", item.Path)
+		}
+		if !utf8.Valid(item.Contents) {
+			return "", fmt.Errorf("input '%s' is not text and cannot be chunked", item.Path)
+		}
+		texts = append(texts, string(item.Contents))
+	}
+	if len(texts) == 0 {
+		return "", fmt.Errorf("chunking requires an input")
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// processChunkedActions splits the step's input into chunks and runs the actions on each
+// chunk in turn. The results are combined with the reduce_action when the step has one, or
+// joined in order otherwise. It returns the response and the model that produced it.
+func (p *Processor) processChunkedActions(step Step, modelNames []string, actions []string, outputSchema map[string]interface{}, isParallel bool, parallelID string) (string, string, error) {
+	text, err := p.chunkableText()
+	if err != nil {
+		return "", "", err
+	}
+	chunks := splitIntoChunks(text, step.Config.Chunking, step.Config.Chunking.measure(modelNames[0]))
+	if len(chunks) == 0 {
+		return "", "", fmt.Errorf("chunking requires a non-empty input")
+	}
+	p.debugf("Split the input of step '%s' into %d chunk(s)", step.Name, len(chunks))
+
+	longest := chunks[0]
+	for _, chunk := range chunks[1:] {
+		if len(chunk) > len(longest) {
+			longest = chunk
+		}
+	}
+	if err := p.checkContextWindow(step, modelNames, actions, []string{longest}, isParallel, parallelID); err != nil {
+		return "", "", fmt.Errorf("context window check failed: %w", err)
+	}
+
+	handler := p.handler
+	defer func() {
+		p.handler = handler
+	}()
+
+	// Only the reduce_action has to produce JSON matching output_schema
+	restore := func() {}
+	if outputSchema != nil {
+		opts := models.RequestOptionsFromContext(p.ctx)
+		opts.JSON, opts.JSONSchema = false, nil
+		restore = p.withContext(models.WithRequestOptions(p.ctx, opts))
+	}
+
+	results := make([]string, len(chunks))
+	var modelName string
+	for i, chunk := range chunks {
+		p.emitStepMessage(step, fmt.Sprintf("Processing chunk %d of %d for step %s", i+1, len(chunks), step.Name), isParallel, parallelID)
+		p.handler = input.NewHandler()
+		p.handler.AddText(fmt.Sprintf("chunk %d of %d", i+1, len(chunks)), chunk)
+		results[i], modelName, err = p.processModelActions(step, modelNames, actions, isParallel, parallelID)
+		if err != nil {
+			err = fmt.Errorf("chunk %d of %d: %w", i+1, len(chunks), err)
+			break
+		}
+	}
+	restore()
+	if err != nil {
+		return "", "", err
+	}
+
+	if step.Config.ReduceAction == nil {
+		return strings.Join(results, "\n\n"), modelName, nil
+	}
+	return p.reduceChunkResults(step, modelNames, results, outputSchema, isParallel, parallelID)
+}
+
+// reduceChunkResults runs the step's reduce_action on the per-chunk results
+func (p *Processor) reduceChunkResults(step Step, modelNames []string, results []string, outputSchema map[string]interface{}, isParallel bool, parallelID string) (string, string, error) {
+	reduceModels := p.resolveModels(p.NormalizeStringSlice(step.Config.ReduceModel))
+	if len(reduceModels) == 0 {
+		reduceModels = modelNames
+	} else if !(len(reduceModels) == 1 && reduceModels[0] == "NA") {
+		if err := p.validateModel(reduceModels, nil); err != nil {
+			return "", "", fmt.Errorf("reduce_model validation error: %w", err)
+		}
+		if err := p.configureProviders(); err != nil {
+			return "", "", fmt.Errorf("provider configuration error: %w", err)
+		}
+	}
+
+	var actions []string
+	for _, action := range p.NormalizeStringSlice(step.Config.ReduceAction) {
+		rendered, err := p.renderTemplate(action)
+		if err != nil {
+			return "", "", fmt.Errorf("reduce_action template error: %w", err)
+		}
+		if outputSchema != nil {
+			rendered += schemaInstructions(outputSchema)
+		}
+		actions = append(actions, rendered)
+	}
+
+	var combined strings.Builder
+	for i, result := range results {
+		fmt.Fprintf(&combined, "Chunk %d of %d:\n%s\n\n", i+1, len(results), result)
+	}
+	p.handler = input.NewHandler()
+	p.handler.AddText("chunk results", strings.TrimSpace(combined.String()))
+	if err := p.checkContextWindow(step, reduceModels, actions, []string{combined.String()}, isParallel, parallelID); err != nil {
+		return "", "", fmt.Errorf("reduce_action context window check failed: %w", err)
+	}
+
+	p.emitStepMessage(step, fmt.Sprintf("Combining %d chunk results for step %s", len(results), step.Name), isParallel, parallelID)
+	response, modelName, err := p.processModelActions(step, reduceModels, actions, isParallel, parallelID)
+	if err != nil {
+		return "", "", fmt.Errorf("reduce_action failed: %w", err)
+	}
+	return response, modelName, nil
+}
+
+// emitStepMessage reports progress within a step
+func (p *Processor) emitStepMessage(step Step, msg string, isParallel bool, parallelID string) {
+	p.debugf("%s", msg)
+	stepInfo := &StepInfo{Name: step.Name, Model: fmt.Sprintf("%v", step.Config.Model)}
+	if isParallel {
+		p.emitParallelProgress(msg, stepInfo, parallelID)
+	} else {
+		p.emitProgress(msg, stepInfo)
+	}
+}
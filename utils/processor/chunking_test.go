@@ -0,0 +1,184 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitIntoChunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		config   ChunkingConfig
+		expected []string
+	}{
+		{
+			name:     "fits in one chunk",
+			text:     "short text\n",
+			config:   ChunkingConfig{Size: 100, Unit: ChunkUnitChars},
+			expected: []string{"short text"},
+		},
+		{
+			name:     "paragraphs",
+			text:     "first paragraph\n\nsecond paragraph\n\nthird",
+			config:   ChunkingConfig{Size: 36, Unit: ChunkUnitChars},
+			expected: []string{"first paragraph\n\nsecond paragraph", "third"},
+		},
+		{
+			name:     "long paragraph falls back to lines",
+			text:     "line one\nline two\nline three\n\nnext",
+			config:   ChunkingConfig{Size: 20, Unit: ChunkUnitChars},
+			expected: []string{"line one\nline two", "line three\n\nnext"},
+		},
+		{
+			name:     "lines",
+			text:     "a1\nb2\nc3\nd4",
+			config:   ChunkingConfig{Size: 6, Unit: ChunkUnitChars, Boundary: ChunkBoundaryLine},
+			expected: []string{"a1\nb2", "c3\nd4"},
+		},
+		{
+			name:     "headings",
+			text:     "# One\nalpha\n\nbeta\n## Two\ngamma\n# Three\ndelta\n",
+			config:   ChunkingConfig{Size: 25, Unit: ChunkUnitChars, Boundary: ChunkBoundaryHeading},
+			expected: []string{"# One\nalpha\n\nbeta", "## Two\ngamma", "# Three\ndelta"},
+		},
+		{
+			name:     "hard cut",
+			text:     "abcdefghij",
+			config:   ChunkingConfig{Size: 4, Unit: ChunkUnitChars},
+			expected: []string{"abcd", "efgh", "ij"},
+		},
+		{
+			name:     "overlap starts at a word",
+			text:     "the quick brown fox\njumps over the lazy dog",
+			config:   ChunkingConfig{Size: 35, Unit: ChunkUnitChars, Overlap: 8, Boundary: ChunkBoundaryLine},
+			expected: []string{"the quick brown fox", "fox\njumps over the lazy dog"},
+		},
+		{
+			name:     "tokens",
+			text:     strings.Repeat("word ", 8),
+			config:   ChunkingConfig{Size: 5},
+			expected: []string{"word word word word", "word word word word"},
+		},
+		{
+			name:     "tokens of CJK text",
+			text:     "一二三四五六七",
+			config:   ChunkingConfig{Size: 3},
+			expected: []string{"一二三", "四五六", "七"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			measure := tt.config.measure("gpt-4o-mini")
+			got := splitIntoChunks(tt.text, &tt.config, measure)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("splitIntoChunks() = %q, want %q", got, tt.expected)
+			}
+			for _, chunk := range got {
+				if measure(chunk) > tt.config.Size {
+					t.Errorf("chunk %q is longer than %d %s", chunk, tt.config.Size, tt.config.Unit)
+				}
+			}
+		})
+	}
+}
+
+func TestChunkedStepWithReduce(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "report.txt")
+	if err := os.WriteFile(inputPath, []byte("Sales grew in EMEA.\n\nCosts fell in APAC.\n\nHiring paused."), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := newScriptedProvider("summary A", "summary B", "summary C", "final summary")
+	useScriptedProvider(t, provider)
+	dslConfig := &DSLConfig{Steps: []Step{{
+		Name: "summarize",
+		Config: StepConfig{
+			Input:        inputPath,
+			Model:        "gpt-4o-mini",
+			Action:       "Summarize this section",
+			Output:       "STDOUT",
+			Chunking:     &ChunkingConfig{Size: 20, Unit: ChunkUnitChars},
+			ReduceAction: "Combine the section summaries",
+		},
+	}}}
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+	progressChan := make(chan ProgressUpdate, 100)
+	processor.SetProgressWriter(NewChannelProgressWriter(progressChan))
+
+	if err := processor.Process(); err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+	close(progressChan)
+
+	if processor.LastOutput() != "final summary" {
+		t.Errorf("LastOutput() = %q, want %q", processor.LastOutput(), "final summary")
+	}
+	if len(provider.prompts) != 4 {
+		t.Fatalf("expected 4 prompts, got %d", len(provider.prompts))
+	}
+	if !strings.Contains(provider.prompts[1], "Costs fell in APAC.") || strings.Contains(provider.prompts[1], "EMEA") {
+		t.Errorf("second chunk prompt = %q", provider.prompts[1])
+	}
+	reduce := provider.prompts[3]
+	for _, want := range []string{"Chunk 1 of 3:\nsummary A", "Chunk 3 of 3:\nsummary C", "Combine the section summaries"} {
+		if !strings.Contains(reduce, want) {
+			t.Errorf("reduce prompt %q does not contain %q", reduce, want)
+		}
+	}
+
+	var chunkMessages []string
+	for update := range progressChan {
+		if strings.Contains(update.Message, "chunk") {
+			chunkMessages = append(chunkMessages, update.Message)
+		}
+	}
+	expected := []string{
+		"Processing chunk 1 of 3 for step summarize",
+		"Processing chunk 2 of 3 for step summarize",
+		"Processing chunk 3 of 3 for step summarize",
+		"Combining 3 chunk results for step summarize",
+	}
+	if !reflect.DeepEqual(chunkMessages, expected) {
+		t.Errorf("chunk progress = %q, want %q", chunkMessages, expected)
+	}
+}
+
+func TestValidateChunking(t *testing.T) {
+	chunking := &ChunkingConfig{Size: 1000}
+	tests := []struct {
+		name    string
+		config  StepConfig
+		wantErr string
+	}{
+		{name: "none", config: StepConfig{}},
+		{name: "valid", config: StepConfig{Chunking: &ChunkingConfig{Size: 1000, Overlap: 100, Unit: ChunkUnitChars, Boundary: ChunkBoundaryHeading}, ReduceAction: "combine", ReduceModel: "gpt-4o"}},
+		{name: "missing size", config: StepConfig{Chunking: &ChunkingConfig{}}, wantErr: "size must be greater than 0"},
+		{name: "overlap too large", config: StepConfig{Chunking: &ChunkingConfig{Size: 10, Overlap: 10}}, wantErr: "overlap must be at least 0 and less than size"},
+		{name: "bad unit", config: StepConfig{Chunking: &ChunkingConfig{Size: 10, Unit: "words"}}, wantErr: "invalid chunking unit 'words'"},
+		{name: "bad boundary", config: StepConfig{Chunking: &ChunkingConfig{Size: 10, Boundary: "sentence"}}, wantErr: "invalid chunking boundary 'sentence'"},
+		{name: "reduce without chunking", config: StepConfig{ReduceAction: "combine"}, wantErr: "reduce_action requires chunking"},
+		{name: "reduce model without reduce", config: StepConfig{Chunking: chunking, ReduceModel: "gpt-4o"}, wantErr: "reduce_model requires reduce_action"},
+		{name: "schema without reduce", config: StepConfig{Chunking: chunking, OutputSchema: nameSchema}, wantErr: "requires reduce_action"},
+		{name: "process step", config: StepConfig{Chunking: chunking, Process: &ProcessStepConfig{WorkflowFile: "sub.yaml"}}, wantErr: "only supported on standard steps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateChunking(tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
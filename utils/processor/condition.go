@@ -0,0 +1,519 @@
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Condition expressions are used by the `when:` field of a step to decide
+// whether the step should run. The grammar is intentionally small:
+//
+//	expr       := or
+//	or         := and { ("||" | "or") and }
+//	and        := unary { ("&&" | "and") unary }
+//	unary      := ("!" | "not") unary | comparison
+//	comparison := operand [ op operand ]
+//	op         := "==" | "!=" | "<" | "<=" | ">" | ">=" |
+//	              "contains" | "not contains" | "startswith" | "endswith" | "matches"
+//	operand    := string | number | "true" | "false" | $variable | "(" expr ")"
+//
+// Variables are resolved against the processor's variables. The special
+// variables $lastOutput and $STDIN refer to the output of the previous step.
+
+// conditionTokenKind identifies the type of a token in a condition expression
+type conditionTokenKind int
+
+const (
+	tokenEOF conditionTokenKind = iota
+	tokenString
+	tokenNumber
+	tokenVariable
+	tokenIdent
+	tokenOperator
+	tokenLParen
+	tokenRParen
+)
+
+// conditionToken is a single lexical token of a condition expression
+type conditionToken struct {
+	kind  conditionTokenKind
+	value string
+	pos   int
+}
+
+// conditionNode is a node of a parsed condition expression
+type conditionNode interface {
+	eval(vars func(string) (string, bool)) (conditionValue, error)
+}
+
+// conditionValue is the result of evaluating a condition node
+type conditionValue struct {
+	str    string
+	isBool bool
+	b      bool
+}
+
+// truthy reports whether a value should be treated as true
+func (v conditionValue) truthy() bool {
+	if v.isBool {
+		return v.b
+	}
+	s := strings.TrimSpace(strings.ToLower(v.str))
+	return s != "" && s != "false" && s != "0" && s != "no"
+}
+
+// String returns the string form of a value
+func (v conditionValue) String() string {
+	if v.isBool {
+		return strconv.FormatBool(v.b)
+	}
+	return v.str
+}
+
+func boolValue(b bool) conditionValue {
+	return conditionValue{isBool: true, b: b}
+}
+
+// Condition is a parsed `when:` expression
+type Condition struct {
+	source string
+	root   conditionNode
+}
+
+// ParseCondition parses a condition expression
+func ParseCondition(expr string) (*Condition, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+	parser := &conditionParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition %q: %w", expr, err)
+	}
+	if tok := parser.peek(); tok.kind != tokenEOF {
+		return nil, fmt.Errorf("invalid condition %q: unexpected %q at position %d", expr, tok.value, tok.pos)
+	}
+	return &Condition{source: expr, root: root}, nil
+}
+
+// Evaluate evaluates the condition using the given variable lookup
+func (c *Condition) Evaluate(vars func(string) (string, bool)) (bool, error) {
+	val, err := c.root.eval(vars)
+	if err != nil {
+		return false, fmt.Errorf("error evaluating condition %q: %w", c.source, err)
+	}
+	return val.truthy(), nil
+}
+
+// String returns the original expression
+func (c *Condition) String() string {
+	return c.source
+}
+
+// tokenizeCondition splits an expression into tokens
+func tokenizeCondition(expr string) ([]conditionToken, error) {
+	var tokens []conditionToken
+	runes := []rune(expr)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, conditionToken{kind: tokenLParen, value: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, conditionToken{kind: tokenRParen, value: ")", pos: i})
+			i++
+		case r == '\'' || r == '"':
+			start := i
+			quote := r
+			i++
+			var sb strings.Builder
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					sb.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == quote {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated string starting at position %d", start)
+			}
+			tokens = append(tokens, conditionToken{kind: tokenString, value: sb.String(), pos: start})
+		case r == '$':
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			name := string(runes[start+1 : i])
+			if name == "" {
+				return nil, fmt.Errorf("empty variable name at position %d", start)
+			}
+			tokens = append(tokens, conditionToken{kind: tokenVariable, value: name, pos: start})
+		case strings.ContainsRune("=!<>&|", r):
+			start := i
+			op := string(r)
+			if i+1 < len(runes) {
+				two := string(runes[i : i+2])
+				switch two {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					op = two
+				}
+			}
+			if op == "=" || op == "&" || op == "|" {
+				return nil, fmt.Errorf("unknown operator %q at position %d", op, start)
+			}
+			i += len(op)
+			tokens = append(tokens, conditionToken{kind: tokenOperator, value: op, pos: start})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, conditionToken{kind: tokenNumber, value: string(runes[start:i]), pos: start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, conditionToken{kind: tokenIdent, value: string(runes[start:i]), pos: start})
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+		}
+	}
+	tokens = append(tokens, conditionToken{kind: tokenEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+// conditionParser is a recursive descent parser for condition expressions
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+}
+
+func (cp *conditionParser) peek() conditionToken {
+	return cp.tokens[cp.pos]
+}
+
+func (cp *conditionParser) peekAt(offset int) conditionToken {
+	if cp.pos+offset >= len(cp.tokens) {
+		return cp.tokens[len(cp.tokens)-1]
+	}
+	return cp.tokens[cp.pos+offset]
+}
+
+func (cp *conditionParser) next() conditionToken {
+	tok := cp.tokens[cp.pos]
+	if tok.kind != tokenEOF {
+		cp.pos++
+	}
+	return tok
+}
+
+// isKeyword checks whether a token is the given (case-insensitive) keyword
+func isKeyword(tok conditionToken, keyword string) bool {
+	return tok.kind == tokenIdent && strings.EqualFold(tok.value, keyword)
+}
+
+func (cp *conditionParser) parseOr() (conditionNode, error) {
+	left, err := cp.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := cp.peek()
+		if !(tok.kind == tokenOperator && tok.value == "||") && !isKeyword(tok, "or") {
+			return left, nil
+		}
+		cp.next()
+		right, err := cp.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "||", left: left, right: right}
+	}
+}
+
+func (cp *conditionParser) parseAnd() (conditionNode, error) {
+	left, err := cp.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := cp.peek()
+		if !(tok.kind == tokenOperator && tok.value == "&&") && !isKeyword(tok, "and") {
+			return left, nil
+		}
+		cp.next()
+		right, err := cp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "&&", left: left, right: right}
+	}
+}
+
+func (cp *conditionParser) parseUnary() (conditionNode, error) {
+	tok := cp.peek()
+	if (tok.kind == tokenOperator && tok.value == "!") || isKeyword(tok, "not") {
+		cp.next()
+		operand, err := cp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return cp.parseComparison()
+}
+
+func (cp *conditionParser) parseComparison() (conditionNode, error) {
+	left, err := cp.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := cp.peek()
+	var op string
+	switch {
+	case tok.kind == tokenOperator && tok.value != "!" && tok.value != "&&" && tok.value != "||":
+		op = tok.value
+		cp.next()
+	case isKeyword(tok, "not") && isKeyword(cp.peekAt(1), "contains"):
+		op = "not contains"
+		cp.next()
+		cp.next()
+	case isKeyword(tok, "contains"), isKeyword(tok, "startswith"), isKeyword(tok, "endswith"), isKeyword(tok, "matches"):
+		op = strings.ToLower(tok.value)
+		cp.next()
+	default:
+		return left, nil
+	}
+
+	right, err := cp.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	node := &compareNode{op: op, left: left, right: right}
+	if op == "matches" {
+		// Pre-compile literal patterns so syntax errors surface at validation time
+		if lit, ok := right.(*literalNode); ok {
+			re, err := regexp.Compile(lit.value.str)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression %q: %w", lit.value.str, err)
+			}
+			node.re = re
+		}
+	}
+	return node, nil
+}
+
+func (cp *conditionParser) parseOperand() (conditionNode, error) {
+	tok := cp.next()
+	switch tok.kind {
+	case tokenString, tokenNumber:
+		return &literalNode{value: conditionValue{str: tok.value}}, nil
+	case tokenVariable:
+		return &variableNode{name: tok.value}, nil
+	case tokenIdent:
+		switch strings.ToLower(tok.value) {
+		case "true":
+			return &literalNode{value: boolValue(true)}, nil
+		case "false":
+			return &literalNode{value: boolValue(false)}, nil
+		}
+		return nil, fmt.Errorf("unexpected identifier %q at position %d (use quotes for strings and $ for variables)", tok.value, tok.pos)
+	case tokenLParen:
+		inner, err := cp.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := cp.next(); closing.kind != tokenRParen {
+			return nil, fmt.Errorf("expected ')' at position %d", closing.pos)
+		}
+		return inner, nil
+	case tokenEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	default:
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.value, tok.pos)
+	}
+}
+
+// literalNode is a constant value
+type literalNode struct {
+	value conditionValue
+}
+
+func (n *literalNode) eval(vars func(string) (string, bool)) (conditionValue, error) {
+	return n.value, nil
+}
+
+// variableNode is a $variable reference
+type variableNode struct {
+	name string
+}
+
+func (n *variableNode) eval(vars func(string) (string, bool)) (conditionValue, error) {
+	val, _ := vars(n.name)
+	return conditionValue{str: val}, nil
+}
+
+// notNode negates its operand
+type notNode struct {
+	operand conditionNode
+}
+
+func (n *notNode) eval(vars func(string) (string, bool)) (conditionValue, error) {
+	val, err := n.operand.eval(vars)
+	if err != nil {
+		return conditionValue{}, err
+	}
+	return boolValue(!val.truthy()), nil
+}
+
+// logicalNode combines two nodes with && or ||
+type logicalNode struct {
+	op          string
+	left, right conditionNode
+}
+
+func (n *logicalNode) eval(vars func(string) (string, bool)) (conditionValue, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return conditionValue{}, err
+	}
+	if n.op == "&&" && !left.truthy() {
+		return boolValue(false), nil
+	}
+	if n.op == "||" && left.truthy() {
+		return boolValue(true), nil
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return conditionValue{}, err
+	}
+	return boolValue(right.truthy()), nil
+}
+
+// compareNode compares two operands
+type compareNode struct {
+	op          string
+	left, right conditionNode
+	re          *regexp.Regexp
+}
+
+func (n *compareNode) eval(vars func(string) (string, bool)) (conditionValue, error) {
+	leftVal, err := n.left.eval(vars)
+	if err != nil {
+		return conditionValue{}, err
+	}
+	rightVal, err := n.right.eval(vars)
+	if err != nil {
+		return conditionValue{}, err
+	}
+
+	// LLM output frequently carries surrounding whitespace, so comparisons ignore it
+	left := strings.TrimSpace(leftVal.String())
+	right := strings.TrimSpace(rightVal.String())
+
+	switch n.op {
+	case "==", "!=":
+		equal := left == right
+		if lf, rf, ok := parseNumbers(left, right); ok {
+			equal = lf == rf
+		}
+		if n.op == "==" {
+			return boolValue(equal), nil
+		}
+		return boolValue(!equal), nil
+	case "<", "<=", ">", ">=":
+		lf, rf, ok := parseNumbers(left, right)
+		if !ok {
+			return conditionValue{}, fmt.Errorf("operator %s requires numeric operands, got %q and %q", n.op, left, right)
+		}
+		switch n.op {
+		case "<":
+			return boolValue(lf < rf), nil
+		case "<=":
+			return boolValue(lf <= rf), nil
+		case ">":
+			return boolValue(lf > rf), nil
+		default:
+			return boolValue(lf >= rf), nil
+		}
+	case "contains":
+		return boolValue(strings.Contains(leftVal.String(), rightVal.String())), nil
+	case "not contains":
+		return boolValue(!strings.Contains(leftVal.String(), rightVal.String())), nil
+	case "startswith":
+		return boolValue(strings.HasPrefix(left, right)), nil
+	case "endswith":
+		return boolValue(strings.HasSuffix(left, right)), nil
+	case "matches":
+		re := n.re
+		if re == nil {
+			re, err = regexp.Compile(rightVal.String())
+			if err != nil {
+				return conditionValue{}, fmt.Errorf("invalid regular expression %q: %w", rightVal.String(), err)
+			}
+		}
+		return boolValue(re.MatchString(leftVal.String())), nil
+	}
+	return conditionValue{}, fmt.Errorf("unknown operator %q", n.op)
+}
+
+// parseNumbers parses both operands as numbers if possible
+func parseNumbers(left, right string) (float64, float64, bool) {
+	lf, err := strconv.ParseFloat(left, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	rf, err := strconv.ParseFloat(right, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return lf, rf, true
+}
+
+// lookupConditionVariable resolves a variable referenced in a condition
+func (p *Processor) lookupConditionVariable(name string) (string, bool) {
+	switch name {
+	case "lastOutput", "STDIN":
+		return p.lastOutput, true
+	}
+	val, ok := p.variables[name]
+	return val, ok
+}
+
+// shouldRunStep evaluates a step's `when:` condition, returning true if the step should run
+func (p *Processor) shouldRunStep(step Step) (bool, error) {
+	if strings.TrimSpace(step.Config.When) == "" {
+		return true, nil
+	}
+	cond, err := ParseCondition(step.Config.When)
+	if err != nil {
+		return false, err
+	}
+	run, err := cond.Evaluate(p.lookupConditionVariable)
+	if err != nil {
+		return false, err
+	}
+	p.debugf("Condition for step '%s' (%s) evaluated to %v", step.Name, step.Config.When, run)
+	return run, nil
+}
@@ -0,0 +1,182 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+func TestConditionEvaluate(t *testing.T) {
+	vars := map[string]string{
+		"classification": "bug\n",
+		"score":          "7",
+		"summary":        "The build failed with a timeout",
+		"empty":          "",
+		"lastOutput":     "previous step output",
+	}
+	lookup := func(name string) (string, bool) {
+		val, ok := vars[name]
+		return val, ok
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected bool
+	}{
+		{"string equality ignores surrounding whitespace", "$classification == 'bug'", true},
+		{"string inequality", "$classification != 'feature'", true},
+		{"double quoted string", `$classification == "bug"`, true},
+		{"numeric greater than", "$score > 5", true},
+		{"numeric less or equal", "$score <= 6", false},
+		{"numeric equality", "$score == 7.0", true},
+		{"contains", "$summary contains 'timeout'", true},
+		{"not contains", "$summary not contains 'success'", true},
+		{"startswith", "$summary startswith 'The build'", true},
+		{"endswith", "$summary endswith 'timeout'", true},
+		{"matches", "$summary matches 'fail(ed|ure)'", true},
+		{"logical and", "$score > 5 && $classification == 'bug'", true},
+		{"logical or", "$score > 10 || $classification == 'bug'", true},
+		{"keyword operators", "$score > 10 or not ($classification == 'feature')", true},
+		{"negation", "!($classification == 'bug')", false},
+		{"parentheses", "($score > 10 || $score < 8) && $summary contains 'build'", true},
+		{"truthy variable", "$summary", true},
+		{"empty variable is false", "$empty", false},
+		{"undefined variable is empty", "$missing == ''", true},
+		{"last output", "$lastOutput contains 'previous'", true},
+		{"boolean literals", "true && !false", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond, err := ParseCondition(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCondition(%q) returned unexpected error: %v", tt.expr, err)
+			}
+			got, err := cond.Evaluate(lookup)
+			if err != nil {
+				t.Fatalf("Evaluate(%q) returned unexpected error: %v", tt.expr, err)
+			}
+			if got != tt.expected {
+				t.Errorf("Evaluate(%q) = %v, want %v", tt.expr, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"unterminated string", "$a == 'bug"},
+		{"missing operand", "$a =="},
+		{"unbalanced parentheses", "($a == 'b'"},
+		{"bare identifier", "$a == bug"},
+		{"single equals", "$a = 'bug'"},
+		{"invalid regex", "$a matches '('"},
+		{"trailing tokens", "$a == 'b' 'c'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCondition(tt.expr); err == nil {
+				t.Errorf("ParseCondition(%q) expected error, got nil", tt.expr)
+			}
+		})
+	}
+}
+
+func TestConditionNumericComparisonError(t *testing.T) {
+	cond, err := ParseCondition("$a > 5")
+	if err != nil {
+		t.Fatalf("ParseCondition returned unexpected error: %v", err)
+	}
+	_, err = cond.Evaluate(func(string) (string, bool) { return "not a number", true })
+	if err == nil {
+		t.Error("expected error comparing non-numeric value, got nil")
+	}
+}
+
+func TestProcessSkipsStepsWhenConditionIsFalse(t *testing.T) {
+	useMockProviders(t)
+	tempDir := t.TempDir()
+
+	dslConfig := DSLConfig{
+		Steps: []Step{
+			{
+				Name: "classify",
+				Config: StepConfig{
+					Input:  "NA",
+					Model:  "gpt-4o-mini",
+					Action: "classify",
+					Output: "STDOUT as $classification",
+				},
+			},
+			{
+				Name: "runs",
+				Config: StepConfig{
+					Input:  "NA",
+					Model:  "gpt-4o-mini",
+					Action: "handle",
+					Output: "ran.txt",
+					When:   "$classification contains 'mock'",
+				},
+			},
+			{
+				Name: "skipped",
+				Config: StepConfig{
+					Input:  "NA",
+					Model:  "gpt-4o-mini",
+					Action: "handle",
+					Output: "skipped.txt",
+					When:   "$classification == 'feature'",
+				},
+			},
+		},
+	}
+
+	serverConfig := &config.ServerConfig{Enabled: true, DataDir: tempDir}
+	processor := NewProcessor(&dslConfig, createTestEnvConfig(), serverConfig, false, "")
+
+	progressChan := make(chan ProgressUpdate, 100)
+	processor.SetProgressWriter(NewChannelProgressWriter(progressChan))
+
+	if err := processor.Process(); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	close(progressChan)
+
+	if _, err := os.Stat(filepath.Join(tempDir, "ran.txt")); err != nil {
+		t.Errorf("expected step 'runs' to write its output: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "skipped.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected step 'skipped' not to write its output")
+	}
+
+	skipped := 0
+	for update := range progressChan {
+		if update.Type == ProgressSkipped {
+			skipped++
+		}
+	}
+	if skipped != 1 {
+		t.Errorf("expected 1 skipped progress update, got %d", skipped)
+	}
+}
+
+func TestValidateStepConfigRejectsInvalidCondition(t *testing.T) {
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false, "")
+	err := processor.validateStepConfig("bad_condition", StepConfig{
+		Input:  "NA",
+		Model:  "gpt-4o-mini",
+		Action: "test",
+		Output: "STDOUT",
+		When:   "$a == ",
+	})
+	if err == nil {
+		t.Error("expected validation error for invalid when condition, got nil")
+	}
+}
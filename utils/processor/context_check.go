@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kris-hansen/comanda/utils/input"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// Context check modes decide what happens when a prompt is estimated not to fit a model's context window
+const (
+	ContextCheckWarn  = "warn"  // Print a warning and send the prompt anyway (default)
+	ContextCheckError = "error" // Fail the step before anything is sent
+	ContextCheckOff   = "off"   // Skip the check
+)
+
+// validateContextCheck checks the context_check field of a step
+func validateContextCheck(mode string) error {
+	switch mode {
+	case "", ContextCheckWarn, ContextCheckError, ContextCheckOff:
+		return nil
+	default:
+		return fmt.Errorf("invalid context_check '%s': must be one of %s, %s or %s",
+			mode, ContextCheckWarn, ContextCheckError, ContextCheckOff)
+	}
+}
+
+// contextInputs returns the input text sent with each prompt of the current step. Inputs that
+// are not text, such as images and PDFs, are left out.
+func (p *Processor) contextInputs(step Step) []string {
+	var files, others []string
+	for _, item := range p.handler.GetInputs() {
+		switch item.Type {
+		case input.ImageInput, input.ScreenshotInput, input.WebScrapeInput:
+			continue
+		}
+		if !utf8.Valid(item.Contents) {
+			p.debugf("Input %s is not text, leaving it out of the context estimate", item.Path)
+			continue
+		}
+		if item.Type == input.FileInput {
+			files = append(files, string(item.Contents))
+		} else {
+			others = append(others, string(item.Contents))
+		}
+	}
+	if len(files) == 0 {
+		return others
+	}
+
+	// Unless batch_mode is combined, several files are sent one at a time
+	if len(files) > 1 && step.Config.BatchMode != "combined" {
+		longest := files[0]
+		for _, file := range files[1:] {
+			if len(file) > len(longest) {
+				longest = file
+			}
+		}
+		return []string{longest}
+	}
+	return files
+}
+
+// estimatePromptTokens estimates the size of a step's largest prompt for a model: its longest
+// action together with the inputs
+func estimatePromptTokens(modelName string, actions []string, inputs []string) int {
+	tokens := 0
+	for _, action := range actions {
+		if n := models.EstimateTokens(modelName, action); n > tokens {
+			tokens = n
+		}
+	}
+	for _, text := range inputs {
+		tokens += models.EstimateTokens(modelName, text)
+	}
+	return tokens
+}
+
+// checkContextWindow compares the estimated prompt size of a step with the context window of
+// each of its models, before anything is sent. Models the prompt does not fit are reported as
+// a warning, or with context_check: error the step fails when the prompt fits none of them.
+// Models without a known context window are not checked.
+func (p *Processor) checkContextWindow(step Step, modelNames []string, actions []string, inputs []string, isParallel bool, parallelID string) error {
+	if step.Config.ContextCheck == ContextCheckOff {
+		return nil
+	}
+
+	var problems []string
+	checked := 0
+	for _, modelName := range modelNames {
+		if modelName == "NA" {
+			continue
+		}
+		limits, ok := models.LookupModelLimits(modelName)
+		if !ok {
+			p.debugf("No context window known for model %s, skipping the context check", modelName)
+			continue
+		}
+		checked++
+		tokens := estimatePromptTokens(modelName, actions, inputs)
+		p.debugf("Estimated %d prompt tokens for model %s (context window %d)", tokens, modelName, limits.ContextWindow)
+		if tokens > limits.ContextWindow {
+			problems = append(problems, fmt.Sprintf("estimated %d prompt tokens exceed the %d token context window of %s",
+				tokens, limits.ContextWindow, modelName))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	hint := "consider chunking the input"
+	if step.Config.Chunking != nil {
+		hint = "consider a smaller chunking size"
+	}
+	msg := fmt.Sprintf("%s; %s", strings.Join(problems, "; "), hint)
+	if step.Config.ContextCheck == ContextCheckError && len(problems) == checked {
+		return fmt.Errorf("%s", msg)
+	}
+	p.emitStepMessage(step, fmt.Sprintf("Warning: step '%s': %s", step.Name, msg), isParallel, parallelID)
+	return nil
+}
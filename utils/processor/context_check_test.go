@@ -0,0 +1,86 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContextWindowCheck(t *testing.T) {
+	inputPath := filepath.Join(t.TempDir(), "big.txt")
+	// About 10,000 estimated tokens: more than gpt-4's 8,192, well within gpt-4o's 128,000
+	if err := os.WriteFile(inputPath, []byte(strings.Repeat("word ", 8000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		model       interface{}
+		mode        string
+		wantErr     bool
+		wantWarning bool
+	}{
+		{name: "fits", model: "gpt-4o"},
+		{name: "warns by default", model: "gpt-4", wantWarning: true},
+		{name: "error mode", model: "gpt-4", mode: ContextCheckError, wantErr: true},
+		{name: "error mode with a fallback that fits", model: []interface{}{"gpt-4", "gpt-4o"}, mode: ContextCheckError, wantWarning: true},
+		{name: "off", model: "gpt-4", mode: ContextCheckOff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newScriptedProvider("summary")
+			useScriptedProvider(t, provider)
+			dslConfig := &DSLConfig{Steps: []Step{{
+				Name: "summarize",
+				Config: StepConfig{
+					Input:        inputPath,
+					Model:        tt.model,
+					Action:       "Summarize",
+					Output:       "STDOUT",
+					ContextCheck: tt.mode,
+				},
+			}}}
+			processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+			progressChan := make(chan ProgressUpdate, 100)
+			processor.SetProgressWriter(NewChannelProgressWriter(progressChan))
+
+			err := processor.Process()
+			close(progressChan)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "exceed the 8192 token context window of gpt-4") {
+					t.Fatalf("expected context window error, got %v", err)
+				}
+				if len(provider.prompts) != 0 {
+					t.Errorf("expected no prompts to be sent, got %d", len(provider.prompts))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Process() error: %v", err)
+			}
+
+			warned := false
+			for update := range progressChan {
+				if strings.HasPrefix(update.Message, "Warning: step 'summarize'") {
+					warned = true
+				}
+			}
+			if warned != tt.wantWarning {
+				t.Errorf("warning emitted = %v, want %v", warned, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestValidateContextCheck(t *testing.T) {
+	for _, mode := range []string{"", ContextCheckWarn, ContextCheckError, ContextCheckOff} {
+		if err := validateContextCheck(mode); err != nil {
+			t.Errorf("validateContextCheck(%q) error: %v", mode, err)
+		}
+	}
+	if err := validateContextCheck("strict"); err == nil || !strings.Contains(err.Error(), "invalid context_check 'strict'") {
+		t.Errorf("expected invalid context_check error, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/kris-hansen/comanda/utils/fileutil"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// conversationStore holds the message history of each conversation in a run. It is shared
+// with forks; the steps of a conversation are scheduled one after another, so a history is
+// never extended by two steps at once.
+type conversationStore struct {
+	mu      sync.Mutex
+	history map[string][]models.Message
+}
+
+func newConversationStore() *conversationStore {
+	return &conversationStore{history: make(map[string][]models.Message)}
+}
+
+// messages returns a copy of the history of a conversation
+func (c *conversationStore) messages(id string) []models.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]models.Message(nil), c.history[id]...)
+}
+
+// append adds turns to the history of a conversation
+func (c *conversationStore) append(id string, turns ...models.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.history[id] = append(c.history[id], turns...)
+}
+
+// validateConversation checks that a step with a conversation sends a single prompt per run
+func validateConversation(config StepConfig) error {
+	if config.Conversation == "" {
+		return nil
+	}
+	switch {
+	case config.Type == "openai-responses":
+		return fmt.Errorf("conversation cannot be used with openai-responses steps; use previous_response_id instead")
+	case config.Generate != nil || config.Process != nil:
+		return fmt.Errorf("conversation can only be used with standard steps")
+	case config.ForEach != nil:
+		return fmt.Errorf("conversation cannot be combined with for_each")
+	case config.Chunking != nil:
+		return fmt.Errorf("conversation cannot be combined with chunking")
+	case config.ModelStrategy == ModelStrategyRace || config.ModelStrategy == ModelStrategyAll:
+		return fmt.Errorf("conversation cannot be combined with model_strategy: %s; use %s", config.ModelStrategy, ModelStrategyFallback)
+	}
+	return nil
+}
+
+// usesMessages reports whether the current step sends its prompt as a message, because it
+// continues a conversation or lets the model call tools
+func (p *Processor) usesMessages() bool {
+	cfg := p.getCurrentStepConfig()
+	return cfg.Conversation != "" || len(cfg.Tools) > 0
+}
+
+// sendMessage sends prompt as a user message, continuing the step's conversation if it has one
+func (p *Processor) sendMessage(provider models.Provider, modelName string, prompt string) (string, error) {
+	if p.getCurrentStepConfig().Conversation != "" {
+		return p.converse(provider, modelName, prompt)
+	}
+	return p.sendMessages(provider, modelName, []models.Message{{Role: models.RoleUser, Content: prompt}})
+}
+
+// sendMessages sends a conversation, running the tool-call loop if the step has tools
+func (p *Processor) sendMessages(provider models.Provider, modelName string, messages []models.Message) (string, error) {
+	if len(p.getCurrentStepConfig().Tools) > 0 {
+		return p.runTools(provider, modelName, messages)
+	}
+	return provider.SendMessages(p.ctx, modelName, messages)
+}
+
+// messagePrompt builds the user message of a step that continues a conversation or uses tools.
+// Files are included as text, since messages are text.
+func messagePrompt(action string, files []models.FileInput, inputs []string) (string, error) {
+	if len(files) == 0 && len(inputs) == 0 {
+		return action, nil
+	}
+	var prompt strings.Builder
+	for i, file := range files {
+		if strings.HasPrefix(file.MimeType, "image/") || file.MimeType == "application/pdf" {
+			return "", fmt.Errorf("steps with a conversation or tools only take text inputs, got %s (%s)", file.Path, file.MimeType)
+		}
+		content, err := fileutil.SafeReadFile(file.Path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file %s: %w", file.Path, err)
+		}
+		fmt.Fprintf(&prompt, "File %d (%s):\n%s\n\n", i+1, file.Path, string(content))
+	}
+	if len(inputs) > 0 {
+		fmt.Fprintf(&prompt, "Input:\n%s\n\n", strings.Join(inputs, "\n\n"))
+	}
+	fmt.Fprintf(&prompt, "Action: %s", action)
+	return prompt.String(), nil
+}
+
+// converse sends prompt as the next user turn of the current step's conversation, together
+// with the history so far, and records the exchange once the model answers. The system prompt
+// of the step that starts a conversation becomes its first message. Tool calls and their
+// results are not kept in the history, only the final answer.
+func (p *Processor) converse(provider models.Provider, modelName string, prompt string) (string, error) {
+	step := p.currentStep
+	id := step.Config.Conversation
+	history := p.conversations.messages(id)
+
+	var turns []models.Message
+	if len(history) == 0 {
+		params := mergeModelParams(p.stepModelParams(step), p.modelDefaults(provider.Name(), modelName))
+		if params.System != "" {
+			turns = append(turns, models.Message{Role: models.RoleSystem, Content: params.System})
+		}
+	}
+	turns = append(turns, models.Message{Role: models.RoleUser, Content: prompt})
+
+	p.debugf("Continuing conversation '%s' with %d previous message(s)", id, len(history))
+	response, err := p.sendMessages(provider, modelName, append(history, turns...))
+	if err != nil {
+		return "", err
+	}
+	p.conversations.append(id, append(turns, models.Message{Role: models.RoleAssistant, Content: response})...)
+	return response, nil
+}
@@ -0,0 +1,161 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// conversationStep returns a graph test step that belongs to a conversation
+func conversationStep(name string, conversation string, dependsOn interface{}) Step {
+	step := newGraphTestStep(name, "NA", "STDOUT", dependsOn)
+	step.Config.Conversation = conversation
+	return step
+}
+
+func TestConversationHistory(t *testing.T) {
+	provider := newScriptedProvider("Hello, Ada.", "Your name is Ada.", "unrelated")
+	useScriptedProvider(t, provider)
+
+	dslConfig := &DSLConfig{Steps: []Step{
+		{Name: "introduce", Config: StepConfig{Input: "NA", Model: "gpt-4o-mini", Action: "My name is Ada.", Output: "STDOUT", Conversation: "chat", System: "Be terse."}},
+		{Name: "recall", Config: StepConfig{Input: "NA", Model: "gpt-4o-mini", Action: "What is my name?", Output: "STDOUT", Conversation: "chat"}},
+		{Name: "standalone", Config: StepConfig{Input: "NA", Model: "gpt-4o-mini", Action: "Say hi.", Output: "STDOUT"}},
+	}}
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+	if err := processor.Process(); err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+
+	if len(provider.messages) != 2 {
+		t.Fatalf("expected 2 conversation calls, got %d", len(provider.messages))
+	}
+	want := []models.Message{
+		{Role: models.RoleSystem, Content: "Be terse."},
+		{Role: models.RoleUser, Content: "My name is Ada."},
+		{Role: models.RoleAssistant, Content: "Hello, Ada."},
+		{Role: models.RoleUser, Content: "What is my name?"},
+	}
+	if !reflect.DeepEqual(provider.messages[0], want[:2]) {
+		t.Errorf("first call messages = %+v", provider.messages[0])
+	}
+	if !reflect.DeepEqual(provider.messages[1], want) {
+		t.Errorf("second call messages = %+v", provider.messages[1])
+	}
+	if got := provider.prompts[2]; got != "Say hi." {
+		t.Errorf("standalone prompt = %q", got)
+	}
+}
+
+func TestConversationFailedTurnIsNotRecorded(t *testing.T) {
+	provider := newScriptedProvider("", "second answer")
+	provider.errs = []error{os.ErrDeadlineExceeded}
+	useScriptedProvider(t, provider)
+
+	step := &Step{Name: "ask", Config: StepConfig{Conversation: "chat"}}
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false, "")
+	processor.currentStep = step
+	if _, err := processor.converse(provider, "gpt-4o-mini", "first"); err == nil {
+		t.Fatal("expected the first turn to fail")
+	}
+	if _, err := processor.converse(provider, "gpt-4o-mini", "second"); err != nil {
+		t.Fatalf("converse() error: %v", err)
+	}
+	want := []models.Message{{Role: models.RoleUser, Content: "second"}}
+	if !reflect.DeepEqual(provider.messages[1], want) {
+		t.Errorf("messages after a failed turn = %+v", provider.messages[1])
+	}
+}
+
+func TestMessagePrompt(t *testing.T) {
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("buy milk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	prompt, err := messagePrompt("Summarize.", []models.FileInput{{Path: notes, MimeType: "text/plain"}}, []string{"extra"})
+	if err != nil {
+		t.Fatalf("messagePrompt() error: %v", err)
+	}
+	want := "File 1 (" + notes + "):\nbuy milk\n\nInput:\nextra\n\nAction: Summarize."
+	if prompt != want {
+		t.Errorf("messagePrompt() = %q, want %q", prompt, want)
+	}
+
+	if _, err := messagePrompt("Describe.", []models.FileInput{{Path: "photo.png", MimeType: "image/png"}}, nil); err == nil {
+		t.Error("expected an error for an image input")
+	}
+}
+
+func TestValidateConversation(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  StepConfig
+		wantErr string
+	}{
+		{"standard step", StepConfig{Conversation: "chat"}, ""},
+		{"responses step", StepConfig{Conversation: "chat", Type: "openai-responses"}, "previous_response_id"},
+		{"for_each", StepConfig{Conversation: "chat", ForEach: &ForEachConfig{}}, "for_each"},
+		{"chunking", StepConfig{Conversation: "chat", Chunking: &ChunkingConfig{}}, "chunking"},
+		{"fallback strategy", StepConfig{Conversation: "chat", ModelStrategy: ModelStrategyFallback}, ""},
+		{"race strategy", StepConfig{Conversation: "chat", ModelStrategy: ModelStrategyRace}, "model_strategy: race"},
+		{"all strategy", StepConfig{Conversation: "chat", ModelStrategy: ModelStrategyAll}, "model_strategy: all"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateConversation(tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateConversation() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateConversation() error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConversationDependencies(t *testing.T) {
+	dslConfig := &DSLConfig{
+		Steps: []Step{
+			conversationStep("ask", "chat", []string{}),
+			conversationStep("other", "side", []string{}),
+			conversationStep("follow-up", "chat", []string{}),
+		},
+		Order: []string{"ask", "other", "follow-up"},
+	}
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), nil, false, "")
+	graph, err := processor.buildExecutionGraph()
+	if err != nil {
+		t.Fatalf("buildExecutionGraph returned unexpected error: %v", err)
+	}
+	if deps := graph.byName["follow-up"].dependsOn; !reflect.DeepEqual(deps, []string{"ask"}) {
+		t.Errorf("dependencies of follow-up = %v, want [ask]", deps)
+	}
+	if deps := graph.byName["other"].dependsOn; deps != nil {
+		t.Errorf("dependencies of other = %v, want none", deps)
+	}
+}
+
+func TestConversationInParallelGroup(t *testing.T) {
+	dslConfig := &DSLConfig{
+		ParallelSteps: map[string][]Step{
+			"parallel-chat": {
+				conversationStep("a", "chat", nil),
+				conversationStep("b", "chat", nil),
+			},
+		},
+	}
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), nil, false, "")
+	_, err := processor.buildExecutionGraph()
+	if err == nil || !strings.Contains(err.Error(), "cannot share conversation 'chat'") {
+		t.Errorf("buildExecutionGraph() error = %v, want a shared conversation error", err)
+	}
+}
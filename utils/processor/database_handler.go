@@ -26,16 +26,20 @@ func (p *Processor) handleDatabaseInput(input interface{}) error {
 	if !ok {
 		return fmt.Errorf("SQL statement not specified")
 	}
+	sql, args, err := p.renderSQL(sql, 0)
+	if err != nil {
+		return fmt.Errorf("SQL template error: %w", err)
+	}
 
 	// Create database handler
 	dbHandler := database.NewHandler(p.envConfig)
 	defer dbHandler.Close()
 
 	// Determine operation type based on SQL
-	sql = strings.TrimSpace(strings.ToUpper(sql))
-	if strings.HasPrefix(sql, "SELECT") {
+	sql = strings.TrimSpace(sql)
+	if strings.HasPrefix(strings.ToUpper(sql), "SELECT") {
 		// Handle read operation
-		results, err := dbHandler.ExecuteRead(dbName, sql)
+		results, err := dbHandler.ExecuteRead(p.ctx, dbName, sql, args...)
 		if err != nil {
 			return fmt.Errorf("database read error: %w", err)
 		}
@@ -50,7 +54,7 @@ func (p *Processor) handleDatabaseInput(input interface{}) error {
 		return nil
 	} else {
 		// Handle write operation
-		affected, err := dbHandler.ExecuteWrite(dbName, sql)
+		affected, err := dbHandler.ExecuteWrite(p.ctx, dbName, sql, args...)
 		if err != nil {
 			return fmt.Errorf("database write error: %w", err)
 		}
@@ -72,6 +76,10 @@ func (p *Processor) handleDatabaseOutput(output string, dbConfig map[string]inte
 	if !ok {
 		return fmt.Errorf("SQL statement not specified")
 	}
+	sql, args, err := p.renderSQL(sql, 0)
+	if err != nil {
+		return fmt.Errorf("SQL template error: %w", err)
+	}
 
 	// Create database handler
 	dbHandler := database.NewHandler(p.envConfig)
@@ -83,7 +91,49 @@ func (p *Processor) handleDatabaseOutput(output string, dbConfig map[string]inte
 	}
 
 	// Execute write operation
-	affected, err := dbHandler.ExecuteWrite(dbName, sql)
+	affected, err := dbHandler.ExecuteWrite(p.ctx, dbName, sql, args...)
+	if err != nil {
+		return fmt.Errorf("database write error: %w", err)
+	}
+
+	p.lastOutput = fmt.Sprintf("Affected rows: %d", affected)
+	return nil
+}
+
+// handleDatabaseRowsOutput runs a database output's SQL once for each row, in one transaction,
+// with the row's values as the arguments of its first placeholders ($1, $2, ...). Values bound
+// in the SQL's template take the placeholders after them.
+func (p *Processor) handleDatabaseRowsOutput(rows [][]interface{}, dbConfig map[string]interface{}) error {
+	dbName, ok := dbConfig["database"].(string)
+	if !ok {
+		return fmt.Errorf("database name not specified")
+	}
+
+	sql, ok := dbConfig["sql"].(string)
+	if !ok {
+		return fmt.Errorf("SQL statement not specified")
+	}
+	width := 0
+	if len(rows) > 0 {
+		width = len(rows[0])
+	}
+	sql, args, err := p.renderSQL(sql, width)
+	if err != nil {
+		return fmt.Errorf("SQL template error: %w", err)
+	}
+
+	dbHandler := database.NewHandler(p.envConfig)
+	defer dbHandler.Close()
+
+	if err := dbHandler.ValidateOperation(sql, database.WriteOperation); err != nil {
+		return fmt.Errorf("invalid database output operation: %w", err)
+	}
+
+	argSets := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		argSets[i] = append(append([]interface{}{}, row...), args...)
+	}
+	affected, err := dbHandler.ExecuteWriteBatch(p.ctx, dbName, sql, argSets)
 	if err != nil {
 		return fmt.Errorf("database write error: %w", err)
 	}
@@ -1,17 +1,16 @@
 package processor
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/kris-hansen/comanda/utils/config"
 	"github.com/kris-hansen/comanda/utils/input"
 	"github.com/kris-hansen/comanda/utils/models"
-	"gopkg.in/yaml.v3"
 )
 
 // GenerateStepConfig defines the configuration for a generate step
@@ -26,23 +25,35 @@ type GenerateStepConfig struct {
 type ProcessStepConfig struct {
 	WorkflowFile   string                 `yaml:"workflow_file"`
 	Inputs         map[string]interface{} `yaml:"inputs"`
-	CaptureOutputs []string               `yaml:"capture_outputs"`
+	CaptureOutputs []string               `yaml:"capture_outputs"` // Exports of the sub-workflow to store in variables, as "name" or "name as $var"
 }
 
 // Processor handles the DSL processing pipeline
 type Processor struct {
-	config       *DSLConfig
-	envConfig    *config.EnvConfig
-	serverConfig *config.ServerConfig // Add server config
-	handler      *input.Handler
-	validator    *input.Validator
-	providers    map[string]models.Provider
-	verbose      bool
-	lastOutput   string
-	spinner      *Spinner
-	variables    map[string]string // Store variables from STDIN
-	progress     ProgressWriter    // Progress writer for streaming updates
-	runtimeDir   string            // Runtime directory for file operations
+	config        *DSLConfig
+	envConfig     *config.EnvConfig
+	serverConfig  *config.ServerConfig // Add server config
+	handler       *input.Handler
+	validator     *input.Validator
+	providers     map[string]models.Provider
+	verbose       bool
+	lastOutput    string
+	spinner       *Spinner
+	variables     map[string]string      // Store variables from STDIN
+	progress      ProgressWriter         // Progress writer for streaming updates
+	runtimeDir    string                 // Runtime directory for file operations
+	currentStep   *Step                  // Step currently being processed
+	ctx           context.Context        // Cancels model calls and other work when done
+	checkpoint    *Checkpointer          // Saves completed steps so the run can be resumed (nil to disable)
+	cacheOptions  CacheOptions           // Response caching for the workflow
+	stepResults   map[string]*StepResult // Results of completed steps, addressable by step name
+	lastModel     string                 // Model that produced the current step's response
+	lastResponse  string                 // Response ID of the current step, for openai-responses steps
+	written       []string               // Files written by this processor, recorded in checkpoints
+	usage         *usageTracker          // Token usage and cost of the run, shared with forks
+	conversations *conversationStore     // Message history of the run's conversations, shared with forks
+	streamed      strings.Builder        // Response streamed by the current step
+	noLocalTools  bool                   // Refuses shell and database tools, for workflows run by the server
 }
 
 // isTestMode checks if the code is running in test mode
@@ -59,17 +70,22 @@ func NewProcessor(config *DSLConfig, envConfig *config.EnvConfig, serverConfig *
 	}
 
 	p := &Processor{
-		config:       config,
-		envConfig:    envConfig,
-		serverConfig: serverConfig, // Store server config
-		handler:      input.NewHandler(),
-		validator:    input.NewValidator(nil),
-		providers:    make(map[string]models.Provider),
-		verbose:      verbose,
-		spinner:      NewSpinner(),
-		variables:    make(map[string]string),
-		runtimeDir:   rd, // Store runtime directory
-	}
+		config:        config,
+		envConfig:     envConfig,
+		serverConfig:  serverConfig, // Store server config
+		handler:       input.NewHandler(),
+		validator:     input.NewValidator(nil),
+		providers:     make(map[string]models.Provider),
+		verbose:       verbose,
+		spinner:       NewSpinner(),
+		variables:     make(map[string]string),
+		stepResults:   make(map[string]*StepResult),
+		runtimeDir:    rd, // Store runtime directory
+		ctx:           context.Background(),
+		usage:         newUsageTracker(envConfig),
+		conversations: newConversationStore(),
+	}
+	p.usage.maxCost = config.MaxCost
 
 	// Store runtime directory as-is (relative or empty)
 	if rd != "" {
@@ -96,6 +112,40 @@ func NewProcessor(config *DSLConfig, envConfig *config.EnvConfig, serverConfig *
 	return p
 }
 
+// fork creates a processor for running part of a workflow concurrently. The fork
+// shares configuration and progress reporting but has its own variables, handler and providers.
+func (p *Processor) fork() *Processor {
+	forked := &Processor{
+		config:        p.config,
+		envConfig:     p.envConfig,
+		serverConfig:  p.serverConfig,
+		handler:       input.NewHandler(),
+		validator:     p.validator,
+		providers:     make(map[string]models.Provider),
+		verbose:       p.verbose,
+		lastOutput:    p.lastOutput,
+		spinner:       NewSpinner(),
+		variables:     make(map[string]string, len(p.variables)),
+		stepResults:   make(map[string]*StepResult, len(p.stepResults)),
+		progress:      p.progress,
+		runtimeDir:    p.runtimeDir,
+		ctx:           p.ctx,
+		cacheOptions:  p.cacheOptions,
+		usage:         p.usage,
+		conversations: p.conversations,
+		noLocalTools:  p.noLocalTools,
+	}
+	// Forks never drive the terminal spinner; the parent owns it
+	forked.spinner.Disable()
+	for name, value := range p.variables {
+		forked.variables[name] = value
+	}
+	for name, result := range p.stepResults {
+		forked.stepResults[name] = result
+	}
+	return forked
+}
+
 // SetProgressWriter sets the progress writer for streaming updates
 func (p *Processor) SetProgressWriter(w ProgressWriter) {
 	p.progress = w
@@ -112,6 +162,11 @@ func (p *Processor) LastOutput() string {
 	return p.lastOutput
 }
 
+// Variable returns the value of a workflow variable
+func (p *Processor) Variable(name string) string {
+	return p.variables[name]
+}
+
 // debugf prints debug information if verbose mode is enabled
 func (p *Processor) debugf(format string, args ...interface{}) {
 	if p.verbose {
@@ -138,6 +193,7 @@ func (p *Processor) emitProgressWithMetrics(msg string, step *StepInfo, metrics
 			Message:            msg,
 			Step:               step,
 			PerformanceMetrics: metrics,
+			Usage:              p.StepUsage(step.Name),
 		})
 	}
 }
@@ -165,6 +221,20 @@ func (p *Processor) emitParallelProgressWithMetrics(msg string, step *StepInfo,
 			IsParallel:         true,
 			ParallelID:         parallelID,
 			PerformanceMetrics: metrics,
+			Usage:              p.StepUsage(step.Name),
+		})
+	}
+}
+
+// emitSkipped sends a progress update for a step whose when condition was false
+func (p *Processor) emitSkipped(msg string, step *StepInfo, isParallel bool, parallelID string) {
+	if p.progress != nil {
+		p.progress.WriteProgress(ProgressUpdate{
+			Type:       ProgressSkipped,
+			Message:    msg,
+			Step:       step,
+			IsParallel: isParallel,
+			ParallelID: parallelID,
 		})
 	}
 }
@@ -190,8 +260,9 @@ func (p *Processor) parseVariableAssignment(input string) (string, string) {
 
 // substituteVariables replaces variable references with their values
 func (p *Processor) substituteVariables(text string) string {
-	for name, value := range p.variables {
-		text = strings.ReplaceAll(text, "$"+name, value)
+	// Longer names are replaced first so that $item.name is not clobbered by $item
+	for _, name := range sortedVariableNames(p.variables) {
+		text = strings.ReplaceAll(text, "$"+name, p.variables[name])
 	}
 	return text
 }
@@ -202,7 +273,7 @@ func (p *Processor) validateStepConfig(stepName string, config StepConfig) error
 
 	isGenerateStep := config.Generate != nil
 	isProcessStep := config.Process != nil
-	isStandardStep := !isGenerateStep && !isProcessStep && config.Type != "openai-responses" // Standard steps are not generate, process, or openai-responses
+	isStandardStep := !isGenerateStep && !isProcessStep && config.Type != "openai-responses" && config.Type != StepTypeEmbed // Standard steps are not generate, process, openai-responses or embed
 	isOpenAIResponsesStep := config.Type == "openai-responses"
 
 	// Ensure a step is of one type only
@@ -272,6 +343,74 @@ func (p *Processor) validateStepConfig(stepName string, config StepConfig) error
 		}
 	}
 
+	if config.ForEach != nil {
+		errors = append(errors, validateForEachConfig(config.ForEach)...)
+	}
+
+	if config.NextAction != nil {
+		if _, err := p.parseNextAction(config.NextAction); err != nil {
+			errors = append(errors, err.Error())
+		} else if isStandardStep {
+			if modelNames := p.NormalizeStringSlice(config.Model); len(modelNames) == 1 && modelNames[0] == "NA" {
+				errors = append(errors, "next-action requires a model; it cannot be used with model: NA")
+			}
+		}
+	}
+
+	if strings.TrimSpace(config.When) != "" {
+		if _, err := ParseCondition(config.When); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	if err := validateModelStrategy(config); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if err := validateStream(config); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if err := validateRetryConfig(config.Retry); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if config.Timeout < 0 {
+		errors = append(errors, "timeout must not be negative")
+	}
+
+	if err := validateOutputSchema(config); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if err := validateModelParams(config); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if err := validateChunking(config); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if err := validateContextCheck(config.ContextCheck); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if err := validateConversation(config); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if err := validateTools(config); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if err := p.validateLocalTools(config); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if err := p.validateEmbed(config); err != nil {
+		errors = append(errors, err.Error())
+	}
+
 	if len(errors) > 0 {
 		return fmt.Errorf("validation errors in step '%s':\n- %s", stepName, strings.Join(errors, "\n- "))
 	}
@@ -297,6 +436,7 @@ func (p *Processor) validateDependencies() error {
 		for _, step := range steps {
 			outputs := p.NormalizeStringSlice(step.Config.Output)
 			for _, output := range outputs {
+				output, _ = p.parseVariableAssignment(output)
 				if output != "STDOUT" {
 					// Check if this output is already produced by another parallel step
 					if producerStep, exists := parallelOutputs[output]; exists {
@@ -349,6 +489,7 @@ func (p *Processor) validateDependencies() error {
 		// Add this step's outputs to the map
 		outputs := p.NormalizeStringSlice(step.Config.Output)
 		for _, output := range outputs {
+			output, _ = p.parseVariableAssignment(output)
 			if output != "STDOUT" {
 				outputFiles[output] = step.Name
 			}
@@ -395,6 +536,19 @@ func (p *Processor) checkCircularDependencies(
 
 // Process executes the DSL processing pipeline
 func (p *Processor) Process() error {
+	return p.ProcessWithContext(context.Background())
+}
+
+// ProcessWithContext processes the DSL configuration, stopping early if ctx is cancelled
+// or the workflow's timeout expires
+func (p *Processor) ProcessWithContext(ctx context.Context) error {
+	if p.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.config.Timeout)
+		defer cancel()
+	}
+	p.ctx = ctx
+
 	// Check if we have any steps to process
 	if len(p.config.Steps) == 0 && len(p.config.ParallelSteps) == 0 {
 		err := fmt.Errorf("no steps defined in DSL configuration")
@@ -409,6 +563,13 @@ func (p *Processor) Process() error {
 	// First validate all steps before processing
 	p.spinner.Start("Validating DSL configuration")
 
+	if err := p.envConfig.ValidateAliases(); err != nil {
+		p.spinner.Stop()
+		p.debugf("Model alias validation error: %v", err)
+		p.emitError(err)
+		return fmt.Errorf("validation error: %w", err)
+	}
+
 	// Validate sequential steps
 	p.debugf("Starting sequential step validation for %d steps", len(p.config.Steps))
 	for i, step := range p.config.Steps {
@@ -475,6 +636,16 @@ func (p *Processor) Process() error {
 		return fmt.Errorf("dependency validation error: %w", err)
 	}
 
+	// Build the execution graph from explicit and inferred dependencies
+	graph, err := p.buildExecutionGraph()
+	if err != nil {
+		p.spinner.Stop()
+		errMsg := fmt.Sprintf("Dependency validation failed: %v", err)
+		p.debugf("Dependency validation error: %s", errMsg)
+		p.emitError(fmt.Errorf(errMsg))
+		return fmt.Errorf("dependency validation error: %w", err)
+	}
+
 	p.spinner.Stop()
 	p.debugf("All steps validated successfully")
 
@@ -486,118 +657,20 @@ func (p *Processor) Process() error {
 		}
 	}()
 
-	// Store results from parallel steps for use in sequential steps
-	parallelResults := make(map[string]string)
-
-	// Process parallel steps first if any
-	for groupName, steps := range p.config.ParallelSteps {
-		p.spinner.Start(fmt.Sprintf("Processing parallel step group: %s", groupName))
-		p.debugf("Starting parallel processing for group '%s' with %d steps", groupName, len(steps))
-
-		// Create channels for collecting results and errors
-		type stepResult struct {
-			name   string
-			output string
+	// Run the steps in dependency order, executing independent steps concurrently
+	if err := p.runGraph(graph); err != nil {
+		p.debugf("Step processing error: %v", err)
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			return fmt.Errorf("workflow timed out after %v: %w", p.config.Timeout, err)
+		case context.Canceled:
+			return fmt.Errorf("workflow cancelled: %w", err)
 		}
-
-		resultChan := make(chan stepResult, len(steps))
-		errorChan := make(chan error, len(steps))
-
-		// Use a WaitGroup to wait for all goroutines to complete
-		var wg sync.WaitGroup
-
-		// Launch a goroutine for each parallel step
-		for _, step := range steps {
-			wg.Add(1)
-
-			// Create a copy of the step for the goroutine to avoid race conditions
-			stepCopy := step
-
-			go func() {
-				defer wg.Done()
-
-				p.debugf("Starting goroutine for parallel step: %s", stepCopy.Name)
-
-				// Process the step
-				response, err := p.processStep(stepCopy, true, groupName)
-				if err != nil {
-					p.debugf("Error in parallel step '%s': %v", stepCopy.Name, err)
-					errorChan <- fmt.Errorf("error in parallel step '%s': %w", stepCopy.Name, err)
-					return
-				}
-
-				// Send the result to the result channel
-				resultChan <- stepResult{
-					name:   stepCopy.Name,
-					output: response,
-				}
-
-				p.debugf("Completed parallel step: %s", stepCopy.Name)
-			}()
-		}
-
-		// Wait for all goroutines to complete in a separate goroutine
-		go func() {
-			wg.Wait()
-			close(resultChan)
-			close(errorChan)
-		}()
-
-		// Check for errors
-		for err := range errorChan {
-			p.spinner.Stop()
-			p.emitError(err)
-			return err
-		}
-
-		// Collect results
-		for result := range resultChan {
-			p.debugf("Collected result from parallel step: %s", result.name)
-			parallelResults[result.name] = result.output
-		}
-
-		p.spinner.Stop()
-		p.debugf("Completed all parallel steps in group: %s", groupName)
+		return fmt.Errorf("step processing error: %w", err)
 	}
 
-	// Process sequential steps
-	for stepIndex, step := range p.config.Steps {
-		stepInfo := &StepInfo{
-			Name:   step.Name,
-			Model:  fmt.Sprintf("%v", step.Config.Model),
-			Action: fmt.Sprintf("%v", step.Config.Action),
-		}
-		if step.Config.Generate != nil {
-			stepInfo.Model = fmt.Sprintf("%v", step.Config.Generate.Model)
-			stepInfo.Action = fmt.Sprintf("%v", step.Config.Generate.Action)
-		} else if step.Config.Process != nil {
-			stepInfo.Action = fmt.Sprintf("Process workflow: %s", step.Config.Process.WorkflowFile)
-			stepInfo.Model = "N/A"
-		}
-
-		stepMsg := fmt.Sprintf("Processing step %d/%d: %s", stepIndex+1, len(p.config.Steps), step.Name)
-		p.emitProgress(stepMsg, stepInfo)
-		p.spinner.Start(stepMsg)
-
-		// Process the step
-		response, err := p.processStep(step, false, "")
-		if err != nil {
-			p.spinner.Stop()
-			errMsg := fmt.Sprintf("Error processing step '%s': %v", step.Name, err)
-			p.debugf("Step processing error: %s", errMsg)
-			p.emitError(fmt.Errorf(errMsg))
-			return fmt.Errorf("step processing error: %w", err)
-		}
-
-		// Store the response for potential use as STDIN in next step
-		p.lastOutput = response
-
-		p.spinner.Stop()
-		p.debugf("Successfully processed step: %s", step.Name)
-
-		// Clear the handler's contents for the next step
-		p.handler = input.NewHandler()
-	}
+	// Clear the handler's contents after processing
+	p.handler = input.NewHandler()
 
 	p.debugf("DSL processing completed successfully")
 	return nil
@@ -605,15 +678,31 @@ func (p *Processor) Process() error {
 
 // processStep handles the processing of a single step (used for both sequential and parallel processing)
 func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (string, error) {
+	if step.Config.Timeout > 0 {
+		return p.processStepWithTimeout(step, isParallel, parallelID)
+	}
+	p.currentStep = &step
+	p.streamed.Reset()
+
 	// Create performance metrics for this step
 	metrics := &PerformanceMetrics{}
 	startTime := time.Now()
 
+	// Handle steps that iterate over a list of items
+	if step.Config.ForEach != nil {
+		return p.processForEachStep(step, isParallel, parallelID)
+	}
+
 	// Check if this is an openai-responses step
 	if step.Config.Type == "openai-responses" {
 		return p.processResponsesStep(step, isParallel, parallelID)
 	}
 
+	// Handle embed step
+	if step.Config.Type == StepTypeEmbed {
+		return p.processEmbedStep(step, isParallel, parallelID)
+	}
+
 	// Handle generate step
 	if step.Config.Generate != nil {
 		return p.processGenerateStep(step, isParallel, parallelID, metrics, startTime)
@@ -692,9 +781,16 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 		inputs = p.NormalizeStringSlice(step.Config.Input)
 	}
 
-	modelNames := p.NormalizeStringSlice(step.Config.Model)
+	modelNames := p.resolveModels(p.NormalizeStringSlice(step.Config.Model))
 	actions := p.NormalizeStringSlice(step.Config.Action)
 
+	// Replace references to earlier steps with their outputs
+	inputs, cleanupStepInputs, err := p.resolveStepInputs(inputs)
+	if err != nil {
+		return "", fmt.Errorf("input error in step '%s': %w", step.Name, err)
+	}
+	defer cleanupStepInputs()
+
 	p.debugf("Step configuration:")
 	p.debugf("- Inputs: %v", inputs)
 	p.debugf("- Models: %v", modelNames)
@@ -788,19 +884,50 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 	// Start action processing time tracking
 	actionStartTime := time.Now()
 
-	// Substitute variables in actions
+	// Render templates and variables in actions
 	substitutedActions := make([]string, len(actions))
 	for i, action := range actions {
 		original := action
-		substituted := p.substituteVariables(action)
+		substituted, err := p.renderTemplate(action)
+		if err != nil {
+			return "", fmt.Errorf("action template error in step '%s': %w", step.Name, err)
+		}
 		substitutedActions[i] = substituted
 		if original != substituted {
 			p.debugf("Variable substitution: original='%s' substituted='%s'", original, substituted)
 		}
 	}
 
+	// Ask for JSON matching the step's output_schema, natively where the provider supports it
+	var outputSchema map[string]interface{}
+	if step.Config.OutputSchema != nil {
+		if outputSchema, err = p.loadOutputSchema(step.Config.OutputSchema); err != nil {
+			return "", fmt.Errorf("output_schema error in step '%s': %w", step.Name, err)
+		}
+		// A chunked step describes the schema in its reduce_action instead
+		if step.Config.Chunking == nil {
+			for i := range substitutedActions {
+				substitutedActions[i] += schemaInstructions(outputSchema)
+			}
+		}
+		defer p.withOutputSchema(outputSchema)()
+	}
+
+	// Warn about, or stop, prompts that cannot fit the model's context window before sending them.
+	// Chunked steps are checked chunk by chunk.
+	if step.Config.Chunking == nil {
+		if err := p.checkContextWindow(step, modelNames, substitutedActions, p.contextInputs(step), isParallel, parallelID); err != nil {
+			return "", fmt.Errorf("context window check failed in step '%s': %w", step.Name, err)
+		}
+	}
+
 	p.debugf("Executing actions: models=%v actions=%v", modelNames, substitutedActions)
-	response, err := p.processActions(modelNames, substitutedActions)
+	var response, modelName string
+	if step.Config.Chunking != nil {
+		response, modelName, err = p.processChunkedActions(step, modelNames, substitutedActions, outputSchema, isParallel, parallelID)
+	} else {
+		response, modelName, err = p.processModelActions(step, modelNames, substitutedActions, isParallel, parallelID)
+	}
 	if err != nil {
 		errMsg := fmt.Sprintf("Action processing failed for step '%s': %v (models=%v actions=%v)",
 			step.Name, err, modelNames, substitutedActions)
@@ -808,6 +935,24 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 		return "", fmt.Errorf("action processing error: %w", err)
 	}
 	p.debugf("Successfully processed actions for step: %s", step.Name)
+	p.lastModel = modelName
+
+	// Refine the response with any next-action prompts
+	if step.Config.NextAction != nil {
+		response, err = p.runNextActions(step, modelName, response, isParallel, parallelID)
+		if err != nil {
+			p.debugf("Next-action error for step '%s': %v", step.Name, err)
+			return "", fmt.Errorf("next-action error: %w", err)
+		}
+	}
+
+	// Validate, and if needed repair, structured output
+	if outputSchema != nil {
+		response, err = p.enforceOutputSchema(step, modelName, outputSchema, response)
+		if err != nil {
+			return "", fmt.Errorf("output_schema error in step '%s': %w", step.Name, err)
+		}
+	}
 
 	// Record action processing time
 	metrics.ActionProcessingTime = time.Since(actionStartTime).Milliseconds()
@@ -855,10 +1000,10 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 	if !handled {
 		outputs := p.NormalizeStringSlice(step.Config.Output)
 		p.debugf("Processing regular output for step '%s': model=%s outputs=%v",
-			step.Name, modelNames[0], outputs)
-		if err := p.handleOutput(modelNames[0], response, outputs, metrics); err != nil {
+			step.Name, modelName, outputs)
+		if err := p.handleOutput(modelName, response, outputs, metrics); err != nil {
 			errMsg := fmt.Sprintf("Output processing failed for step '%s': %v (model=%s outputs=%v)",
-				step.Name, err, modelNames[0], outputs)
+				step.Name, err, modelName, outputs)
 			p.debugf("Output processing error: %s", errMsg)
 			return "", fmt.Errorf("output handling error: %w", err)
 		}
@@ -926,6 +1071,7 @@ func (p *Processor) processGenerateStep(step Step, isParallel bool, parallelID s
 			return "", fmt.Errorf("no model specified for generate step '%s' and no default_generation_model configured", step.Name)
 		}
 	}
+	genModelName = p.envConfig.ResolveModel(genModelName)
 	p.debugf("Using model '%s' for workflow generation in step '%s'", genModelName, step.Name)
 
 	// 2. Prepare the prompt for the LLM
@@ -940,6 +1086,10 @@ func (p *Processor) processGenerateStep(step Step, isParallel bool, parallelID s
 	if userAction == "" {
 		return "", fmt.Errorf("action for generate step '%s' is empty", step.Name)
 	}
+	userAction, err := p.renderTemplate(userAction)
+	if err != nil {
+		return "", fmt.Errorf("action template error in generate step '%s': %w", step.Name, err)
+	}
 
 	// Handle input for generate step (e.g., from STDIN or context_files)
 	var contextInput string
@@ -956,6 +1106,15 @@ func (p *Processor) processGenerateStep(step Step, isParallel bool, parallelID s
 				// A more sophisticated approach might handle them differently.
 				var sb strings.Builder
 				for _, inputPath := range inputs {
+					if name, ok := p.stepInputReference(inputPath); ok {
+						result, err := p.completedStep(name)
+						if err != nil {
+							return "", fmt.Errorf("input error in generate step '%s': %w", step.Name, err)
+						}
+						sb.WriteString(result.Output)
+						sb.WriteString("\n\n")
+						continue
+					}
 					content, err := os.ReadFile(inputPath)
 					if err != nil {
 						p.debugf("Warning: could not read input file %s for generate step %s: %v", inputPath, step.Name, err)
@@ -1024,10 +1183,11 @@ IMPORTANT: When specifying models in the generated YAML, you MUST use one of the
 	// }
 
 	// Assuming provider is already configured via configureProviders() or similar mechanism
-	generatedResponse, err := provider.SendPrompt(genModelName, fullPrompt)
+	generatedResponse, err := p.stepProvider(provider).SendPrompt(p.ctx, genModelName, fullPrompt)
 	if err != nil {
 		return "", fmt.Errorf("LLM execution failed for generate step '%s' with model '%s': %w", step.Name, genModelName, err)
 	}
+	p.lastModel = genModelName
 
 	// Extract YAML content from the response
 	yamlContent := generatedResponse
@@ -1072,6 +1232,7 @@ IMPORTANT: When specifying models in the generated YAML, you MUST use one of the
 	if err := os.WriteFile(outputFilePath, []byte(yamlContent), 0644); err != nil {
 		return "", fmt.Errorf("failed to write generated workflow to '%s' in generate step '%s': %w", outputFilePath, step.Name, err)
 	}
+	p.written = append(p.written, outputFilePath)
 
 	p.debugf("Generated workflow saved to %s", outputFilePath)
 
@@ -1108,22 +1269,35 @@ func (p *Processor) processProcessStep(step Step, isParallel bool, parallelID st
 		return "", fmt.Errorf("failed to read sub-workflow file '%s' for process step '%s': %w", subWorkflowPath, step.Name, err)
 	}
 
-	var subDSLConfig DSLConfig
-	if err := yaml.Unmarshal(yamlFile, &subDSLConfig); err != nil {
+	subDSLConfig, err := ParseDSL(yamlFile)
+	if err != nil {
 		return "", fmt.Errorf("failed to unmarshal sub-workflow YAML '%s' for process step '%s': %w", subWorkflowPath, step.Name, err)
 	}
+	if err := p.checkCaptureOutputs(step, subDSLConfig); err != nil {
+		return "", fmt.Errorf("error capturing outputs in step '%s': %w", step.Name, err)
+	}
 
 	// 2. Create a new Processor for the sub-workflow
 	//    It inherits verbose settings and envConfig, but has its own DSLConfig and variables.
 	//    The runtimeDir for the sub-processor could be the directory of the sub-workflow file or inherited.
 	//    For now, let's assume it inherits the parent's runtimeDir.
-	subProcessor := NewProcessor(&subDSLConfig, p.envConfig, p.serverConfig, p.verbose, p.runtimeDir)
+	subProcessor := NewProcessor(subDSLConfig, p.envConfig, p.serverConfig, p.verbose, p.runtimeDir)
 	if p.progress != nil { // Propagate progress writer if available
 		subProcessor.SetProgressWriter(p.progress)
 	}
-
-	// 3. Handle inputs for the sub-workflow (optional)
-	if step.Config.Process.Inputs != nil {
+	subProcessor.SetCacheOptions(p.cacheOptions)
+	subProcessor.noLocalTools = p.noLocalTools
+	// The sub-workflow's usage counts towards this step and this workflow's budget
+	subProcessor.usage.parent = p.usage
+	subProcessor.usage.parentStep = step.Name
+
+	// 3. Handle inputs for the sub-workflow (optional). Sub-workflows that declare params
+	//    receive them as parameters, so they are type checked and defaults apply.
+	if len(subDSLConfig.Params) > 0 {
+		if err := subProcessor.SetParams(step.Config.Process.Inputs); err != nil {
+			return "", fmt.Errorf("invalid inputs for sub-workflow '%s' in step '%s': %w", subWorkflowPath, step.Name, err)
+		}
+	} else if step.Config.Process.Inputs != nil {
 		for key, value := range step.Config.Process.Inputs {
 			// How these inputs are made available to the sub-workflow needs careful design.
 			// Option 1: Set them as initial variables in the sub-processor.
@@ -1143,15 +1317,15 @@ func (p *Processor) processProcessStep(step Step, isParallel bool, parallelID st
 	}
 
 	// 4. Execute the sub-workflow
-	if err := subProcessor.Process(); err != nil {
+	if err := subProcessor.ProcessWithContext(p.ctx); err != nil {
 		return "", fmt.Errorf("error processing sub-workflow '%s' in step '%s': %w", subWorkflowPath, step.Name, err)
 	}
+	p.written = append(p.written, subProcessor.written...)
 
-	// 5. Handle output capture (optional)
-	//    This is a placeholder for now. Capturing specific outputs from a sub-workflow
-	//    and making them available to the parent requires more design (e.g., sub-workflow
-	//    explicitly "exports" variables or files).
-	//    For now, the main output of the sub-processor (lastOutput) could be returned.
+	// 5. Store the exports listed in capture_outputs in the parent's variables
+	if err := p.captureOutputs(step, subProcessor); err != nil {
+		return "", fmt.Errorf("error capturing outputs in step '%s': %w", step.Name, err)
+	}
 
 	resultMessage := fmt.Sprintf("Successfully processed sub-workflow %s", subWorkflowPath)
 	p.debugf(resultMessage)
@@ -1167,8 +1341,40 @@ func (p *Processor) processProcessStep(step Step, isParallel bool, parallelID st
 	return subProcessor.LastOutput(), nil // Return the last output of the sub-workflow
 }
 
+// withContext makes ctx the context of the requests sent for the current step and returns a
+// function that restores the previous one. Steps change their context only through it, and
+// defer the returned function so that the context is restored on every path.
+func (p *Processor) withContext(ctx context.Context) func() {
+	parent := p.ctx
+	p.ctx = ctx
+	return func() {
+		p.ctx = parent
+	}
+}
+
+// processStepWithTimeout runs a step with a deadline of step.Config.Timeout. The timeout covers
+// the whole step, including every item of a for_each step.
+func (p *Processor) processStepWithTimeout(step Step, isParallel bool, parallelID string) (string, error) {
+	timeout := step.Config.Timeout
+	parent := p.ctx
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	defer p.withContext(ctx)()
+
+	step.Config.Timeout = 0
+	response, err := p.processStep(step, isParallel, parallelID)
+	if err != nil && ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+		return "", fmt.Errorf("step '%s' timed out after %v: %w", step.Name, timeout, err)
+	}
+	return response, err
+}
+
 // getCurrentStepConfig returns the configuration for the current step being processed
 func (p *Processor) getCurrentStepConfig() StepConfig {
+	if p.currentStep != nil {
+		return p.currentStep.Config
+	}
+
 	// If we're not processing a step yet, return an empty config with default values
 	if p.config == nil || (len(p.config.Steps) == 0 && len(p.config.ParallelSteps) == 0) {
 		return StepConfig{
@@ -1205,8 +1411,8 @@ func (p *Processor) validateGeneratedWorkflow(yamlContent string) error {
 	p.debugf("Validating generated workflow YAML")
 
 	// Parse the YAML to check for model validity
-	var generatedConfig DSLConfig
-	if err := yaml.Unmarshal([]byte(yamlContent), &generatedConfig); err != nil {
+	generatedConfig, err := ParseDSL([]byte(yamlContent))
+	if err != nil {
 		return fmt.Errorf("generated YAML is invalid: %w", err)
 	}
 
@@ -1268,7 +1474,7 @@ func (p *Processor) validateGeneratedWorkflow(yamlContent string) error {
 
 	// Validate each referenced model
 	invalidModels := []string{}
-	for _, modelName := range referencedModels {
+	for _, modelName := range p.resolveModels(referencedModels) {
 		p.debugf("Checking if model '%s' in generated workflow is valid", modelName)
 
 		// Check if provider exists for this model
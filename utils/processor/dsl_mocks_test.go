@@ -1,6 +1,7 @@
 package processor
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/kris-hansen/comanda/utils/models"
@@ -85,7 +86,7 @@ func (m *MockProvider) Configure(apiKey string) error {
 	return nil
 }
 
-func (m *MockProvider) SendPrompt(model, prompt string) (string, error) {
+func (m *MockProvider) SendPrompt(ctx context.Context, model, prompt string) (string, error) {
 	if !m.configured {
 		return "", fmt.Errorf("provider not configured")
 	}
@@ -95,7 +96,7 @@ func (m *MockProvider) SendPrompt(model, prompt string) (string, error) {
 	return "mock response", nil
 }
 
-func (m *MockProvider) SendPromptWithFile(model, prompt string, file models.FileInput) (string, error) {
+func (m *MockProvider) SendPromptWithFile(ctx context.Context, model, prompt string, file models.FileInput) (string, error) {
 	if !m.configured {
 		return "", fmt.Errorf("provider not configured")
 	}
@@ -105,6 +106,21 @@ func (m *MockProvider) SendPromptWithFile(model, prompt string, file models.File
 	return fmt.Sprintf("mock response for file: %s", file.Path), nil
 }
 
+func (m *MockProvider) SendMessages(ctx context.Context, model string, messages []models.Message) (string, error) {
+	if !m.configured {
+		return "", fmt.Errorf("provider not configured")
+	}
+	if !m.SupportsModel(model) {
+		return "", fmt.Errorf("unsupported model: %s", model)
+	}
+	return "mock response", nil
+}
+
+func (m *MockProvider) SendMessagesWithTools(ctx context.Context, model string, messages []models.Message, tools []models.Tool) (models.Message, error) {
+	response, err := m.SendMessages(ctx, model, messages)
+	return models.Message{Role: models.RoleAssistant, Content: response}, err
+}
+
 func (m *MockProvider) SetVerbose(verbose bool) {
 	m.verbose = verbose
 }
@@ -0,0 +1,319 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/input"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// StepTypeEmbed is the type of steps that compute vector embeddings of their inputs
+const StepTypeEmbed = "embed"
+
+// Actions of embed steps
+const (
+	EmbedActionEmbed      = "embed"      // Write the embedding of each text (default)
+	EmbedActionSimilarity = "similarity" // Rank the texts by their similarity to a query
+)
+
+// How embed steps split their inputs into texts
+const (
+	EmbedSplitLines = "lines" // A JSON array yields its elements, anything else its non-empty lines (default)
+	EmbedSplitNone  = "none"  // Each input is one text
+)
+
+// EmbedConfig represents the configuration of an embed step
+type EmbedConfig struct {
+	Split string `yaml:"split"` // How inputs are split into texts: lines (default) or none
+	Query string `yaml:"query"` // Text the inputs are ranked against by the similarity action
+	TopK  int    `yaml:"top_k"` // Number of best matches the similarity action keeps (default all)
+}
+
+// textEmbedding is the embedding of one text, as written by the embed action
+type textEmbedding struct {
+	Text      string    `json:"text"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// similarityMatch is a text ranked by the similarity action
+type similarityMatch struct {
+	Index int     `json:"index"` // Position of the text among the step's texts
+	Text  string  `json:"text"`
+	Score float64 `json:"score"` // Cosine similarity to the query
+}
+
+// embedAction returns the action of an embed step
+func embedAction(actions []string) string {
+	if len(actions) == 0 {
+		return EmbedActionEmbed
+	}
+	return strings.TrimSpace(actions[0])
+}
+
+// validateEmbed checks the fields of an embed step, and that embed settings are only used on one
+func (p *Processor) validateEmbed(config StepConfig) error {
+	if config.Type != StepTypeEmbed {
+		if config.Embed != nil {
+			return fmt.Errorf("embed settings require type: %s", StepTypeEmbed)
+		}
+		return nil
+	}
+
+	if config.Input == nil {
+		return fmt.Errorf("input is required for embed steps")
+	}
+	if modelNames := p.NormalizeStringSlice(config.Model); len(modelNames) != 1 || modelNames[0] == "NA" {
+		return fmt.Errorf("embed steps require a single embedding model")
+	}
+	if config.Output == nil {
+		return fmt.Errorf("output is required for embed steps")
+	}
+
+	for _, field := range []struct {
+		name string
+		set  bool
+	}{
+		{"stream", config.Stream},
+		{"chunking", config.Chunking != nil},
+		{"next-action", config.NextAction != nil},
+		{"output_schema", config.OutputSchema != nil},
+		{"conversation", config.Conversation != ""},
+		{"tools", len(config.Tools) > 0},
+		{"cache", config.Cache != nil},
+	} {
+		if field.set {
+			return fmt.Errorf("%s cannot be used with embed steps", field.name)
+		}
+	}
+
+	var embed EmbedConfig
+	if config.Embed != nil {
+		embed = *config.Embed
+	}
+	actions := p.NormalizeStringSlice(config.Action)
+	if len(actions) > 1 {
+		return fmt.Errorf("embed steps take a single action: %s or %s", EmbedActionEmbed, EmbedActionSimilarity)
+	}
+	switch action := embedAction(actions); action {
+	case EmbedActionEmbed:
+		if embed.Query != "" || embed.TopK != 0 {
+			return fmt.Errorf("query and top_k require action: %s", EmbedActionSimilarity)
+		}
+	case EmbedActionSimilarity:
+		if strings.TrimSpace(embed.Query) == "" {
+			return fmt.Errorf("action %s requires a query in the embed settings", EmbedActionSimilarity)
+		}
+		if embed.TopK < 0 {
+			return fmt.Errorf("top_k must not be negative")
+		}
+	default:
+		return fmt.Errorf("invalid embed action '%s': must be %s or %s", action, EmbedActionEmbed, EmbedActionSimilarity)
+	}
+	switch embed.Split {
+	case "", EmbedSplitLines, EmbedSplitNone:
+	default:
+		return fmt.Errorf("invalid embed split '%s': must be %s or %s", embed.Split, EmbedSplitLines, EmbedSplitNone)
+	}
+	return nil
+}
+
+// processEmbedStep computes the embeddings of an embed step's texts and writes them, or for
+// the similarity action, writes the texts ranked by their similarity to the query
+func (p *Processor) processEmbedStep(step Step, isParallel bool, parallelID string) (string, error) {
+	startTime := time.Now()
+	var embed EmbedConfig
+	if step.Config.Embed != nil {
+		embed = *step.Config.Embed
+	}
+	modelName := p.envConfig.ResolveModel(p.NormalizeStringSlice(step.Config.Model)[0])
+	action := embedAction(p.NormalizeStringSlice(step.Config.Action))
+
+	stepInfo := &StepInfo{Name: step.Name, Model: modelName, Action: action}
+	if isParallel {
+		p.emitParallelProgress(fmt.Sprintf("Processing parallel step: %s", step.Name), stepInfo, parallelID)
+	} else {
+		p.emitProgress(fmt.Sprintf("Processing step: %s", step.Name), stepInfo)
+	}
+	p.debugf("Processing embed step: name=%s model=%s action=%s", step.Name, modelName, action)
+
+	texts, err := p.embedTexts(step.Config.Input, embed.Split)
+	if err != nil {
+		return "", fmt.Errorf("input error in step '%s': %w", step.Name, err)
+	}
+	if len(texts) == 0 {
+		return "", fmt.Errorf("no text to embed in step '%s'", step.Name)
+	}
+
+	// The query is embedded with the texts, as the last of them
+	toEmbed := texts
+	if action == EmbedActionSimilarity {
+		query, err := p.renderTemplate(embed.Query)
+		if err != nil {
+			return "", fmt.Errorf("query template error in step '%s': %w", step.Name, err)
+		}
+		toEmbed = append(append([]string{}, texts...), query)
+	}
+
+	if err := p.validateModel([]string{modelName}, nil); err != nil {
+		return "", fmt.Errorf("model validation error: %w", err)
+	}
+	if err := p.configureProviders(); err != nil {
+		return "", fmt.Errorf("provider configuration error: %w", err)
+	}
+	provider, err := p.configuredProviderFor(modelName)
+	if err != nil {
+		return "", err
+	}
+
+	p.debugf("Embedding %d texts with model %s", len(toEmbed), modelName)
+	embeddings, err := models.Embed(p.ctx, p.withStepRetry(p.withUsage(provider)), modelName, toEmbed)
+	if err != nil {
+		return "", fmt.Errorf("embedding error in step '%s': %w", step.Name, err)
+	}
+	p.lastModel = modelName
+
+	// Rows hold the arguments of a database output's placeholders for each text
+	var data []byte
+	var rows [][]interface{}
+	if action == EmbedActionSimilarity {
+		matches, err := rankBySimilarity(texts, embeddings[:len(texts)], embeddings[len(texts)], embed.TopK)
+		if err != nil {
+			return "", fmt.Errorf("similarity error in step '%s': %w", step.Name, err)
+		}
+		for _, match := range matches {
+			rows = append(rows, []interface{}{match.Text, match.Score})
+		}
+		data, err = json.MarshalIndent(matches, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("error converting matches to JSON: %w", err)
+		}
+	} else {
+		results := make([]textEmbedding, len(texts))
+		for i, text := range texts {
+			results[i] = textEmbedding{Text: text, Embedding: embeddings[i]}
+			rows = append(rows, []interface{}{text, vectorLiteral(embeddings[i])})
+		}
+		data, err = json.Marshal(results)
+		if err != nil {
+			return "", fmt.Errorf("error converting embeddings to JSON: %w", err)
+		}
+	}
+	response := string(data)
+
+	metrics := &PerformanceMetrics{TotalProcessingTime: time.Since(startTime).Milliseconds()}
+	if dbConfig, ok := step.Config.Output.(map[string]interface{}); ok && dbConfig["database"] != nil {
+		if err := p.handleDatabaseRowsOutput(rows, dbConfig); err != nil {
+			return "", fmt.Errorf("database output error: %w", err)
+		}
+	} else if err := p.handleOutput(modelName, response, p.NormalizeStringSlice(step.Config.Output), metrics); err != nil {
+		return "", fmt.Errorf("output handling error: %w", err)
+	}
+
+	message := fmt.Sprintf("Completed step: %s (in %d ms)", step.Name, metrics.TotalProcessingTime)
+	if isParallel {
+		p.emitParallelProgressWithMetrics(message, stepInfo, parallelID, metrics)
+	} else {
+		p.emitProgressWithMetrics(message, stepInfo, metrics)
+	}
+	return response, nil
+}
+
+// embedTexts returns the texts an embed step embeds. STDIN is the previous step's output, and
+// other inputs are read like those of standard steps. Each input is split into texts unless
+// split is none.
+func (p *Processor) embedTexts(stepInput interface{}, split string) ([]string, error) {
+	inputs, cleanup, err := p.resolveStepInputs(p.NormalizeStringSlice(stepInput))
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var contents, paths []string
+	for _, in := range inputs {
+		if strings.HasPrefix(in, "STDIN") {
+			if _, varName := p.parseVariableAssignment(in); varName != "" {
+				p.variables[varName] = p.lastOutput
+			}
+			contents = append(contents, p.lastOutput)
+			continue
+		}
+		paths = append(paths, in)
+	}
+	p.handler = input.NewHandler()
+	if err := p.processInputs(paths); err != nil {
+		return nil, err
+	}
+	for _, in := range p.handler.GetInputs() {
+		contents = append(contents, string(in.Contents))
+	}
+
+	var texts []string
+	for _, content := range contents {
+		if split == EmbedSplitNone {
+			if text := strings.TrimSpace(content); text != "" {
+				texts = append(texts, text)
+			}
+			continue
+		}
+		items, err := parseForEachContent(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split input into texts: %w", err)
+		}
+		for _, item := range items {
+			texts = append(texts, item.value)
+		}
+	}
+	return texts, nil
+}
+
+// rankBySimilarity orders texts by the cosine similarity of their embeddings to the query's,
+// most similar first, keeping the first topK when it is greater than 0
+func rankBySimilarity(texts []string, embeddings [][]float32, query []float32, topK int) ([]similarityMatch, error) {
+	matches := make([]similarityMatch, len(texts))
+	for i, text := range texts {
+		score, err := cosineSimilarity(embeddings[i], query)
+		if err != nil {
+			return nil, err
+		}
+		matches[i] = similarityMatch{Index: i, Text: text, Score: score}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	if topK > 0 && topK < len(matches) {
+		matches = matches[:topK]
+	}
+	return matches, nil
+}
+
+// cosineSimilarity returns the cosine of the angle between two embeddings, or 0 if either is zero
+func cosineSimilarity(a, b []float32) (float64, error) {
+	if len(a) != len(b) {
+		return 0, fmt.Errorf("embeddings have different sizes: %d and %d", len(a), len(b))
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0, nil
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB)), nil
+}
+
+// vectorLiteral formats an embedding as a pgvector value such as [0.1,0.2]
+func vectorLiteral(values []float32) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.FormatFloat(float64(v), 'g', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
@@ -0,0 +1,182 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// embeddingProvider returns fixed embeddings for known texts and records the texts it embeds
+type embeddingProvider struct {
+	MockProvider
+	vectors map[string][]float32
+	calls   [][]string
+}
+
+func (e *embeddingProvider) SupportsModel(modelName string) bool {
+	return modelName == "text-embedding-3-small"
+}
+
+func (e *embeddingProvider) Embed(ctx context.Context, modelName string, texts []string) ([][]float32, error) {
+	e.calls = append(e.calls, texts)
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector, ok := e.vectors[text]
+		if !ok {
+			return nil, fmt.Errorf("no embedding for %q", text)
+		}
+		embeddings[i] = vector
+	}
+	return embeddings, nil
+}
+
+// runEmbedStep runs an embed step over the lines of input and returns what it wrote
+func runEmbedStep(t *testing.T, provider *embeddingProvider, input string, action string, embed *EmbedConfig) (string, error) {
+	t.Helper()
+	original := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider {
+		if provider.SupportsModel(modelName) {
+			return provider
+		}
+		return nil
+	}
+	t.Cleanup(func() {
+		models.DetectProvider = original
+	})
+
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "docs.txt")
+	outputPath := filepath.Join(dir, "out.json")
+	if err := os.WriteFile(inputPath, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	envConfig := createTestEnvConfig()
+	envConfig.Providers["openai"].Models = append(envConfig.Providers["openai"].Models,
+		config.Model{Name: "text-embedding-3-small", Type: "external", Modes: []config.ModelMode{config.TextMode}})
+	stepConfig := StepConfig{Type: StepTypeEmbed, Input: inputPath, Model: "text-embedding-3-small", Output: outputPath, Embed: embed}
+	if action != "" {
+		stepConfig.Action = action
+	}
+	dslConfig := &DSLConfig{Steps: []Step{{Name: "embed_docs", Config: stepConfig}}}
+	if err := NewProcessor(dslConfig, envConfig, createTestServerConfig(), false, "").Process(); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), nil
+}
+
+func TestEmbedStep(t *testing.T) {
+	provider := &embeddingProvider{
+		MockProvider: MockProvider{name: "openai"},
+		vectors:      map[string][]float32{"cats": {1, 0}, "dogs": {0, 1}},
+	}
+	output, err := runEmbedStep(t, provider, "cats\n\ndogs\n", "", nil)
+	if err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+
+	var got []textEmbedding
+	if err := json.Unmarshal([]byte(output), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, output)
+	}
+	want := []textEmbedding{{Text: "cats", Embedding: []float32{1, 0}}, {Text: "dogs", Embedding: []float32{0, 1}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("embeddings = %+v, want %+v", got, want)
+	}
+	if len(provider.calls) != 1 {
+		t.Errorf("got %d embedding requests, want 1", len(provider.calls))
+	}
+}
+
+func TestEmbedStepSimilarity(t *testing.T) {
+	provider := &embeddingProvider{
+		MockProvider: MockProvider{name: "openai"},
+		vectors: map[string][]float32{
+			"reset your password": {1, 0.1},
+			"pricing plans":       {0, 1},
+			"account recovery":    {0.8, 0.6},
+			"forgot password":     {1, 0},
+		},
+	}
+	input := `["pricing plans", "reset your password", "account recovery"]`
+	output, err := runEmbedStep(t, provider, input, EmbedActionSimilarity, &EmbedConfig{Query: "forgot password", TopK: 2})
+	if err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+
+	var got []similarityMatch
+	if err := json.Unmarshal([]byte(output), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, output)
+	}
+	if len(got) != 2 || got[0].Text != "reset your password" || got[0].Index != 1 || got[1].Text != "account recovery" {
+		t.Errorf("matches = %+v, want reset your password then account recovery", got)
+	}
+	if got[0].Score < got[1].Score || got[1].Score <= 0 {
+		t.Errorf("scores = %v, %v, want descending and positive", got[0].Score, got[1].Score)
+	}
+	if calls := provider.calls; len(calls) != 1 || calls[0][len(calls[0])-1] != "forgot password" {
+		t.Errorf("embedding requests = %q, want one ending with the query", calls)
+	}
+}
+
+func TestValidateEmbed(t *testing.T) {
+	valid := StepConfig{Type: StepTypeEmbed, Input: "docs.txt", Model: "text-embedding-3-small", Output: "out.json"}
+	with := func(change func(*StepConfig)) StepConfig {
+		config := valid
+		change(&config)
+		return config
+	}
+
+	tests := []struct {
+		name    string
+		config  StepConfig
+		wantErr string
+	}{
+		{"embed", valid, ""},
+		{"similarity", with(func(c *StepConfig) {
+			c.Action = "similarity"
+			c.Embed = &EmbedConfig{Query: "refunds", TopK: 3}
+		}), ""},
+		{"database output", with(func(c *StepConfig) {
+			c.Output = map[string]interface{}{"database": "docs", "sql": "INSERT INTO docs (content, embedding) VALUES ($1, $2)"}
+		}), ""},
+		{"similarity without query", with(func(c *StepConfig) { c.Action = "similarity" }), "requires a query"},
+		{"query without similarity", with(func(c *StepConfig) { c.Embed = &EmbedConfig{Query: "refunds"} }), "require action: similarity"},
+		{"unknown action", with(func(c *StepConfig) { c.Action = "summarize" }), "invalid embed action"},
+		{"unknown split", with(func(c *StepConfig) { c.Embed = &EmbedConfig{Split: "words"} }), "invalid embed split"},
+		{"several models", with(func(c *StepConfig) { c.Model = []interface{}{"text-embedding-3-small", "text-embedding-3-large"} }), "single embedding model"},
+		{"stream", with(func(c *StepConfig) { c.Stream = true }), "stream cannot be used"},
+		{"embed settings on a standard step", StepConfig{Embed: &EmbedConfig{Query: "refunds"}}, "require type: embed"},
+	}
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false, "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := processor.validateEmbed(tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateEmbed() error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateEmbed() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVectorLiteral(t *testing.T) {
+	if got := vectorLiteral([]float32{0.5, -1, 0.125}); got != "[0.5,-1,0.125]" {
+		t.Errorf("vectorLiteral() = %s", got)
+	}
+}
@@ -34,31 +34,50 @@ This is the most common step type.
 step_name:
   input: [input source]
   model: [model name]
+  model_strategy: [fallback|race|all] # Optional, how a list of models is used
   action: [action to perform / prompt provided]
   output: [output destination]
   type: [optional, e.g., "openai-responses"] # Specifies specialized handling
   batch_mode: [individual|combined] # Optional, for multi-file inputs
   skip_errors: [true|false] # Optional, for multi-file inputs
+  when: "[condition]" # Optional, step only runs when the condition is true
+  for_each: [items] # Optional, runs the step once per item
+  depends_on: [step names] # Optional, steps or parallel groups that must finish first
+  next-action: [follow-up prompt(s)] # Optional, refines the output with more prompts
+  retry: {max_attempts: 3} # Optional, retries rate-limited or failed model calls
+  timeout: 2m # Optional, maximum duration of the step
+  cache: [true|false|ttl] # Optional, reuses cached responses to identical prompts
+  temperature: 0.2 # Optional model parameters: temperature, max_tokens, top_p, stop, seed, system
+  stream: [true|false] # Optional, writes the response as it is generated
   # ... other type-specific fields for "openai-responses" like 'instructions', 'tools', etc.
 ` + "```" + `
 
 **Key Elements:**
 - ` + "`input`" + `: (Required for most, can be ` + "`NA`" + `) Source of data. See "Input Types".
 - ` + "`model`" + `: (Required, can be ` + "`NA`" + `) LLM model to use. See "Models".
+- ` + "`model_strategy`" + `: (Optional, default: ` + "`fallback`" + `) How a list of models is used. See "Multiple Models".
 - ` + "`action`" + `: (Required for most) Instructions or operations. See "Actions".
 - ` + "`output`" + `: (Required) Destination for results. See "Outputs".
 - ` + "`type`" + `: (Optional) Specifies a specialized handler for the step, e.g., ` + "`openai-responses`" + `. If omitted, it's a general-purpose LLM or NA step.
 - ` + "`batch_mode`" + `: (Optional, default: ` + "`combined`" + `) For steps with multiple file inputs, defines if files are processed ` + "`combined`" + ` into one LLM call or ` + "`individual`" + `ly.
 - ` + "`skip_errors`" + `: (Optional, default: ` + "`false`" + `) If ` + "`batch_mode: individual`" + `, determines if processing continues if one file fails.
+- ` + "`when`" + `: (Optional) A condition evaluated before the step runs. If it is false, the step is skipped. See "Conditional Steps".
+- ` + "`for_each`" + `: (Optional) Runs the step once for each item of a list. See "Looping Over Items".
+- ` + "`depends_on`" + `: (Optional) Step names or parallel group names this step waits for. See "Parallel Groups and Dependencies".
+- ` + "`next-action`" + `: (Optional) Follow-up prompts sent to the same model to refine the output, optionally in a loop. See "Iterative Refinement".
+- ` + "`retry`" + `: (Optional) Retries model calls that fail with transient errors, with exponential backoff. See "Retrying Failed Model Calls".
+- ` + "`timeout`" + `: (Optional) Maximum duration of the step, such as ` + "`30s`" + ` or ` + "`2m`" + `. See "Timeouts and Cancellation".
+- ` + "`cache`" + `: (Optional) Reuses the cached response when the same prompt and files were already sent to the same model. See "Caching Model Responses".
+- ` + "`temperature`" + `, ` + "`max_tokens`" + `, ` + "`top_p`" + `, ` + "`stop`" + `, ` + "`seed`" + `, ` + "`system`" + `: (Optional) Model parameters for the step's calls. See "Model Parameters".
+- ` + "`stream`" + `: (Optional, default: ` + "`false`" + `) Writes the response as it is generated. See "Streaming Responses".
 
 **OpenAI Responses API Specific Fields (used when ` + "`type: openai-responses`" + `):**
 - ` + "`instructions`" + `: (string) System message for the LLM.
-- ` + "`tools`" + `: (list of maps) Configuration for tools/functions the LLM can call.
+- ` + "`tools`" + `: (list of maps) Configuration for tools/functions the LLM can call. Standard steps use built-in tools instead (see Tools).
 - ` + "`previous_response_id`" + `: (string) ID of a previous response for maintaining conversation state.
-- ` + "`max_output_tokens`" + `: (int) Token limit for the LLM response.
-- ` + "`temperature`" + `: (float) Sampling temperature.
-- ` + "`top_p`" + `: (float) Nucleus sampling (top-p).
-- ` + "`stream`" + `: (bool) Whether to stream the response.
+- ` + "`max_output_tokens`" + `: (int) Token limit for the LLM response (defaults to ` + "`max_tokens`" + `).
+- ` + "`temperature`" + ` and ` + "`top_p`" + ` apply as on standard steps; ` + "`system`" + ` is used when ` + "`instructions`" + ` is not set.
+- ` + "`stream`" + `: (bool) Whether to stream the response through the Responses API.
 - ` + "`response_format`" + `: (map) Specifies response format, e.g., ` + "`{ type: \"json_object\" }`" + `.
 
 
@@ -94,18 +113,52 @@ step_name_for_processing:
   process:
     workflow_file: [path_to_comanda_yaml_to_execute] # e.g., generated_workflow.yaml or existing_flow.yaml
     inputs: {key1: value1, key2: value2, optional} # Map of inputs to pass to the sub-workflow.
-    # capture_outputs: [list_of_outputs_to_capture, optional] # Future: Define how to capture specific outputs.
+    capture_outputs: [export_name, other_export as $parent_var, optional] # Exports of the sub-workflow to store in variables.
 ` + "```" + `
 **` + "`process`" + ` Block Attributes:**
 - ` + "`workflow_file`" + `: (string, required) The path to the Comanda workflow YAML file to be executed. This can be a statically defined path or the output of a ` + "`generate`" + ` step.
 - ` + "`inputs`" + `: (map, optional) A map of key-value pairs to pass as initial variables to the sub-workflow. These can be accessed within the sub-workflow (e.g., as ` + "`$parent.key1`" + `).
+- ` + "`capture_outputs`" + `: (list, optional) Names of values the sub-workflow exports. ` + "`name`" + ` stores the export in ` + "`$name`" + `; ` + "`name as $var`" + ` stores it in ` + "`$var`" + `. Capturing a name the sub-workflow does not export is an error.
 - **Note:** The ` + "`input`" + ` field for a ` + "`process`" + ` step is optional. If ` + "`input: STDIN`" + ` is used, the output of the previous step in the parent workflow will be available as the initial ` + "`STDIN`" + ` for the *first* step of the sub-workflow if that first step expects ` + "`STDIN`" + `.
 
+**Exporting values from a sub-workflow (` + "`outputs`" + `):**
+A workflow declares what it exports with the top-level ` + "`outputs`" + ` key, mapping export names to a variable (` + "`$name`" + `), a step result (` + "`steps.step_name`" + ` or ` + "`steps.step_name.field`" + `) or a file path (its contents):
+` + "```yaml" + `
+# summarize_flow.yaml
+summarize:
+  input: STDIN
+  model: gpt-4o-mini
+  action: "Summarize this text."
+  output: STDOUT as $summary
+
+outputs:
+  summary: $summary
+  model_used: steps.summarize.model
+  notes: notes.txt
+` + "```" + `
+` + "```yaml" + `
+# parent workflow
+run_summary:
+  input: STDIN
+  process:
+    workflow_file: summarize_flow.yaml
+    capture_outputs: [summary, model_used as $summary_model]
+
+report:
+  input: NA
+  model: gpt-4o
+  action: "Write a report from this summary: $summary"
+  output: STDOUT
+` + "```" + `
+- Exports are read after the sub-workflow finishes. An unset variable, an unknown or unfinished step, or an unreadable file is an error that names the export.
+- ` + "`outputs`" + ` is reserved at the top level and cannot be used as a step name.
+
 ## Common Elements (for Standard Steps)
 
 ### Input Types
 - File path: ` + "`input: path/to/file.txt`" + `
 - Previous step output: ` + "`input: STDIN`" + `
+- Output of any earlier step by name: ` + "`input: steps.extract_entities`" + ` (see "Step Results")
 - Multiple file paths: ` + "`input: [file1.txt, file2.txt]`" + `
 - Web scraping: ` + "`input: { url: \"https://example.com\" }`" + ` (Further scrape config under ` + "`scrape_config`" + ` map if needed)
 - Database query: ` + "`input: { database: { type: \"postgres\", query: \"SELECT * FROM users\" } }`" + `
@@ -117,6 +170,7 @@ step_name_for_processing:
 - Single model: ` + "`model: gpt-4o-mini`" + `
 - No model (for non-LLM operations): ` + "`model: NA`" + `
 - Multiple models (for comparison): ` + "`model: [gpt-4o-mini, claude-3-opus-20240229]`" + `
+- Model alias from the environment file's ` + "`aliases:`" + ` (e.g. ` + "`model: smart`" + `): resolved to the model it names before the provider is detected. ` + "`COMANDA_ENVIRONMENT`" + ` selects per-environment overrides.
 
 ### Actions
 - Single instruction: ` + "`action: \"Summarize this text.\"`" + `
@@ -128,12 +182,476 @@ step_name_for_processing:
 - Console: ` + "`output: STDOUT`" + `
 - File: ` + "`output: results.txt`" + `
 - Database: ` + "`output: { database: { type: \"postgres\", table: \"results_table\" } }`" + `
-- Output with alias (if supported for variable creation from output): ` + "`output: STDOUT as $step_output_var`" + `
+- Output with alias (stores the response in a variable): ` + "`output: STDOUT as $step_output_var`" + `
 
 ## Variables
 - Definition: ` + "`input: data.txt as $initial_data`" + `
 - Reference: ` + "`action: \"Compare this analysis with $initial_data\"`" + `
 - Scope: Variables are typically scoped to the workflow. For ` + "`process`" + ` steps, parent variables are not directly accessible by default; use the ` + "`process.inputs`" + ` map to pass data.
+- Templates: ` + "`{{ .vars.initial_data }}`" + ` also references a variable. See "Templates".
+
+## Templates
+Actions, ` + "`instructions`" + `, output file paths and database ` + "`sql`" + ` are rendered as Go templates (` + "`text/template`" + `).
+
+` + "```yaml" + `
+report:
+  input: NA
+  model: gpt-4o
+  action: |
+    Write a {{ .vars.tone | default "neutral" }} report for {{ env "TEAM_NAME" }} based on:
+    {{ .steps.summarize.output | truncate 4000 }}
+  output: "reports/{{ .vars.region | lower }}.md"
+` + "```" + `
+
+- Data: ` + "`.vars.name`" + ` (variables), ` + "`.steps.step_name.output`" + ` (output of a completed step; see "Step Results" for the other fields), ` + "`.stdin`" + ` (the step's input).
+- Functions: ` + "`env \"NAME\"`" + `, ` + "`var \"item.name\"`" + ` (variables with dots), ` + "`default \"fallback\"`" + `, ` + "`json`" + `, ` + "`truncate N`" + `, ` + "`upper`" + `, ` + "`lower`" + `, ` + "`trim`" + `.
+- In database ` + "`sql`" + `, values are never pasted into the statement: every ` + "`{{ }}`" + ` that prints must end with ` + "`param`" + `, which binds the value to a placeholder, e.g. ` + "`sql: \"SELECT * FROM orders WHERE customer = {{ .vars.customer | param }}\"`" + ` runs with ` + "`$1`" + ` bound to the variable. Legacy ` + "`$variable`" + ` and ` + "`${steps...}`" + ` references are not substituted in SQL.
+- Missing variables and steps render as empty strings; use ` + "`default`" + ` to provide a fallback.
+- Write literal braces as ` + "`{{ \"{{\" }}`" + `.
+- The legacy ` + "`$variable`" + ` syntax still works. Add ` + "`template_syntax: go`" + ` at the top level of the workflow to turn it off, so that ` + "`$`" + ` is always literal and invalid templates are reported as errors. With the default ` + "`template_syntax: compat`" + `, text that is not a valid template is sent unchanged.
+
+## Step Results (` + "`steps.<name>`" + `)
+Every completed step's result is kept by name, so a step can use any earlier step's output, not just the previous one.
+
+` + "```yaml" + `
+extract_entities:
+  input: article.txt
+  model: gpt-4o-mini
+  action: "List the people and places mentioned."
+  output: STDOUT
+
+summarize:
+  input: article.txt
+  model: gpt-4o-mini
+  action: "Summarize the article."
+  output: STDOUT
+
+report:
+  input: steps.extract_entities
+  model: gpt-4o
+  action: "Write a report on these entities. Use this summary for context: ${steps.summarize.output}"
+  output: report.md
+` + "```" + `
+
+- As an input: ` + "`input: steps.step_name`" + ` (or ` + "`steps.step_name.output`" + `) passes the step's output like a file. ` + "`steps.step_name as $var`" + ` also stores it in a variable.
+- In actions, ` + "`instructions`" + ` and output paths: ` + "`${steps.step_name.field}`" + `. In SQL, bind the field with ` + "`{{ .steps.step_name.output | param }}`" + `.
+- Fields: ` + "`output`" + `, ` + "`model`" + ` (the model that answered), ` + "`started_at`" + `, ` + "`duration_ms`" + `, ` + "`response_id`" + ` (` + "`openai-responses`" + ` steps), ` + "`skipped`" + ` (` + "`true`" + ` if the step's ` + "`when`" + ` condition was false).
+- Referencing a step adds an implicit dependency on it, as if it were listed in ` + "`depends_on`" + `.
+- Referencing an unknown step, an unknown field, or a step that has not completed is an error. Steps in the same parallel group cannot reference each other.
+
+## Parallel Groups and Dependencies
+- Any top-level key starting with ` + "`parallel-`" + ` (e.g. ` + "`parallel-process`" + `, ` + "`parallel-research`" + `) whose value maps step names to step definitions is a group of steps that run at the same time. A ` + "`parallel-`" + ` key holding a step definition is an ordinary step. A workflow can have several groups.
+- Steps in the same group must not depend on each other.
+- Without ` + "`depends_on`" + `, a step or group waits for the entry just before it in the file. A step also waits for any earlier step that writes a file it reads.
+- With ` + "`depends_on`" + `, a step waits only for the listed steps or groups (plus file dependencies). Independent steps run concurrently. ` + "`depends_on: []`" + ` means no dependencies.
+- ` + "`STDIN`" + ` for a step is the output of its dependency that appears last in the file.
+
+` + "```yaml" + `
+parallel-research:
+  history:
+    input: NA
+    model: gpt-4o-mini
+    action: "Write a short history of the bicycle."
+    output: history.txt
+  design:
+    input: NA
+    model: gpt-4o-mini
+    action: "Describe bicycle frame design."
+    output: design.txt
+
+summary:
+  depends_on: [parallel-research]
+  input: [history.txt, design.txt]
+  model: gpt-4o
+  action: "Combine these into one article."
+  output: STDOUT
+` + "```" + `
+
+## Conditional Steps (` + "`when`" + `)
+A step with a ` + "`when`" + ` field only runs if the condition evaluates to true. Skipped steps do not change ` + "`STDIN`" + ` for the next step.
+
+` + "```yaml" + `
+classify:
+  input: STDIN
+  model: gpt-4o-mini
+  action: "Classify this issue as bug, feature or question. Reply with one word."
+  output: STDOUT as $classification
+
+handle_bug:
+  input: STDIN
+  model: gpt-4o-mini
+  when: "$classification == 'bug'"
+  action: "Write a bug report for this issue."
+  output: STDOUT
+` + "```" + `
+
+- Operands: variables (` + "`$name`" + `), ` + "`$lastOutput`" + ` (the previous step's output), quoted strings, numbers, ` + "`true`" + `, ` + "`false`" + `.
+- Comparison: ` + "`==`" + `, ` + "`!=`" + `, ` + "`<`" + `, ` + "`<=`" + `, ` + "`>`" + `, ` + "`>=`" + `, ` + "`contains`" + `, ` + "`not contains`" + `, ` + "`startswith`" + `, ` + "`endswith`" + `, ` + "`matches`" + ` (regular expression).
+- Logic: ` + "`&&`" + ` / ` + "`and`" + `, ` + "`||`" + ` / ` + "`or`" + `, ` + "`!`" + ` / ` + "`not`" + `, parentheses.
+- Surrounding whitespace is ignored when comparing values. Values that look like numbers are compared numerically.
+- A bare operand is true unless it is empty, ` + "`false`" + `, ` + "`0`" + ` or ` + "`no`" + `.
+
+## Looping Over Items (` + "`for_each`" + `)
+A step with ` + "`for_each`" + ` runs once per item. Each run sees the item as ` + "`$item`" + ` and its zero-based position as ` + "`$index`" + `.
+
+` + "```yaml" + `
+summarize_customers:
+  for_each:
+    items: STDIN        # list, STDIN, $variable, or a file path
+    as: customer        # optional, default: item
+    concurrency: 4      # optional, default: 1
+    separator: "\n\n"   # optional, used when results are combined
+  input: NA
+  model: gpt-4o-mini
+  action: "Write a one paragraph summary of customer $customer.name: $customer"
+  output: summaries/customer-$index.txt
+` + "```" + `
+
+- ` + "`items`" + ` can be an inline list, ` + "`STDIN`" + ` (previous step output), a ` + "`$variable`" + `, or a file path.
+- Text items are parsed as a JSON array if they start with ` + "`[`" + ` (a surrounding markdown code fence is ignored). Otherwise each non-empty line is one item. Database ` + "`SELECT`" + ` results are JSON arrays, so each row becomes one item.
+- For object items, ` + "`$item`" + ` is the JSON object and ` + "`$item.field`" + ` is the value of each top-level field.
+- If the ` + "`output`" + ` refers to ` + "`$index`" + ` or the item variable (` + "`$item`" + `, ` + "`{{ .vars.item }}`" + ` or ` + "`{{ var \"item.name\" }}`" + `), each item writes its own output. Database outputs are also written per item. Otherwise all results are joined with ` + "`separator`" + ` and written once.
+- The combined result becomes ` + "`STDIN`" + ` for the next step.
+- With ` + "`skip_errors: true`" + `, failed items are left out instead of failing the step.
+
+## Iterative Refinement (` + "`next-action`" + `)
+` + "`next-action`" + ` sends follow-up prompts to the step's model after the ` + "`action`" + `. Each prompt receives the latest output as its input, and the final result becomes the step's output.
+
+` + "```yaml" + `
+write_summary:
+  input: report.txt
+  model: gpt-4o
+  action: "Summarize this report in 5 bullet points."
+  next-action:
+    action:
+      - "Critique this summary. If it is accurate and complete, reply with APPROVED only."
+      - "The text above critiques this summary: $draft\n\nIf it is APPROVED, reply with APPROVED followed by the summary unchanged. Otherwise rewrite the summary to address the critique."
+    until: "$lastOutput startswith 'APPROVED'"
+    max_iterations: 4
+  output: summary.txt
+` + "```" + `
+
+- The short forms ` + "`next-action: \"prompt\"`" + ` and ` + "`next-action: [prompt, prompt]`" + ` run the prompts once.
+- In the map form, every ` + "`action`" + ` prompt runs in order on each iteration. The loop stops once ` + "`until`" + ` is true or after ` + "`max_iterations`" + ` iterations.
+- ` + "`max_iterations`" + ` defaults to 3 when ` + "`until`" + ` is set, and 1 otherwise.
+- ` + "`until`" + ` uses the same syntax as ` + "`when`" + `. Inside it, ` + "`$lastOutput`" + ` is the latest refined output.
+- ` + "`$iteration`" + ` holds the current iteration number (starting at 1) in the prompts.
+- ` + "`$draft`" + ` (or ` + "`{{ .vars.draft }}`" + `) holds the output the current iteration started from. Each prompt's input is the previous prompt's output, so a revise prompt that follows a critique prompt should include ` + "`$draft`" + ` to see the text it revises.
+- ` + "`next-action`" + ` cannot be used with ` + "`model: NA`" + `.
+
+## Retrying Failed Model Calls (` + "`retry`" + `)
+By default a failed model call fails the step and the workflow. A ` + "`retry`" + ` block retries transient failures with exponential backoff.
+
+` + "```yaml" + `
+analyze:
+  input: report.txt
+  model: claude-3-5-sonnet-latest
+  action: "Summarize the key findings."
+  output: STDOUT
+  retry:
+    max_attempts: 4        # total attempts, default: 3
+    initial_delay: 2s      # default: 1s
+    max_delay: 1m          # default: 30s
+    multiplier: 2          # default: 2
+    jitter: true           # default: true
+    retry_on: [rate_limit, overloaded]   # optional
+` + "```" + `
+
+- Provider errors are classified as ` + "`rate_limit`" + ` (HTTP 429), ` + "`overloaded`" + ` (HTTP 5xx and 529), ` + "`timeout`" + `, ` + "`network`" + `, ` + "`auth`" + ` (HTTP 401/403), ` + "`invalid_request`" + ` (other HTTP 4xx) or ` + "`unknown`" + `.
+- Without ` + "`retry_on`" + `, ` + "`rate_limit`" + `, ` + "`overloaded`" + `, ` + "`timeout`" + ` and ` + "`network`" + ` errors are retried. ` + "`auth`" + ` and ` + "`invalid_request`" + ` errors fail immediately.
+- The delay doubles (by ` + "`multiplier`" + `) after each attempt, up to ` + "`max_delay`" + `. With ` + "`jitter`" + `, each delay is randomized between half and all of its value. A longer ` + "`Retry-After`" + ` from the provider is respected.
+- Durations use Go syntax, such as ` + "`500ms`" + `, ` + "`2s`" + ` or ` + "`1m`" + `.
+
+## Multiple Models (` + "`model_strategy`" + `)
+` + "`model`" + ` can be a list. ` + "`model_strategy`" + ` decides how the list is used:
+
+- ` + "`fallback`" + ` (default): Try the models in order. The next model is only used if the previous one fails (including timeouts). The step fails if every model fails.
+- ` + "`race`" + `: Send the prompt to all models at once and use the first successful response. Requests to the other models are cancelled.
+- ` + "`all`" + `: Send the prompt to all models and combine every result, in list order, under a ` + "`## model-name`" + ` heading. Any failure fails the step, unless ` + "`skip_errors: true`" + `, in which case the error is shown in place of that model's result. ` + "`next-action`" + ` cannot be used with ` + "`all`" + `.
+
+` + "```yaml" + `
+compare_models:
+  input: examples/test.csv
+  model: [gpt-4o-mini, claude-3-5-sonnet-latest]
+  model_strategy: all
+  action: "Analyze this CSV file and list the key points."
+  output: STDOUT
+
+judge:
+  input: STDIN
+  model: gpt-4o
+  action: "Compare these analyses and grade each one (A-F)."
+  output: comparison.txt
+` + "```" + `
+
+With ` + "`retry`" + `, each model's calls are retried before falling back to the next model.
+
+## Timeouts and Cancellation (` + "`timeout`" + `)
+A step's ` + "`timeout`" + ` limits how long the step may run, including retries, ` + "`next-action`" + ` iterations and every ` + "`for_each`" + ` item. A top-level ` + "`timeout`" + ` key with a duration value limits the whole workflow.
+
+` + "```yaml" + `
+timeout: 10m   # whole workflow
+
+summarize:
+  input: report.txt
+  model: gpt-4o
+  action: "Summarize the key findings."
+  output: STDOUT
+  timeout: 90s   # this step only
+` + "```" + `
+
+- When a timeout expires, in-flight model requests, database queries and web scraping are cancelled and the step fails with "timed out after ...".
+- A step timeout counts as a ` + "`timeout`" + ` error, so a ` + "`fallback`" + ` model list does not move on to the next model after it.
+- Durations use Go syntax, such as ` + "`500ms`" + `, ` + "`30s`" + ` or ` + "`5m`" + `.
+- Pressing Ctrl+C cancels a running workflow. In server mode, a workflow is cancelled when the client disconnects.
+
+## Caching Model Responses (` + "`cache`" + `)
+With ` + "`cache`" + `, a step reuses the saved response when an identical request was made before, instead of calling the model again. This is useful while iterating on later steps of a workflow.
+
+` + "```yaml" + `
+extract:
+  input: contracts/*.pdf
+  model: gpt-4o
+  action: "List the parties and dates in this contract."
+  output: STDOUT
+  cache: 24h   # reuse responses up to a day old
+` + "```" + `
+
+- ` + "`cache: true`" + ` reuses responses of any age, ` + "`cache: 24h`" + ` only responses newer than the duration, and ` + "`cache: false`" + ` always calls the model.
+- Requests match when the provider, model, prompt, attached file contents and sampling parameters are the same.
+- Only successful responses are cached. Steps of ` + "`type: openai-responses`" + ` are not cached.
+- ` + "`comanda process --cache`" + ` caches every step that does not set ` + "`cache`" + `, and ` + "`--no-cache`" + ` disables the cache for the run.
+
+## Workflow Parameters (` + "`params`" + `)
+A top-level ` + "`params`" + ` section declares typed parameters. Their values are stored as variables, so steps use them as ` + "`$name`" + ` or ` + "`{{ .vars.name }}`" + `.
+
+` + "```yaml" + `
+params:
+  region:
+    type: string
+    required: true
+    description: Sales region to report on
+  max_items:
+    type: int
+    default: 10
+  tone: neutral   # shorthand for a string parameter with a default
+
+report:
+  input: NA
+  model: gpt-4o
+  action: "List the top $max_items deals in $region, in a $tone tone."
+  output: STDOUT
+` + "```" + `
+
+- Attributes: ` + "`type`" + ` (` + "`string`" + ` (default), ` + "`int`" + `, ` + "`number`" + ` or ` + "`bool`" + `), ` + "`default`" + `, ` + "`required`" + `, ` + "`description`" + `.
+- Values come from ` + "`comanda process file.yaml --set key=value`" + ` (repeatable), ` + "`--params-file values.yaml`" + `, a ` + "`params`" + ` JSON object sent to the server, or the ` + "`inputs`" + ` map of a ` + "`process`" + ` step that runs the workflow.
+- Missing required parameters, values of the wrong type and undeclared parameters are errors reported before any step runs. Parameters without a value or default are empty.
+- ` + "`params`" + ` is reserved at the top level and cannot be used as a step name.
+
+## Structured Output (` + "`output_schema`" + `)
+` + "`output_schema`" + ` makes a step return JSON that matches a JSON Schema, given inline or as the path of a JSON or YAML schema file.
+
+` + "```yaml" + `
+extract_contacts:
+  input: emails.txt
+  model: gpt-4o
+  action: "Extract every contact mentioned in these emails."
+  output_schema:
+    type: object
+    required: [contacts]
+    properties:
+      contacts:
+        type: array
+        items:
+          type: object
+          required: [name, email]
+          properties:
+            name: {type: string}
+            email: {type: string}
+  schema_retries: 3   # optional, default 2
+  output: contacts.json
+` + "```" + `
+
+- The schema is appended to the action, and providers are asked for JSON natively where supported (OpenAI ` + "`response_format`" + `, Gemini JSON response type, Ollama ` + "`format`" + `).
+- Code fences around the response are removed. A response that is not valid JSON or does not match the schema is sent back to the same model with the validation errors, up to ` + "`schema_retries`" + ` times; the step fails after that.
+- The step's output is the JSON text without fences, ready to be written to a ` + "`.json`" + ` file or read by later steps.
+- Supported keywords: ` + "`type`" + `, ` + "`enum`" + `, ` + "`const`" + `, ` + "`properties`" + `, ` + "`required`" + `, ` + "`additionalProperties`" + `, ` + "`items`" + `, ` + "`minItems`" + `, ` + "`maxItems`" + `, ` + "`minLength`" + `, ` + "`maxLength`" + `, ` + "`pattern`" + `, ` + "`minimum`" + `, ` + "`maximum`" + `, ` + "`exclusiveMinimum`" + `, ` + "`exclusiveMaximum`" + `, ` + "`anyOf`" + `, ` + "`oneOf`" + `, ` + "`allOf`" + `.
+- Cannot be combined with ` + "`model_strategy: all`" + `.
+
+## Chunking Large Inputs (` + "`chunking`" + `, ` + "`reduce_action`" + `)
+` + "`chunking`" + ` splits a step's text input into chunks that each fit the model, runs the action on every chunk in turn, and optionally combines the results with ` + "`reduce_action`" + `.
+
+` + "```yaml" + `
+summarize_report:
+  input: annual_report.md
+  model: gpt-4o-mini
+  action: "Summarize this section of the annual report."
+  chunking:
+    size: 4000          # required, maximum chunk size
+    unit: tokens        # tokens (default, estimated for the first model) or chars
+    overlap: 200        # optional, repeated from the end of the previous chunk
+    boundary: heading   # paragraph (default), line or heading
+  reduce_action: "Combine these section summaries into one executive summary."
+  reduce_model: gpt-4o  # optional, defaults to the step's model
+  output: summary.md
+` + "```" + `
+
+- Chunks end at the chosen boundary where possible; text without one is split at paragraphs, then lines, then cut.
+- Without ` + "`reduce_action`" + `, the step output is the per-chunk results joined in order. With it, the results are labelled ` + "`Chunk N of M:`" + ` and sent with the ` + "`reduce_action`" + ` as one input.
+- Progress events report ` + "`Processing chunk N of M for step <name>`" + `.
+- Inputs must be text (not images or scraped pages). ` + "`output_schema`" + ` on a chunked step applies to the ` + "`reduce_action`" + ` and requires one.
+
+## Context Window Check (` + "`context_check`" + `)
+Before a step sends anything, comanda estimates the size of its prompt (action plus text inputs) for each model and compares it with the model's context window.
+
+` + "```yaml" + `
+analyze_logs:
+  input: server.log
+  model: [gpt-4, gpt-4o]
+  action: "Find the root cause of the outage."
+  context_check: error   # warn (default), error or off
+  output: STDOUT
+` + "```" + `
+
+- ` + "`warn`" + ` prints a warning naming the model and estimate and sends the prompt anyway. ` + "`error`" + ` fails the step without sending anything when the prompt fits none of the step's models. ` + "`off`" + ` skips the check.
+- Estimates use each provider's average characters per token; they are approximate and err on the high side for non-English text. Images and other non-text inputs are not counted.
+- Models without a known context window (e.g. most Ollama models) are not checked. Chunked steps are checked per chunk, and their ` + "`reduce_action`" + ` input is checked too.
+
+## Run Budget (` + "`max_cost`" + `)
+A top-level scalar ` + "`max_cost`" + ` sets the budget of a run in US dollars. It is not a step.
+
+` + "```yaml" + `
+max_cost: 0.50
+
+summarize:
+  input: report.md
+  model: gpt-4o
+  action: "Summarize the report."
+  output: STDOUT
+` + "```" + `
+
+- Token usage of every model call is tracked per step and per run. Costs come from the ` + "`pricing`" + ` table of the environment file (USD per million tokens for ` + "`input`" + `, ` + "`output`" + ` and optional ` + "`cached_input`" + `, keyed by model name or a ` + "`prefix*`" + `).
+- Before each call, the amount spent plus the estimated prompt cost is compared with ` + "`max_cost`" + `, and the run fails with "max_cost budget exceeded" instead of calling the model. Output tokens are not known in advance, so a run can end slightly over budget.
+- Models without a price cost $0 and never trigger the budget. Sub-workflow usage counts towards the parent's budget. ` + "`--max-cost`" + ` on the command line overrides ` + "`max_cost`" + `.
+
+## Model Parameters (` + "`temperature`" + `, ` + "`max_tokens`" + `, ` + "`top_p`" + `, ` + "`stop`" + `, ` + "`seed`" + `, ` + "`system`" + `)
+Any step that calls a model can set these parameters:
+
+` + "```yaml" + `
+classify:
+  input: ticket.txt
+  model: claude-3-5-sonnet-latest
+  system: "You are a support triage assistant. Answer with one word."
+  action: "Classify this ticket as bug, question or feature."
+  temperature: 0
+  max_tokens: 10
+  stop: ["\n"]
+  output: STDOUT
+` + "```" + `
+
+- ` + "`temperature`" + ` (0 to 2), ` + "`top_p`" + ` (above 0, up to 1), ` + "`max_tokens`" + ` (above 0), ` + "`stop`" + ` (string or list), ` + "`seed`" + ` (int) and ` + "`system`" + ` (string).
+- Unset parameters fall back to the model's ` + "`defaults`" + ` in the env file, then to the provider's defaults.
+- Providers ignore what they do not support: Anthropic and Google have no ` + "`seed`" + `. OpenAI reasoning models (o1, o3, o4) ignore ` + "`temperature`" + `, ` + "`top_p`" + ` and ` + "`stop`" + `. ` + "`deepseek-reasoner`" + ` ignores ` + "`temperature`" + `, ` + "`top_p`" + ` and ` + "`max_tokens`" + `.
+- The parameters are part of the response cache key.
+
+## Conversations (` + "`conversation`" + `)
+Standard steps with the same ` + "`conversation`" + ` ID share a message history. Each step sends the earlier system, user and assistant turns followed by its own prompt, then adds its prompt and the response to the history:
+
+` + "```yaml" + `
+draft:
+  input: brief.txt
+  model: gpt-4o
+  conversation: copywriting
+  system: "You write product copy."
+  action: "Write a tagline for this product."
+  output: STDOUT
+
+shorten:
+  input: NA
+  model: gpt-4o
+  conversation: copywriting
+  action: "Make it shorter."
+  output: STDOUT
+` + "```" + `
+
+- Works with every provider. For ` + "`type: openai-responses`" + ` steps, use ` + "`previous_response_id`" + ` instead.
+- The ` + "`system`" + ` prompt of the first step in the conversation is kept as its first message.
+- A step runs after the previous step of its conversation. Steps of one parallel group cannot share a conversation.
+- Inputs are sent as text; image and PDF inputs, ` + "`for_each`" + `, ` + "`chunking`" + ` and ` + "`model_strategy: race`" + ` or ` + "`all`" + ` are not allowed.
+- The history is kept in memory for the run only. ` + "`--resume`" + ` restores the turns of the steps it skips from their checkpoints.
+
+## Tools (` + "`tools`" + `, ` + "`max_tool_calls`" + `)
+A standard step can let its model call built-in tools. comanda runs the calls and returns their results to the model until it answers:
+
+` + "```yaml" + `
+investigate:
+  input: NA
+  model: gpt-4o
+  action: "Find out why the nightly build failed."
+  tools:
+    - type: shell            # runs a command from allow, without a shell
+      allow: [ls, git]
+    - type: read_file        # reads files under the runtime directory
+    - type: database         # read-only SELECT queries
+      database: builds       # database name from the env file
+    - type: http             # calls URLs under the allowed prefixes
+      name: status_api
+      allow: ["https://status.example.com/api/"]
+  max_tool_calls: 20         # default 10
+  output: STDOUT
+` + "```" + `
+
+- Tool fields: ` + "`type`" + ` (required), ` + "`name`" + ` (defaults to the type; letters, digits, ` + "`_`" + ` and ` + "`-`" + `), ` + "`description`" + `, ` + "`allow`" + `, ` + "`database`" + `, ` + "`timeout`" + ` (default 30s).
+- ` + "`shell`" + ` and ` + "`http`" + ` tools require ` + "`allow`" + `; ` + "`database`" + ` tools require ` + "`database`" + `.
+- ` + "`shell`" + ` tool arguments are not restricted: the model picks them, so ` + "`allow: [cat]`" + ` can read any file, including files outside the directory ` + "`read_file`" + ` is confined to. Only allow commands that are safe with any arguments.
+- Workflows run by the server cannot use ` + "`shell`" + ` or ` + "`database`" + ` tools unless the env file's ` + "`server`" + ` section sets ` + "`allowLocalTools: true`" + `.
+- Supported by OpenAI, Anthropic, Google, Ollama, X.AI and DeepSeek models. Inputs must be text.
+- On ` + "`type: openai-responses`" + ` steps, ` + "`tools`" + ` keeps its Responses API meaning and is passed through unchanged.
+
+## Streaming Responses (` + "`stream`" + `)
+With ` + "`stream: true`" + `, a step writes its response as the model generates it, instead of waiting for the whole answer:
+
+` + "```yaml" + `
+draft_report:
+  input: notes.txt
+  model: claude-3-5-sonnet-latest
+  action: "Write a detailed report from these notes."
+  stream: true
+  output: report.md
+` + "```" + `
+
+- The response appears on STDOUT as it arrives, or as ` + "`output`" + ` events when the workflow runs on the server. The step's outputs are written as usual once it completes; an STDOUT output is not written twice.
+- Supported by OpenAI, Anthropic, Google, Ollama, X.AI, DeepSeek and OpenAI-compatible models. Other models write the response in one piece.
+- Only text prompts are streamed. Image and PDF inputs, conversations and tool calls are answered whole.
+- A retry, or a fallback to the next model, only happens if the call fails before any of the response was written.
+- ` + "`stream`" + ` cannot be combined with ` + "`model_strategy: race`" + ` or ` + "`all`" + `, or with ` + "`for_each`" + ` concurrency above 1.
+
+## Embeddings (` + "`type: embed`" + `)
+A step with ` + "`type: embed`" + ` computes vector embeddings of its inputs instead of prompting a model:
+
+` + "```yaml" + `
+embed_docs:
+  type: embed
+  input: faq.txt
+  model: text-embedding-3-small
+  output: faq-embeddings.json
+
+find_related:
+  type: embed
+  input: STDIN
+  model: text-embedding-3-small
+  action: similarity
+  embed:
+    query: "How do I reset my password?"
+    top_k: 3
+  output: STDOUT
+` + "```" + `
+
+- Texts: each non-empty line of each input, or each element of a JSON array. ` + "`embed.split: none`" + ` embeds each input whole.
+- ` + "`action`" + ` is ` + "`embed`" + ` (default) or ` + "`similarity`" + `. ` + "`embed`" + ` writes ` + "`[{\"text\", \"embedding\"}]`" + ` as JSON. ` + "`similarity`" + ` requires ` + "`embed.query`" + ` and writes ` + "`[{\"index\", \"text\", \"score\"}]`" + `, most similar first, keeping ` + "`embed.top_k`" + ` matches if set.
+- Database output: ` + "`output: { database: mydb, sql: \"INSERT INTO docs (content, embedding) VALUES ($1, $2)\" }`" + ` runs once per text, in one transaction, with the text as ` + "`$1`" + ` and the embedding (pgvector format) or score as ` + "`$2`" + `. Values bound with ` + "`param`" + ` in the SQL take ` + "`$3`" + ` onwards.
+- ` + "`model`" + ` must be a single embedding model: OpenAI ` + "`text-embedding-3-*`" + `, Google ` + "`text-embedding-004`" + ` or ` + "`gemini-embedding-001`" + `, an Ollama embedding model such as ` + "`nomic-embed-text`" + `, or an OpenAI-compatible endpoint's model.
+- Cannot be combined with ` + "`stream`" + `, ` + "`cache`" + `, ` + "`chunking`" + `, ` + "`next-action`" + `, ` + "`output_schema`" + `, ` + "`conversation`" + ` or ` + "`tools`" + `.
 
 ## Validation Rules Summary (for LLM)
 
@@ -142,6 +660,7 @@ step_name_for_processing:
 2.  **Standard Step:**
     *   Must contain ` + "`input`" + `, ` + "`model`" + `, ` + "`action`" + `, ` + "`output`" + ` (unless ` + "`type: openai-responses`" + `, where ` + "`action`" + ` might be replaced by ` + "`instructions`" + `).
     *   ` + "`input`" + ` can be ` + "`NA`" + `. ` + "`model`" + ` can be ` + "`NA`" + `.
+    *   A ` + "`type: embed`" + ` step needs ` + "`input`" + `, a single embedding ` + "`model`" + ` and ` + "`output`" + `; ` + "`action`" + ` is optional (` + "`embed`" + ` or ` + "`similarity`" + `).
 3.  **Generate Step:**
     *   Must contain a ` + "`generate`" + ` block.
     *   ` + "`generate`" + ` block must contain ` + "`action`" + ` (string prompt) and ` + "`output`" + ` (string filename).
@@ -0,0 +1,443 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ForEachConfig represents the configuration for iterating a step over a list of items
+type ForEachConfig struct {
+	Items       interface{} `yaml:"items"`       // List of items, STDIN, $variable or a file path (JSON array or lines)
+	As          string      `yaml:"as"`          // Variable name bound to each item (default "item")
+	Concurrency int         `yaml:"concurrency"` // Maximum number of items processed at once (default 1)
+	Separator   string      `yaml:"separator"`   // Separator used when combining results into one output
+}
+
+// UnmarshalYAML allows the shorthand forms `for_each: STDIN` and `for_each: [a, b, c]`
+func (f *ForEachConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode || value.Kind == yaml.SequenceNode {
+		var items interface{}
+		if err := value.Decode(&items); err != nil {
+			return err
+		}
+		f.Items = items
+		return nil
+	}
+
+	type rawForEachConfig ForEachConfig
+	var raw rawForEachConfig
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	*f = ForEachConfig(raw)
+	return nil
+}
+
+// defaultForEachSeparator separates item results when they are combined into one output
+const defaultForEachSeparator = "\n\n"
+
+// forEachItem is a single resolved item of a for_each loop
+type forEachItem struct {
+	value  string            // String form of the item, bound to $item
+	fields map[string]string // Scalar fields of object items, bound to $item.field
+}
+
+// validateForEachConfig checks a for_each configuration for errors
+func validateForEachConfig(config *ForEachConfig) []string {
+	var errors []string
+	if config.Items == nil {
+		errors = append(errors, "'items' is required within the 'for_each' configuration")
+	}
+	if config.Concurrency < 0 {
+		errors = append(errors, "'concurrency' in 'for_each' must not be negative")
+	}
+	if config.As != "" && strings.ContainsAny(config.As, "$ .") {
+		errors = append(errors, "'as' in 'for_each' must be a plain variable name without '$', spaces or dots")
+	}
+	return errors
+}
+
+// resolveForEachItems resolves the items of a for_each loop into a list
+func (p *Processor) resolveForEachItems(config *ForEachConfig) ([]forEachItem, error) {
+	switch v := config.Items.(type) {
+	case []interface{}:
+		items := make([]forEachItem, 0, len(v))
+		for _, raw := range v {
+			item, err := newForEachItem(raw)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case []string:
+		items := make([]forEachItem, 0, len(v))
+		for _, raw := range v {
+			items = append(items, forEachItem{value: raw})
+		}
+		return items, nil
+	case string:
+		source := strings.TrimSpace(v)
+		var content string
+		switch {
+		case source == "STDIN":
+			content = p.lastOutput
+		case strings.HasPrefix(source, "$"):
+			val, ok := p.variables[strings.TrimPrefix(source, "$")]
+			if !ok {
+				return nil, fmt.Errorf("for_each variable %s is not defined", source)
+			}
+			content = val
+		default:
+			path := p.resolveDataPath(source)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read for_each items from %s: %w", path, err)
+			}
+			content = string(data)
+		}
+		return parseForEachContent(content)
+	case nil:
+		return nil, fmt.Errorf("for_each items are not defined")
+	default:
+		return nil, fmt.Errorf("unsupported for_each items type %T", v)
+	}
+}
+
+// parseForEachContent splits text into items: a JSON array yields its elements,
+// anything else yields its non-empty lines
+func parseForEachContent(content string) ([]forEachItem, error) {
+	trimmed := stripCodeFences(content)
+	if strings.HasPrefix(trimmed, "[") {
+		var elements []interface{}
+		if err := json.Unmarshal([]byte(trimmed), &elements); err != nil {
+			return nil, fmt.Errorf("failed to parse for_each items as a JSON array: %w", err)
+		}
+		items := make([]forEachItem, 0, len(elements))
+		for _, raw := range elements {
+			item, err := newForEachItem(raw)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+
+	var items []forEachItem
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			items = append(items, forEachItem{value: line})
+		}
+	}
+	return items, nil
+}
+
+// newForEachItem converts a decoded YAML or JSON value into an item
+func newForEachItem(raw interface{}) (forEachItem, error) {
+	switch v := raw.(type) {
+	case string:
+		return forEachItem{value: v}, nil
+	case map[string]interface{}:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return forEachItem{}, fmt.Errorf("failed to encode for_each item: %w", err)
+		}
+		fields := make(map[string]string)
+		for key, val := range v {
+			switch fv := val.(type) {
+			case map[string]interface{}, []interface{}:
+				if b, err := json.Marshal(fv); err == nil {
+					fields[key] = string(b)
+				}
+			case nil:
+				fields[key] = ""
+			default:
+				fields[key] = scalarToString(fv)
+			}
+		}
+		return forEachItem{value: string(encoded), fields: fields}, nil
+	case []interface{}:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return forEachItem{}, fmt.Errorf("failed to encode for_each item: %w", err)
+		}
+		return forEachItem{value: string(encoded)}, nil
+	case nil:
+		return forEachItem{}, nil
+	default:
+		return forEachItem{value: scalarToString(v)}, nil
+	}
+}
+
+// scalarToString formats a scalar value without exponent notation for whole numbers
+func scalarToString(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// resolveDataPath resolves a relative path the same way output files are resolved
+func (p *Processor) resolveDataPath(path string) string {
+	if filepath.IsAbs(path) || p.serverConfig == nil {
+		return path
+	}
+	if p.runtimeDir != "" {
+		return filepath.Join(p.serverConfig.DataDir, p.runtimeDir, path)
+	}
+	return filepath.Join(p.serverConfig.DataDir, path)
+}
+
+// isTemplatedOutput reports whether an output path refers to the loop variables, either as
+// $item and $index or inside a template such as {{ .vars.item }}
+func (p *Processor) isTemplatedOutput(output, itemVar string) bool {
+	if strings.Contains(output, "$index") || strings.Contains(output, "$"+itemVar) {
+		return true
+	}
+	if !strings.Contains(output, "{{") {
+		return false
+	}
+	tmpl, err := template.New("").Funcs(p.templateFuncs()).Parse(output)
+	if err != nil {
+		return false
+	}
+	return refersToVars(tmpl.Tree.Root, func(name string) bool {
+		return name == itemVar || name == "index" || strings.HasPrefix(name, itemVar+".")
+	})
+}
+
+// refersToVars reports whether a template reads a variable accepted by match, through
+// .vars.name, var "name" or index .vars "name"
+func refersToVars(node parse.Node, match func(string) bool) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Nodes {
+			if refersToVars(child, match) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return refersToVars(n.Pipe, match)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			if refersToVars(cmd, match) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		lookup := false
+		if ident, ok := n.Args[0].(*parse.IdentifierNode); ok {
+			lookup = ident.Ident == "var" || ident.Ident == "index"
+		}
+		for _, arg := range n.Args {
+			if s, ok := arg.(*parse.StringNode); ok && lookup && match(s.Text) {
+				return true
+			}
+			if refersToVars(arg, match) {
+				return true
+			}
+		}
+	case *parse.FieldNode:
+		return len(n.Ident) > 1 && n.Ident[0] == "vars" && match(n.Ident[1])
+	case *parse.IfNode:
+		return refersToVarsInBranch(&n.BranchNode, match)
+	case *parse.RangeNode:
+		return refersToVarsInBranch(&n.BranchNode, match)
+	case *parse.WithNode:
+		return refersToVarsInBranch(&n.BranchNode, match)
+	}
+	return false
+}
+
+// refersToVarsInBranch checks the pipeline and both branches of an if, range or with action
+func refersToVarsInBranch(n *parse.BranchNode, match func(string) bool) bool {
+	return refersToVars(n.Pipe, match) || refersToVars(n.List, match) || refersToVars(n.ElseList, match)
+}
+
+// processForEachStep runs a step once per item and collects the results
+func (p *Processor) processForEachStep(step Step, isParallel bool, parallelID string) (string, error) {
+	startTime := time.Now()
+	forEach := step.Config.ForEach
+	itemVar := forEach.As
+	if itemVar == "" {
+		itemVar = "item"
+	}
+	concurrency := forEach.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	separator := forEach.Separator
+	if separator == "" {
+		separator = defaultForEachSeparator
+	}
+
+	items, err := p.resolveForEachItems(forEach)
+	if err != nil {
+		return "", fmt.Errorf("for_each error in step '%s': %w", step.Name, err)
+	}
+	p.debugf("Step '%s' iterating over %d item(s) with concurrency %d", step.Name, len(items), concurrency)
+
+	stepInfo := &StepInfo{
+		Name:   step.Name,
+		Model:  fmt.Sprintf("%v", step.Config.Model),
+		Action: fmt.Sprintf("%v", step.Config.Action),
+	}
+	startMsg := fmt.Sprintf("Processing step %s over %d item(s)", step.Name, len(items))
+	if isParallel {
+		p.emitParallelProgress(startMsg, stepInfo, parallelID)
+	} else {
+		p.emitProgress(startMsg, stepInfo)
+	}
+
+	// Outputs that reference $index or the item variable are written once per item.
+	// Database outputs are also written per item. Everything else receives the combined result.
+	perItemOutput := false
+	if _, isMap := step.Config.Output.(map[string]interface{}); isMap {
+		perItemOutput = true
+	} else {
+		for _, output := range p.NormalizeStringSlice(step.Config.Output) {
+			if p.isTemplatedOutput(output, itemVar) {
+				perItemOutput = true
+				break
+			}
+		}
+	}
+
+	results := make([]string, len(items))
+	failed := make([]bool, len(items))
+	errs := make([]error, len(items))
+	written := make([][]string, len(items))
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		sem <- struct{}{}
+		// Stop starting new items once the step is cancelled or times out
+		if p.ctx.Err() != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(index int, item forEachItem) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			itemProcessor := p.fork()
+			itemProcessor.variables[itemVar] = item.value
+			itemProcessor.variables["index"] = strconv.Itoa(index)
+			for field, value := range item.fields {
+				itemProcessor.variables[itemVar+"."+field] = value
+			}
+
+			itemConfig := step.Config
+			itemConfig.ForEach = nil
+			var err error
+			if itemConfig.Input, err = itemProcessor.renderInSlice(step.Config.Input); err != nil {
+				errs[index] = fmt.Errorf("item %d: input: %w", index, err)
+				failed[index] = true
+				return
+			}
+			if perItemOutput {
+				if itemConfig.Output, err = itemProcessor.renderInSlice(step.Config.Output); err != nil {
+					errs[index] = fmt.Errorf("item %d: output: %w", index, err)
+					failed[index] = true
+					return
+				}
+			} else {
+				itemConfig.Output = nil
+			}
+
+			itemStep := Step{
+				Name:   fmt.Sprintf("%s[%d]", step.Name, index),
+				Config: itemConfig,
+			}
+			p.debugf("Processing item %d/%d of step '%s'", index+1, len(items), step.Name)
+
+			response, err := itemProcessor.processStep(itemStep, isParallel, parallelID)
+			written[index] = itemProcessor.written
+			if err != nil {
+				errs[index] = fmt.Errorf("item %d: %w", index, err)
+				failed[index] = true
+				return
+			}
+			results[index] = response
+		}(i, item)
+	}
+	wg.Wait()
+	for _, files := range written {
+		p.written = append(p.written, files...)
+	}
+
+	// Cancellation fails the step even with skip_errors, since items were left unprocessed
+	if err := p.ctx.Err(); err != nil {
+		return "", fmt.Errorf("for_each in step '%s' stopped: %w", step.Name, err)
+	}
+
+	var collected []string
+	for i := range items {
+		if failed[i] {
+			if !step.Config.SkipErrors {
+				return "", fmt.Errorf("for_each error in step '%s': %w", step.Name, errs[i])
+			}
+			p.debugf("Skipping failed item %d of step '%s': %v", i, step.Name, errs[i])
+			continue
+		}
+		collected = append(collected, results[i])
+	}
+	combined := strings.Join(collected, separator)
+
+	if !perItemOutput {
+		modelName := ""
+		if modelNames := p.NormalizeStringSlice(step.Config.Model); len(modelNames) > 0 {
+			modelName = p.envConfig.ResolveModel(modelNames[0])
+		}
+		if err := p.handleOutput(modelName, combined, p.NormalizeStringSlice(step.Config.Output), nil); err != nil {
+			return "", fmt.Errorf("output handling error: %w", err)
+		}
+	}
+
+	metrics := &PerformanceMetrics{TotalProcessingTime: time.Since(startTime).Milliseconds()}
+	doneMsg := fmt.Sprintf("Completed step: %s (%d/%d item(s) in %d ms)", step.Name, len(collected), len(items), metrics.TotalProcessingTime)
+	if isParallel {
+		p.emitParallelProgressWithMetrics(doneMsg, stepInfo, parallelID, metrics)
+	} else {
+		p.emitProgressWithMetrics(doneMsg, stepInfo, metrics)
+	}
+
+	return combined, nil
+}
+
+// sortedVariableNames returns variable names ordered longest first so that
+// $item.name is substituted before $item
+func sortedVariableNames(variables map[string]string) []string {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
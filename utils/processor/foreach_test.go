@@ -0,0 +1,196 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"gopkg.in/yaml.v3"
+)
+
+func TestForEachConfigUnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		expected ForEachConfig
+	}{
+		{
+			name:     "scalar shorthand",
+			yaml:     "for_each: STDIN",
+			expected: ForEachConfig{Items: "STDIN"},
+		},
+		{
+			name:     "list shorthand",
+			yaml:     "for_each: [a, b]",
+			expected: ForEachConfig{Items: []interface{}{"a", "b"}},
+		},
+		{
+			name:     "full form",
+			yaml:     "for_each:\n  items: rows.json\n  as: row\n  concurrency: 3\n",
+			expected: ForEachConfig{Items: "rows.json", As: "row", Concurrency: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var step StepConfig
+			if err := yaml.Unmarshal([]byte(tt.yaml), &step); err != nil {
+				t.Fatalf("yaml.Unmarshal returned unexpected error: %v", err)
+			}
+			if step.ForEach == nil {
+				t.Fatal("expected for_each to be set")
+			}
+			if !reflect.DeepEqual(*step.ForEach, tt.expected) {
+				t.Errorf("got %+v, want %+v", *step.ForEach, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolveForEachItems(t *testing.T) {
+	tempDir := t.TempDir()
+	linesFile := filepath.Join(tempDir, "lines.txt")
+	if err := os.WriteFile(linesFile, []byte("first\n\nsecond\n"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), nil, false, "")
+	processor.SetLastOutput("```json\n[{\"id\": 1, \"name\": \"alpha\"}, {\"id\": 2, \"name\": \"beta\"}]\n```")
+	processor.variables["colors"] = `["red", "green"]`
+
+	tests := []struct {
+		name     string
+		items    interface{}
+		expected []string
+	}{
+		{"inline list", []interface{}{"a", 2, true}, []string{"a", "2", "true"}},
+		{"JSON array from STDIN", "STDIN", []string{`{"id":1,"name":"alpha"}`, `{"id":2,"name":"beta"}`}},
+		{"JSON array from variable", "$colors", []string{"red", "green"}},
+		{"lines of a file", linesFile, []string{"first", "second"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := processor.resolveForEachItems(&ForEachConfig{Items: tt.items})
+			if err != nil {
+				t.Fatalf("resolveForEachItems returned unexpected error: %v", err)
+			}
+			var got []string
+			for _, item := range items {
+				got = append(got, item.value)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	items, err := processor.resolveForEachItems(&ForEachConfig{Items: "STDIN"})
+	if err != nil {
+		t.Fatalf("resolveForEachItems returned unexpected error: %v", err)
+	}
+	if items[1].fields["name"] != "beta" || items[1].fields["id"] != "2" {
+		t.Errorf("expected object fields to be bound, got %v", items[1].fields)
+	}
+
+	if _, err := processor.resolveForEachItems(&ForEachConfig{Items: "$undefined"}); err == nil {
+		t.Error("expected error for undefined variable, got nil")
+	}
+}
+
+func TestSubstituteVariablesLongestFirst(t *testing.T) {
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), nil, false, "")
+	processor.variables["item"] = `{"name":"alpha"}`
+	processor.variables["item.name"] = "alpha"
+
+	got := processor.substituteVariables("Name: $item.name, raw: $item")
+	expected := `Name: alpha, raw: {"name":"alpha"}`
+	if got != expected {
+		t.Errorf("substituteVariables() = %q, want %q", got, expected)
+	}
+}
+
+func TestIsTemplatedOutput(t *testing.T) {
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), nil, false, "")
+
+	tests := []struct {
+		output string
+		want   bool
+	}{
+		{"out/$item.md", true},
+		{"out/$index.md", true},
+		{"out/{{ .vars.item }}.md", true},
+		{"out/{{ .vars.index }}.md", true},
+		{`out/{{ var "item.name" }}.md`, true},
+		{`out/{{ index .vars "item" }}.md`, true},
+		{`out/{{ if .vars.item }}{{ .vars.item | lower }}{{ end }}.md`, true},
+		{"out/report.md", false},
+		{"reports/{{ .vars.item_count }}-summary.md", false},
+		{"out/{{ .vars.items }}/line_item_index.md", false},
+		{`{{ env "ITEM" }}/item-log.txt`, false},
+		{`out/{{ var "index_name" }}.md`, false},
+		{"out/{{ .vars.item", false},
+	}
+
+	for _, tt := range tests {
+		if got := processor.isTemplatedOutput(tt.output, "item"); got != tt.want {
+			t.Errorf("isTemplatedOutput(%q) = %v, want %v", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestProcessForEachStep(t *testing.T) {
+	useMockProviders(t)
+	tempDir := t.TempDir()
+
+	dslConfig := DSLConfig{
+		Steps: []Step{
+			{
+				Name: "per_item",
+				Config: StepConfig{
+					ForEach: &ForEachConfig{Items: []interface{}{"a", "b", "c"}, Concurrency: 2},
+					Input:   "NA",
+					Model:   "gpt-4o-mini",
+					Action:  "describe $item",
+					Output:  "item-$index.txt",
+				},
+			},
+			{
+				Name: "combined",
+				Config: StepConfig{
+					ForEach: &ForEachConfig{Items: []interface{}{"a", "b"}, Separator: "\n---\n"},
+					Input:   "NA",
+					Model:   "gpt-4o-mini",
+					Action:  "describe $item",
+					Output:  "combined.txt",
+				},
+			},
+		},
+	}
+
+	serverConfig := &config.ServerConfig{Enabled: true, DataDir: tempDir}
+	processor := NewProcessor(&dslConfig, createTestEnvConfig(), serverConfig, false, "")
+	if err := processor.Process(); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"item-0.txt", "item-1.txt", "item-2.txt"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Errorf("expected per-item output %s: %v", name, err)
+		}
+	}
+
+	combined, err := os.ReadFile(filepath.Join(tempDir, "combined.txt"))
+	if err != nil {
+		t.Fatalf("expected combined output: %v", err)
+	}
+	if parts := strings.Split(string(combined), "\n---\n"); len(parts) != 2 {
+		t.Errorf("expected 2 combined results, got %d: %q", len(parts), combined)
+	}
+	if processor.LastOutput() != string(combined) {
+		t.Errorf("expected last output to be the combined result")
+	}
+}
@@ -1,73 +1,56 @@
 package processor
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"strings"
-	"time"
 
 	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/discovery"
 	"github.com/kris-hansen/comanda/utils/models"
 )
 
-// --- Ollama specific types (copied from ollama.go for local check) ---
+// --- Helper function to check Ollama models ---
 
-// OllamaTagsResponse represents the top-level structure of Ollama's /api/tags response
-type OllamaTagsResponse struct {
-	Models []OllamaModelTag `json:"models"`
-}
-
-// OllamaModelTag represents the details of a single model tag from /api/tags
-type OllamaModelTag struct {
-	Name string `json:"name"`
-}
-
-// --- Helper function to check local Ollama models ---
-
-// checkOllamaModelExists queries the local Ollama instance to see if a model tag exists.
-func checkOllamaModelExists(modelName string) (bool, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get("http://localhost:11434/api/tags")
-	if err != nil {
-		if strings.Contains(err.Error(), "connection refused") {
-			return false, fmt.Errorf("failed to connect to Ollama at http://localhost:11434 to verify model '%s'. Is Ollama running?", modelName)
+// checkOllamaModelExists queries the configured Ollama servers to see if any of them has a model tag.
+func checkOllamaModelExists(hosts []config.Host, modelName string) (bool, error) {
+	var availableModels, unreachable []string
+	for _, host := range hosts {
+		tags, err := discovery.GetOllamaHostModels(host)
+		if err != nil {
+			unreachable = append(unreachable, fmt.Sprintf("%s (%v)", host.BaseURL, err))
+			continue
+		}
+		for _, model := range tags {
+			if strings.EqualFold(model.Name, modelName) {
+				return true, nil // Model found
+			}
+			availableModels = append(availableModels, model.Name)
 		}
-		return false, fmt.Errorf("error calling Ollama /api/tags to verify model '%s': %v", modelName, err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return false, fmt.Errorf("Ollama /api/tags returned non-OK status %d while verifying model '%s': %s", resp.StatusCode, modelName, string(bodyBytes))
 	}
 
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return false, fmt.Errorf("error reading Ollama /api/tags response body while verifying model '%s': %v", modelName, err)
+	if len(unreachable) == len(hosts) {
+		return false, fmt.Errorf("failed to connect to Ollama at %s to verify model '%s'. Is Ollama running?", strings.Join(unreachable, ", "), modelName)
 	}
 
-	var tagsResponse OllamaTagsResponse
-	if err := json.Unmarshal(bodyBytes, &tagsResponse); err != nil {
-		return false, fmt.Errorf("error unmarshaling Ollama /api/tags response while verifying model '%s': %v. Body: %s", modelName, err, string(bodyBytes))
+	// Model not found in the list
+	// Construct a helpful error message suggesting how to pull the model
+	errMsg := fmt.Sprintf("model tag '%s' not found in the configured Ollama instances. Available models: %v. Try running 'ollama pull %s'", modelName, availableModels, modelName)
+	if len(unreachable) > 0 {
+		errMsg += fmt.Sprintf(" (unreachable: %s)", strings.Join(unreachable, ", "))
 	}
+	return false, fmt.Errorf("%s", errMsg)
+}
 
-	modelNameLower := strings.ToLower(modelName)
-	for _, model := range tagsResponse.Models {
-		if strings.ToLower(model.Name) == modelNameLower {
-			return true, nil // Model found
+// resolveModels replaces the model aliases in modelNames with the models they name
+func (p *Processor) resolveModels(modelNames []string) []string {
+	resolved := make([]string, len(modelNames))
+	for i, modelName := range modelNames {
+		resolved[i] = p.envConfig.ResolveModel(modelName)
+		if resolved[i] != modelName {
+			p.debugf("Resolved model alias %s to %s", modelName, resolved[i])
 		}
 	}
-
-	// Model not found in the list
-	// Construct a helpful error message suggesting how to pull the model
-	availableModels := make([]string, len(tagsResponse.Models))
-	for i, m := range tagsResponse.Models {
-		availableModels[i] = m.Name
-	}
-	errMsg := fmt.Sprintf("model tag '%s' not found in local Ollama instance. Available models: %v. Try running 'ollama pull %s'", modelName, availableModels, modelName)
-	return false, fmt.Errorf(errMsg)
+	return resolved
 }
 
 // validateModel checks if the specified model is supported and has the required capabilities
@@ -75,6 +58,7 @@ func (p *Processor) validateModel(modelNames []string, inputs []string) error {
 	if len(modelNames) == 0 {
 		return fmt.Errorf("no model specified")
 	}
+	modelNames = p.resolveModels(modelNames)
 
 	// Special case: if the only model is "NA", skip validation
 	if len(modelNames) == 1 && modelNames[0] == "NA" {
@@ -108,8 +92,12 @@ func (p *Processor) validateModel(modelNames []string, inputs []string) error {
 
 		// --- Add Ollama specific local check ---
 		if providerName == "ollama" {
-			p.debugf("Performing local check for Ollama model tag: %s", modelName)
-			exists, err := checkOllamaModelExists(modelName)
+			p.debugf("Performing check for Ollama model tag: %s", modelName)
+			hosts, _, err := p.envConfig.OllamaHosts()
+			if err != nil {
+				return err
+			}
+			exists, err := checkOllamaModelExists(hosts, modelName)
 			if err != nil {
 				// Error occurred during check (e.g., connection refused, API error)
 				p.debugf("Ollama local check failed for %s: %v", modelName, err)
@@ -185,6 +173,15 @@ func (p *Processor) configureProviders() error {
 			if err := provider.Configure("LOCAL"); err != nil { // Pass "LOCAL" as expected by OllamaProvider.Configure
 				return fmt.Errorf("failed to configure provider %s: %w", providerName, err)
 			}
+			if ollama, ok := provider.(*models.OllamaProvider); ok {
+				hosts, routing, err := p.envConfig.OllamaHosts()
+				if err != nil {
+					return err
+				}
+				if err := ollama.SetHosts(hosts, routing); err != nil {
+					return fmt.Errorf("failed to configure provider %s: %w", providerName, err)
+				}
+			}
 			p.debugf("Successfully configured local provider %s", providerName)
 			continue
 		}
@@ -204,6 +201,15 @@ func (p *Processor) configureProviders() error {
 		case "deepseek":
 			providerConfig, err = p.envConfig.GetProviderConfig("deepseek")
 		default:
+			// OpenAI-compatible endpoints are named in the env file and may not need an API key
+			providerConfig, err = p.envConfig.GetProviderConfig(providerName)
+			if err == nil && providerConfig.Type == config.OpenAICompatible {
+				if err := provider.Configure(providerConfig.APIKey); err != nil {
+					return fmt.Errorf("failed to configure provider %s: %w", providerName, err)
+				}
+				p.debugf("Successfully configured OpenAI-compatible provider %s", providerName)
+				continue
+			}
 			return fmt.Errorf("unknown provider: %s", providerName)
 		}
 
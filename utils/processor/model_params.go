@@ -0,0 +1,142 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// validateModelParams checks the temperature, max_tokens, top_p and stop fields of a step
+func validateModelParams(cfg StepConfig) error {
+	if cfg.Temperature != nil && (*cfg.Temperature < 0 || *cfg.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if cfg.TopP != nil && (*cfg.TopP <= 0 || *cfg.TopP > 1) {
+		return fmt.Errorf("top_p must be greater than 0 and at most 1")
+	}
+	if cfg.MaxTokens != nil && *cfg.MaxTokens <= 0 {
+		return fmt.Errorf("max_tokens must be greater than 0")
+	}
+	switch stop := cfg.Stop.(type) {
+	case nil, string:
+	case []interface{}:
+		for _, item := range stop {
+			if _, ok := item.(string); !ok {
+				return fmt.Errorf("stop must be a string or a list of strings")
+			}
+		}
+	default:
+		return fmt.Errorf("stop must be a string or a list of strings")
+	}
+	return nil
+}
+
+// stepModelParams returns the model parameters set by a step
+func (p *Processor) stepModelParams(step *Step) config.ModelParams {
+	if step == nil {
+		return config.ModelParams{}
+	}
+	return config.ModelParams{
+		Temperature: step.Config.Temperature,
+		MaxTokens:   step.Config.MaxTokens,
+		TopP:        step.Config.TopP,
+		Stop:        p.NormalizeStringSlice(step.Config.Stop),
+		Seed:        step.Config.Seed,
+		System:      step.Config.System,
+	}
+}
+
+// modelDefaults returns the default parameters of a model from the env file
+func (p *Processor) modelDefaults(providerName, modelName string) config.ModelParams {
+	if p.envConfig == nil {
+		return config.ModelParams{}
+	}
+	model, err := p.envConfig.GetModelConfig(providerName, modelName)
+	if err != nil || model.Defaults == nil {
+		return config.ModelParams{}
+	}
+	return *model.Defaults
+}
+
+// mergeModelParams returns params with its unset fields taken from defaults
+func mergeModelParams(params, defaults config.ModelParams) config.ModelParams {
+	if params.Temperature == nil {
+		params.Temperature = defaults.Temperature
+	}
+	if params.MaxTokens == nil {
+		params.MaxTokens = defaults.MaxTokens
+	}
+	if params.TopP == nil {
+		params.TopP = defaults.TopP
+	}
+	if len(params.Stop) == 0 {
+		params.Stop = defaults.Stop
+	}
+	if params.Seed == nil {
+		params.Seed = defaults.Seed
+	}
+	if params.System == "" {
+		params.System = defaults.System
+	}
+	return params
+}
+
+// paramsProvider sends prompts with the model parameters of a step, falling back to the
+// model's defaults from the env file
+type paramsProvider struct {
+	models.Provider
+	processor *Processor
+	params    config.ModelParams
+}
+
+// withParams returns ctx carrying the model parameters for a call to modelName
+func (m *paramsProvider) withParams(ctx context.Context, modelName string) context.Context {
+	params := mergeModelParams(m.params, m.processor.modelDefaults(m.Name(), modelName))
+	opts := models.RequestOptionsFromContext(ctx)
+	opts.Temperature = params.Temperature
+	opts.MaxTokens = params.MaxTokens
+	opts.TopP = params.TopP
+	opts.Stop = params.Stop
+	opts.Seed = params.Seed
+	opts.System = params.System
+	return models.WithRequestOptions(ctx, opts)
+}
+
+// SendPrompt sends a prompt with the model parameters
+func (m *paramsProvider) SendPrompt(ctx context.Context, modelName string, prompt string) (string, error) {
+	return m.Provider.SendPrompt(m.withParams(ctx, modelName), modelName, prompt)
+}
+
+// SendPromptStream streams a prompt with the model parameters
+func (m *paramsProvider) SendPromptStream(ctx context.Context, modelName string, prompt string, onDelta func(delta string)) (string, error) {
+	return models.SendPromptStream(m.withParams(ctx, modelName), m.Provider, modelName, prompt, onDelta)
+}
+
+// SendPromptWithFile sends a prompt with a file and the model parameters
+func (m *paramsProvider) SendPromptWithFile(ctx context.Context, modelName string, prompt string, file models.FileInput) (string, error) {
+	return m.Provider.SendPromptWithFile(m.withParams(ctx, modelName), modelName, prompt, file)
+}
+
+// SendMessages sends a conversation with the model parameters
+func (m *paramsProvider) SendMessages(ctx context.Context, modelName string, messages []models.Message) (string, error) {
+	return m.Provider.SendMessages(m.withParams(ctx, modelName), modelName, messages)
+}
+
+// SendMessagesWithTools sends a conversation with tools and the model parameters
+func (m *paramsProvider) SendMessagesWithTools(ctx context.Context, modelName string, messages []models.Message, tools []models.Tool) (models.Message, error) {
+	return m.Provider.SendMessagesWithTools(m.withParams(ctx, modelName), modelName, messages, tools)
+}
+
+// withModelParams wraps a provider so that calls made for the current step use its model parameters
+func (p *Processor) withModelParams(provider models.Provider) models.Provider {
+	return &paramsProvider{Provider: provider, processor: p, params: p.stepModelParams(p.currentStep)}
+}
+
+// stepProvider wraps a configured provider with the current step's model parameters and its
+// cache, retry and budget settings. Model parameters are applied first because they are part
+// of the cache key, and cached responses cost nothing, so the cache is checked before the budget.
+func (p *Processor) stepProvider(provider models.Provider) models.Provider {
+	return p.withModelParams(p.withStepCache(p.withStepRetry(p.withUsage(provider))))
+}
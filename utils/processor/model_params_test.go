@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"gopkg.in/yaml.v3"
+)
+
+func floatPtr(f float64) *float64 { return &f }
+func intPtr(i int) *int           { return &i }
+
+func TestValidateModelParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{"all parameters", "temperature: 0.2\nmax_tokens: 500\ntop_p: 0.9\nstop: [END]\nseed: 7\nsystem: Be terse.\n", false},
+		{"zero temperature", "temperature: 0\n", false},
+		{"stop as a string", "stop: END\n", false},
+		{"temperature too high", "temperature: 2.5\n", true},
+		{"negative temperature", "temperature: -1\n", true},
+		{"zero top_p", "top_p: 0\n", true},
+		{"zero max_tokens", "max_tokens: 0\n", true},
+		{"stop with a non-string", "stop: [END, {a: b}]\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg StepConfig
+			if err := yaml.Unmarshal([]byte(tt.yaml), &cfg); err != nil {
+				t.Fatalf("yaml.Unmarshal() error: %v", err)
+			}
+			if err := validateModelParams(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateModelParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStepModelParamsWithDefaults(t *testing.T) {
+	provider := newScriptedProvider("one", "two")
+	useScriptedProvider(t, provider)
+
+	envConfig := createTestEnvConfig()
+	for i, model := range envConfig.Providers["openai"].Models {
+		if model.Name == "gpt-4o-mini" {
+			envConfig.Providers["openai"].Models[i].Defaults = &config.ModelParams{
+				Temperature: floatPtr(0.1),
+				MaxTokens:   intPtr(500),
+				System:      "Be terse.",
+			}
+		}
+	}
+
+	dslConfig := &DSLConfig{Steps: []Step{
+		{Name: "defaults", Config: StepConfig{Input: "NA", Model: "gpt-4o-mini", Action: "one", Output: "STDOUT"}},
+		{Name: "overrides", Config: StepConfig{
+			Input:       "NA",
+			Model:       "gpt-4o-mini",
+			Action:      "two",
+			Output:      "STDOUT",
+			Temperature: floatPtr(0),
+			Stop:        []interface{}{"END"},
+			Seed:        intPtr(42),
+		}},
+	}}
+	processor := NewProcessor(dslConfig, envConfig, createTestServerConfig(), false, "")
+	if err := processor.Process(); err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+	if len(provider.options) != 2 {
+		t.Fatalf("expected 2 prompts, got %d", len(provider.options))
+	}
+
+	defaults := provider.options[0]
+	if *defaults.Temperature != 0.1 || *defaults.MaxTokens != 500 || defaults.System != "Be terse." ||
+		defaults.TopP != nil || defaults.Stop != nil || defaults.Seed != nil {
+		t.Errorf("first step options = %+v", defaults)
+	}
+
+	overrides := provider.options[1]
+	if *overrides.Temperature != 0 || *overrides.MaxTokens != 500 || overrides.System != "Be terse." ||
+		!reflect.DeepEqual(overrides.Stop, []string{"END"}) || *overrides.Seed != 42 {
+		t.Errorf("second step options = %+v", overrides)
+	}
+}
+
+func TestMergeModelParams(t *testing.T) {
+	defaults := config.ModelParams{Temperature: floatPtr(0.5), TopP: floatPtr(0.9), Stop: []string{"STOP"}, System: "default"}
+	params := config.ModelParams{Temperature: floatPtr(1), System: "step"}
+	merged := mergeModelParams(params, defaults)
+	if *merged.Temperature != 1 || *merged.TopP != 0.9 || merged.System != "step" || !reflect.DeepEqual(merged.Stop, []string{"STOP"}) {
+		t.Errorf("mergeModelParams() = %+v", merged)
+	}
+}
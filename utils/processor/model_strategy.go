@@ -0,0 +1,171 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Model strategies decide how a step with a list of models uses them
+const (
+	ModelStrategyFallback = "fallback" // Try the models in order until one succeeds (default)
+	ModelStrategyRace     = "race"     // Send to all models at once and keep the first success
+	ModelStrategyAll      = "all"      // Send to all models and combine the labelled results
+)
+
+// validateModelStrategy checks the model_strategy field of a step
+func validateModelStrategy(config StepConfig) error {
+	switch config.ModelStrategy {
+	case "", ModelStrategyFallback, ModelStrategyRace:
+		return nil
+	case ModelStrategyAll:
+		if config.NextAction != nil {
+			return fmt.Errorf("next-action cannot be used with model_strategy: all")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid model_strategy '%s': must be one of %s, %s or %s",
+			config.ModelStrategy, ModelStrategyFallback, ModelStrategyRace, ModelStrategyAll)
+	}
+}
+
+// modelResult holds the outcome of running a step's actions against one model
+type modelResult struct {
+	index    int // Position of the model in the step's model list
+	model    string
+	response string
+	err      error
+}
+
+// processModelActions runs the step's actions against its models according to model_strategy.
+// It returns the response and the model that produced it. For the all strategy, the model is
+// the comma separated list of models.
+func (p *Processor) processModelActions(step Step, modelNames []string, actions []string, isParallel bool, parallelID string) (string, string, error) {
+	if len(modelNames) <= 1 {
+		response, err := p.processActions(modelNames, actions)
+		if len(modelNames) == 0 {
+			return response, "", err
+		}
+		return response, modelNames[0], err
+	}
+
+	switch step.Config.ModelStrategy {
+	case ModelStrategyRace:
+		return p.raceModels(step, modelNames, actions)
+	case ModelStrategyAll:
+		response, err := p.runAllModels(step, modelNames, actions)
+		return response, strings.Join(modelNames, ", "), err
+	default:
+		return p.fallbackModels(step, modelNames, actions, isParallel, parallelID)
+	}
+}
+
+// fallbackModels tries each model in order and returns the first successful response
+func (p *Processor) fallbackModels(step Step, modelNames []string, actions []string, isParallel bool, parallelID string) (string, string, error) {
+	var failures []string
+	for i, modelName := range modelNames {
+		response, err := p.processActions([]string{modelName}, actions)
+		if err == nil {
+			return response, modelName, nil
+		}
+
+		failures = append(failures, fmt.Sprintf("%s: %v", modelName, err))
+		// Falling back is pointless once the step has been cancelled or timed out
+		if p.ctx.Err() != nil {
+			return "", "", err
+		}
+		// The next model's response would be streamed after the part already written
+		if p.streamed.Len() > 0 {
+			return "", "", fmt.Errorf("model %s failed after part of its response was streamed: %w", modelName, err)
+		}
+		if i < len(modelNames)-1 {
+			msg := fmt.Sprintf("Model %s failed for step %s, falling back to %s", modelName, step.Name, modelNames[i+1])
+			p.debugf("%s: %v", msg, err)
+			stepInfo := &StepInfo{Name: step.Name, Model: modelNames[i+1]}
+			if isParallel {
+				p.emitParallelProgress(msg, stepInfo, parallelID)
+			} else {
+				p.emitProgress(msg, stepInfo)
+			}
+		}
+	}
+	return "", "", fmt.Errorf("all models failed:\n- %s", strings.Join(failures, "\n- "))
+}
+
+// runModelsConcurrently sends the actions to every model at once. Results are delivered
+// on the returned channel as they complete.
+func (p *Processor) runModelsConcurrently(modelNames []string, actions []string) <-chan modelResult {
+	// Buffered so that slower models can finish after the caller stops reading
+	results := make(chan modelResult, len(modelNames))
+	for i, modelName := range modelNames {
+		go func(index int, modelName string) {
+			response, err := p.processActions([]string{modelName}, actions)
+			results <- modelResult{index: index, model: modelName, response: response, err: err}
+		}(i, modelName)
+	}
+	return results
+}
+
+// raceModels returns the first successful response from any of the models. Once a model
+// wins, the requests still running for the other models are cancelled.
+func (p *Processor) raceModels(step Step, modelNames []string, actions []string) (string, string, error) {
+	ctx, cancel := context.WithCancel(p.ctx)
+	restore := p.withContext(ctx)
+	results := p.runModelsConcurrently(modelNames, actions)
+
+	// Wait for the cancelled models to return before restoring the context they share
+	pending := len(modelNames)
+	defer func() {
+		cancel()
+		for ; pending > 0; pending-- {
+			<-results
+		}
+		restore()
+	}()
+
+	var failures []string
+	for range modelNames {
+		result := <-results
+		pending--
+		if result.err == nil {
+			p.debugf("Model %s won the race for step '%s'", result.model, step.Name)
+			return result.response, result.model, nil
+		}
+		p.debugf("Model %s failed in race for step '%s': %v", result.model, step.Name, result.err)
+		failures = append(failures, fmt.Sprintf("%s: %v", result.model, result.err))
+	}
+	return "", "", fmt.Errorf("all models failed:\n- %s", strings.Join(failures, "\n- "))
+}
+
+// runAllModels sends the actions to every model and combines the results in the order the
+// models are listed, each under a heading with the model name. A failed model fails the step
+// unless skip_errors is set, in which case its error is reported in place of its result.
+func (p *Processor) runAllModels(step Step, modelNames []string, actions []string) (string, error) {
+	results := p.runModelsConcurrently(modelNames, actions)
+
+	ordered := make([]modelResult, len(modelNames))
+	for range modelNames {
+		result := <-results
+		ordered[result.index] = result
+	}
+
+	var sections []string
+	succeeded := 0
+	for _, result := range ordered {
+		modelName := result.model
+		if result.err != nil {
+			if !step.Config.SkipErrors {
+				return "", fmt.Errorf("model %s failed: %w", modelName, result.err)
+			}
+			p.debugf("Model %s failed for step '%s', skipping: %v", modelName, step.Name, result.err)
+			sections = append(sections, fmt.Sprintf("## %s\n\nError: %v", modelName, result.err))
+			continue
+		}
+		succeeded++
+		sections = append(sections, fmt.Sprintf("## %s\n\n%s", modelName, strings.TrimSpace(result.response)))
+	}
+	if succeeded == 0 {
+		return "", fmt.Errorf("all models failed for step '%s'", step.Name)
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
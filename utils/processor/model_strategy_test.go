@@ -0,0 +1,153 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// perModelProvider answers with the model name, failing or delaying selected models
+type perModelProvider struct {
+	MockProvider
+	mu     sync.Mutex
+	errs   map[string]error
+	delays map[string]time.Duration
+	calls  []string
+}
+
+func (m *perModelProvider) SendPrompt(ctx context.Context, modelName, prompt string) (string, error) {
+	m.mu.Lock()
+	m.calls = append(m.calls, modelName)
+	err := m.errs[modelName]
+	delay := m.delays[modelName]
+	m.mu.Unlock()
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	if err != nil {
+		return "", err
+	}
+	return "response from " + modelName, nil
+}
+
+func runModelStrategyStep(t *testing.T, provider *perModelProvider, config StepConfig) (*Processor, error) {
+	t.Helper()
+	original := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider {
+		if provider.SupportsModel(modelName) {
+			return provider
+		}
+		return nil
+	}
+	t.Cleanup(func() {
+		models.DetectProvider = original
+	})
+
+	config.Input = "NA"
+	config.Action = "answer"
+	config.Output = "STDOUT"
+	dslConfig := &DSLConfig{Steps: []Step{{Name: "compare", Config: config}}}
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+	return processor, processor.Process()
+}
+
+func TestModelStrategies(t *testing.T) {
+	overloaded := &models.ProviderError{Provider: "openai", Kind: models.ErrorOverloaded, Message: "overloaded"}
+
+	tests := []struct {
+		name     string
+		config   StepConfig
+		errs     map[string]error
+		delays   map[string]time.Duration
+		expected string
+		wantErr  string
+	}{
+		{
+			name:     "fallback uses the first model that succeeds",
+			config:   StepConfig{Model: []interface{}{"gpt-4o", "gpt-4o-mini"}},
+			errs:     map[string]error{"gpt-4o": overloaded},
+			expected: "response from gpt-4o-mini",
+		},
+		{
+			name:     "fallback stops at the first success",
+			config:   StepConfig{Model: []interface{}{"gpt-4o", "gpt-4o-mini"}, ModelStrategy: ModelStrategyFallback},
+			expected: "response from gpt-4o",
+		},
+		{
+			name:    "fallback fails when every model fails",
+			config:  StepConfig{Model: []interface{}{"gpt-4o", "gpt-4o-mini"}},
+			errs:    map[string]error{"gpt-4o": overloaded, "gpt-4o-mini": errors.New("boom")},
+			wantErr: "all models failed",
+		},
+		{
+			name:     "race keeps the fastest response",
+			config:   StepConfig{Model: []interface{}{"gpt-4o", "gpt-4o-mini"}, ModelStrategy: ModelStrategyRace},
+			delays:   map[string]time.Duration{"gpt-4o": 200 * time.Millisecond},
+			expected: "response from gpt-4o-mini",
+		},
+		{
+			name:     "race ignores models that fail",
+			config:   StepConfig{Model: []interface{}{"gpt-4o", "gpt-4o-mini"}, ModelStrategy: ModelStrategyRace},
+			errs:     map[string]error{"gpt-4o-mini": overloaded},
+			delays:   map[string]time.Duration{"gpt-4o": 20 * time.Millisecond},
+			expected: "response from gpt-4o",
+		},
+		{
+			name:     "all labels every result in model order",
+			config:   StepConfig{Model: []interface{}{"gpt-4o", "gpt-4o-mini"}, ModelStrategy: ModelStrategyAll},
+			delays:   map[string]time.Duration{"gpt-4o": 20 * time.Millisecond},
+			expected: "## gpt-4o\n\nresponse from gpt-4o\n\n## gpt-4o-mini\n\nresponse from gpt-4o-mini",
+		},
+		{
+			name:    "all fails when a model fails",
+			config:  StepConfig{Model: []interface{}{"gpt-4o", "gpt-4o-mini"}, ModelStrategy: ModelStrategyAll},
+			errs:    map[string]error{"gpt-4o": overloaded},
+			wantErr: "model gpt-4o failed",
+		},
+		{
+			name:     "all reports failures with skip_errors",
+			config:   StepConfig{Model: []interface{}{"gpt-4o", "gpt-4o-mini"}, ModelStrategy: ModelStrategyAll, SkipErrors: true},
+			errs:     map[string]error{"gpt-4o": overloaded},
+			expected: "## gpt-4o\n\nError: " + overloaded.Error() + "\n\n## gpt-4o-mini\n\nresponse from gpt-4o-mini",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &perModelProvider{MockProvider: MockProvider{name: "openai"}, errs: tt.errs, delays: tt.delays}
+			processor, err := runModelStrategyStep(t, provider, tt.config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Process() returned unexpected error: %v", err)
+			}
+			if processor.LastOutput() != tt.expected {
+				t.Errorf("LastOutput() = %q, want %q", processor.LastOutput(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateModelStrategy(t *testing.T) {
+	if err := validateModelStrategy(StepConfig{ModelStrategy: "vote"}); err == nil {
+		t.Error("expected error for unknown model_strategy")
+	}
+	if err := validateModelStrategy(StepConfig{ModelStrategy: ModelStrategyAll, NextAction: "refine"}); err == nil {
+		t.Error("expected error for next-action with model_strategy: all")
+	}
+	if err := validateModelStrategy(StepConfig{ModelStrategy: ModelStrategyRace}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -1,7 +1,13 @@
 package processor
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
 )
 
 func TestValidateModel(t *testing.T) {
@@ -138,3 +144,119 @@ func TestConfigureProviders(t *testing.T) {
 	// Restore original DetectProvider after tests
 	restoreDetectProvider()
 }
+
+func TestCheckOllamaModelExists(t *testing.T) {
+	gpu := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"models": [{"name": "llama3:70b"}]}`))
+	}))
+	defer gpu.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	gpuHost := config.Host{Name: "gpu", BaseURL: gpu.URL, Headers: map[string]string{"Authorization": "Bearer secret"}}
+	downHost := config.Host{Name: "laptop", BaseURL: down.URL}
+
+	tests := []struct {
+		name    string
+		hosts   []config.Host
+		model   string
+		exists  bool
+		wantErr string
+	}{
+		{"found on a remote host", []config.Host{downHost, gpuHost}, "llama3:70b", true, ""},
+		{"case insensitive", []config.Host{gpuHost}, "Llama3:70B", true, ""},
+		{"not found", []config.Host{downHost, gpuHost}, "mistral", false, "ollama pull mistral"},
+		{"missing auth header", []config.Host{{Name: "gpu", BaseURL: gpu.URL}}, "llama3:70b", false, "failed to connect"},
+		{"no host reachable", []config.Host{downHost}, "llama3:70b", false, "failed to connect"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exists, err := checkOllamaModelExists(tt.hosts, tt.model)
+			if exists != tt.exists {
+				t.Errorf("checkOllamaModelExists() = %v, want %v", exists, tt.exists)
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("checkOllamaModelExists() error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkOllamaModelExists() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigureOpenAICompatibleProvider(t *testing.T) {
+	previous := models.DetectProvider
+	models.DetectProvider = originalDetectProvider
+	defer func() { models.DetectProvider = previous }()
+
+	envConfig := createTestEnvConfig()
+	envConfig.Providers["vllm"] = &config.Provider{
+		Type:        config.OpenAICompatible,
+		BaseURL:     "http://gpu:8000/v1",
+		ModelPrefix: "vllm/",
+		Models:      []config.Model{{Name: "meta-llama/Llama-3-8B", Alias: "llama3-8b", Modes: []config.ModelMode{config.TextMode}}},
+	}
+	if err := models.RegisterOpenAICompatibleProviders(envConfig); err != nil {
+		t.Fatalf("RegisterOpenAICompatibleProviders() error: %v", err)
+	}
+	defer models.RegisterOpenAICompatibleProviders(nil)
+
+	processor := NewProcessor(&DSLConfig{}, envConfig, createTestServerConfig(), false, "")
+	if err := processor.validateModel([]string{"llama3-8b", "vllm/qwen2-7b"}, []string{}); err != nil {
+		t.Fatalf("validateModel() error: %v", err)
+	}
+	if err := processor.configureProviders(); err != nil {
+		t.Fatalf("configureProviders() without an API key error: %v", err)
+	}
+	if provider := processor.GetModelProvider("vllm/qwen2-7b"); provider == nil || provider.Name() != "vllm" {
+		t.Errorf("GetModelProvider(vllm/qwen2-7b) = %v, want the vllm endpoint", provider)
+	}
+}
+
+func TestModelAliases(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment string
+		model       string
+		wantErr     string
+	}{
+		{"alias", "", "fast", ""},
+		{"model name", "", "gpt-4o", ""},
+		{"environment override", "ci", "smart", ""},
+		{"alias without override", "", "smart", "unsupported model: claude-3-5-sonnet-latest"},
+		{"undefined environment", "staging", "fast", "environment 'staging'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(config.EnvironmentVar, tt.environment)
+			scripted := newScriptedProvider("done")
+			useScriptedProvider(t, scripted)
+
+			envConfig := createTestEnvConfig()
+			envConfig.Aliases = map[string]string{"fast": "gpt-4o-mini", "smart": "claude-3-5-sonnet-latest"}
+			envConfig.Environments = map[string]*config.Environment{"ci": {Aliases: map[string]string{"smart": "gpt-4o"}}}
+			dslConfig := &DSLConfig{Steps: []Step{{Name: "summarize", Config: StepConfig{
+				Input:  "NA",
+				Model:  tt.model,
+				Action: "summarize",
+				Output: "STDOUT",
+			}}}}
+			err := NewProcessor(dslConfig, envConfig, createTestServerConfig(), false, "").Process()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Process() error: %v", err)
+				}
+				if len(scripted.prompts) != 1 {
+					t.Errorf("got %d prompts, want 1", len(scripted.prompts))
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Process() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
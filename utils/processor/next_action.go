@@ -0,0 +1,168 @@
+package processor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultNextActionIterations is the iteration limit for next-action loops with an until condition
+const defaultNextActionIterations = 3
+
+// NextActionConfig describes follow-up prompts that refine a step's output.
+// In YAML, next-action can be a single prompt, a list of prompts, or a map:
+//
+//	next-action:
+//	  action: [critique the draft, revise the draft using the critique]
+//	  until: "$lastOutput contains 'APPROVED'"
+//	  max_iterations: 5
+type NextActionConfig struct {
+	Actions       []string // Prompts run in order on each iteration
+	Until         string   // Condition that ends the loop once true
+	MaxIterations int      // Maximum number of iterations
+}
+
+// parseNextAction converts the next-action field into a NextActionConfig. It returns nil if no next-action is set.
+func (p *Processor) parseNextAction(value interface{}) (*NextActionConfig, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string, []string, []interface{}:
+		actions := p.NormalizeStringSlice(v)
+		if len(actions) == 0 {
+			return nil, nil
+		}
+		return &NextActionConfig{Actions: actions, MaxIterations: 1}, nil
+	case map[string]interface{}:
+		cfg := &NextActionConfig{}
+		for key, raw := range v {
+			switch key {
+			case "action":
+				cfg.Actions = p.NormalizeStringSlice(raw)
+			case "until":
+				until, ok := raw.(string)
+				if !ok {
+					return nil, fmt.Errorf("next-action 'until' must be a string condition")
+				}
+				cfg.Until = until
+			case "max_iterations":
+				n, ok := raw.(int)
+				if !ok || n < 1 {
+					return nil, fmt.Errorf("next-action 'max_iterations' must be a positive integer")
+				}
+				cfg.MaxIterations = n
+			default:
+				return nil, fmt.Errorf("unknown next-action field '%s'", key)
+			}
+		}
+		if len(cfg.Actions) == 0 {
+			return nil, fmt.Errorf("next-action requires an 'action'")
+		}
+		if cfg.Until != "" {
+			if _, err := ParseCondition(cfg.Until); err != nil {
+				return nil, fmt.Errorf("next-action 'until': %w", err)
+			}
+		}
+		if cfg.MaxIterations == 0 {
+			if cfg.Until != "" {
+				cfg.MaxIterations = defaultNextActionIterations
+			} else {
+				cfg.MaxIterations = 1
+			}
+		}
+		return cfg, nil
+	default:
+		return nil, fmt.Errorf("unsupported next-action type %T", value)
+	}
+}
+
+// runNextActions applies a step's next-action prompts to its response using the step's model.
+// Each iteration runs every prompt in order against the latest output, and the loop ends once
+// the until condition is true or max_iterations is reached. The prompts can refer to the
+// output the iteration started from as $draft, so that a prompt revising a draft after a
+// critique sees both.
+func (p *Processor) runNextActions(step Step, modelName string, response string, isParallel bool, parallelID string) (string, error) {
+	cfg, err := p.parseNextAction(step.Config.NextAction)
+	if err != nil || cfg == nil {
+		return response, err
+	}
+
+	provider, err := p.configuredProviderFor(modelName)
+	if err != nil {
+		return "", err
+	}
+	provider = p.stepProvider(provider)
+
+	var until *Condition
+	if cfg.Until != "" {
+		if until, err = ParseCondition(cfg.Until); err != nil {
+			return "", err
+		}
+	}
+
+	// $iteration and $draft are only visible while the loop runs
+	for _, name := range []string{"iteration", "draft"} {
+		previous, had := p.variables[name]
+		defer func() {
+			if had {
+				p.variables[name] = previous
+			} else {
+				delete(p.variables, name)
+			}
+		}()
+	}
+
+	stepInfo := &StepInfo{Name: step.Name, Model: modelName}
+	current := response
+	for iteration := 1; iteration <= cfg.MaxIterations; iteration++ {
+		p.variables["iteration"] = strconv.Itoa(iteration)
+		p.variables["draft"] = current
+
+		for i, action := range cfg.Actions {
+			if action, err = p.renderTemplate(action); err != nil {
+				return "", fmt.Errorf("next-action template error in step '%s': %w", step.Name, err)
+			}
+			stepInfo.Action = action
+
+			msg := fmt.Sprintf("Running next-action %d/%d for step %s (iteration %d/%d)",
+				i+1, len(cfg.Actions), step.Name, iteration, cfg.MaxIterations)
+			p.debugf("%s: %s", msg, action)
+			if isParallel {
+				p.emitParallelProgress(msg, stepInfo, parallelID)
+			} else {
+				p.emitProgress(msg, stepInfo)
+			}
+
+			prompt := fmt.Sprintf("Input:\n%s\n\nAction: %s", current, action)
+			current, err = provider.SendPrompt(p.ctx, modelName, prompt)
+			if err != nil {
+				return "", fmt.Errorf("next-action %d failed on iteration %d: %w", i+1, iteration, err)
+			}
+		}
+
+		if until == nil {
+			continue
+		}
+		latest := current
+		done, err := until.Evaluate(func(name string) (string, bool) {
+			// Within an until condition, $lastOutput is the latest refined output
+			if name == "lastOutput" || name == "STDIN" {
+				return latest, true
+			}
+			return p.lookupConditionVariable(name)
+		})
+		if err != nil {
+			return "", err
+		}
+		if done {
+			p.debugf("next-action loop for step '%s' finished after %d iteration(s): %s", step.Name, iteration, cfg.Until)
+			break
+		}
+		if iteration == cfg.MaxIterations {
+			p.debugf("next-action loop for step '%s' reached max_iterations (%d) before '%s' was met",
+				step.Name, cfg.MaxIterations, strings.TrimSpace(cfg.Until))
+		}
+	}
+
+	return current, nil
+}
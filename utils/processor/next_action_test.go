@@ -0,0 +1,146 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+)
+
+func runNextActionStep(t *testing.T, nextAction interface{}) *Processor {
+	t.Helper()
+	dslConfig := &DSLConfig{
+		Steps: []Step{
+			{
+				Name: "draft",
+				Config: StepConfig{
+					Input:      "NA",
+					Model:      "gpt-4o-mini",
+					Action:     "write a draft",
+					Output:     "STDOUT",
+					NextAction: nextAction,
+				},
+			},
+		},
+	}
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+	if err := processor.Process(); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	return processor
+}
+
+func TestNextActionList(t *testing.T) {
+	provider := newScriptedProvider("draft", "critique", "revision")
+	useScriptedProvider(t, provider)
+
+	processor := runNextActionStep(t, []interface{}{"critique this", "revise using the critique"})
+
+	if processor.LastOutput() != "revision" {
+		t.Errorf("LastOutput() = %q, want %q", processor.LastOutput(), "revision")
+	}
+	if len(provider.prompts) != 3 {
+		t.Fatalf("expected 3 prompts, got %d", len(provider.prompts))
+	}
+	if !strings.Contains(provider.prompts[1], "draft") || !strings.Contains(provider.prompts[1], "critique this") {
+		t.Errorf("first follow-up should receive the draft, got %q", provider.prompts[1])
+	}
+	if !strings.Contains(provider.prompts[2], "critique") {
+		t.Errorf("second follow-up should receive the critique, got %q", provider.prompts[2])
+	}
+}
+
+func TestNextActionUntil(t *testing.T) {
+	provider := newScriptedProvider("draft", "better draft", "final draft APPROVED")
+	useScriptedProvider(t, provider)
+
+	processor := runNextActionStep(t, map[string]interface{}{
+		"action":         "improve this draft (round $iteration)",
+		"until":          "$lastOutput contains 'APPROVED'",
+		"max_iterations": 5,
+	})
+
+	if processor.LastOutput() != "final draft APPROVED" {
+		t.Errorf("LastOutput() = %q, want %q", processor.LastOutput(), "final draft APPROVED")
+	}
+	if len(provider.prompts) != 3 {
+		t.Errorf("expected loop to stop after 2 iterations, got %d prompts", len(provider.prompts))
+	}
+	if !strings.Contains(provider.prompts[2], "round 2") {
+		t.Errorf("expected $iteration to be substituted, got %q", provider.prompts[2])
+	}
+	if _, ok := processor.variables["iteration"]; ok {
+		t.Error("expected $iteration to be removed after the loop")
+	}
+}
+
+func TestNextActionDraft(t *testing.T) {
+	provider := newScriptedProvider("first draft", "critique 1", "second draft", "critique 2", "final draft")
+	useScriptedProvider(t, provider)
+
+	processor := runNextActionStep(t, map[string]interface{}{
+		"action":         []interface{}{"critique this", "revise [{{ .vars.draft }}] using the critique"},
+		"until":          "$lastOutput == 'never'",
+		"max_iterations": 2,
+	})
+
+	if processor.LastOutput() != "final draft" {
+		t.Errorf("LastOutput() = %q, want %q", processor.LastOutput(), "final draft")
+	}
+	if len(provider.prompts) != 5 {
+		t.Fatalf("expected 5 prompts, got %d", len(provider.prompts))
+	}
+	// The revise prompt gets the critique as its input and the iteration's draft in its action
+	if !strings.Contains(provider.prompts[2], "critique 1") || !strings.Contains(provider.prompts[2], "revise [first draft]") {
+		t.Errorf("first revision should receive the critique and the draft, got %q", provider.prompts[2])
+	}
+	if !strings.Contains(provider.prompts[4], "critique 2") || !strings.Contains(provider.prompts[4], "revise [second draft]") {
+		t.Errorf("second revision should receive the critique and the revised draft, got %q", provider.prompts[4])
+	}
+	if _, ok := processor.variables["draft"]; ok {
+		t.Error("expected $draft to be removed after the loop")
+	}
+}
+
+func TestNextActionMaxIterations(t *testing.T) {
+	provider := newScriptedProvider("draft", "revision 1", "revision 2")
+	useScriptedProvider(t, provider)
+
+	processor := runNextActionStep(t, map[string]interface{}{
+		"action":         "improve this draft",
+		"until":          "$lastOutput == 'never'",
+		"max_iterations": 2,
+	})
+
+	if processor.LastOutput() != "revision 2" {
+		t.Errorf("LastOutput() = %q, want %q", processor.LastOutput(), "revision 2")
+	}
+}
+
+func TestParseNextActionErrors(t *testing.T) {
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), nil, false, "")
+
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{"missing action", map[string]interface{}{"until": "$a == 'b'"}},
+		{"invalid until", map[string]interface{}{"action": "x", "until": "$a =="}},
+		{"invalid max_iterations", map[string]interface{}{"action": "x", "max_iterations": 0}},
+		{"unknown field", map[string]interface{}{"action": "x", "repeat": 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := processor.parseNextAction(tt.value); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+
+	cfg, err := processor.parseNextAction(map[string]interface{}{"action": "x", "until": "$a == 'b'"})
+	if err != nil {
+		t.Fatalf("parseNextAction returned unexpected error: %v", err)
+	}
+	if cfg.MaxIterations != defaultNextActionIterations {
+		t.Errorf("MaxIterations = %d, want default %d", cfg.MaxIterations, defaultNextActionIterations)
+	}
+}
@@ -18,8 +18,23 @@ func min(a, b int) int {
 func (p *Processor) handleOutput(modelName string, response string, outputs []string, metrics *PerformanceMetrics) error {
 	p.debugf("Handling %d output(s)", len(outputs))
 	for _, output := range outputs {
+		// Check for "as $varname" syntax to store the response in a variable
+		output, varName := p.parseVariableAssignment(output)
+		if output != "STDOUT" {
+			rendered, err := p.renderTemplate(output)
+			if err != nil {
+				return fmt.Errorf("output path template error: %w", err)
+			}
+			output = rendered
+		}
+		if varName != "" {
+			p.variables[varName] = response
+			p.debugf("Stored response in variable $%s", varName)
+		}
 		p.debugf("Processing output: %s", output)
 		if output == "STDOUT" {
+			// A streamed response was written as it arrived
+			streamed := p.streamedResponse(response)
 			if p.progress != nil {
 				// Send through progress channel for streaming
 				p.debugf("Sending output event with content: %s", response)
@@ -40,8 +55,11 @@ func (p *Processor) handleOutput(modelName string, response string, outputs []st
 
 				// Add performance metrics to the output
 				outputWithMetrics := response
+				if streamed {
+					outputWithMetrics = ""
+				}
 				if metrics != nil {
-					outputWithMetrics = response + perfInfo
+					outputWithMetrics += perfInfo
 				}
 
 				if err := p.progress.WriteProgress(ProgressUpdate{
@@ -55,7 +73,11 @@ func (p *Processor) handleOutput(modelName string, response string, outputs []st
 				p.debugf("Output event sent successfully")
 			} else {
 				// Fallback to direct console output
-				fmt.Printf("\nResponse from %s:\n%s\n", modelName, response)
+				if streamed {
+					fmt.Println()
+				} else {
+					fmt.Printf("\nResponse from %s:\n%s\n", modelName, response)
+				}
 
 				// Print performance metrics if available
 				if metrics != nil {
@@ -108,6 +130,7 @@ func (p *Processor) handleOutput(modelName string, response string, outputs []st
 				return fmt.Errorf(errMsg)
 			}
 			p.debugf("Response successfully written to file: %s", outputPath)
+			p.written = append(p.written, outputPath)
 
 			// Print a message to the console to inform the user
 			fmt.Printf("\nResponse written to file: %s\n", outputPath)
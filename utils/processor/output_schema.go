@@ -0,0 +1,133 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/jsonschema"
+	"github.com/kris-hansen/comanda/utils/models"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultSchemaRetries is the number of repair prompts sent when a response does not match output_schema
+const defaultSchemaRetries = 2
+
+// validateOutputSchema checks the output_schema and schema_retries fields of a step
+func validateOutputSchema(config StepConfig) error {
+	if config.OutputSchema == nil {
+		if config.SchemaRetries != nil {
+			return fmt.Errorf("schema_retries requires output_schema")
+		}
+		return nil
+	}
+	switch config.OutputSchema.(type) {
+	case string, map[string]interface{}:
+	default:
+		return fmt.Errorf("output_schema must be a JSON Schema or the path of a schema file")
+	}
+	if config.SchemaRetries != nil && *config.SchemaRetries < 0 {
+		return fmt.Errorf("schema_retries must not be negative")
+	}
+	if config.ModelStrategy == ModelStrategyAll {
+		return fmt.Errorf("output_schema cannot be used with model_strategy: all")
+	}
+	return nil
+}
+
+// loadOutputSchema returns a step's output_schema, reading it from a JSON or YAML file
+// when it is given as a path
+func (p *Processor) loadOutputSchema(value interface{}) (map[string]interface{}, error) {
+	if path, ok := value.(string); ok {
+		data, err := os.ReadFile(p.resolveDataPath(path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema file '%s': %w", path, err)
+		}
+		// YAML is a superset of JSON, so this reads both
+		var decoded interface{}
+		if err := yaml.Unmarshal(data, &decoded); err != nil {
+			return nil, fmt.Errorf("failed to parse schema file '%s': %w", path, err)
+		}
+		value = decoded
+	}
+	return jsonschema.Normalize(value)
+}
+
+// withOutputSchema asks providers for JSON matching schema on the calls made for the current
+// step. The returned function restores the previous context.
+func (p *Processor) withOutputSchema(schema map[string]interface{}) func() {
+	opts := models.RequestOptionsFromContext(p.ctx)
+	opts.JSON, opts.JSONSchema = true, schema
+	return p.withContext(models.WithRequestOptions(p.ctx, opts))
+}
+
+// schemaInstructions returns the text appended to a step's actions to describe the expected output
+func schemaInstructions(schema map[string]interface{}) string {
+	data, _ := json.MarshalIndent(schema, "", "  ")
+	return fmt.Sprintf("\n\nRespond with only a JSON value that matches this JSON Schema, without code fences or commentary:\n%s", data)
+}
+
+// codeFencePattern matches a fenced code block, optionally labelled with a language such as json
+var codeFencePattern = regexp.MustCompile("(?s)```[A-Za-z0-9_+-]*[ \t]*\n(.*?)\n?```")
+
+// stripCodeFences returns the contents of the first fenced code block in a response, or the
+// trimmed response if it has none. Models often fence the JSON they are asked for.
+func stripCodeFences(response string) string {
+	if match := codeFencePattern.FindStringSubmatch(response); match != nil {
+		return strings.TrimSpace(match[1])
+	}
+	return strings.TrimSpace(response)
+}
+
+// checkOutputSchema returns the problems that stop text from being JSON matching schema
+func checkOutputSchema(schema map[string]interface{}, text string) []string {
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return []string{fmt.Sprintf("response is not valid JSON: %v", err)}
+	}
+	return jsonschema.Validate(schema, value)
+}
+
+// enforceOutputSchema checks a step's response against its output schema. Code fences are
+// removed first, and a response that still does not match is sent back to the model with
+// the validation errors, up to schema_retries times. It returns the JSON text.
+func (p *Processor) enforceOutputSchema(step Step, modelName string, schema map[string]interface{}, response string) (string, error) {
+	retries := defaultSchemaRetries
+	if step.Config.SchemaRetries != nil {
+		retries = *step.Config.SchemaRetries
+	}
+	if modelName == "" || modelName == "NA" {
+		retries = 0
+	}
+
+	var provider models.Provider
+	for attempt := 0; ; attempt++ {
+		cleaned := stripCodeFences(response)
+		problems := checkOutputSchema(schema, cleaned)
+		if len(problems) == 0 {
+			return cleaned, nil
+		}
+		if attempt >= retries {
+			return "", fmt.Errorf("response does not match output_schema after %d repair attempt(s):\n- %s",
+				retries, strings.Join(problems, "\n- "))
+		}
+		p.debugf("Response of step '%s' does not match output_schema, sending repair prompt %d/%d: %s",
+			step.Name, attempt+1, retries, strings.Join(problems, "; "))
+
+		if provider == nil {
+			configured, err := p.configuredProviderFor(modelName)
+			if err != nil {
+				return "", err
+			}
+			provider = p.stepProvider(configured)
+		}
+		prompt := fmt.Sprintf("Your previous response did not match the required JSON Schema.\n\nErrors:\n- %s\n\nPrevious response:\n%s%s",
+			strings.Join(problems, "\n- "), cleaned, schemaInstructions(schema))
+		var err error
+		if response, err = provider.SendPrompt(p.ctx, modelName, prompt); err != nil {
+			return "", fmt.Errorf("output_schema repair prompt failed: %w", err)
+		}
+	}
+}
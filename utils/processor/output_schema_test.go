@@ -0,0 +1,133 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// nameSchema requires an object with a string name, as decoded from YAML
+var nameSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []interface{}{"name"},
+	"properties": map[string]interface{}{
+		"name": map[string]interface{}{"type": "string"},
+	},
+}
+
+func TestStripCodeFences(t *testing.T) {
+	tests := []struct {
+		response string
+		expected string
+	}{
+		{response: `  {"a": 1}  `, expected: `{"a": 1}`},
+		{response: "```json\n{\"a\": 1}\n```", expected: `{"a": 1}`},
+		{response: "```\n[1, 2]\n```", expected: `[1, 2]`},
+		{response: "Here you go:\n```json\n{\"a\": 1}\n```\nAnything else?", expected: `{"a": 1}`},
+		{response: "```javascript\n[\"a\", \"b\"]```", expected: `["a", "b"]`},
+		{response: "```[1, 2]```", expected: "```[1, 2]```"},
+	}
+	for _, tt := range tests {
+		if got := stripCodeFences(tt.response); got != tt.expected {
+			t.Errorf("stripCodeFences(%q) = %q, want %q", tt.response, got, tt.expected)
+		}
+	}
+}
+
+func runSchemaStep(t *testing.T, schema interface{}, retries *int, responses ...string) (*Processor, *scriptedProvider, error) {
+	t.Helper()
+	provider := newScriptedProvider(responses...)
+	useScriptedProvider(t, provider)
+	dslConfig := &DSLConfig{Steps: []Step{{
+		Name: "extract",
+		Config: StepConfig{
+			Input:         "NA",
+			Model:         "gpt-4o-mini",
+			Action:        "extract the person",
+			Output:        "STDOUT",
+			OutputSchema:  schema,
+			SchemaRetries: retries,
+		},
+	}}}
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+	return processor, provider, processor.Process()
+}
+
+func TestOutputSchemaRepair(t *testing.T) {
+	processor, provider, err := runSchemaStep(t, nameSchema, nil, "```json\n{\"name\": 1}\n```", "not json", `{"name": "Ada"}`)
+	if err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+	if processor.LastOutput() != `{"name": "Ada"}` {
+		t.Errorf("LastOutput() = %q", processor.LastOutput())
+	}
+	if len(provider.prompts) != 3 {
+		t.Fatalf("expected 3 prompts, got %d", len(provider.prompts))
+	}
+	if !strings.Contains(provider.prompts[0], "JSON Schema") {
+		t.Errorf("action does not describe the schema: %q", provider.prompts[0])
+	}
+	if !strings.Contains(provider.prompts[1], "$.name: expected string, got number") {
+		t.Errorf("first repair prompt does not list the validation error: %q", provider.prompts[1])
+	}
+	if !strings.Contains(provider.prompts[2], "response is not valid JSON") {
+		t.Errorf("second repair prompt does not report invalid JSON: %q", provider.prompts[2])
+	}
+}
+
+func TestOutputSchemaRetriesExhausted(t *testing.T) {
+	retries := 1
+	_, provider, err := runSchemaStep(t, nameSchema, &retries, `{}`, `{"other": true}`)
+	if err == nil || !strings.Contains(err.Error(), `missing required property "name"`) {
+		t.Fatalf("expected schema error, got %v", err)
+	}
+	if len(provider.prompts) != 2 {
+		t.Errorf("expected 2 prompts, got %d", len(provider.prompts))
+	}
+}
+
+func TestOutputSchemaFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "person.yaml")
+	schema := "type: object\nrequired: [name]\nproperties:\n  name: {type: string}\n"
+	if err := os.WriteFile(path, []byte(schema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	processor, _, err := runSchemaStep(t, path, nil, `{"name": "Ada"}`)
+	if err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+	if processor.LastOutput() != `{"name": "Ada"}` {
+		t.Errorf("LastOutput() = %q", processor.LastOutput())
+	}
+}
+
+func TestValidateOutputSchema(t *testing.T) {
+	negative := -1
+	tests := []struct {
+		name    string
+		config  StepConfig
+		wantErr string
+	}{
+		{name: "inline", config: StepConfig{OutputSchema: nameSchema}},
+		{name: "file", config: StepConfig{OutputSchema: "schema.json"}},
+		{name: "list", config: StepConfig{OutputSchema: []interface{}{"a"}}, wantErr: "must be a JSON Schema"},
+		{name: "negative retries", config: StepConfig{OutputSchema: nameSchema, SchemaRetries: &negative}, wantErr: "must not be negative"},
+		{name: "retries without schema", config: StepConfig{SchemaRetries: &negative}, wantErr: "requires output_schema"},
+		{name: "model_strategy all", config: StepConfig{OutputSchema: nameSchema, ModelStrategy: ModelStrategyAll}, wantErr: "model_strategy: all"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOutputSchema(tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Outputs returns the values the workflow exports through its top-level outputs key.
+// Each export is read from a variable ($name), a step result (steps.name or
+// steps.name.field) or a file, and is resolved after the workflow has run.
+func (p *Processor) Outputs() (map[string]string, error) {
+	outputs := make(map[string]string)
+	if p.config == nil {
+		return outputs, nil
+	}
+	for _, name := range p.exportNames() {
+		value, err := p.resolveOutput(name)
+		if err != nil {
+			return nil, err
+		}
+		outputs[name] = value
+	}
+	return outputs, nil
+}
+
+// exportNames returns the names of the workflow's exports in sorted order
+func (p *Processor) exportNames() []string {
+	return sortedExportNames(p.config.Outputs)
+}
+
+// sortedExportNames returns the names of a workflow's outputs in sorted order
+func sortedExportNames(outputs map[string]string) []string {
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveOutput returns the value of a single export
+func (p *Processor) resolveOutput(name string) (string, error) {
+	source, ok := p.config.Outputs[name]
+	if !ok {
+		return "", fmt.Errorf("output '%s' is not declared", name)
+	}
+	source = strings.TrimSpace(source)
+
+	switch {
+	case strings.HasPrefix(source, "$"):
+		varName := strings.TrimPrefix(source, "$")
+		value, ok := p.variables[varName]
+		if !ok {
+			return "", fmt.Errorf("output '%s': variable $%s is not set", name, varName)
+		}
+		return value, nil
+
+	case strings.HasPrefix(source, "steps."):
+		stepName, field := strings.TrimPrefix(source, "steps."), "output"
+		if !p.hasStep(stepName) {
+			if i := strings.LastIndex(stepName, "."); i > 0 {
+				stepName, field = stepName[:i], stepName[i+1:]
+			}
+		}
+		result, err := p.completedStep(stepName)
+		if err != nil {
+			return "", fmt.Errorf("output '%s': %w", name, err)
+		}
+		value, ok := result.fields()[field]
+		if !ok {
+			return "", fmt.Errorf("output '%s': unknown field '%s' of step '%s'", name, field, stepName)
+		}
+		return value, nil
+
+	default:
+		content, err := os.ReadFile(p.resolveDataPath(source))
+		if err != nil {
+			return "", fmt.Errorf("output '%s': failed to read file '%s': %w", name, source, err)
+		}
+		return string(content), nil
+	}
+}
+
+// checkCaptureOutputs checks that a sub-workflow exports every name in the process step's
+// capture_outputs, so that a misspelt name fails before the sub-workflow runs
+func (p *Processor) checkCaptureOutputs(step Step, subConfig *DSLConfig) error {
+	for _, capture := range step.Config.Process.CaptureOutputs {
+		name, _ := p.parseVariableAssignment(strings.TrimSpace(capture))
+		if _, ok := subConfig.Outputs[name]; !ok {
+			declared := "none"
+			if len(subConfig.Outputs) > 0 {
+				declared = strings.Join(sortedExportNames(subConfig.Outputs), ", ")
+			}
+			return fmt.Errorf("sub-workflow '%s' does not export '%s' (exports: %s)",
+				step.Config.Process.WorkflowFile, name, declared)
+		}
+	}
+	return nil
+}
+
+// captureOutputs stores the exports of a finished sub-workflow in variables, as listed in
+// the process step's capture_outputs. "summary" stores the export in $summary, and
+// "summary as $report" stores it in $report. The names are checked by checkCaptureOutputs
+// before the sub-workflow runs.
+func (p *Processor) captureOutputs(step Step, sub *Processor) error {
+	for _, capture := range step.Config.Process.CaptureOutputs {
+		name, varName := p.parseVariableAssignment(strings.TrimSpace(capture))
+		if varName == "" {
+			varName = name
+		}
+		value, err := sub.resolveOutput(name)
+		if err != nil {
+			return fmt.Errorf("sub-workflow '%s': %w", step.Config.Process.WorkflowFile, err)
+		}
+		p.variables[varName] = value
+		p.debugf("Captured output '%s' of sub-workflow '%s' in $%s", name, step.Config.Process.WorkflowFile, varName)
+	}
+	return nil
+}
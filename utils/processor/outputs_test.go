@@ -0,0 +1,139 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSubWorkflow writes a sub-workflow that summarizes once and exports the given outputs
+func writeSubWorkflow(t *testing.T, dir, outputs string) string {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("some notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	content := `
+summarize:
+  input: NA
+  model: gpt-4o-mini
+  action: summarize
+  output: STDOUT as $summary_var
+
+outputs:
+` + outputs
+	path := filepath.Join(dir, "sub.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runProcessStep runs a parent workflow with a single process step capturing the given exports
+func runProcessStep(t *testing.T, workflowFile string, capture []string) (*Processor, *scriptedProvider, error) {
+	t.Helper()
+	provider := newScriptedProvider("the summary")
+	useScriptedProvider(t, provider)
+	dslConfig := &DSLConfig{Steps: []Step{{
+		Name: "run_sub",
+		Config: StepConfig{
+			Input:   "NA",
+			Process: &ProcessStepConfig{WorkflowFile: workflowFile, CaptureOutputs: capture},
+		},
+	}}}
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+	return processor, provider, processor.Process()
+}
+
+func TestCaptureOutputs(t *testing.T) {
+	dir := t.TempDir()
+	workflowFile := writeSubWorkflow(t, dir, `
+  summary: steps.summarize
+  model: steps.summarize.model
+  via_var: $summary_var
+  notes: `+filepath.Join(dir, "notes.txt")+`
+`)
+
+	processor, _, err := runProcessStep(t, workflowFile, []string{"summary", "model", "via_var as $copy", "notes"})
+	if err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+
+	want := map[string]string{
+		"summary": "the summary",
+		"model":   "gpt-4o-mini",
+		"copy":    "the summary",
+		"notes":   "some notes",
+	}
+	for name, value := range want {
+		if got := processor.variables[name]; got != value {
+			t.Errorf("$%s = %q, want %q", name, got, value)
+		}
+	}
+	if _, ok := processor.variables["summary_var"]; ok {
+		t.Error("variables of the sub-workflow should not leak into the parent")
+	}
+}
+
+func TestCaptureOutputsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		outputs string
+		capture []string
+		wantErr string
+		notRun  bool // The error is found before the sub-workflow runs
+	}{
+		{
+			name:    "undeclared export",
+			outputs: "  summary: steps.summarize\n",
+			capture: []string{"summary", "missing as $result"},
+			wantErr: "does not export 'missing' (exports: summary)",
+			notRun:  true,
+		},
+		{
+			name:    "unset variable",
+			outputs: "  result: $nope\n",
+			capture: []string{"result"},
+			wantErr: "output 'result': variable $nope is not set",
+		},
+		{
+			name:    "unknown step",
+			outputs: "  result: steps.other\n",
+			capture: []string{"result"},
+			wantErr: "output 'result': unknown step 'other'",
+		},
+		{
+			name:    "missing file",
+			outputs: "  result: missing.txt\n",
+			capture: []string{"result"},
+			wantErr: "output 'result': failed to read file 'missing.txt'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workflowFile := writeSubWorkflow(t, t.TempDir(), tt.outputs)
+			_, provider, err := runProcessStep(t, workflowFile, tt.capture)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Process() error = %v, want %q", err, tt.wantErr)
+			}
+			if tt.notRun && len(provider.prompts) > 0 {
+				t.Errorf("the sub-workflow ran %d prompts before the error", len(provider.prompts))
+			}
+		})
+	}
+}
+
+func TestParseDSLOutputs(t *testing.T) {
+	dslConfig, err := ParseDSL([]byte("outputs:\n  summary: steps.summarize\n  topic: $topic\n"))
+	if err != nil {
+		t.Fatalf("ParseDSL() error: %v", err)
+	}
+	if len(dslConfig.Steps) != 0 || dslConfig.Outputs["summary"] != "steps.summarize" || dslConfig.Outputs["topic"] != "$topic" {
+		t.Errorf("unexpected config: %+v", dslConfig)
+	}
+
+	if _, err := ParseDSL([]byte("outputs: [summary]\n")); err == nil {
+		t.Error("expected error for outputs that are not a mapping")
+	}
+}
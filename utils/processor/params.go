@@ -0,0 +1,168 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Parameter types accepted in the params section
+const (
+	ParamTypeString = "string"
+	ParamTypeInt    = "int"
+	ParamTypeNumber = "number"
+	ParamTypeBool   = "bool"
+)
+
+// ParamSpec declares a workflow parameter in the top-level params section:
+//
+//	params:
+//	  region:
+//	    type: string
+//	    required: true
+//	    description: Sales region to report on
+//	  max_items:
+//	    type: int
+//	    default: 10
+//	  tone: neutral   # shorthand for a string parameter with a default
+type ParamSpec struct {
+	Type        string      `yaml:"type"`        // string (default), int, number or bool
+	Default     interface{} `yaml:"default"`     // Value used when none is given
+	Required    bool        `yaml:"required"`    // A value must be given when there is no default
+	Description string      `yaml:"description"` // Shown in the configuration summary
+}
+
+// UnmarshalYAML accepts a full parameter definition or a scalar default value
+func (s *ParamSpec) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*s = ParamSpec{Type: ParamTypeString, Default: value.Value}
+		return nil
+	}
+	type plain ParamSpec
+	var spec plain
+	if err := value.Decode(&spec); err != nil {
+		return err
+	}
+	*s = ParamSpec(spec)
+	if s.Type == "" {
+		s.Type = ParamTypeString
+	}
+	return nil
+}
+
+// validateParams checks the types and defaults of the params section
+func validateParams(params map[string]ParamSpec) error {
+	for _, name := range sortedParamNames(params) {
+		spec := params[name]
+		switch spec.Type {
+		case ParamTypeString, ParamTypeInt, ParamTypeNumber, ParamTypeBool:
+		default:
+			return fmt.Errorf("parameter '%s': unknown type '%s': must be %s, %s, %s or %s",
+				name, spec.Type, ParamTypeString, ParamTypeInt, ParamTypeNumber, ParamTypeBool)
+		}
+		if spec.Default != nil {
+			if _, err := convertParam(spec.Type, fmt.Sprint(spec.Default)); err != nil {
+				return fmt.Errorf("parameter '%s': invalid default: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// convertParam checks a value against a parameter type and returns its canonical form
+func convertParam(paramType, value string) (string, error) {
+	switch paramType {
+	case ParamTypeString:
+		return value, nil
+	case ParamTypeInt:
+		if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			return strconv.Itoa(n), nil
+		}
+		// Whole numbers may be written with an exponent, as JSON numbers such as 1e+06 are
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return "", fmt.Errorf("expected an integer, got '%s'", value)
+		}
+		return strconv.Itoa(int(f)), nil
+	case ParamTypeNumber:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return "", fmt.Errorf("expected a number, got '%s'", value)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case ParamTypeBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("expected true or false, got '%s'", value)
+		}
+		return strconv.FormatBool(b), nil
+	default:
+		return "", fmt.Errorf("unknown type '%s'", paramType)
+	}
+}
+
+// sortedParamNames returns the names of the declared parameters in sorted order
+func sortedParamNames(params map[string]ParamSpec) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetParams checks values against the workflow's params section and stores them, or the
+// declared defaults, as variables. Values may be strings, as given with --set, or the
+// numbers and booleans of a params file or JSON request. Every problem is reported at once.
+func (p *Processor) SetParams(values map[string]interface{}) error {
+	var params map[string]ParamSpec
+	if p.config != nil {
+		params = p.config.Params
+	}
+
+	var errors []string
+	for name := range values {
+		if _, ok := params[name]; !ok {
+			errors = append(errors, fmt.Sprintf("unknown parameter '%s'", name))
+		}
+	}
+	sort.Strings(errors)
+	if len(errors) > 0 && len(params) > 0 {
+		errors = append(errors, fmt.Sprintf("declared parameters: %s", strings.Join(sortedParamNames(params), ", ")))
+	}
+
+	resolved := make(map[string]string, len(params))
+	for _, name := range sortedParamNames(params) {
+		spec := params[name]
+		value, ok := values[name]
+		if !ok || value == nil {
+			value = spec.Default
+		}
+		if value == nil {
+			if spec.Required {
+				errors = append(errors, fmt.Sprintf("missing required parameter '%s'", name))
+			}
+			resolved[name] = ""
+			continue
+		}
+		converted, err := convertParam(spec.Type, fmt.Sprint(value))
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("parameter '%s': %v", name, err))
+			continue
+		}
+		resolved[name] = converted
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("invalid workflow parameters: %s", strings.Join(errors, "; "))
+	}
+	for name, value := range resolved {
+		p.variables[name] = value
+		p.debugf("Set parameter %s=%s", name, value)
+	}
+	return nil
+}
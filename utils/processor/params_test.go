@@ -0,0 +1,129 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+)
+
+const paramsWorkflow = `
+params:
+  region:
+    type: string
+    required: true
+    description: Sales region
+  max_items:
+    type: int
+    default: 10
+  threshold:
+    type: number
+  verbose_report:
+    type: bool
+    default: false
+  tone: neutral
+
+report:
+  input: NA
+  model: gpt-4o-mini
+  action: "Report on $region"
+  output: STDOUT
+`
+
+func TestSetParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   map[string]interface{}
+		expected map[string]string
+		wantErr  []string
+	}{
+		{
+			name:   "defaults",
+			values: map[string]interface{}{"region": "emea"},
+			expected: map[string]string{
+				"region": "emea", "max_items": "10", "threshold": "", "verbose_report": "false", "tone": "neutral",
+			},
+		},
+		{
+			name:   "strings from --set are converted",
+			values: map[string]interface{}{"region": "apac", "max_items": " 25", "threshold": "0.50", "verbose_report": "TRUE"},
+			expected: map[string]string{
+				"region": "apac", "max_items": "25", "threshold": "0.5", "verbose_report": "true", "tone": "neutral",
+			},
+		},
+		{
+			name:   "JSON numbers and booleans",
+			values: map[string]interface{}{"region": "us", "max_items": float64(3), "verbose_report": true},
+			expected: map[string]string{
+				"region": "us", "max_items": "3", "threshold": "", "verbose_report": "true", "tone": "neutral",
+			},
+		},
+		{
+			name:   "exponent notation",
+			values: map[string]interface{}{"region": "us", "max_items": float64(1000000), "threshold": "1e3"},
+			expected: map[string]string{
+				"region": "us", "max_items": "1000000", "threshold": "1000", "verbose_report": "false", "tone": "neutral",
+			},
+		},
+		{
+			name:    "fractional integer",
+			values:  map[string]interface{}{"region": "us", "max_items": "2.5"},
+			wantErr: []string{"parameter 'max_items': expected an integer"},
+		},
+		{
+			name:    "every problem is reported",
+			values:  map[string]interface{}{"max_items": "many", "colour": "blue"},
+			wantErr: []string{"unknown parameter 'colour'", "missing required parameter 'region'", "parameter 'max_items': expected an integer"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dslConfig, err := ParseDSL([]byte(paramsWorkflow))
+			if err != nil {
+				t.Fatalf("ParseDSL() error: %v", err)
+			}
+			processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+
+			err = processor.SetParams(tt.values)
+			if len(tt.wantErr) > 0 {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("error %q does not contain %q", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetParams() error: %v", err)
+			}
+			for name, value := range tt.expected {
+				if got := processor.Variable(name); got != value {
+					t.Errorf("$%s = %q, want %q", name, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestParseDSLInvalidParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{name: "unknown type", yaml: "params:\n  n:\n    type: integer\n", wantErr: "unknown type 'integer'"},
+		{name: "bad default", yaml: "params:\n  n:\n    type: int\n    default: ten\n", wantErr: "invalid default"},
+		{name: "not a mapping", yaml: "params: [a, b]\n", wantErr: "invalid params"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseDSL([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseDSL() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
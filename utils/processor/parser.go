@@ -0,0 +1,166 @@
+package processor
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parallelGroupPrefix marks a top-level key whose steps run in parallel
+const parallelGroupPrefix = "parallel-"
+
+// stepFields holds the keys of a step definition, from the yaml tags of StepConfig
+var stepFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(StepConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ","); name != "" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// hasKeys reports whether a mapping node has any of the keys that match
+func hasKeys(node *yaml.Node, match func(key string) bool) bool {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if match(node.Content[i].Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// isParallelGroup reports whether a top-level workflow key defines a parallel group: its name
+// starts with parallel- and its value maps step names to step definitions. A value with the
+// keys of a step definition, such as that of a step named parallel-summary, is a step.
+func isParallelGroup(name string, value *yaml.Node) bool {
+	if !strings.HasPrefix(name, parallelGroupPrefix) {
+		return false
+	}
+	return value.Kind != yaml.MappingNode || !hasKeys(value, func(key string) bool { return stepFields[key] })
+}
+
+// checkReservedSection refuses a step named like the params or outputs section. Both
+// sections map names of the workflow's choosing, so a step is told apart by its model and
+// action, or its generate or process settings.
+func checkReservedSection(name string, value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return nil
+	}
+	has := func(key string) bool {
+		return hasKeys(value, func(k string) bool { return k == key })
+	}
+	if (has("model") && has("action")) || has("generate") || has("process") {
+		return fmt.Errorf("'%s' is reserved for the workflow's %s section and cannot name a step; rename the step", name, name)
+	}
+	return nil
+}
+
+// ParseDSL parses a workflow YAML document into a DSLConfig, preserving the
+// order in which steps and parallel groups appear in the file
+func ParseDSL(data []byte) (*DSLConfig, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, fmt.Errorf("error parsing YAML: %w", err)
+	}
+
+	dslConfig := &DSLConfig{
+		ParallelSteps: make(map[string][]Step),
+	}
+
+	// An empty document has no content
+	if len(node.Content) == 0 {
+		return dslConfig, nil
+	}
+
+	mapping := node.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("workflow must be a mapping of step names to step definitions")
+	}
+
+	// Each pair of nodes in the mapping represents a key and its value
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		name := mapping.Content[i].Value
+		value := mapping.Content[i+1]
+
+		// A scalar timeout applies to the whole workflow rather than defining a step
+		if name == "timeout" && value.Kind == yaml.ScalarNode {
+			if err := value.Decode(&dslConfig.Timeout); err != nil {
+				return nil, fmt.Errorf("invalid workflow timeout '%s': %w", value.Value, err)
+			}
+			continue
+		}
+
+		// A scalar max_cost is the budget of the whole run
+		if name == "max_cost" && value.Kind == yaml.ScalarNode {
+			if err := value.Decode(&dslConfig.MaxCost); err != nil || dslConfig.MaxCost <= 0 {
+				return nil, fmt.Errorf("invalid max_cost '%s': must be a positive amount in US dollars", value.Value)
+			}
+			continue
+		}
+
+		// A scalar template_syntax selects how templates in the workflow are rendered
+		if name == "template_syntax" && value.Kind == yaml.ScalarNode {
+			if err := validateTemplateSyntax(value.Value); err != nil {
+				return nil, err
+			}
+			dslConfig.TemplateSyntax = value.Value
+			continue
+		}
+
+		// params declares the workflow's parameters
+		if name == "params" {
+			if err := checkReservedSection(name, value); err != nil {
+				return nil, err
+			}
+			if err := value.Decode(&dslConfig.Params); err != nil {
+				return nil, fmt.Errorf("invalid params: %w", err)
+			}
+			if err := validateParams(dslConfig.Params); err != nil {
+				return nil, fmt.Errorf("invalid params: %w", err)
+			}
+			continue
+		}
+
+		// outputs declares the values a sub-workflow exports to its parent
+		if name == "outputs" {
+			if err := checkReservedSection(name, value); err != nil {
+				return nil, err
+			}
+			if err := value.Decode(&dslConfig.Outputs); err != nil {
+				return nil, fmt.Errorf("outputs must map export names to variables, step results or files: %w", err)
+			}
+			continue
+		}
+
+		if isParallelGroup(name, value) {
+			if value.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("parallel group '%s' must be a mapping of step names to step definitions", name)
+			}
+			var steps []Step
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				stepName := value.Content[j].Value
+				var config StepConfig
+				if err := value.Content[j+1].Decode(&config); err != nil {
+					return nil, fmt.Errorf("error decoding step '%s' in parallel group '%s': %w", stepName, name, err)
+				}
+				steps = append(steps, Step{Name: stepName, Config: config})
+			}
+			dslConfig.ParallelSteps[name] = steps
+			dslConfig.Order = append(dslConfig.Order, name)
+			continue
+		}
+
+		var config StepConfig
+		if err := value.Decode(&config); err != nil {
+			return nil, fmt.Errorf("error decoding step '%s': %w", name, err)
+		}
+		dslConfig.Steps = append(dslConfig.Steps, Step{Name: name, Config: config})
+		dslConfig.Order = append(dslConfig.Order, name)
+	}
+
+	return dslConfig, nil
+}
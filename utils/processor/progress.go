@@ -10,6 +10,7 @@ const (
 	ProgressError
 	ProgressOutput       // New type for output events
 	ProgressParallelStep // New type for parallel step updates
+	ProgressSkipped      // Step skipped because its when condition was false
 )
 
 // StepInfo contains detailed information about a processing step
@@ -30,6 +31,7 @@ type ProgressUpdate struct {
 	IsParallel         bool                // Whether this update is from a parallel step
 	ParallelID         string              // Identifier for the parallel step group
 	PerformanceMetrics *PerformanceMetrics // Performance metrics for the step
+	Usage              *UsageReport        // Token usage and cost of the step, sent when it completes
 }
 
 // ProgressWriter is an interface for handling progress updates
@@ -356,6 +356,16 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 
 	startTime := time.Now()
 
+	// Render templates in the instructions and actions
+	instructions, err := p.renderTemplate(step.Config.Instructions)
+	if err != nil {
+		return "", fmt.Errorf("instructions template error in step '%s': %w", step.Name, err)
+	}
+	step.Config.Instructions = instructions
+	if step.Config.Action, err = p.renderInSlice(step.Config.Action); err != nil {
+		return "", fmt.Errorf("action template error in step '%s': %w", step.Name, err)
+	}
+
 	// Send initial progress update
 	p.sendProgressUpdate(ProgressUpdate{
 		Type:       ProgressStep,
@@ -370,7 +380,7 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 	if len(modelNames) == 0 {
 		return "", fmt.Errorf("no model specified for openai-responses step")
 	}
-	modelName := modelNames[0]
+	modelName := p.envConfig.ResolveModel(modelNames[0])
 
 	// Get the OpenAI provider
 	provider := models.DetectProvider(modelName)
@@ -490,12 +500,26 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 		Instructions:       step.Config.Instructions,
 		PreviousResponseID: step.Config.PreviousResponseID,
 		MaxOutputTokens:    step.Config.MaxOutputTokens,
-		Temperature:        step.Config.Temperature,
-		TopP:               step.Config.TopP,
 		Stream:             step.Config.Stream,
 		Tools:              step.Config.Tools,
 	}
 
+	// Apply the step's model parameters, falling back to the model's defaults. The Responses
+	// API has no stop or seed parameters.
+	params := mergeModelParams(p.stepModelParams(&step), p.modelDefaults("openai", modelName))
+	if params.Temperature != nil {
+		config.Temperature = *params.Temperature
+	}
+	if params.TopP != nil {
+		config.TopP = *params.TopP
+	}
+	if config.MaxOutputTokens == 0 && params.MaxTokens != nil {
+		config.MaxOutputTokens = *params.MaxTokens
+	}
+	if config.Instructions == "" {
+		config.Instructions = params.System
+	}
+
 	// Log the configuration details for debugging
 	p.debugf("ResponsesConfig details:")
 	p.debugf("- Model: %s", config.Model)
@@ -537,8 +561,13 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 		ParallelID: parallelID,
 	})
 
+	// Stop before the call if it would exceed the budget, and record its usage
+	if err := p.usage.checkBudget(modelName, models.EstimateTokens(modelName, config.Instructions+prompt)); err != nil {
+		return "", err
+	}
+	ctx := p.usageContext(p.ctx, step.Name)
+
 	var response string
-	var err error
 
 	// Check if streaming is enabled
 	if step.Config.Stream {
@@ -557,7 +586,7 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 		}
 
 		// Send the request with streaming
-		err = responsesProvider.SendPromptWithResponsesStream(config, streamHandler)
+		err = responsesProvider.SendPromptWithResponsesStream(ctx, config, streamHandler)
 		if err != nil {
 			return "", fmt.Errorf("streaming error: %w", err)
 		}
@@ -565,7 +594,9 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 		response = responseBuffer.String()
 	} else {
 		// Non-streaming path
-		response, err = responsesProvider.SendPromptWithResponses(config)
+		response, err = p.withRetry(ctx, step.Name, step.Config.Retry, func() (string, error) {
+			return responsesProvider.SendPromptWithResponses(ctx, config)
+		})
 		if err != nil {
 			return "", err
 		}
@@ -575,9 +606,11 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 		if err == nil && responseID != "" {
 			// Store in variables map
 			p.variables[step.Name+".response_id"] = responseID
+			p.lastResponse = responseID
 			p.debugf("[%s] Stored response ID: %s", step.Name, responseID)
 		}
 	}
+	p.lastModel = modelName
 
 	// Calculate performance metrics
 	elapsedTime := time.Since(startTime)
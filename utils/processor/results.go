@@ -0,0 +1,180 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StepResult records the outcome of a completed step. Results are kept for every step of
+// the workflow, so later steps can read any earlier step's output by name.
+type StepResult struct {
+	Name       string
+	Output     string
+	Model      string        // Model that produced the output; a comma separated list for model_strategy: all
+	StartedAt  time.Time     // When the step started
+	Duration   time.Duration // How long the step took
+	ResponseID string        // Response ID of openai-responses steps
+	Skipped    bool          // The step's when condition was false, so its input was passed through
+	Restored   bool          // The result was restored from a checkpoint
+}
+
+// fields returns the result's values by the names used in templates and references
+func (r *StepResult) fields() map[string]string {
+	return map[string]string{
+		"output":      r.Output,
+		"model":       r.Model,
+		"started_at":  r.StartedAt.Format(time.RFC3339),
+		"duration_ms": strconv.FormatInt(r.Duration.Milliseconds(), 10),
+		"response_id": r.ResponseID,
+		"skipped":     strconv.FormatBool(r.Skipped),
+	}
+}
+
+// StepResult returns the result of a completed step
+func (p *Processor) StepResult(name string) (*StepResult, bool) {
+	result, ok := p.stepResults[name]
+	return result, ok
+}
+
+// hasStep reports whether the workflow defines a step with the given name
+func (p *Processor) hasStep(name string) bool {
+	if p.config == nil {
+		return false
+	}
+	for _, step := range p.config.Steps {
+		if step.Name == name {
+			return true
+		}
+	}
+	for _, steps := range p.config.ParallelSteps {
+		for _, step := range steps {
+			if step.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stepInputReference returns the step named by an input of the form steps.<name> or
+// steps.<name>.output. Inputs naming a step the workflow does not define are treated as files.
+func (p *Processor) stepInputReference(input string) (string, bool) {
+	input, _ = p.parseVariableAssignment(input)
+	if !strings.HasPrefix(input, "steps.") {
+		return "", false
+	}
+	name := strings.TrimPrefix(input, "steps.")
+	if !p.hasStep(name) {
+		name = strings.TrimSuffix(name, ".output")
+	}
+	if !p.hasStep(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// referencedSteps returns the steps whose results a step refers to in its inputs, actions or outputs
+func (p *Processor) referencedSteps(config StepConfig) []string {
+	var names []string
+	if _, isMap := config.Input.(map[string]interface{}); !isMap {
+		for _, input := range p.NormalizeStringSlice(config.Input) {
+			if name, ok := p.stepInputReference(input); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	texts := append(p.NormalizeStringSlice(config.Action), p.NormalizeStringSlice(config.Output)...)
+	texts = append(texts, p.NormalizeStringSlice(config.ReduceAction)...)
+	for _, text := range texts {
+		for _, match := range stepReferencePattern.FindAllStringSubmatch(text, -1) {
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// resolveStepInputs replaces inputs that reference an earlier step's output with temporary
+// files holding that output. The returned function removes the temporary files.
+func (p *Processor) resolveStepInputs(inputs []string) ([]string, func(), error) {
+	var tmpPaths []string
+	cleanup := func() {
+		for _, path := range tmpPaths {
+			os.Remove(path)
+		}
+	}
+
+	resolved := make([]string, len(inputs))
+	for i, input := range inputs {
+		name, ok := p.stepInputReference(input)
+		if !ok {
+			resolved[i] = input
+			continue
+		}
+		result, err := p.completedStep(name)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+
+		// Store the output in a variable when the input uses "as $name"
+		if _, varName := p.parseVariableAssignment(input); varName != "" {
+			p.variables[varName] = result.Output
+		}
+
+		tmpFile, err := os.CreateTemp("", "comanda-step-*.txt")
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to create temp file for output of step '%s': %w", name, err)
+		}
+		tmpPaths = append(tmpPaths, tmpFile.Name())
+		_, err = tmpFile.WriteString(result.Output)
+		tmpFile.Close()
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to write output of step '%s': %w", name, err)
+		}
+		p.debugf("Using output of step '%s' as input from %s", name, tmpFile.Name())
+		resolved[i] = tmpFile.Name()
+	}
+	return resolved, cleanup, nil
+}
+
+// completedStep returns the result of a step, or an error explaining why there is none
+func (p *Processor) completedStep(name string) (*StepResult, error) {
+	if result, ok := p.stepResults[name]; ok {
+		return result, nil
+	}
+	if p.hasStep(name) {
+		return nil, fmt.Errorf("step '%s' has not completed yet; add it to depends_on", name)
+	}
+	return nil, fmt.Errorf("unknown step '%s'", name)
+}
+
+// stepReferencePattern matches ${steps.<name>.<field>} references
+var stepReferencePattern = regexp.MustCompile(`\$\{steps\.([^}\s]+)\.([a-z_]+)\}`)
+
+// substituteStepReferences replaces ${steps.<name>.<field>} references with the field of
+// the named step's result, e.g. ${steps.summarize.output} or ${steps.summarize.model}
+func (p *Processor) substituteStepReferences(text string) (string, error) {
+	var firstErr error
+	text = stepReferencePattern.ReplaceAllStringFunc(text, func(ref string) string {
+		match := stepReferencePattern.FindStringSubmatch(ref)
+		result, err := p.completedStep(match[1])
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", ref, err)
+			}
+			return ref
+		}
+		value, ok := result.fields()[match[2]]
+		if !ok && firstErr == nil {
+			firstErr = fmt.Errorf("%s: unknown field '%s'", ref, match[2])
+		}
+		return value
+	})
+	return text, firstErr
+}
@@ -0,0 +1,115 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+)
+
+// resultsWorkflow runs two independent steps and a third that reads both by name
+func resultsWorkflow(finalInput, finalAction string) *DSLConfig {
+	return &DSLConfig{Steps: []Step{
+		{Name: "extract", Config: StepConfig{Input: "NA", Model: "gpt-4o-mini", Action: "extract entities", Output: "STDOUT"}},
+		{Name: "summarize", Config: StepConfig{Input: "NA", Model: "gpt-4o-mini", Action: "summarize", Output: "STDOUT"}},
+		{Name: "report", Config: StepConfig{Input: finalInput, Model: "gpt-4o-mini", Action: finalAction, Output: "STDOUT"}},
+	}}
+}
+
+func TestStepInputReference(t *testing.T) {
+	processor := NewProcessor(resultsWorkflow("NA", "report"), createTestEnvConfig(), createTestServerConfig(), false, "")
+
+	tests := []struct {
+		input    string
+		wantName string
+		wantOK   bool
+	}{
+		{input: "steps.extract", wantName: "extract", wantOK: true},
+		{input: "steps.extract.output", wantName: "extract", wantOK: true},
+		{input: "steps.extract as $entities", wantName: "extract", wantOK: true},
+		{input: "steps.unknown", wantOK: false},
+		{input: "steps.txt", wantOK: false},
+		{input: "extract", wantOK: false},
+		{input: "STDIN", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			name, ok := processor.stepInputReference(tt.input)
+			if ok != tt.wantOK || name != tt.wantName {
+				t.Errorf("stepInputReference(%q) = %q, %v, want %q, %v", tt.input, name, ok, tt.wantName, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestStepResultsAddressableByName(t *testing.T) {
+	provider := newScriptedProvider("Ada, London", "A short summary", "report")
+	useScriptedProvider(t, provider)
+
+	dslConfig := resultsWorkflow("steps.extract as $entities",
+		"Entities: $entities. Summary: ${steps.summarize.output} (by ${steps.summarize.model})")
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+	if err := processor.Process(); err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+
+	want := "Entities: Ada, London. Summary: A short summary (by gpt-4o-mini)"
+	if len(provider.prompts) != 3 || provider.prompts[2] != want {
+		t.Fatalf("report prompt = %q, want %q", provider.prompts, want)
+	}
+
+	result, ok := processor.StepResult("extract")
+	if !ok {
+		t.Fatal("StepResult(\"extract\") not found")
+	}
+	if result.Output != "Ada, London" || result.Model != "gpt-4o-mini" || result.StartedAt.IsZero() {
+		t.Errorf("unexpected result for extract: %+v", result)
+	}
+	if _, ok := processor.StepResult("missing"); ok {
+		t.Error("StepResult(\"missing\") should not be found")
+	}
+}
+
+func TestStepReferenceAddsDependency(t *testing.T) {
+	// Neither step lists depends_on, but the second must still wait for the first
+	dslConfig := &DSLConfig{Steps: []Step{
+		newGraphTestStep("first", "NA", "STDOUT", []interface{}{}),
+		newGraphTestStep("second", "steps.first", "STDOUT", []interface{}{}),
+		{Name: "third", Config: StepConfig{Input: "NA", Model: "gpt-4o-mini", Action: "use ${steps.first.output}", Output: "STDOUT", DependsOn: []interface{}{}}},
+	}}
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+
+	graph, err := processor.buildExecutionGraph()
+	if err != nil {
+		t.Fatalf("buildExecutionGraph() error: %v", err)
+	}
+	for _, name := range []string{"second", "third"} {
+		deps := graph.byName[name].dependsOn
+		if len(deps) != 1 || deps[0] != "first" {
+			t.Errorf("%s depends on %v, want [first]", name, deps)
+		}
+	}
+}
+
+func TestStepReferenceErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{name: "unknown step", text: "${steps.missing.output}", wantErr: "unknown step 'missing'"},
+		{name: "not completed", text: "${steps.report.output}", wantErr: "has not completed yet"},
+		{name: "unknown field", text: "${steps.extract.tokens}", wantErr: "unknown field 'tokens'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := NewProcessor(resultsWorkflow("NA", "report"), createTestEnvConfig(), createTestServerConfig(), false, "")
+			processor.stepResults["extract"] = &StepResult{Name: "extract", Output: "entities"}
+
+			_, err := processor.renderTemplate(tt.text)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("renderTemplate(%q) error = %v, want %q", tt.text, err, tt.wantErr)
+			}
+		})
+	}
+}
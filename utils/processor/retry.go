@@ -0,0 +1,224 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// Defaults for retry blocks that leave fields unset
+const (
+	defaultRetryMaxAttempts  = 3
+	defaultRetryInitialDelay = time.Second
+	defaultRetryMaxDelay     = 30 * time.Second
+	defaultRetryMultiplier   = 2.0
+)
+
+// RetryConfig describes how a step retries failed model calls:
+//
+//	retry:
+//	  max_attempts: 4         # total attempts, including the first
+//	  initial_delay: 2s       # delay before the first retry
+//	  max_delay: 1m           # upper bound for any delay
+//	  multiplier: 2           # growth factor between delays
+//	  jitter: true            # randomize delays to avoid synchronized retries
+//	  retry_on: [rate_limit, overloaded]
+type RetryConfig struct {
+	MaxAttempts  int           `yaml:"max_attempts"`  // Total attempts including the first (default 3)
+	InitialDelay time.Duration `yaml:"initial_delay"` // Delay before the first retry (default 1s)
+	MaxDelay     time.Duration `yaml:"max_delay"`     // Maximum delay between attempts (default 30s)
+	Multiplier   float64       `yaml:"multiplier"`    // Backoff growth factor (default 2)
+	Jitter       *bool         `yaml:"jitter"`        // Randomize delays (default true)
+	RetryOn      []string      `yaml:"retry_on"`      // Error kinds to retry (default: rate_limit, overloaded, timeout, network)
+}
+
+// validateRetryConfig checks a retry block for invalid values
+func validateRetryConfig(cfg *RetryConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.MaxAttempts < 0 {
+		return fmt.Errorf("retry max_attempts must not be negative")
+	}
+	if cfg.InitialDelay < 0 || cfg.MaxDelay < 0 {
+		return fmt.Errorf("retry delays must not be negative")
+	}
+	if cfg.Multiplier != 0 && cfg.Multiplier < 1 {
+		return fmt.Errorf("retry multiplier must be at least 1")
+	}
+	for _, kind := range cfg.RetryOn {
+		if _, err := models.ParseErrorKind(kind); err != nil {
+			return fmt.Errorf("retry_on: %w", err)
+		}
+	}
+	return nil
+}
+
+// maxAttempts returns the configured number of attempts, applying the default
+func (cfg *RetryConfig) maxAttempts() int {
+	if cfg.MaxAttempts == 0 {
+		return defaultRetryMaxAttempts
+	}
+	return cfg.MaxAttempts
+}
+
+// shouldRetry reports whether an error is retryable under this configuration
+func (cfg *RetryConfig) shouldRetry(err error) bool {
+	if len(cfg.RetryOn) == 0 {
+		return models.IsRetryable(err)
+	}
+	kind := models.ErrorKindOf(err)
+	for _, name := range cfg.RetryOn {
+		if k, err := models.ParseErrorKind(name); err == nil && k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait before the given retry (1 for the first retry).
+// A delay requested by the provider, such as a Retry-After header, takes precedence
+// when it is longer than the computed backoff.
+func (cfg *RetryConfig) delay(retry int, err error) time.Duration {
+	initial := cfg.InitialDelay
+	if initial == 0 {
+		initial = defaultRetryInitialDelay
+	}
+	maxDelay := cfg.MaxDelay
+	if maxDelay == 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	multiplier := cfg.Multiplier
+	if multiplier == 0 {
+		multiplier = defaultRetryMultiplier
+	}
+
+	d := time.Duration(float64(initial) * math.Pow(multiplier, float64(retry-1)))
+	if d > maxDelay || d < 0 {
+		d = maxDelay
+	}
+	// Equal jitter: keep half of the delay and randomize the rest
+	if (cfg.Jitter == nil || *cfg.Jitter) && d > 1 {
+		half := d / 2
+		d = half + time.Duration(rand.Int63n(int64(half)+1))
+	}
+	if requested := models.RetryAfterOf(err); requested > d {
+		d = requested
+	}
+	return d
+}
+
+// withRetry runs call, retrying retryable failures according to the step's retry block.
+// Without a retry block the call runs once. Retries stop as soon as ctx is done.
+func (p *Processor) withRetry(ctx context.Context, stepName string, cfg *RetryConfig, call func() (string, error)) (string, error) {
+	if cfg == nil {
+		return call()
+	}
+
+	attempts := cfg.maxAttempts()
+	for attempt := 1; ; attempt++ {
+		result, err := call()
+		if err == nil {
+			return result, nil
+		}
+		if attempt >= attempts || !cfg.shouldRetry(err) || ctx.Err() != nil {
+			if attempt > 1 {
+				return "", fmt.Errorf("failed after %d attempts: %w", attempt, err)
+			}
+			return "", err
+		}
+
+		wait := cfg.delay(attempt, err)
+		p.debugf("Step '%s' attempt %d/%d failed with %s error, retrying in %v: %v",
+			stepName, attempt, attempts, models.ErrorKindOf(err), wait, err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return "", fmt.Errorf("%w (retry interrupted: %v)", err, ctx.Err())
+		}
+	}
+}
+
+// retryingProvider applies a step's retry block to every prompt sent through a provider
+type retryingProvider struct {
+	models.Provider
+	processor *Processor
+	stepName  string
+	config    *RetryConfig
+}
+
+// SendPrompt sends a prompt, retrying retryable failures
+func (r *retryingProvider) SendPrompt(ctx context.Context, modelName string, prompt string) (string, error) {
+	return r.processor.withRetry(ctx, r.stepName, r.config, func() (string, error) {
+		return r.Provider.SendPrompt(ctx, modelName, prompt)
+	})
+}
+
+// SendPromptStream streams a prompt, retrying retryable failures until part of the response
+// has been streamed. A retry would then repeat what was already written.
+func (r *retryingProvider) SendPromptStream(ctx context.Context, modelName string, prompt string, onDelta func(delta string)) (string, error) {
+	streamed := false
+	return r.processor.withRetry(ctx, r.stepName, r.config, func() (string, error) {
+		response, err := models.SendPromptStream(ctx, r.Provider, modelName, prompt, func(delta string) {
+			streamed = true
+			onDelta(delta)
+		})
+		if err != nil && streamed {
+			return "", fmt.Errorf("stream interrupted: %v", err)
+		}
+		return response, err
+	})
+}
+
+// SendPromptWithFile sends a prompt with a file, retrying retryable failures
+func (r *retryingProvider) SendPromptWithFile(ctx context.Context, modelName string, prompt string, file models.FileInput) (string, error) {
+	return r.processor.withRetry(ctx, r.stepName, r.config, func() (string, error) {
+		return r.Provider.SendPromptWithFile(ctx, modelName, prompt, file)
+	})
+}
+
+// SendMessages sends a conversation, retrying retryable failures
+func (r *retryingProvider) SendMessages(ctx context.Context, modelName string, messages []models.Message) (string, error) {
+	return r.processor.withRetry(ctx, r.stepName, r.config, func() (string, error) {
+		return r.Provider.SendMessages(ctx, modelName, messages)
+	})
+}
+
+// SendMessagesWithTools sends a conversation with tools, retrying retryable failures
+func (r *retryingProvider) SendMessagesWithTools(ctx context.Context, modelName string, messages []models.Message, tools []models.Tool) (models.Message, error) {
+	var reply models.Message
+	_, err := r.processor.withRetry(ctx, r.stepName, r.config, func() (string, error) {
+		var err error
+		reply, err = r.Provider.SendMessagesWithTools(ctx, modelName, messages, tools)
+		return reply.Content, err
+	})
+	return reply, err
+}
+
+// Embed embeds texts, retrying retryable failures
+func (r *retryingProvider) Embed(ctx context.Context, modelName string, texts []string) ([][]float32, error) {
+	var embeddings [][]float32
+	_, err := r.processor.withRetry(ctx, r.stepName, r.config, func() (string, error) {
+		var err error
+		embeddings, err = models.Embed(ctx, r.Provider, modelName, texts)
+		return "", err
+	})
+	return embeddings, err
+}
+
+// withStepRetry wraps a provider so that calls made for the current step follow its retry block
+func (p *Processor) withStepRetry(provider models.Provider) models.Provider {
+	if p.currentStep == nil || p.currentStep.Config.Retry == nil {
+		return provider
+	}
+	return &retryingProvider{
+		Provider:  provider,
+		processor: p,
+		stepName:  p.currentStep.Name,
+		config:    p.currentStep.Config.Retry,
+	}
+}
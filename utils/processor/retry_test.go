@@ -0,0 +1,152 @@
+package processor
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/models"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRetryConfigUnmarshalYAML(t *testing.T) {
+	var step StepConfig
+	yamlContent := `
+retry:
+  max_attempts: 5
+  initial_delay: 500ms
+  max_delay: 1m
+  multiplier: 3
+  jitter: false
+  retry_on: [rate_limit, overloaded]
+`
+	if err := yaml.Unmarshal([]byte(yamlContent), &step); err != nil {
+		t.Fatalf("yaml.Unmarshal returned unexpected error: %v", err)
+	}
+	cfg := step.Retry
+	if cfg == nil {
+		t.Fatal("expected retry to be set")
+	}
+	if cfg.MaxAttempts != 5 || cfg.InitialDelay != 500*time.Millisecond || cfg.MaxDelay != time.Minute || cfg.Multiplier != 3 {
+		t.Errorf("unexpected retry config: %+v", cfg)
+	}
+	if cfg.Jitter == nil || *cfg.Jitter {
+		t.Error("expected jitter to be disabled")
+	}
+	if err := validateRetryConfig(cfg); err != nil {
+		t.Errorf("validateRetryConfig returned unexpected error: %v", err)
+	}
+}
+
+func TestValidateRetryConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config RetryConfig
+	}{
+		{"negative attempts", RetryConfig{MaxAttempts: -1}},
+		{"negative delay", RetryConfig{InitialDelay: -time.Second}},
+		{"multiplier below one", RetryConfig{Multiplier: 0.5}},
+		{"unknown error kind", RetryConfig{RetryOn: []string{"sometimes"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRetryConfig(&tt.config); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	noJitter := false
+	cfg := &RetryConfig{InitialDelay: time.Second, MaxDelay: 5 * time.Second, Jitter: &noJitter}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		if got := cfg.delay(i+1, errors.New("boom")); got != want {
+			t.Errorf("delay(%d) = %v, want %v", i+1, got, want)
+		}
+	}
+
+	// A longer Retry-After from the provider wins over the computed backoff
+	rateLimited := &models.ProviderError{Provider: "openai", Kind: models.ErrorRateLimit, RetryAfter: 10 * time.Second}
+	if got := cfg.delay(1, rateLimited); got != 10*time.Second {
+		t.Errorf("delay with Retry-After = %v, want 10s", got)
+	}
+
+	jittered := &RetryConfig{InitialDelay: time.Second}
+	for i := 0; i < 20; i++ {
+		if got := jittered.delay(1, nil); got < 500*time.Millisecond || got > time.Second {
+			t.Fatalf("jittered delay %v outside [500ms, 1s]", got)
+		}
+	}
+}
+
+func runRetryStep(t *testing.T, provider *scriptedProvider, retry *RetryConfig) (*Processor, error) {
+	t.Helper()
+	useScriptedProvider(t, provider)
+	dslConfig := &DSLConfig{
+		Steps: []Step{
+			{
+				Name: "flaky",
+				Config: StepConfig{
+					Input:  "NA",
+					Model:  "gpt-4o-mini",
+					Action: "say hello",
+					Output: "STDOUT",
+					Retry:  retry,
+				},
+			},
+		},
+	}
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+	return processor, processor.Process()
+}
+
+func TestStepRetry(t *testing.T) {
+	rateLimited := &models.ProviderError{Provider: "openai", Kind: models.ErrorRateLimit, StatusCode: http.StatusTooManyRequests}
+	overloaded := &models.ProviderError{Provider: "openai", Kind: models.ErrorOverloaded, StatusCode: http.StatusServiceUnavailable}
+	unauthorized := &models.ProviderError{Provider: "openai", Kind: models.ErrorAuth, StatusCode: http.StatusUnauthorized}
+	fastRetry := &RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond}
+
+	tests := []struct {
+		name      string
+		errs      []error
+		retry     *RetryConfig
+		wantCalls int
+		wantErr   string
+	}{
+		{"retryable errors then success", []error{rateLimited, overloaded}, fastRetry, 3, ""},
+		{"attempts exhausted", []error{rateLimited, rateLimited, rateLimited}, fastRetry, 3, "failed after 3 attempts"},
+		{"fatal error is not retried", []error{unauthorized}, fastRetry, 1, "auth"},
+		{"no retry block", []error{rateLimited}, nil, 1, "rate_limit"},
+		{"retry_on limits kinds", []error{overloaded}, &RetryConfig{InitialDelay: time.Millisecond, RetryOn: []string{"rate_limit"}}, 1, "overloaded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newScriptedProvider("hello", "hello", "hello")
+			provider.errs = tt.errs
+
+			processor, err := runRetryStep(t, provider, tt.retry)
+			if len(provider.prompts) != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, len(provider.prompts))
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Process() returned unexpected error: %v", err)
+				}
+				if processor.LastOutput() != "hello" {
+					t.Errorf("LastOutput() = %q, want %q", processor.LastOutput(), "hello")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,488 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// scheduledStep is a node of the execution graph
+type scheduledStep struct {
+	step      Step
+	group     string   // Parallel group the step belongs to, empty for top-level steps
+	index     int      // Position of the step in file order
+	dependsOn []string // Names of the steps that must complete first
+}
+
+// executionGraph holds the steps of a workflow and the edges between them
+type executionGraph struct {
+	steps      []*scheduledStep
+	byName     map[string]*scheduledStep
+	dependents map[string][]string
+}
+
+// executionUnit is a top-level entry of the workflow: a single step or a parallel group
+type executionUnit struct {
+	name  string
+	group bool
+	steps []Step
+}
+
+// executionUnits returns the top-level steps and parallel groups in file order.
+// Configurations built without ParseDSL have no order; for those, parallel groups
+// run first followed by the sequential steps, as they always have.
+func (p *Processor) executionUnits() ([]executionUnit, error) {
+	order := p.config.Order
+	if len(order) == 0 {
+		var groups []string
+		for name := range p.config.ParallelSteps {
+			groups = append(groups, name)
+		}
+		sort.Strings(groups)
+		order = append(order, groups...)
+		for _, step := range p.config.Steps {
+			order = append(order, step.Name)
+		}
+	}
+
+	stepsByName := make(map[string]Step, len(p.config.Steps))
+	for _, step := range p.config.Steps {
+		stepsByName[step.Name] = step
+	}
+
+	var units []executionUnit
+	for _, name := range order {
+		if steps, ok := p.config.ParallelSteps[name]; ok {
+			units = append(units, executionUnit{name: name, group: true, steps: steps})
+			continue
+		}
+		step, ok := stepsByName[name]
+		if !ok {
+			return nil, fmt.Errorf("step '%s' listed in workflow order is not defined", name)
+		}
+		units = append(units, executionUnit{name: name, steps: []Step{step}})
+	}
+	return units, nil
+}
+
+// inputFiles returns the file inputs of a step with any variable aliases removed
+func (p *Processor) inputFiles(config StepConfig) []string {
+	if _, isMap := config.Input.(map[string]interface{}); isMap {
+		return nil
+	}
+	var files []string
+	for _, input := range p.NormalizeStringSlice(config.Input) {
+		input, _ = p.parseVariableAssignment(input)
+		if input == "" || input == "NA" || input == "STDIN" {
+			continue
+		}
+		if _, ok := p.stepInputReference(input); ok {
+			continue
+		}
+		files = append(files, input)
+	}
+	return files
+}
+
+// buildExecutionGraph builds the dependency graph of the workflow.
+//
+// A step depends on:
+//   - the steps listed in its depends_on field, which may also name a parallel group;
+//   - any earlier step that writes a file the step reads;
+//   - any step whose result it refers to with steps.<name> or ${steps.<name>.<field>};
+//   - the previous step of the same conversation, so its turns are added in file order;
+//   - the previous top-level entry, if the step has no depends_on field. This keeps
+//     workflows without depends_on running in file order.
+func (p *Processor) buildExecutionGraph() (*executionGraph, error) {
+	units, err := p.executionUnits()
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &executionGraph{
+		byName:     make(map[string]*scheduledStep),
+		dependents: make(map[string][]string),
+	}
+	groupMembers := make(map[string][]string)
+
+	for _, unit := range units {
+		for _, step := range unit.steps {
+			if _, exists := graph.byName[step.Name]; exists {
+				return nil, fmt.Errorf("step name '%s' is used more than once", step.Name)
+			}
+			node := &scheduledStep{step: step, index: len(graph.steps)}
+			if unit.group {
+				node.group = unit.name
+				groupMembers[unit.name] = append(groupMembers[unit.name], step.Name)
+			}
+			graph.steps = append(graph.steps, node)
+			graph.byName[step.Name] = node
+		}
+	}
+
+	outputFiles := make(map[string]string)   // file -> producing step
+	conversations := make(map[string]string) // conversation -> its latest step
+	var previous []string                    // steps of the previous top-level entry
+	position := 0
+	for _, unit := range units {
+		var unitSteps []string
+		for range unit.steps {
+			node := graph.steps[position]
+			position++
+			deps := make(map[string]bool)
+
+			if node.step.Config.DependsOn == nil {
+				for _, name := range previous {
+					deps[name] = true
+				}
+			} else {
+				for _, name := range p.NormalizeStringSlice(node.step.Config.DependsOn) {
+					if members, ok := groupMembers[name]; ok {
+						for _, member := range members {
+							deps[member] = true
+						}
+						continue
+					}
+					if _, ok := graph.byName[name]; !ok {
+						return nil, fmt.Errorf("step '%s' depends on unknown step '%s'", node.step.Name, name)
+					}
+					deps[name] = true
+				}
+			}
+
+			for _, file := range p.inputFiles(node.step.Config) {
+				if producer, ok := outputFiles[file]; ok {
+					deps[producer] = true
+				}
+			}
+
+			for _, name := range p.referencedSteps(node.step.Config) {
+				if _, ok := graph.byName[name]; ok {
+					deps[name] = true
+				}
+			}
+
+			if id := node.step.Config.Conversation; id != "" {
+				if last, ok := conversations[id]; ok {
+					if node.group != "" && graph.byName[last].group == node.group {
+						return nil, fmt.Errorf("parallel steps '%s' and '%s' of group '%s' cannot share conversation '%s'",
+							last, node.step.Name, node.group, id)
+					}
+					deps[last] = true
+				}
+				conversations[id] = node.step.Name
+			}
+
+			delete(deps, node.step.Name)
+			for name := range deps {
+				if node.group != "" && graph.byName[name].group == node.group {
+					return nil, fmt.Errorf("parallel step '%s' cannot depend on step '%s' from the same parallel group '%s'",
+						node.step.Name, name, node.group)
+				}
+				node.dependsOn = append(node.dependsOn, name)
+				graph.dependents[name] = append(graph.dependents[name], node.step.Name)
+			}
+			sort.Slice(node.dependsOn, func(i, j int) bool {
+				return graph.byName[node.dependsOn[i]].index < graph.byName[node.dependsOn[j]].index
+			})
+			unitSteps = append(unitSteps, node.step.Name)
+		}
+
+		// Outputs become visible to later entries only, so steps of the same group stay independent
+		for _, name := range unitSteps {
+			for _, output := range p.NormalizeStringSlice(graph.byName[name].step.Config.Output) {
+				output, _ = p.parseVariableAssignment(output)
+				if output != "STDOUT" && output != "" {
+					outputFiles[output] = name
+				}
+			}
+		}
+		previous = unitSteps
+	}
+
+	for name := range graph.dependents {
+		sort.Slice(graph.dependents[name], func(i, j int) bool {
+			return graph.byName[graph.dependents[name][i]].index < graph.byName[graph.dependents[name][j]].index
+		})
+	}
+
+	if err := graph.checkCycles(); err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
+
+// checkCycles verifies that every step can be scheduled
+func (g *executionGraph) checkCycles() error {
+	indegree := make(map[string]int, len(g.steps))
+	var ready []string
+	for _, node := range g.steps {
+		indegree[node.step.Name] = len(node.dependsOn)
+		if len(node.dependsOn) == 0 {
+			ready = append(ready, node.step.Name)
+		}
+	}
+
+	visited := 0
+	for len(ready) > 0 {
+		name := ready[0]
+		ready = ready[1:]
+		visited++
+		for _, dependent := range g.dependents[name] {
+			indegree[dependent]--
+			if indegree[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if visited == len(g.steps) {
+		return nil
+	}
+	var blocked []string
+	for _, node := range g.steps {
+		if indegree[node.step.Name] > 0 {
+			blocked = append(blocked, node.step.Name)
+		}
+	}
+	return fmt.Errorf("circular dependency detected between steps: %s", strings.Join(blocked, ", "))
+}
+
+// scheduledResult is the outcome of running one node of the graph
+type scheduledResult struct {
+	node      *scheduledStep
+	step      *StepResult
+	variables map[string]string // Variables set or changed by the step
+	written   []string          // Files written by the step
+	turns     []models.Message  // Messages the step added to its conversation
+	hash      string            // Checkpoint hash of the step, empty if it cannot be checkpointed
+	restored  bool              // The result was restored from a checkpoint rather than run
+	err       error
+}
+
+// runGraph executes the workflow, running every step as soon as its dependencies
+// have completed. Independent steps run concurrently, each on its own fork of the
+// processor, while the scheduling state is only touched by the calling goroutine.
+// A step's STDIN is the output of its dependency that appears last in the file;
+// steps without dependencies receive the workflow's initial input.
+func (p *Processor) runGraph(graph *executionGraph) error {
+	if len(graph.steps) == 0 {
+		return nil
+	}
+
+	initialOutput := p.lastOutput
+	outputs := make(map[string]string, len(graph.steps))
+	indegree := make(map[string]int, len(graph.steps))
+	groupRemaining := make(map[string]int)
+	for _, node := range graph.steps {
+		indegree[node.step.Name] = len(node.dependsOn)
+		if node.group != "" {
+			groupRemaining[node.group]++
+		}
+	}
+
+	results := make(chan scheduledResult)
+	running := 0
+	spinnerOwner := ""
+
+	launch := func(node *scheduledStep) {
+		stdin := initialOutput
+		if len(node.dependsOn) > 0 {
+			stdin = outputs[node.dependsOn[len(node.dependsOn)-1]]
+		}
+
+		forked := p.fork()
+		forked.lastOutput = stdin
+		snapshot := make(map[string]string, len(forked.variables))
+		for name, value := range forked.variables {
+			snapshot[name] = value
+		}
+
+		// Restore steps that completed in an earlier attempt of the run with the same inputs
+		hash := ""
+		if p.checkpoint != nil {
+			var err error
+			if hash, err = forked.stepHash(node.step); err != nil {
+				p.debugf("Step '%s' will not be checkpointed: %v", node.step.Name, err)
+				hash = ""
+			} else if checkpoint, ok := p.checkpoint.lookup(node.step.Name, hash); ok {
+				stepInfo := &StepInfo{Name: node.step.Name}
+				p.emitSkipped(fmt.Sprintf("Skipping step %d/%d: %s (restored from run %s)",
+					node.index+1, len(graph.steps), node.step.Name, p.checkpoint.RunID()), stepInfo, node.group != "", node.group)
+				// Later steps of the conversation continue from the restored turns
+				if id := node.step.Config.Conversation; id != "" {
+					p.conversations.append(id, checkpoint.Turns...)
+				}
+				running++
+				restored := &StepResult{
+					Name:       node.step.Name,
+					Output:     checkpoint.Output,
+					Model:      checkpoint.Model,
+					ResponseID: checkpoint.ResponseID,
+					Restored:   true,
+				}
+				go func() {
+					results <- scheduledResult{node: node, step: restored, variables: checkpoint.Variables, restored: true}
+				}()
+				return
+			}
+		}
+
+		// Only one spinner can be shown at a time, and none over a streamed response
+		if running == 0 && spinnerOwner == "" && !node.step.Config.Stream {
+			if node.group != "" {
+				spinnerOwner = node.group
+				p.spinner.Start(fmt.Sprintf("Processing parallel step group: %s", node.group))
+			} else {
+				spinnerOwner = node.step.Name
+				p.spinner.Start(fmt.Sprintf("Processing step %d/%d: %s", node.index+1, len(graph.steps), node.step.Name))
+			}
+		}
+
+		// The steps of a conversation run one at a time, so the turns after the current
+		// history are the ones this step adds
+		conversation := node.step.Config.Conversation
+		historyLen := len(p.conversations.messages(conversation))
+
+		running++
+		go func() {
+			stepResult, err := forked.runScheduledStep(node, len(graph.steps))
+			changed := make(map[string]string)
+			for name, value := range forked.variables {
+				if old, ok := snapshot[name]; !ok || old != value {
+					changed[name] = value
+				}
+			}
+			var turns []models.Message
+			if conversation != "" {
+				turns = forked.conversations.messages(conversation)[historyLen:]
+			}
+			results <- scheduledResult{node: node, step: stepResult, variables: changed, written: forked.written, turns: turns, hash: hash, err: err}
+		}()
+	}
+
+	for _, node := range graph.steps {
+		if indegree[node.step.Name] == 0 {
+			launch(node)
+		}
+	}
+
+	var firstErr error
+	for running > 0 {
+		result := <-results
+		running--
+		name := result.node.step.Name
+
+		if result.node.group != "" {
+			groupRemaining[result.node.group]--
+		}
+		if spinnerOwner == name || (spinnerOwner == result.node.group && groupRemaining[result.node.group] == 0) {
+			p.spinner.Stop()
+			spinnerOwner = ""
+		}
+
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			continue
+		}
+
+		outputs[name] = result.step.Output
+		p.stepResults[name] = result.step
+		for varName, value := range result.variables {
+			p.variables[varName] = value
+		}
+		p.written = append(p.written, result.written...)
+		if p.checkpoint != nil && !result.restored && result.hash != "" {
+			if err := p.checkpoint.record(name, result.hash, result.step, result.variables, result.written, result.turns); err != nil {
+				p.debugf("Warning: failed to checkpoint step '%s': %v", name, err)
+			}
+		}
+		p.debugf("Completed step: %s", name)
+
+		// Stop scheduling new steps after a failure, but let running steps finish
+		if firstErr != nil {
+			continue
+		}
+		for _, dependent := range graph.dependents[name] {
+			indegree[dependent]--
+			if indegree[dependent] == 0 {
+				launch(graph.byName[dependent])
+			}
+		}
+	}
+
+	if firstErr != nil {
+		p.spinner.Stop()
+		p.emitError(firstErr)
+		return firstErr
+	}
+
+	// The output of the last step in the file becomes the workflow's output
+	p.lastOutput = outputs[graph.steps[len(graph.steps)-1].step.Name]
+	return nil
+}
+
+// runScheduledStep runs a single node of the graph on a forked processor
+func (p *Processor) runScheduledStep(node *scheduledStep, total int) (*StepResult, error) {
+	step := node.step
+	isParallel := node.group != ""
+
+	// Do not start steps once the workflow has been cancelled or timed out
+	if err := p.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &StepResult{Name: step.Name, StartedAt: time.Now()}
+
+	stepInfo := &StepInfo{
+		Name:   step.Name,
+		Model:  fmt.Sprintf("%v", step.Config.Model),
+		Action: fmt.Sprintf("%v", step.Config.Action),
+	}
+	if step.Config.Generate != nil {
+		stepInfo.Model = fmt.Sprintf("%v", step.Config.Generate.Model)
+		stepInfo.Action = fmt.Sprintf("%v", step.Config.Generate.Action)
+	} else if step.Config.Process != nil {
+		stepInfo.Action = fmt.Sprintf("Process workflow: %s", step.Config.Process.WorkflowFile)
+		stepInfo.Model = "N/A"
+	}
+
+	// Evaluate the step's when condition, if any
+	run, err := p.shouldRunStep(step)
+	if err != nil {
+		errMsg := fmt.Sprintf("Error evaluating condition for step '%s': %v", step.Name, err)
+		p.debugf("Condition error: %s", errMsg)
+		return nil, fmt.Errorf("step processing error: %w", err)
+	}
+	if !run {
+		skipMsg := fmt.Sprintf("Skipping step %d/%d: %s (condition not met: %s)", node.index+1, total, step.Name, step.Config.When)
+		p.debugf("%s", skipMsg)
+		p.emitSkipped(skipMsg, stepInfo, isParallel, node.group)
+		// A skipped step passes its input through so later steps see the most recent output
+		result.Output = p.lastOutput
+		result.Skipped = true
+		return result, nil
+	}
+
+	if !isParallel {
+		p.emitProgress(fmt.Sprintf("Processing step %d/%d: %s", node.index+1, total, step.Name), stepInfo)
+	}
+
+	response, err := p.processStep(step, isParallel, node.group)
+	if err != nil {
+		if isParallel {
+			return nil, fmt.Errorf("error in parallel step '%s': %w", step.Name, err)
+		}
+		return nil, fmt.Errorf("error processing step '%s': %w", step.Name, err)
+	}
+	result.Output = response
+	result.Model = p.lastModel
+	result.ResponseID = p.lastResponse
+	result.Duration = time.Since(result.StartedAt)
+	return result, nil
+}
@@ -0,0 +1,271 @@
+package processor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDSL(t *testing.T) {
+	yamlContent := `
+first:
+  input: NA
+  model: gpt-4o-mini
+  action: start
+  output: first.txt
+
+parallel-fetch:
+  fetch_a:
+    input: first.txt
+    model: gpt-4o-mini
+    action: fetch a
+    output: a.txt
+  fetch_b:
+    input: first.txt
+    model: gpt-4o-mini
+    action: fetch b
+    output: b.txt
+
+parallel-analyze:
+  analyze_a:
+    input: a.txt
+    model: gpt-4o-mini
+    action: analyze
+    output: STDOUT
+
+last:
+  depends_on: [parallel-fetch]
+  input: NA
+  model: gpt-4o-mini
+  action: finish
+  output: STDOUT
+`
+	dslConfig, err := ParseDSL([]byte(yamlContent))
+	if err != nil {
+		t.Fatalf("ParseDSL returned unexpected error: %v", err)
+	}
+
+	expectedOrder := []string{"first", "parallel-fetch", "parallel-analyze", "last"}
+	if !reflect.DeepEqual(dslConfig.Order, expectedOrder) {
+		t.Errorf("Order = %v, want %v", dslConfig.Order, expectedOrder)
+	}
+	if len(dslConfig.Steps) != 2 || dslConfig.Steps[0].Name != "first" || dslConfig.Steps[1].Name != "last" {
+		t.Errorf("unexpected sequential steps: %+v", dslConfig.Steps)
+	}
+	if len(dslConfig.ParallelSteps["parallel-fetch"]) != 2 || len(dslConfig.ParallelSteps["parallel-analyze"]) != 1 {
+		t.Errorf("unexpected parallel groups: %+v", dslConfig.ParallelSteps)
+	}
+
+	if _, err := ParseDSL([]byte("- not\n- a mapping\n")); err == nil {
+		t.Error("expected error for a workflow that is not a mapping")
+	}
+	if _, err := ParseDSL([]byte("parallel-bad: just a string\n")); err == nil {
+		t.Error("expected error for a parallel group that is not a mapping")
+	}
+}
+
+func TestParseDSLStepNamesLikeSections(t *testing.T) {
+	yamlContent := `
+parallel-summary:
+  input: NA
+  model: gpt-4o-mini
+  action: summarize
+  output: STDOUT
+
+params:
+  model:
+    type: string
+    default: gpt-4o-mini
+`
+	dslConfig, err := ParseDSL([]byte(yamlContent))
+	if err != nil {
+		t.Fatalf("ParseDSL returned unexpected error: %v", err)
+	}
+	if len(dslConfig.Steps) != 1 || dslConfig.Steps[0].Name != "parallel-summary" || dslConfig.Steps[0].Config.Action != "summarize" {
+		t.Errorf("expected parallel-summary to be a step, got steps %+v", dslConfig.Steps)
+	}
+	if len(dslConfig.ParallelSteps) != 0 {
+		t.Errorf("expected no parallel groups, got %+v", dslConfig.ParallelSteps)
+	}
+	if _, ok := dslConfig.Params["model"]; !ok {
+		t.Errorf("expected a parameter named model, got %+v", dslConfig.Params)
+	}
+
+	for _, name := range []string{"params", "outputs"} {
+		step := name + ":\n  input: NA\n  model: gpt-4o-mini\n  action: list them\n  output: STDOUT\n"
+		if _, err := ParseDSL([]byte(step)); err == nil || !strings.Contains(err.Error(), "cannot name a step") {
+			t.Errorf("ParseDSL() of a step named %s error = %v, want a reserved name error", name, err)
+		}
+	}
+}
+
+// newGraphTestStep creates a minimal standard step for graph tests
+func newGraphTestStep(name, input, output string, dependsOn interface{}) Step {
+	return Step{
+		Name: name,
+		Config: StepConfig{
+			Input:     input,
+			Model:     "gpt-4o-mini",
+			Action:    "test",
+			Output:    output,
+			DependsOn: dependsOn,
+		},
+	}
+}
+
+func TestBuildExecutionGraph(t *testing.T) {
+	dslConfig := &DSLConfig{
+		Steps: []Step{
+			newGraphTestStep("load", "NA", "data.txt", nil),
+			newGraphTestStep("independent", "NA", "STDOUT", []string{}),
+			newGraphTestStep("merge", "NA", "STDOUT", []interface{}{"parallel-branches"}),
+			newGraphTestStep("report", "left.txt", "STDOUT", "load"),
+		},
+		ParallelSteps: map[string][]Step{
+			"parallel-branches": {
+				newGraphTestStep("left", "data.txt", "left.txt", nil),
+				newGraphTestStep("right", "data.txt", "right.txt", nil),
+			},
+		},
+		Order: []string{"load", "parallel-branches", "independent", "merge", "report"},
+	}
+
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), nil, false, "")
+	graph, err := processor.buildExecutionGraph()
+	if err != nil {
+		t.Fatalf("buildExecutionGraph returned unexpected error: %v", err)
+	}
+
+	expected := map[string][]string{
+		"load":        nil,
+		"left":        {"load"},
+		"right":       {"load"},
+		"independent": nil,
+		"merge":       {"left", "right"},
+		"report":      {"load", "left"}, // explicit plus inferred from left.txt
+	}
+	for name, deps := range expected {
+		node := graph.byName[name]
+		if node == nil {
+			t.Fatalf("step %s missing from graph", name)
+		}
+		if !reflect.DeepEqual(node.dependsOn, deps) {
+			t.Errorf("dependencies of %s = %v, want %v", name, node.dependsOn, deps)
+		}
+	}
+}
+
+func TestBuildExecutionGraphErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *DSLConfig
+		wantErr string
+	}{
+		{
+			name: "unknown dependency",
+			config: &DSLConfig{
+				Steps: []Step{newGraphTestStep("a", "NA", "STDOUT", "missing")},
+			},
+			wantErr: "unknown step",
+		},
+		{
+			name: "circular dependency",
+			config: &DSLConfig{
+				Steps: []Step{
+					newGraphTestStep("a", "NA", "STDOUT", "b"),
+					newGraphTestStep("b", "NA", "STDOUT", "a"),
+				},
+			},
+			wantErr: "circular dependency",
+		},
+		{
+			name: "dependency within a parallel group",
+			config: &DSLConfig{
+				ParallelSteps: map[string][]Step{
+					"parallel-process": {
+						newGraphTestStep("a", "NA", "STDOUT", nil),
+						newGraphTestStep("b", "NA", "STDOUT", "a"),
+					},
+				},
+			},
+			wantErr: "same parallel group",
+		},
+		{
+			name: "duplicate step name",
+			config: &DSLConfig{
+				Steps: []Step{newGraphTestStep("a", "NA", "STDOUT", nil)},
+				ParallelSteps: map[string][]Step{
+					"parallel-process": {newGraphTestStep("a", "NA", "STDOUT", nil)},
+				},
+			},
+			wantErr: "more than once",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := NewProcessor(tt.config, createTestEnvConfig(), nil, false, "")
+			_, err := processor.buildExecutionGraph()
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %q does not contain %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProcessRunsMultipleParallelGroups(t *testing.T) {
+	useMockProviders(t)
+	yamlContent := `
+parallel-first:
+  one:
+    input: NA
+    model: gpt-4o-mini
+    action: one
+    output: STDOUT as $one
+  two:
+    input: NA
+    model: gpt-4o-mini
+    action: two
+    output: STDOUT as $two
+
+parallel-second:
+  three:
+    input: STDIN
+    model: gpt-4o-mini
+    action: three
+    output: STDOUT
+  four:
+    input: STDIN
+    model: gpt-4o-mini
+    action: four
+    output: STDOUT
+
+summary:
+  depends_on: [parallel-first, parallel-second]
+  input: NA
+  model: gpt-4o-mini
+  action: "summarize $one and $two"
+  output: STDOUT as $summary
+`
+	dslConfig, err := ParseDSL([]byte(yamlContent))
+	if err != nil {
+		t.Fatalf("ParseDSL returned unexpected error: %v", err)
+	}
+
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+	if err := processor.Process(); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"one", "two", "summary"} {
+		if processor.variables[name] != "mock response" {
+			t.Errorf("expected variable $%s to be set by its step, got %q", name, processor.variables[name])
+		}
+	}
+	if processor.LastOutput() != "mock response" {
+		t.Errorf("expected last output from the final step, got %q", processor.LastOutput())
+	}
+}
@@ -0,0 +1,77 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// validateStream checks that a step with stream enabled runs one model call at a time, so that
+// the streamed responses do not interleave. With fallback models, a model that fails after
+// streaming part of its response fails the step instead of falling back.
+func validateStream(config StepConfig) error {
+	if !config.Stream {
+		return nil
+	}
+	if config.ModelStrategy == ModelStrategyRace || config.ModelStrategy == ModelStrategyAll {
+		return fmt.Errorf("stream cannot be used with model_strategy: %s", config.ModelStrategy)
+	}
+	if config.ForEach != nil && config.ForEach.Concurrency > 1 {
+		return fmt.Errorf("stream cannot be used with for_each concurrency greater than 1")
+	}
+	return nil
+}
+
+// streamingProvider streams the prompts sent through a provider, writing each piece of the
+// response as it arrives
+type streamingProvider struct {
+	models.Provider
+	processor *Processor
+	stepName  string
+}
+
+// SendPrompt streams a prompt and returns the whole response
+func (s *streamingProvider) SendPrompt(ctx context.Context, modelName string, prompt string) (string, error) {
+	return models.SendPromptStream(ctx, s.Provider, modelName, prompt, func(delta string) {
+		s.processor.writeDelta(s.stepName, modelName, delta)
+	})
+}
+
+// withStream wraps a provider so that the prompts of a step with stream enabled are streamed.
+// Prompts with files, conversations and tool calls are answered whole.
+func (p *Processor) withStream(provider models.Provider) models.Provider {
+	if p.currentStep == nil || !p.currentStep.Config.Stream {
+		return provider
+	}
+	return &streamingProvider{Provider: provider, processor: p, stepName: p.currentStep.Name}
+}
+
+// writeDelta writes a piece of a streamed response as an output event, or to STDOUT when
+// there is no progress writer
+func (p *Processor) writeDelta(stepName string, modelName string, delta string) {
+	first := p.streamed.Len() == 0
+	p.streamed.WriteString(delta)
+
+	if p.progress != nil {
+		if err := p.progress.WriteProgress(ProgressUpdate{
+			Type:   ProgressOutput,
+			Stdout: delta,
+			Step:   &StepInfo{Name: stepName, Model: modelName},
+		}); err != nil {
+			p.debugf("Warning: failed to send streamed output: %v", err)
+		}
+		return
+	}
+	if first {
+		fmt.Printf("\nResponse from %s:\n", modelName)
+	}
+	fmt.Print(delta)
+}
+
+// streamedResponse reports whether response is what the current step streamed, and so has
+// already been written. A response changed after streaming, by next-action or output_schema
+// repair, is written again.
+func (p *Processor) streamedResponse(response string) bool {
+	return p.streamed.Len() > 0 && p.streamed.String() == response
+}
@@ -0,0 +1,179 @@
+package processor
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// streamingScriptedProvider streams the scripted responses a word at a time. A scripted error
+// is returned after the first word has been streamed.
+type streamingScriptedProvider struct {
+	*scriptedProvider
+	streamErr error
+}
+
+func (s *streamingScriptedProvider) SendPromptStream(ctx context.Context, model, prompt string, onDelta func(string)) (string, error) {
+	response, err := s.SendPrompt(ctx, model, prompt)
+	if err != nil {
+		return "", err
+	}
+	words := strings.SplitAfter(response, " ")
+	for i, word := range words {
+		onDelta(word)
+		if i == 0 && s.streamErr != nil {
+			return "", s.streamErr
+		}
+	}
+	return response, nil
+}
+
+// runStreamStep runs a step with stream enabled against provider and returns the output events
+func runStreamStep(t *testing.T, provider models.Provider, model interface{}, retry *RetryConfig) ([]ProgressUpdate, error) {
+	t.Helper()
+	original := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider {
+		if provider.SupportsModel(modelName) {
+			return provider
+		}
+		return nil
+	}
+	t.Cleanup(func() {
+		models.DetectProvider = original
+	})
+
+	dslConfig := &DSLConfig{Steps: []Step{{Name: "story", Config: StepConfig{
+		Input:  "NA",
+		Model:  model,
+		Action: "tell a story",
+		Output: "STDOUT",
+		Stream: true,
+		Retry:  retry,
+	}}}}
+	progressChan := make(chan ProgressUpdate, 100)
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+	processor.SetProgressWriter(NewChannelProgressWriter(progressChan))
+	err := processor.Process()
+
+	close(progressChan)
+	var outputs []ProgressUpdate
+	for update := range progressChan {
+		if update.Type == ProgressOutput {
+			outputs = append(outputs, update)
+		}
+	}
+	return outputs, err
+}
+
+func TestStreamStep(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider models.Provider
+		deltas   []string
+	}{
+		{"streaming provider", &streamingScriptedProvider{scriptedProvider: newScriptedProvider("once upon a time")}, []string{"once ", "upon ", "a ", "time"}},
+		{"provider without streaming", newScriptedProvider("once upon a time"), []string{"once upon a time"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs, err := runStreamStep(t, tt.provider, "gpt-4o-mini", nil)
+			if err != nil {
+				t.Fatalf("Process() error: %v", err)
+			}
+
+			var deltas []string
+			for _, update := range outputs {
+				if update.Step != nil {
+					deltas = append(deltas, update.Stdout)
+				} else if strings.Contains(update.Stdout, "once upon a time") {
+					t.Errorf("streamed response was written again: %q", update.Stdout)
+				}
+			}
+			if strings.Join(deltas, "|") != strings.Join(tt.deltas, "|") {
+				t.Errorf("deltas = %q, want %q", deltas, tt.deltas)
+			}
+		})
+	}
+}
+
+func TestStreamRetry(t *testing.T) {
+	rateLimited := &models.ProviderError{Provider: "openai", Kind: models.ErrorRateLimit, StatusCode: http.StatusTooManyRequests}
+	retry := &RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond}
+
+	t.Run("failure before streaming is retried", func(t *testing.T) {
+		scripted := newScriptedProvider("", "once upon a time")
+		scripted.errs = []error{rateLimited}
+		outputs, err := runStreamStep(t, &streamingScriptedProvider{scriptedProvider: scripted}, "gpt-4o-mini", retry)
+		if err != nil {
+			t.Fatalf("Process() error: %v", err)
+		}
+		if len(scripted.prompts) != 2 || len(outputs) != 5 {
+			t.Errorf("got %d prompts and %d output events, want 2 and 5", len(scripted.prompts), len(outputs))
+		}
+	})
+
+	t.Run("failure after streaming is not retried", func(t *testing.T) {
+		scripted := newScriptedProvider("once upon a time", "once upon a time")
+		_, err := runStreamStep(t, &streamingScriptedProvider{scriptedProvider: scripted, streamErr: rateLimited}, "gpt-4o-mini", retry)
+		if err == nil || !strings.Contains(err.Error(), "stream interrupted") {
+			t.Fatalf("Process() error = %v, want stream interrupted", err)
+		}
+		if len(scripted.prompts) != 1 {
+			t.Errorf("got %d prompts, want 1", len(scripted.prompts))
+		}
+	})
+}
+
+func TestStreamFallback(t *testing.T) {
+	rateLimited := &models.ProviderError{Provider: "openai", Kind: models.ErrorRateLimit, StatusCode: http.StatusTooManyRequests}
+	fallback := []interface{}{"gpt-4o-mini", "gpt-4o"}
+
+	t.Run("failure before streaming falls back", func(t *testing.T) {
+		scripted := newScriptedProvider("", "once upon a time")
+		scripted.errs = []error{rateLimited}
+		outputs, err := runStreamStep(t, &streamingScriptedProvider{scriptedProvider: scripted}, fallback, nil)
+		if err != nil {
+			t.Fatalf("Process() error: %v", err)
+		}
+		if len(scripted.prompts) != 2 || len(outputs) != 5 {
+			t.Errorf("got %d prompts and %d output events, want 2 and 5", len(scripted.prompts), len(outputs))
+		}
+	})
+
+	t.Run("failure after streaming does not fall back", func(t *testing.T) {
+		scripted := newScriptedProvider("once upon a time", "a different story")
+		_, err := runStreamStep(t, &streamingScriptedProvider{scriptedProvider: scripted, streamErr: rateLimited}, fallback, nil)
+		if err == nil || !strings.Contains(err.Error(), "after part of its response was streamed") {
+			t.Fatalf("Process() error = %v, want a failure after streaming", err)
+		}
+		if len(scripted.prompts) != 1 {
+			t.Errorf("got %d prompts, want 1", len(scripted.prompts))
+		}
+	})
+}
+
+func TestValidateStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  StepConfig
+		wantErr bool
+	}{
+		{"stream", StepConfig{Stream: true}, false},
+		{"fallback models", StepConfig{Stream: true, ModelStrategy: ModelStrategyFallback}, false},
+		{"race", StepConfig{Stream: true, ModelStrategy: ModelStrategyRace}, true},
+		{"all", StepConfig{Stream: true, ModelStrategy: ModelStrategyAll}, true},
+		{"concurrent for_each", StepConfig{Stream: true, ForEach: &ForEachConfig{Concurrency: 4}}, true},
+		{"race without stream", StepConfig{ModelStrategy: ModelStrategyRace}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateStream(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("validateStream() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Template syntaxes selected by the top-level template_syntax key
+const (
+	TemplateSyntaxCompat = "compat" // {{ }} templates plus legacy $variable references (default)
+	TemplateSyntaxGo     = "go"     // {{ }} templates only; $ is always literal
+)
+
+// validateTemplateSyntax checks the value of the top-level template_syntax key
+func validateTemplateSyntax(syntax string) error {
+	switch syntax {
+	case "", TemplateSyntaxCompat, TemplateSyntaxGo:
+		return nil
+	default:
+		return fmt.Errorf("invalid template_syntax '%s': must be %s or %s", syntax, TemplateSyntaxCompat, TemplateSyntaxGo)
+	}
+}
+
+// renderTemplate expands the templates in an action, instruction or output path.
+//
+// Text containing {{ is rendered with text/template. The data has .vars (workflow variables),
+// .steps (results of completed steps, e.g. .steps.summarize.output) and .stdin (the step's
+// input), and templateFuncs lists the helper functions. Missing variables and steps render
+// as empty strings, which the default helper can replace.
+//
+// ${steps.<name>.<field>} references are then replaced with fields of earlier steps' results;
+// unlike templates, they fail when the step has not completed.
+//
+// In compat mode, legacy $variable references are substituted last, and text that does
+// not parse as a template is used as it is.
+func (p *Processor) renderTemplate(text string) (string, error) {
+	compat := p.config == nil || p.config.TemplateSyntax != TemplateSyntaxGo
+
+	if strings.Contains(text, "{{") {
+		tmpl, err := template.New("").Option("missingkey=zero").Funcs(p.templateFuncs()).Parse(text)
+		switch {
+		case err == nil:
+			var buf strings.Builder
+			if err := tmpl.Execute(&buf, p.templateData()); err != nil {
+				return "", fmt.Errorf("template error: %w", err)
+			}
+			text = buf.String()
+		case compat:
+			// Older workflows may contain literal braces meant for the model
+			p.debugf("Text is not a valid template, using it as is: %v", err)
+		default:
+			return "", fmt.Errorf("invalid template: %w", err)
+		}
+	}
+
+	text, err := p.substituteStepReferences(text)
+	if err != nil {
+		return "", err
+	}
+
+	if compat {
+		text = p.substituteVariables(text)
+	}
+	return text, nil
+}
+
+// templateData returns the data templates are rendered with
+func (p *Processor) templateData() map[string]interface{} {
+	vars := make(map[string]string, len(p.variables))
+	for name, value := range p.variables {
+		vars[name] = value
+	}
+	steps := make(map[string]map[string]string, len(p.stepResults))
+	for name, result := range p.stepResults {
+		steps[name] = result.fields()
+	}
+	return map[string]interface{}{
+		"vars":  vars,
+		"steps": steps,
+		"stdin": p.lastOutput,
+	}
+}
+
+// templateFuncs returns the helper functions available in templates
+func (p *Processor) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// env returns an environment variable
+		"env": os.Getenv,
+		// var returns a variable by name, including names with dots such as item.name
+		"var": func(name string) string {
+			return p.variables[name]
+		},
+		// default returns def when value is empty: {{ .vars.tone | default "neutral" }}
+		"default": func(def string, value interface{}) string {
+			if value == nil {
+				return def
+			}
+			if s := fmt.Sprint(value); s != "" {
+				return s
+			}
+			return def
+		},
+		// json encodes a value as JSON, e.g. to embed text in a JSON document
+		"json": func(value interface{}) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+		// truncate shortens text to at most n characters: {{ .stdin | truncate 500 }}
+		"truncate": func(n int, s string) string {
+			runes := []rune(s)
+			if n < 0 || len(runes) <= n {
+				return s
+			}
+			return string(runes[:n])
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"trim":  strings.TrimSpace,
+	}
+}
+
+// renderSQL expands the templates in an SQL statement. Values can't be pasted into SQL, so each
+// template action must end with the param function, which binds its value to a placeholder:
+// {{ .vars.id | param }} renders as $1 and adds the value to the returned arguments. Placeholders
+// are numbered after the first reserved ones, which the caller binds. Legacy $variable and
+// ${steps...} references are not substituted in SQL.
+func (p *Processor) renderSQL(text string, reserved int) (string, []interface{}, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil, nil
+	}
+
+	var args []interface{}
+	funcs := p.templateFuncs()
+	funcs["param"] = func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", reserved+len(args))
+	}
+	tmpl, err := template.New("").Option("missingkey=zero").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid template: %w", err)
+	}
+	if err := checkSQLTemplate(tmpl.Tree.Root); err != nil {
+		return "", nil, err
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, p.templateData()); err != nil {
+		return "", nil, fmt.Errorf("template error: %w", err)
+	}
+	return buf.String(), args, nil
+}
+
+// checkSQLTemplate returns an error for template actions in SQL that would print a value
+// rather than bind it with param
+func checkSQLTemplate(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkSQLTemplate(child); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		// Declarations and assignments print nothing
+		if len(n.Pipe.Decl) > 0 {
+			return nil
+		}
+		last := n.Pipe.Cmds[len(n.Pipe.Cmds)-1]
+		if ident, ok := last.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "param" {
+			return nil
+		}
+		return fmt.Errorf("%s: values in SQL must be bound with param, e.g. {{ .vars.id | param }}", n)
+	case *parse.IfNode:
+		return checkSQLBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		return checkSQLBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return checkSQLBranch(&n.BranchNode)
+	case *parse.TemplateNode:
+		return fmt.Errorf("%s: templates can't be invoked in SQL", n)
+	}
+	return nil
+}
+
+// checkSQLBranch checks both branches of an if, range or with action in SQL
+func checkSQLBranch(n *parse.BranchNode) error {
+	if err := checkSQLTemplate(n.List); err != nil {
+		return err
+	}
+	return checkSQLTemplate(n.ElseList)
+}
+
+// renderInSlice renders the templates in a string or list of strings, leaving other values untouched
+func (p *Processor) renderInSlice(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return p.renderTemplate(v)
+	case []string, []interface{}:
+		values := p.NormalizeStringSlice(v)
+		rendered := make([]string, len(values))
+		for i, s := range values {
+			r, err := p.renderTemplate(s)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = r
+		}
+		return rendered, nil
+	default:
+		return value, nil
+	}
+}
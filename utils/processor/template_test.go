@@ -0,0 +1,142 @@
+package processor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	t.Setenv("COMANDA_TEST_REGION", "eu-west")
+
+	tests := []struct {
+		name     string
+		syntax   string
+		text     string
+		expected string
+		wantErr  bool
+	}{
+		{name: "variable", text: "Hello {{ .vars.name }}", expected: "Hello Ada"},
+		{name: "step output", text: "Summary: {{ .steps.summarize.output }}", expected: "Summary: short"},
+		{name: "stdin", text: "{{ .stdin | upper }}", expected: "PREVIOUS"},
+		{name: "default for missing variable", text: `{{ .vars.tone | default "neutral" }}`, expected: "neutral"},
+		{name: "default for missing step", text: `{{ .steps.missing.output | default "none" }}`, expected: "none"},
+		{name: "env", text: `{{ env "COMANDA_TEST_REGION" }}`, expected: "eu-west"},
+		{name: "json", text: `{"text": {{ .vars.quote | json }}}`, expected: `{"text": "say \"hi\""}`},
+		{name: "truncate", text: "{{ .steps.summarize.output | truncate 3 }}", expected: "sho"},
+		{name: "dotted variable", text: `{{ var "item.name" }}`, expected: "widget"},
+		{name: "escaped braces", text: `{{ "{{" }}x}}`, expected: "{{x}}"},
+		{name: "legacy variables", text: "$name and $name_full", expected: "Ada and Ada Lovelace"},
+		{name: "legacy and template together", text: "$name {{ .vars.name_full }}", expected: "Ada Ada Lovelace"},
+		{name: "compat keeps invalid templates", text: "Fill in {{ name }} for $name", expected: "Fill in {{ name }} for Ada"},
+		{name: "go syntax leaves $ literal", syntax: TemplateSyntaxGo, text: "$name costs $5, {{ .vars.name }}", expected: "$name costs $5, Ada"},
+		{name: "go syntax rejects invalid templates", syntax: TemplateSyntaxGo, text: "Fill in {{ name }}", wantErr: true},
+		{name: "execution error", text: "{{ truncate .vars.name 3 }}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := NewProcessor(&DSLConfig{TemplateSyntax: tt.syntax}, createTestEnvConfig(), createTestServerConfig(), false, "")
+			processor.variables = map[string]string{
+				"name":      "Ada",
+				"name_full": "Ada Lovelace",
+				"quote":     `say "hi"`,
+				"item.name": "widget",
+			}
+			processor.stepResults["summarize"] = &StepResult{Name: "summarize", Output: "short"}
+			processor.lastOutput = "previous"
+
+			got, err := processor.renderTemplate(tt.text)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("renderTemplate() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRenderSQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		reserved int
+		expected string
+		args     []interface{}
+		wantErr  string
+	}{
+		{name: "no template", text: "SELECT * FROM t WHERE owner = $name", expected: "SELECT * FROM t WHERE owner = $name"},
+		{name: "bound variable", text: "SELECT * FROM t WHERE owner = {{ .vars.owner | param }}", expected: "SELECT * FROM t WHERE owner = $1", args: []interface{}{"O'Brien'; DROP TABLE t; --"}},
+		{name: "bound step output", text: "INSERT INTO notes (a, b) VALUES ({{ param .steps.summarize.output }}, {{ .vars.owner | trim | param }})", expected: "INSERT INTO notes (a, b) VALUES ($1, $2)", args: []interface{}{"short", "O'Brien'; DROP TABLE t; --"}},
+		{name: "after reserved placeholders", text: "INSERT INTO docs VALUES ($1, $2, {{ .vars.owner | param }})", reserved: 2, expected: "INSERT INTO docs VALUES ($1, $2, $3)", args: []interface{}{"O'Brien'; DROP TABLE t; --"}},
+		{name: "condition", text: "SELECT * FROM t{{ if .vars.owner }} WHERE owner = {{ param .vars.owner }}{{ end }}", expected: "SELECT * FROM t WHERE owner = $1", args: []interface{}{"O'Brien'; DROP TABLE t; --"}},
+		{name: "legacy variables are not substituted", text: "SELECT '$owner', {{ .vars.owner | param }}", expected: "SELECT '$owner', $1", args: []interface{}{"O'Brien'; DROP TABLE t; --"}},
+		{name: "printed variable", text: "SELECT * FROM t WHERE owner = '{{ .vars.owner }}'", wantErr: "must be bound with param"},
+		{name: "printed value after param", text: "SELECT {{ .vars.owner | param | upper }}", wantErr: "must be bound with param"},
+		{name: "printed value in a branch", text: "SELECT 1{{ if .vars.owner }}{{ else }}{{ .stdin }}{{ end }}", wantErr: "must be bound with param"},
+		{name: "invalid template", text: "SELECT {{ owner }}", wantErr: "invalid template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false, "")
+			processor.variables = map[string]string{"owner": "O'Brien'; DROP TABLE t; --"}
+			processor.stepResults["summarize"] = &StepResult{Name: "summarize", Output: "short"}
+
+			got, args, err := processor.renderSQL(tt.text, tt.reserved)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("renderSQL() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected || !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("renderSQL() = %q, %q, want %q, %q", got, args, tt.expected, tt.args)
+			}
+		})
+	}
+}
+
+func TestParseDSLTemplateSyntax(t *testing.T) {
+	dslConfig, err := ParseDSL([]byte("template_syntax: go\n"))
+	if err != nil {
+		t.Fatalf("ParseDSL() error: %v", err)
+	}
+	if dslConfig.TemplateSyntax != TemplateSyntaxGo {
+		t.Errorf("TemplateSyntax = %q, want %q", dslConfig.TemplateSyntax, TemplateSyntaxGo)
+	}
+	if len(dslConfig.Steps) != 0 {
+		t.Errorf("template_syntax should not define a step, got %d step(s)", len(dslConfig.Steps))
+	}
+	if _, err := ParseDSL([]byte("template_syntax: jinja\n")); err == nil {
+		t.Error("expected error for unknown template_syntax")
+	}
+}
+
+func TestActionTemplateReadsEarlierStep(t *testing.T) {
+	provider := newScriptedProvider("Paris, Berlin", "ignored", "final")
+	useScriptedProvider(t, provider)
+
+	dslConfig := &DSLConfig{Steps: []Step{
+		{Name: "cities", Config: StepConfig{Input: "NA", Model: "gpt-4o-mini", Action: "list cities", Output: "STDOUT"}},
+		{Name: "other", Config: StepConfig{Input: "NA", Model: "gpt-4o-mini", Action: "something else", Output: "STDOUT"}},
+		{Name: "describe", Config: StepConfig{Input: "NA", Model: "gpt-4o-mini", Action: "Describe {{ .steps.cities.output }}", Output: "STDOUT"}},
+	}}
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+	if err := processor.Process(); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	if len(provider.prompts) != 3 || !strings.Contains(provider.prompts[2], "Describe Paris, Berlin") {
+		t.Errorf("expected the third prompt to include the first step's output, got %q", provider.prompts)
+	}
+}
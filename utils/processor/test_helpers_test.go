@@ -1,6 +1,14 @@
 package processor
 
-import "github.com/kris-hansen/comanda/utils/config"
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+)
 
 // Helper function to create a test environment config
 func createTestEnvConfig() *config.EnvConfig {
@@ -26,3 +34,97 @@ func createTestEnvConfig() *config.EnvConfig {
 		},
 	}
 }
+
+// useMockProviders routes model detection to the mock providers for the duration of a test
+func useMockProviders(t *testing.T) {
+	t.Helper()
+	original := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider {
+		for _, provider := range []models.Provider{NewMockProvider("openai"), NewMockProvider("anthropic")} {
+			if provider.SupportsModel(modelName) {
+				return provider
+			}
+		}
+		return nil
+	}
+	t.Cleanup(func() {
+		models.DetectProvider = original
+	})
+}
+
+// scriptedProvider returns a fixed sequence of responses and records the prompts it receives.
+// A non-nil entry in errs makes the corresponding call fail instead. Successful calls report
+// usage to the context's usage recorder.
+type scriptedProvider struct {
+	MockProvider
+	mu        sync.Mutex
+	responses []string
+	errs      []error
+	prompts   []string
+	options   []models.RequestOptions // Request options of each prompt
+	messages  [][]models.Message      // Conversation of each prompt sent with SendMessages
+	toolCalls [][]models.ToolCall     // Replies that call tools, given before the responses
+	usage     models.Usage
+}
+
+func newScriptedProvider(responses ...string) *scriptedProvider {
+	return &scriptedProvider{MockProvider: MockProvider{name: "openai"}, responses: responses}
+}
+
+func (s *scriptedProvider) SendPrompt(ctx context.Context, model, prompt string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.prompts) >= len(s.responses) {
+		return "", fmt.Errorf("unexpected prompt %d: %s", len(s.prompts)+1, prompt)
+	}
+	s.prompts = append(s.prompts, prompt)
+	s.options = append(s.options, models.RequestOptionsFromContext(ctx))
+	i := len(s.prompts) - 1
+	if i < len(s.errs) && s.errs[i] != nil {
+		return "", s.errs[i]
+	}
+	models.ReportUsage(ctx, model, s.usage)
+	return s.responses[i], nil
+}
+
+func (s *scriptedProvider) SendPromptWithFile(ctx context.Context, model, prompt string, file models.FileInput) (string, error) {
+	return s.SendPrompt(ctx, model, prompt)
+}
+
+// SendMessages records the conversation and answers it like a prompt of its last message
+func (s *scriptedProvider) SendMessages(ctx context.Context, model string, messages []models.Message) (string, error) {
+	s.mu.Lock()
+	s.messages = append(s.messages, append([]models.Message(nil), messages...))
+	s.mu.Unlock()
+	return s.SendPrompt(ctx, model, messages[len(messages)-1].Content)
+}
+
+// SendMessagesWithTools replies with the next scripted tool calls, then answers like SendMessages
+func (s *scriptedProvider) SendMessagesWithTools(ctx context.Context, model string, messages []models.Message, tools []models.Tool) (models.Message, error) {
+	s.mu.Lock()
+	if len(s.toolCalls) > 0 {
+		calls := s.toolCalls[0]
+		s.toolCalls = s.toolCalls[1:]
+		s.messages = append(s.messages, append([]models.Message(nil), messages...))
+		s.mu.Unlock()
+		return models.Message{Role: models.RoleAssistant, ToolCalls: calls}, nil
+	}
+	s.mu.Unlock()
+	response, err := s.SendMessages(ctx, model, messages)
+	return models.Message{Role: models.RoleAssistant, Content: response}, err
+}
+
+// useScriptedProvider routes model detection to a scripted provider for the duration of a test
+func useScriptedProvider(t *testing.T, provider *scriptedProvider) {
+	t.Helper()
+	original := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider {
+		if provider.SupportsModel(modelName) {
+			return provider
+		}
+		return nil
+	}
+	t.Cleanup(func() {
+		models.DetectProvider = original
+	})
+}
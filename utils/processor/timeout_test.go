@@ -0,0 +1,132 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+func TestStepTimeout(t *testing.T) {
+	provider := &perModelProvider{
+		MockProvider: MockProvider{name: "openai"},
+		delays:       map[string]time.Duration{"gpt-4o": 5 * time.Second},
+	}
+	start := time.Now()
+	_, err := runModelStrategyStep(t, provider, StepConfig{Model: "gpt-4o", Timeout: 50 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Fatalf("expected step timeout error, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error to wrap context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("step ran for %v despite its timeout", elapsed)
+	}
+}
+
+func TestStepContextRestoredAfterTimeout(t *testing.T) {
+	provider := &perModelProvider{
+		MockProvider: MockProvider{name: "openai"},
+		delays:       map[string]time.Duration{"gpt-4o": 5 * time.Second},
+	}
+	original := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider { return provider }
+	t.Cleanup(func() { models.DetectProvider = original })
+
+	step := Step{Name: "slow", Config: StepConfig{Input: "NA", Model: "gpt-4o", Action: "answer", Output: "STDOUT", Timeout: 20 * time.Millisecond}}
+	processor := NewProcessor(&DSLConfig{Steps: []Step{step}}, createTestEnvConfig(), createTestServerConfig(), false, "")
+	parent := context.Background()
+	processor.ctx = parent
+	if _, err := processor.processStepWithTimeout(step, false, ""); err == nil {
+		t.Fatal("expected the step to time out")
+	}
+	if processor.ctx != parent {
+		t.Error("the step's context was not restored after it failed")
+	}
+}
+
+func TestWorkflowTimeout(t *testing.T) {
+	yamlContent := `
+timeout: 50ms
+
+slow:
+  input: NA
+  model: gpt-4o
+  action: answer
+  output: STDOUT
+`
+	dslConfig, err := ParseDSL([]byte(yamlContent))
+	if err != nil {
+		t.Fatalf("ParseDSL() error: %v", err)
+	}
+	if dslConfig.Timeout != 50*time.Millisecond {
+		t.Errorf("Timeout = %v, want 50ms", dslConfig.Timeout)
+	}
+	if len(dslConfig.Steps) != 1 || dslConfig.Steps[0].Name != "slow" {
+		t.Fatalf("expected only the 'slow' step, got %+v", dslConfig.Steps)
+	}
+
+	provider := &perModelProvider{
+		MockProvider: MockProvider{name: "openai"},
+		delays:       map[string]time.Duration{"gpt-4o": 5 * time.Second},
+	}
+	original := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider { return provider }
+	t.Cleanup(func() { models.DetectProvider = original })
+
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+	err = processor.Process()
+	if err == nil || !strings.Contains(err.Error(), "workflow timed out after 50ms") {
+		t.Fatalf("expected workflow timeout error, got %v", err)
+	}
+}
+
+func TestParseDSLInvalidTimeout(t *testing.T) {
+	if _, err := ParseDSL([]byte("timeout: soon\n")); err == nil {
+		t.Error("expected error for invalid workflow timeout")
+	}
+}
+
+func TestProcessWithContextCancelled(t *testing.T) {
+	useMockProviders(t)
+	dslConfig := &DSLConfig{Steps: []Step{{
+		Name:   "never",
+		Config: StepConfig{Input: "NA", Model: "gpt-4o", Action: "answer", Output: "STDOUT"},
+	}}}
+	processor := NewProcessor(dslConfig, createTestEnvConfig(), createTestServerConfig(), false, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := processor.ProcessWithContext(ctx)
+	if err == nil || !strings.Contains(err.Error(), "workflow cancelled") {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected error to wrap context.Canceled, got %v", err)
+	}
+}
+
+func TestRaceCancelsSlowerModels(t *testing.T) {
+	provider := &perModelProvider{
+		MockProvider: MockProvider{name: "openai"},
+		delays:       map[string]time.Duration{"gpt-4o": 5 * time.Second},
+	}
+	start := time.Now()
+	processor, err := runModelStrategyStep(t, provider, StepConfig{
+		Model:         []interface{}{"gpt-4o", "gpt-4o-mini"},
+		ModelStrategy: ModelStrategyRace,
+	})
+	if err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	if processor.LastOutput() != "response from gpt-4o-mini" {
+		t.Errorf("LastOutput() = %q", processor.LastOutput())
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("race waited %v for the losing model", elapsed)
+	}
+}
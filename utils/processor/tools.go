@@ -0,0 +1,529 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/database"
+	"github.com/kris-hansen/comanda/utils/fileutil"
+	"github.com/kris-hansen/comanda/utils/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Types of the built-in tools
+const (
+	toolShell    = "shell"
+	toolReadFile = "read_file"
+	toolDatabase = "database"
+	toolHTTP     = "http"
+)
+
+const (
+	defaultMaxToolCalls = 10               // Tool calls a step's model can make unless max_tool_calls is set
+	defaultToolTimeout  = 30 * time.Second // Limit on each tool call unless the tool sets a timeout
+	maxToolOutput       = 64 * 1024        // Bytes of a tool's output sent back to the model
+)
+
+// toolNamePattern matches the tool names that every provider accepts
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// ToolConfig declares a built-in tool that the model of a standard step can call
+type ToolConfig struct {
+	Type        string        `yaml:"type"`        // shell, read_file, database or http
+	Name        string        `yaml:"name"`        // Name the model calls the tool by (defaults to the type)
+	Description string        `yaml:"description"` // Replaces the built-in description
+	Allow       []string      `yaml:"allow"`       // shell: commands that may run; http: URL prefixes that may be called
+	Database    string        `yaml:"database"`    // database: database from the env file to query
+	Timeout     time.Duration `yaml:"timeout"`     // Limit on each call (default 30s)
+}
+
+// toolName returns the name the model calls the tool by
+func (c ToolConfig) toolName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Type
+}
+
+// parseToolConfigs decodes the tools of a standard step. Unknown keys are rejected so that
+// a misspelled allowlist does not go unnoticed.
+func parseToolConfigs(raw []map[string]interface{}) ([]ToolConfig, error) {
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tools: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var tools []ToolConfig
+	if err := decoder.Decode(&tools); err != nil {
+		return nil, fmt.Errorf("invalid tools: %w", err)
+	}
+	return tools, nil
+}
+
+// validateTools checks the tools and max_tool_calls fields of a standard step
+func validateTools(config StepConfig) error {
+	if config.MaxToolCalls != nil && *config.MaxToolCalls <= 0 {
+		return fmt.Errorf("max_tool_calls must be greater than 0")
+	}
+	if len(config.Tools) == 0 || config.Type == "openai-responses" {
+		return nil
+	}
+	if config.Generate != nil || config.Process != nil {
+		return fmt.Errorf("tools can only be used with standard steps")
+	}
+
+	tools, err := parseToolConfigs(config.Tools)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for _, tool := range tools {
+		name := tool.toolName()
+		if !toolNamePattern.MatchString(name) {
+			return fmt.Errorf("tool name %q must be 1 to 64 letters, digits, underscores or dashes", name)
+		}
+		if names[name] {
+			return fmt.Errorf("tool name %q is used more than once", name)
+		}
+		names[name] = true
+		if tool.Timeout < 0 {
+			return fmt.Errorf("tool %s: timeout must not be negative", name)
+		}
+
+		switch tool.Type {
+		case toolShell:
+			if len(tool.Allow) == 0 {
+				return fmt.Errorf("tool %s: shell tools need an allow list of commands", name)
+			}
+		case toolReadFile:
+		case toolDatabase:
+			if tool.Database == "" {
+				return fmt.Errorf("tool %s: database tools need a database", name)
+			}
+		case toolHTTP:
+			if len(tool.Allow) == 0 {
+				return fmt.Errorf("tool %s: http tools need an allow list of URL prefixes", name)
+			}
+			for _, prefix := range tool.Allow {
+				if u, err := url.Parse(prefix); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("tool %s: %q is not an http or https URL", name, prefix)
+				}
+			}
+		case "":
+			return fmt.Errorf("tool %s: type is required (shell, read_file, database or http)", name)
+		default:
+			return fmt.Errorf("tool %s: unknown type %q (expected shell, read_file, database or http)", name, tool.Type)
+		}
+	}
+	return nil
+}
+
+// SetLocalTools sets whether steps may use shell and database tools, which run processes and
+// queries on the local host. They are allowed unless the workflow comes from a server client.
+func (p *Processor) SetLocalTools(allowed bool) {
+	p.noLocalTools = !allowed
+}
+
+// isLocalTool reports whether a tool type runs processes or queries on the local host
+func isLocalTool(toolType string) bool {
+	return toolType == toolShell || toolType == toolDatabase
+}
+
+// validateLocalTools refuses shell and database tools when they are not allowed
+func (p *Processor) validateLocalTools(config StepConfig) error {
+	if !p.noLocalTools || len(config.Tools) == 0 || config.Type == "openai-responses" {
+		return nil
+	}
+	tools, err := parseToolConfigs(config.Tools)
+	if err != nil {
+		return err
+	}
+	for _, tool := range tools {
+		if isLocalTool(tool.Type) {
+			return fmt.Errorf("tool %s: %s tools are disabled for workflows run by the server (set allowLocalTools in the server configuration to enable them)", tool.toolName(), tool.Type)
+		}
+	}
+	return nil
+}
+
+// toolExecutor runs the calls a model makes to one tool
+type toolExecutor struct {
+	tool    models.Tool
+	timeout time.Duration
+	run     func(ctx context.Context, arguments json.RawMessage) (string, error)
+}
+
+// stepTools returns the executors of the current step's tools
+func (p *Processor) stepTools() ([]*toolExecutor, error) {
+	configs, err := parseToolConfigs(p.getCurrentStepConfig().Tools)
+	if err != nil {
+		return nil, err
+	}
+	executors := make([]*toolExecutor, len(configs))
+	for i, cfg := range configs {
+		executor, err := p.newToolExecutor(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Description != "" {
+			executor.tool.Description = cfg.Description
+		}
+		executor.timeout = cfg.Timeout
+		if executor.timeout == 0 {
+			executor.timeout = defaultToolTimeout
+		}
+		executors[i] = executor
+	}
+	return executors, nil
+}
+
+// newToolExecutor creates the executor of a built-in tool
+func (p *Processor) newToolExecutor(cfg ToolConfig) (*toolExecutor, error) {
+	name := cfg.toolName()
+	if p.noLocalTools && isLocalTool(cfg.Type) {
+		return nil, fmt.Errorf("tool %s: %s tools are disabled for workflows run by the server", name, cfg.Type)
+	}
+	switch cfg.Type {
+	case toolShell:
+		return &toolExecutor{
+			tool: models.Tool{
+				Name:        name,
+				Description: "Run a command, without a shell, and return its combined output. Allowed commands: " + strings.Join(cfg.Allow, ", "),
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"command": map[string]interface{}{"type": "string", "enum": stringsToInterfaces(cfg.Allow)},
+						"args":    map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+					},
+					"required": []interface{}{"command"},
+				},
+			},
+			run: func(ctx context.Context, arguments json.RawMessage) (string, error) {
+				return p.runShellTool(ctx, cfg.Allow, arguments)
+			},
+		}, nil
+	case toolReadFile:
+		return &toolExecutor{
+			tool: models.Tool{
+				Name:        name,
+				Description: "Read a text file. Paths are relative to the workflow's working directory, and files outside it cannot be read.",
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"path": map[string]interface{}{"type": "string"},
+					},
+					"required": []interface{}{"path"},
+				},
+			},
+			run: p.runReadFileTool,
+		}, nil
+	case toolDatabase:
+		return &toolExecutor{
+			tool: models.Tool{
+				Name:        name,
+				Description: fmt.Sprintf("Run a single read-only SQL SELECT query on the %s PostgreSQL database and return the rows as JSON.", cfg.Database),
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"query": map[string]interface{}{"type": "string"},
+					},
+					"required": []interface{}{"query"},
+				},
+			},
+			run: func(ctx context.Context, arguments json.RawMessage) (string, error) {
+				return p.runDatabaseTool(ctx, cfg.Database, arguments)
+			},
+		}, nil
+	case toolHTTP:
+		return &toolExecutor{
+			tool: models.Tool{
+				Name:        name,
+				Description: "Call an HTTP endpoint and return its status and body. Allowed URL prefixes: " + strings.Join(cfg.Allow, ", "),
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"url":    map[string]interface{}{"type": "string"},
+						"method": map[string]interface{}{"type": "string", "enum": []interface{}{"GET", "POST", "PUT", "PATCH", "DELETE"}},
+						"body":   map[string]interface{}{"type": "string"},
+					},
+					"required": []interface{}{"url"},
+				},
+			},
+			run: func(ctx context.Context, arguments json.RawMessage) (string, error) {
+				return runHTTPTool(ctx, cfg.Allow, arguments)
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown tool type %q", cfg.Type)
+}
+
+// runTools sends a conversation with the current step's tools. While the model answers with
+// tool calls, it runs them and sends back their results; it returns the model's final answer.
+func (p *Processor) runTools(provider models.Provider, modelName string, messages []models.Message) (string, error) {
+	executors, err := p.stepTools()
+	if err != nil {
+		return "", err
+	}
+	tools := make([]models.Tool, len(executors))
+	byName := make(map[string]*toolExecutor, len(executors))
+	for i, executor := range executors {
+		tools[i] = executor.tool
+		byName[executor.tool.Name] = executor
+	}
+	limit := defaultMaxToolCalls
+	if max := p.getCurrentStepConfig().MaxToolCalls; max != nil {
+		limit = *max
+	}
+
+	calls := 0
+	for {
+		reply, err := provider.SendMessagesWithTools(p.ctx, modelName, messages, tools)
+		if err != nil {
+			return "", err
+		}
+		if len(reply.ToolCalls) == 0 {
+			return reply.Content, nil
+		}
+		calls += len(reply.ToolCalls)
+		if calls > limit {
+			return "", fmt.Errorf("model made more than %d tool calls (max_tool_calls)", limit)
+		}
+
+		messages = append(messages, reply)
+		for _, call := range reply.ToolCalls {
+			messages = append(messages, models.Message{
+				Role:       models.RoleTool,
+				ToolCallID: call.ID,
+				Content:    p.runToolCall(byName[call.Name], call),
+			})
+		}
+	}
+}
+
+// runToolCall runs one tool call and returns the result for the model. Failures are returned
+// to the model as text so that it can correct its call.
+func (p *Processor) runToolCall(executor *toolExecutor, call models.ToolCall) string {
+	if executor == nil {
+		return fmt.Sprintf("Error: unknown tool %q", call.Name)
+	}
+	p.debugf("Calling tool %s with arguments: %s", call.Name, call.Arguments)
+
+	ctx, cancel := context.WithTimeout(p.ctx, executor.timeout)
+	defer cancel()
+	arguments := json.RawMessage(call.Arguments)
+	if len(bytes.TrimSpace(arguments)) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	result, err := executor.run(ctx, arguments)
+	if err != nil {
+		p.debugf("Tool %s failed: %v", call.Name, err)
+		result = "Error: " + err.Error()
+	}
+	if len(result) > maxToolOutput {
+		result = result[:maxToolOutput] + "\n[output truncated]"
+	}
+	return result
+}
+
+// toolRoot returns the directory that tools work in. Like other data paths it is the runtime
+// directory under the server's data directory; without a server configuration it is the
+// runtime directory, or the current directory.
+func (p *Processor) toolRoot() (string, error) {
+	root := p.runtimeDir
+	if p.serverConfig != nil {
+		root = p.resolveDataPath(".")
+	} else if root == "" {
+		root = "."
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(root)
+}
+
+// runShellTool runs an allowed command without a shell, so arguments cannot chain other commands
+func (p *Processor) runShellTool(ctx context.Context, allow []string, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Command string   `json:"command"`
+		Args    []string `json:"args"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	allowed := false
+	for _, command := range allow {
+		if args.Command == command {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return "", fmt.Errorf("command %q is not allowed; allowed commands: %s", args.Command, strings.Join(allow, ", "))
+	}
+
+	root, err := p.toolRoot()
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, args.Command, args.Args...)
+	cmd.Dir = root
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v\n%s", err, output)
+	}
+	return string(output), nil
+}
+
+// runReadFileTool reads a file under the tool root
+func (p *Processor) runReadFileTool(ctx context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	root, err := p.toolRoot()
+	if err != nil {
+		return "", err
+	}
+
+	target := args.Path
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(root, target)
+	}
+	// Resolve symlinks so a link cannot lead outside the root
+	resolved, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		return "", fmt.Errorf("cannot read %s: %w", args.Path, err)
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the working directory", args.Path)
+	}
+
+	content, err := fileutil.SafeReadFile(resolved)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// runDatabaseTool runs a query in a read-only transaction on a database from the env file
+func (p *Processor) runDatabaseTool(ctx context.Context, dbName string, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	if p.envConfig == nil {
+		return "", fmt.Errorf("no environment configuration for database %s", dbName)
+	}
+
+	dbHandler := database.NewHandler(p.envConfig)
+	defer dbHandler.Close()
+	rows, err := dbHandler.ExecuteReadOnly(ctx, dbName, args.Query)
+	if err != nil {
+		return "", err
+	}
+	result, err := json.MarshalIndent(rows, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error converting results to JSON: %w", err)
+	}
+	return string(result), nil
+}
+
+// runHTTPTool calls a URL that starts with one of the allowed prefixes. Redirects are followed
+// only to allowed URLs.
+func runHTTPTool(ctx context.Context, allow []string, arguments json.RawMessage) (string, error) {
+	var args struct {
+		URL    string `json:"url"`
+		Method string `json:"method"`
+		Body   string `json:"body"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	if args.Method == "" {
+		args.Method = http.MethodGet
+	}
+	target, err := url.Parse(args.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	if !urlAllowed(target, allow) {
+		return "", fmt.Errorf("URL %s is not allowed; allowed prefixes: %s", args.URL, strings.Join(allow, ", "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(args.Method), target.String(), strings.NewReader(args.Body))
+	if err != nil {
+		return "", err
+	}
+	if args.Body != "" {
+		if json.Valid([]byte(args.Body)) {
+			req.Header.Set("Content-Type", "application/json")
+		} else {
+			req.Header.Set("Content-Type", "text/plain")
+		}
+	}
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !urlAllowed(req.URL, allow) {
+				return fmt.Errorf("redirect to %s is not allowed", req.URL)
+			}
+			return nil
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxToolOutput+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	return fmt.Sprintf("HTTP %d\n\n%s", resp.StatusCode, body), nil
+}
+
+// urlAllowed reports whether a URL has the scheme and host of an allowed prefix and a path
+// under the prefix's path. Paths are cleaned first so that ".." cannot climb out of a prefix.
+func urlAllowed(target *url.URL, allow []string) bool {
+	if target.User != nil {
+		return false
+	}
+	targetPath := path.Clean("/" + target.Path)
+	for _, prefix := range allow {
+		allowed, err := url.Parse(prefix)
+		if err != nil || allowed.Scheme != target.Scheme || allowed.Host != target.Host {
+			continue
+		}
+		allowedPath := strings.TrimSuffix(path.Clean("/"+allowed.Path), "/")
+		if targetPath == allowedPath || strings.HasPrefix(targetPath, allowedPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// stringsToInterfaces converts strings for use in a JSON Schema
+func stringsToInterfaces(values []string) []interface{} {
+	converted := make([]interface{}, len(values))
+	for i, value := range values {
+		converted[i] = value
+	}
+	return converted
+}
@@ -0,0 +1,282 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models"
+	"gopkg.in/yaml.v3"
+)
+
+func TestValidateTools(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"built-in tools", "tools:\n  - type: shell\n    allow: [ls]\n  - type: read_file\n  - type: http\n    name: weather\n    allow: [\"https://api.example.com/v1\"]\n  - type: database\n    database: sales\nmax_tool_calls: 5\n", ""},
+		{"shell without allow", "tools:\n  - type: shell\n", "allow list of commands"},
+		{"http with a bad prefix", "tools:\n  - type: http\n    allow: [\"ftp://example.com\"]\n", "not an http or https URL"},
+		{"database without a name", "tools:\n  - type: database\n", "need a database"},
+		{"unknown type", "tools:\n  - type: browser\n", "unknown type"},
+		{"missing type", "tools:\n  - name: helper\n", "type is required"},
+		{"misspelled key", "tools:\n  - type: shell\n    allowed: [ls]\n", "invalid tools"},
+		{"duplicate names", "tools:\n  - type: read_file\n  - type: read_file\n", "more than once"},
+		{"invalid name", "tools:\n  - type: read_file\n    name: read file\n", "letters, digits"},
+		{"zero max_tool_calls", "max_tool_calls: 0\n", "max_tool_calls"},
+		{"responses tools are passed through", "type: openai-responses\ntools:\n  - type: web_search\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg StepConfig
+			if err := yaml.Unmarshal([]byte(tt.yaml), &cfg); err != nil {
+				t.Fatalf("yaml.Unmarshal() error: %v", err)
+			}
+			err := validateTools(cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateTools() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateTools() error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLocalToolsDisabled(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"shell", "tools:\n  - type: shell\n    allow: [ls]\n", "shell tools are disabled"},
+		{"database", "tools:\n  - type: database\n    name: sales_db\n    database: sales\n", "tool sales_db: database tools are disabled"},
+		{"read_file and http", "tools:\n  - type: read_file\n  - type: http\n    allow: [\"https://api.example.com/v1\"]\n", ""},
+	}
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false, "")
+	processor.SetLocalTools(false)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg StepConfig
+			if err := yaml.Unmarshal([]byte(tt.yaml), &cfg); err != nil {
+				t.Fatalf("yaml.Unmarshal() error: %v", err)
+			}
+			err := processor.validateLocalTools(cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateLocalTools() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateLocalTools() error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// The executor refuses them too, for steps that skipped validation
+	if _, err := processor.newToolExecutor(ToolConfig{Type: toolShell, Allow: []string{"ls"}}); err == nil {
+		t.Error("expected newToolExecutor() to refuse a shell tool")
+	}
+	processor.SetLocalTools(true)
+	if _, err := processor.newToolExecutor(ToolConfig{Type: toolShell, Allow: []string{"ls"}}); err != nil {
+		t.Errorf("newToolExecutor() error: %v", err)
+	}
+}
+
+// toolStep returns a step that lets gpt-4o-mini call the given tools
+func toolStep(tools []map[string]interface{}, maxToolCalls *int) Step {
+	return Step{Name: "agent", Config: StepConfig{
+		Input:        "NA",
+		Model:        "gpt-4o-mini",
+		Action:       "What do my notes say?",
+		Output:       "STDOUT",
+		Tools:        tools,
+		MaxToolCalls: maxToolCalls,
+	}}
+}
+
+func TestToolLoop(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("buy milk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	provider := newScriptedProvider("Your notes say to buy milk.")
+	provider.toolCalls = [][]models.ToolCall{{{ID: "call_1", Name: "read_file", Arguments: `{"path":"notes.txt"}`}}}
+	useScriptedProvider(t, provider)
+
+	step := toolStep([]map[string]interface{}{{"type": "read_file"}}, nil)
+	processor := NewProcessor(&DSLConfig{Steps: []Step{step}}, createTestEnvConfig(), createTestServerConfig(), false, dir)
+	if err := processor.Process(); err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+	if got := processor.lastOutput; got != "Your notes say to buy milk." {
+		t.Errorf("output = %q", got)
+	}
+
+	if len(provider.messages) != 2 {
+		t.Fatalf("expected 2 model calls, got %d", len(provider.messages))
+	}
+	second := provider.messages[1]
+	if len(second) != 3 || second[1].Role != models.RoleAssistant || len(second[1].ToolCalls) != 1 {
+		t.Fatalf("second call messages = %+v", second)
+	}
+	if result := second[2]; result.Role != models.RoleTool || result.ToolCallID != "call_1" || result.Content != "buy milk" {
+		t.Errorf("tool result = %+v", result)
+	}
+}
+
+func TestToolLoopStopsAtMaxToolCalls(t *testing.T) {
+	provider := newScriptedProvider("never sent")
+	call := models.ToolCall{ID: "call", Name: "read_file", Arguments: `{"path":"missing.txt"}`}
+	provider.toolCalls = [][]models.ToolCall{{call}, {call}}
+	useScriptedProvider(t, provider)
+
+	limit := 1
+	step := toolStep([]map[string]interface{}{{"type": "read_file"}}, &limit)
+	processor := NewProcessor(&DSLConfig{Steps: []Step{step}}, createTestEnvConfig(), createTestServerConfig(), false, t.TempDir())
+	err := processor.Process()
+	if err == nil || !strings.Contains(err.Error(), "more than 1 tool calls") {
+		t.Errorf("Process() error = %v, want the max_tool_calls error", err)
+	}
+}
+
+func TestRunToolCallReportsErrorsToModel(t *testing.T) {
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false, t.TempDir())
+	if got := processor.runToolCall(nil, models.ToolCall{Name: "missing"}); got != `Error: unknown tool "missing"` {
+		t.Errorf("unknown tool result = %q", got)
+	}
+	failing := &toolExecutor{timeout: defaultToolTimeout, run: func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		return "", fmt.Errorf("boom")
+	}}
+	if got := processor.runToolCall(failing, models.ToolCall{Name: "failing"}); got != "Error: boom" {
+		t.Errorf("failing tool result = %q", got)
+	}
+}
+
+func TestShellTool(t *testing.T) {
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false, t.TempDir())
+	output, err := processor.runShellTool(context.Background(), []string{"echo"}, json.RawMessage(`{"command":"echo","args":["hi; rm -rf /"]}`))
+	if err != nil || output != "hi; rm -rf /\n" {
+		t.Errorf("runShellTool(echo) = %q, %v", output, err)
+	}
+	if _, err := processor.runShellTool(context.Background(), []string{"echo"}, json.RawMessage(`{"command":"rm","args":["x"]}`)); err == nil {
+		t.Error("expected a command outside the allow list to be refused")
+	}
+}
+
+func TestReadFileToolStaysInRoot(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false, root)
+
+	for _, path := range []string{"../" + filepath.Base(outside) + "/secret.txt", filepath.Join(outside, "secret.txt"), "link.txt"} {
+		arguments, _ := json.Marshal(map[string]string{"path": path})
+		if _, err := processor.runReadFileTool(context.Background(), arguments); err == nil || !strings.Contains(err.Error(), "outside the working directory") {
+			t.Errorf("runReadFileTool(%s) error = %v, want an outside error", path, err)
+		}
+	}
+}
+
+func TestReadFileToolStaysInDataDir(t *testing.T) {
+	dir := t.TempDir()
+	dataDir := filepath.Join(dir, "data")
+	if err := os.MkdirAll(filepath.Join(dataDir, "jobs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "jobs", "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("OPENAI_API_KEY=secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := createTestServerConfig()
+	serverConfig.DataDir = dataDir
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), serverConfig, false, "jobs")
+	processor.SetLocalTools(false)
+
+	output, err := processor.runReadFileTool(context.Background(), json.RawMessage(`{"path":"notes.txt"}`))
+	if err != nil || output != "notes" {
+		t.Errorf("runReadFileTool(notes.txt) = %q, %v, want the file under the data directory", output, err)
+	}
+	// Neither files beside the data directory nor those of the server's working directory
+	for _, path := range []string{"../../.env", filepath.Join(dir, ".env"), "tools_test.go"} {
+		arguments, _ := json.Marshal(map[string]string{"path": path})
+		if output, err := processor.runReadFileTool(context.Background(), arguments); err == nil {
+			t.Errorf("runReadFileTool(%s) = %q, want an error", path, output)
+		}
+	}
+}
+
+func TestHTTPTool(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/redirect" {
+			http.Redirect(w, r, "/private", http.StatusFound)
+			return
+		}
+		fmt.Fprintf(w, "%s %s", r.Method, r.URL.Path)
+	}))
+	defer server.Close()
+	allow := []string{server.URL + "/api"}
+
+	tests := []struct {
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{server.URL + "/api/items", "HTTP 200\n\nGET /api/items", false},
+		{server.URL + "/apikeys", "", true},
+		{server.URL + "/api/../private", "", true},
+		{server.URL + "/api/redirect", "", true},
+	}
+	for _, tt := range tests {
+		arguments, _ := json.Marshal(map[string]string{"url": tt.url})
+		got, err := runHTTPTool(context.Background(), allow, arguments)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("runHTTPTool(%s) = %q, %v", tt.url, got, err)
+		}
+	}
+}
+
+func TestURLAllowed(t *testing.T) {
+	allow := []string{"https://api.example.com/v1/", "http://localhost:8080"}
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://api.example.com/v1/users", true},
+		{"https://api.example.com/v1", true},
+		{"https://api.example.com/v2/users", false},
+		{"https://api.example.com.evil.com/v1/users", false},
+		{"http://api.example.com/v1/users", false},
+		{"https://user@api.example.com/v1/users", false},
+		{"http://localhost:8080/anything", true},
+		{"http://localhost:9090/anything", false},
+	}
+	for _, tt := range tests {
+		target, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := urlAllowed(target, allow); got != tt.want {
+			t.Errorf("urlAllowed(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
@@ -1,23 +1,47 @@
 package processor
 
+import "time"
+
 // StepConfig represents the configuration for a single step
 type StepConfig struct {
-	Type       string      `yaml:"type"`        // Step type (default is standard LLM step)
-	Input      interface{} `yaml:"input"`       // Can be string or map[string]interface{}
-	Model      interface{} `yaml:"model"`       // Can be string or []string
-	Action     interface{} `yaml:"action"`      // Can be string or []string
-	Output     interface{} `yaml:"output"`      // Can be string or []string
-	NextAction interface{} `yaml:"next-action"` // Can be string or []string
-	BatchMode  string      `yaml:"batch_mode"`  // How to process multiple files: "combined" (default) or "individual"
-	SkipErrors bool        `yaml:"skip_errors"` // Whether to continue processing if some files fail
+	Type          string          `yaml:"type"`           // Step type (default is standard LLM step)
+	Input         interface{}     `yaml:"input"`          // Can be string or map[string]interface{}
+	Model         interface{}     `yaml:"model"`          // Can be string or []string
+	ModelStrategy string          `yaml:"model_strategy"` // How a list of models is used: "fallback" (default), "race" or "all"
+	Action        interface{}     `yaml:"action"`         // Can be string or []string
+	Output        interface{}     `yaml:"output"`         // Can be string or []string
+	NextAction    interface{}     `yaml:"next-action"`    // Can be string or []string
+	BatchMode     string          `yaml:"batch_mode"`     // How to process multiple files: "combined" (default) or "individual"
+	SkipErrors    bool            `yaml:"skip_errors"`    // Whether to continue processing if some files fail
+	When          string          `yaml:"when"`           // Condition that must evaluate to true for the step to run
+	ForEach       *ForEachConfig  `yaml:"for_each"`       // Run the step once for each item of a list
+	DependsOn     interface{}     `yaml:"depends_on"`     // Steps or parallel groups that must complete first (string or []string)
+	Retry         *RetryConfig    `yaml:"retry"`          // Retry policy for failed model calls
+	Timeout       time.Duration   `yaml:"timeout"`        // Maximum duration of the step (0 for no limit)
+	Cache         *CacheConfig    `yaml:"cache"`          // Reuse cached model responses (true, false or a TTL)
+	OutputSchema  interface{}     `yaml:"output_schema"`  // JSON Schema the response must match, inline or a file path
+	SchemaRetries *int            `yaml:"schema_retries"` // Repair prompts sent when the response does not match (default 2)
+	Chunking      *ChunkingConfig `yaml:"chunking"`       // Split large inputs and run the action on each chunk
+	ReduceAction  interface{}     `yaml:"reduce_action"`  // Combines the per-chunk results (string or []string)
+	ReduceModel   interface{}     `yaml:"reduce_model"`   // Model for reduce_action (defaults to the step's model)
+	ContextCheck  string          `yaml:"context_check"`  // Prompts estimated not to fit the context window: warn (default), error or off
+	Conversation  string          `yaml:"conversation"`   // Steps with the same ID share their message history
+	MaxToolCalls  *int            `yaml:"max_tool_calls"` // Tool calls the model can make in the step (default 10)
+	Embed         *EmbedConfig    `yaml:"embed"`          // Settings of embed steps: split, query and top_k
+
+	// Model parameters, overriding the model's defaults from the env file
+	Temperature *float64    `yaml:"temperature"` // Sampling temperature
+	MaxTokens   *int        `yaml:"max_tokens"`  // Maximum tokens in the response
+	TopP        *float64    `yaml:"top_p"`       // Top-p sampling
+	Stop        interface{} `yaml:"stop"`        // Sequences that end the response (string or []string)
+	Seed        *int        `yaml:"seed"`        // Seed for reproducible sampling, where the provider supports one
+	System      string      `yaml:"system"`      // System prompt
 
 	// OpenAI Responses API specific fields
 	Instructions       string                   `yaml:"instructions"`         // System message
-	Tools              []map[string]interface{} `yaml:"tools"`                // Tools configuration
+	Tools              []map[string]interface{} `yaml:"tools"`                // Tools configuration (built-in tools on standard steps)
 	PreviousResponseID string                   `yaml:"previous_response_id"` // For conversation state
 	MaxOutputTokens    int                      `yaml:"max_output_tokens"`    // Token limit
-	Temperature        float64                  `yaml:"temperature"`          // Temperature setting
-	TopP               float64                  `yaml:"top_p"`                // Top-p sampling
 	Stream             bool                     `yaml:"stream"`               // Whether to stream the response
 	ResponseFormat     map[string]interface{}   `yaml:"response_format"`      // Format specification (e.g., JSON)
 
@@ -34,8 +58,14 @@ type Step struct {
 
 // DSLConfig represents the structure of the DSL configuration
 type DSLConfig struct {
-	Steps         []Step
-	ParallelSteps map[string][]Step // Steps that can be executed in parallel
+	Steps          []Step
+	ParallelSteps  map[string][]Step    // Steps that can be executed in parallel
+	Order          []string             // Top-level step and parallel group names in file order
+	Timeout        time.Duration        // Maximum duration of the whole workflow (0 for no limit)
+	TemplateSyntax string               // Template syntax of actions and paths: compat (default) or go
+	Outputs        map[string]string    // Values exported to workflows that run this one in a process step
+	Params         map[string]ParamSpec // Parameters set with --set, a params file or a process step's inputs
+	MaxCost        float64              // Budget of the run in US dollars (0 for no limit)
 }
 
 // StepDependency represents a dependency between steps
@@ -0,0 +1,234 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// ErrBudgetExceeded is returned when a model call would take a run over its max_cost budget
+var ErrBudgetExceeded = errors.New("max_cost budget exceeded")
+
+// UsageReport is the token usage and cost of a step or a whole run
+type UsageReport struct {
+	models.Usage
+	Calls    int      `json:"calls"`              // Model calls that reported usage
+	Cost     float64  `json:"cost"`               // Cost in US dollars of the priced models
+	Unpriced []string `json:"unpriced,omitempty"` // Models used that have no entry in the pricing table
+}
+
+// add records the usage and cost of one model call
+func (r *UsageReport) add(modelName string, usage models.Usage, cost float64, priced bool) {
+	r.Usage.Add(usage)
+	r.Calls++
+	r.Cost += cost
+	if !priced {
+		for _, name := range r.Unpriced {
+			if name == modelName {
+				return
+			}
+		}
+		r.Unpriced = append(r.Unpriced, modelName)
+		sort.Strings(r.Unpriced)
+	}
+}
+
+// copy returns a copy of the report that does not share the unpriced list
+func (r *UsageReport) copy() UsageReport {
+	c := *r
+	c.Unpriced = append([]string(nil), r.Unpriced...)
+	return c
+}
+
+// usageTracker aggregates the usage of a run per step and enforces its max_cost budget.
+// The tracker of a sub-workflow also reports to the tracker of the workflow that runs it.
+type usageTracker struct {
+	mu         sync.Mutex
+	envConfig  *config.EnvConfig
+	maxCost    float64 // Budget in US dollars (0 for no limit)
+	total      UsageReport
+	steps      map[string]*UsageReport
+	parent     *usageTracker
+	parentStep string // Step of the parent workflow that runs this one
+}
+
+func newUsageTracker(envConfig *config.EnvConfig) *usageTracker {
+	return &usageTracker{envConfig: envConfig, steps: make(map[string]*UsageReport)}
+}
+
+// price returns the cost of usage on a model, and whether the model has a price
+func (t *usageTracker) price(modelName string, usage models.Usage) (float64, bool) {
+	if t.envConfig == nil {
+		return 0, false
+	}
+	price, ok := t.envConfig.GetModelPrice(modelName)
+	if !ok {
+		return 0, false
+	}
+	cachedPrice := price.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = price.Input
+	}
+	cost := float64(usage.InputTokens-usage.CachedTokens)*price.Input +
+		float64(usage.CachedTokens)*cachedPrice +
+		float64(usage.OutputTokens)*price.Output
+	return cost / 1e6, true
+}
+
+// record adds the usage of a model call made by a step
+func (t *usageTracker) record(stepName string, modelName string, usage models.Usage) {
+	cost, priced := t.price(modelName, usage)
+
+	t.mu.Lock()
+	t.total.add(modelName, usage, cost, priced)
+	report, ok := t.steps[stepName]
+	if !ok {
+		report = &UsageReport{}
+		t.steps[stepName] = report
+	}
+	report.add(modelName, usage, cost, priced)
+	t.mu.Unlock()
+
+	if t.parent != nil {
+		t.parent.record(t.parentStep, modelName, usage)
+	}
+}
+
+// checkBudget returns an error if a call to a model with about inputTokens of prompt would
+// take the run, or a workflow running it, over its budget. Output tokens are not known in
+// advance, so a call is allowed as long as its input fits in what is left.
+func (t *usageTracker) checkBudget(modelName string, inputTokens int) error {
+	estimate, _ := t.price(modelName, models.Usage{InputTokens: inputTokens})
+
+	t.mu.Lock()
+	spent, maxCost := t.total.Cost, t.maxCost
+	t.mu.Unlock()
+
+	if maxCost > 0 && spent+estimate > maxCost {
+		return fmt.Errorf("%w: spent $%.4f of $%.4f, next call to %s estimated at $%.4f",
+			ErrBudgetExceeded, spent, maxCost, modelName, estimate)
+	}
+	if t.parent != nil {
+		return t.parent.checkBudget(modelName, inputTokens)
+	}
+	return nil
+}
+
+// report returns the usage of the whole run
+func (t *usageTracker) report() UsageReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total.copy()
+}
+
+// stepReport returns the usage of a step, or nil if it made no model calls
+func (t *usageTracker) stepReport(stepName string) *UsageReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	report, ok := t.steps[stepName]
+	if !ok {
+		return nil
+	}
+	c := report.copy()
+	return &c
+}
+
+// SetMaxCost sets the run's budget in US dollars, replacing the workflow's max_cost (0 for no limit)
+func (p *Processor) SetMaxCost(maxCost float64) {
+	p.usage.maxCost = maxCost
+}
+
+// Usage returns the token usage and cost of the run so far
+func (p *Processor) Usage() UsageReport {
+	return p.usage.report()
+}
+
+// StepUsage returns the token usage and cost of a step, or nil if it made no model calls
+func (p *Processor) StepUsage(stepName string) *UsageReport {
+	return p.usage.stepReport(stepName)
+}
+
+// usageContext returns a context whose model calls are recorded as usage of a step
+func (p *Processor) usageContext(ctx context.Context, stepName string) context.Context {
+	tracker := p.usage
+	return models.WithUsageRecorder(ctx, func(modelName string, usage models.Usage) {
+		tracker.record(stepName, modelName, usage)
+	})
+}
+
+// usageProvider records the usage of the prompts sent through a provider and stops
+// prompts that would exceed the budget
+type usageProvider struct {
+	models.Provider
+	processor *Processor
+	stepName  string
+}
+
+// SendPrompt checks the budget, then sends the prompt and records its usage
+func (u *usageProvider) SendPrompt(ctx context.Context, modelName string, prompt string) (string, error) {
+	if err := u.processor.usage.checkBudget(modelName, models.EstimateTokens(modelName, prompt)); err != nil {
+		return "", err
+	}
+	return u.Provider.SendPrompt(u.processor.usageContext(ctx, u.stepName), modelName, prompt)
+}
+
+// SendPromptStream checks the budget, then streams the prompt and records its usage
+func (u *usageProvider) SendPromptStream(ctx context.Context, modelName string, prompt string, onDelta func(delta string)) (string, error) {
+	if err := u.processor.usage.checkBudget(modelName, models.EstimateTokens(modelName, prompt)); err != nil {
+		return "", err
+	}
+	return models.SendPromptStream(u.processor.usageContext(ctx, u.stepName), u.Provider, modelName, prompt, onDelta)
+}
+
+// SendPromptWithFile checks the budget, then sends the prompt with the file and records its usage
+func (u *usageProvider) SendPromptWithFile(ctx context.Context, modelName string, prompt string, file models.FileInput) (string, error) {
+	tokens := models.EstimateTokens(modelName, prompt)
+	if info, err := os.Stat(file.Path); err == nil {
+		tokens += models.EstimateTokensForSize(modelName, info.Size())
+	}
+	if err := u.processor.usage.checkBudget(modelName, tokens); err != nil {
+		return "", err
+	}
+	return u.Provider.SendPromptWithFile(u.processor.usageContext(ctx, u.stepName), modelName, prompt, file)
+}
+
+// SendMessages checks the budget, then sends the conversation and records its usage
+func (u *usageProvider) SendMessages(ctx context.Context, modelName string, messages []models.Message) (string, error) {
+	if err := u.processor.usage.checkBudget(modelName, models.EstimateTokens(modelName, models.MessagesText(messages))); err != nil {
+		return "", err
+	}
+	return u.Provider.SendMessages(u.processor.usageContext(ctx, u.stepName), modelName, messages)
+}
+
+// SendMessagesWithTools checks the budget, then sends the conversation with the tools and records its usage
+func (u *usageProvider) SendMessagesWithTools(ctx context.Context, modelName string, messages []models.Message, tools []models.Tool) (models.Message, error) {
+	if err := u.processor.usage.checkBudget(modelName, models.EstimateTokens(modelName, models.MessagesText(messages))); err != nil {
+		return models.Message{}, err
+	}
+	return u.Provider.SendMessagesWithTools(u.processor.usageContext(ctx, u.stepName), modelName, messages, tools)
+}
+
+// Embed checks the budget, then embeds the texts and records their usage
+func (u *usageProvider) Embed(ctx context.Context, modelName string, texts []string) ([][]float32, error) {
+	if err := u.processor.usage.checkBudget(modelName, models.EstimateTokens(modelName, strings.Join(texts, "\n"))); err != nil {
+		return nil, err
+	}
+	return models.Embed(u.processor.usageContext(ctx, u.stepName), u.Provider, modelName, texts)
+}
+
+// withUsage wraps a provider so that calls made for the current step are recorded in the
+// run's usage and checked against its budget
+func (p *Processor) withUsage(provider models.Provider) models.Provider {
+	stepName := ""
+	if p.currentStep != nil {
+		stepName = p.currentStep.Name
+	}
+	return &usageProvider{Provider: provider, processor: p, stepName: stepName}
+}
@@ -0,0 +1,189 @@
+package processor
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// usageEnvConfig returns a test environment that prices gpt-4o-mini
+func usageEnvConfig() *config.EnvConfig {
+	envConfig := createTestEnvConfig()
+	envConfig.Pricing = map[string]config.ModelPrice{
+		"gpt-4o-mini": {Input: 1, Output: 2, CachedInput: 0.5},
+	}
+	return envConfig
+}
+
+// usageSteps returns n steps that each send one prompt to gpt-4o-mini
+func usageSteps(n int) []Step {
+	names := []string{"first", "second", "third"}
+	var steps []Step
+	for _, name := range names[:n] {
+		steps = append(steps, Step{Name: name, Config: StepConfig{
+			Input:  "NA",
+			Model:  "gpt-4o-mini",
+			Action: "say " + name,
+			Output: "STDOUT",
+		}})
+	}
+	return steps
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestUsagePrice(t *testing.T) {
+	tracker := newUsageTracker(usageEnvConfig())
+	tests := []struct {
+		name   string
+		model  string
+		usage  models.Usage
+		cost   float64
+		priced bool
+	}{
+		{"input and output", "gpt-4o-mini", models.Usage{InputTokens: 1000, OutputTokens: 500}, 0.002, true},
+		{"cached input", "gpt-4o-mini", models.Usage{InputTokens: 1000, OutputTokens: 500, CachedTokens: 200}, 0.0019, true},
+		{"unpriced model", "gpt-4o", models.Usage{InputTokens: 1000, OutputTokens: 500}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost, priced := tracker.price(tt.model, tt.usage)
+			if !almostEqual(cost, tt.cost) || priced != tt.priced {
+				t.Errorf("price() = %v, %v, want %v, %v", cost, priced, tt.cost, tt.priced)
+			}
+		})
+	}
+}
+
+func TestWorkflowUsage(t *testing.T) {
+	provider := newScriptedProvider("one", "two")
+	provider.usage = models.Usage{InputTokens: 1000, OutputTokens: 500, CachedTokens: 200}
+	useScriptedProvider(t, provider)
+
+	progressChan := make(chan ProgressUpdate, 100)
+	processor := NewProcessor(&DSLConfig{Steps: usageSteps(2)}, usageEnvConfig(), createTestServerConfig(), false, "")
+	processor.SetProgressWriter(NewChannelProgressWriter(progressChan))
+	if err := processor.Process(); err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+
+	total := processor.Usage()
+	if total.Calls != 2 || total.InputTokens != 2000 || total.OutputTokens != 1000 || total.CachedTokens != 400 {
+		t.Errorf("Usage() = %+v", total)
+	}
+	if !almostEqual(total.Cost, 0.0038) {
+		t.Errorf("Usage().Cost = %v, want 0.0038", total.Cost)
+	}
+	first := processor.StepUsage("first")
+	if first == nil || first.Calls != 1 || !almostEqual(first.Cost, 0.0019) {
+		t.Errorf("StepUsage(first) = %+v", first)
+	}
+	if processor.StepUsage("missing") != nil {
+		t.Error("StepUsage(missing) should be nil")
+	}
+
+	close(progressChan)
+	var completed int
+	for update := range progressChan {
+		if strings.HasPrefix(update.Message, "Completed step") {
+			completed++
+			if update.Usage == nil || update.Usage.Calls != 1 {
+				t.Errorf("completion update %q has usage %+v", update.Message, update.Usage)
+			}
+		}
+	}
+	if completed != 2 {
+		t.Errorf("expected 2 completion updates, got %d", completed)
+	}
+}
+
+func TestUnpricedModelUsage(t *testing.T) {
+	provider := newScriptedProvider("one")
+	provider.usage = models.Usage{InputTokens: 10, OutputTokens: 5}
+	useScriptedProvider(t, provider)
+
+	processor := NewProcessor(&DSLConfig{Steps: usageSteps(1)}, createTestEnvConfig(), createTestServerConfig(), false, "")
+	if err := processor.Process(); err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+	total := processor.Usage()
+	if total.Cost != 0 || len(total.Unpriced) != 1 || total.Unpriced[0] != "gpt-4o-mini" {
+		t.Errorf("Usage() = %+v", total)
+	}
+}
+
+func TestMaxCostAbortsRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxCost float64
+		prompts int
+		wantErr bool
+	}{
+		{"within budget", 1, 3, false},
+		{"stops before overspending", 0.002, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newScriptedProvider("one", "two", "three")
+			provider.usage = models.Usage{InputTokens: 1000, OutputTokens: 500, CachedTokens: 200}
+			useScriptedProvider(t, provider)
+
+			dslConfig := &DSLConfig{Steps: usageSteps(3), MaxCost: tt.maxCost}
+			processor := NewProcessor(dslConfig, usageEnvConfig(), createTestServerConfig(), false, "")
+			err := processor.Process()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Process() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), ErrBudgetExceeded.Error()) {
+				t.Errorf("error %q does not mention the budget", err)
+			}
+			if len(provider.prompts) != tt.prompts {
+				t.Errorf("sent %d prompts, want %d", len(provider.prompts), tt.prompts)
+			}
+		})
+	}
+}
+
+func TestSetMaxCostOverridesWorkflow(t *testing.T) {
+	provider := newScriptedProvider("one", "two")
+	provider.usage = models.Usage{InputTokens: 1000, OutputTokens: 500}
+	useScriptedProvider(t, provider)
+
+	dslConfig := &DSLConfig{Steps: usageSteps(2), MaxCost: 100}
+	processor := NewProcessor(dslConfig, usageEnvConfig(), createTestServerConfig(), false, "")
+	processor.SetMaxCost(0.001)
+	if err := processor.Process(); err == nil {
+		t.Fatal("expected the run to stop at the budget set with SetMaxCost")
+	}
+	if len(provider.prompts) != 1 {
+		t.Errorf("sent %d prompts, want 1", len(provider.prompts))
+	}
+}
+
+func TestParseMaxCost(t *testing.T) {
+	tests := []struct {
+		yaml    string
+		want    float64
+		wantErr bool
+	}{
+		{"max_cost: 2.5\n", 2.5, false},
+		{"max_cost: 0\n", 0, true},
+		{"max_cost: -1\n", 0, true},
+		{"max_cost: lots\n", 0, true},
+	}
+	for _, tt := range tests {
+		dslConfig, err := ParseDSL([]byte(tt.yaml))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDSL(%q) error = %v, wantErr %v", tt.yaml, err, tt.wantErr)
+			continue
+		}
+		if err == nil && dslConfig.MaxCost != tt.want {
+			t.Errorf("ParseDSL(%q).MaxCost = %v, want %v", tt.yaml, dslConfig.MaxCost, tt.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package scraper
 
 import (
+	"context"
 	"log"
 	"strings"
 
@@ -36,8 +37,11 @@ func NewScraper() *Scraper {
 	}
 }
 
-// Scrape performs web scraping on the given URL and returns structured data
-func (s *Scraper) Scrape(url string) (*ScrapedData, error) {
+// Scrape performs web scraping on the given URL and returns structured data.
+// The request is aborted when ctx is cancelled.
+func (s *Scraper) Scrape(ctx context.Context, url string) (*ScrapedData, error) {
+	s.collector.Context = ctx
+
 	data := &ScrapedData{
 		URL: url,
 	}
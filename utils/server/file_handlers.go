@@ -15,7 +15,6 @@ import (
 
 	"github.com/kris-hansen/comanda/utils/config"
 	"github.com/kris-hansen/comanda/utils/processor"
-	"gopkg.in/yaml.v3"
 )
 
 // ensureRuntimeDir creates the specified runtime directory if it doesn't exist
@@ -761,9 +760,9 @@ func (s *Server) handleYAMLProcess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// First unmarshal into a map to preserve step names
-	var rawConfig map[string]processor.StepConfig
-	if err := yaml.Unmarshal([]byte(req.Content), &rawConfig); err != nil {
+	// Parse the workflow preserving step order
+	dslConfig, err := processor.ParseDSL([]byte(req.Content))
+	if err != nil {
 		if req.Streaming {
 			w.Header().Set("Content-Type", "text/event-stream")
 			w.Header().Set("Cache-Control", "no-cache")
@@ -791,26 +790,29 @@ func (s *Server) handleYAMLProcess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert map to ordered Steps slice
-	var dslConfig processor.DSLConfig
-	for name, config := range rawConfig {
-		dslConfig.Steps = append(dslConfig.Steps, processor.Step{
-			Name:   name,
-			Config: config,
-		})
-	}
-
 	// Get runtime directory from query parameter
 	runtimeDir := r.URL.Query().Get("runtimeDir")
 
 	// Create processor instance with validation enabled and runtime directory
-	proc := processor.NewProcessor(&dslConfig, s.envConfig, s.config, true, runtimeDir)
+	proc := processor.NewProcessor(dslConfig, s.envConfig, s.config, true, runtimeDir)
+	proc.SetLocalTools(s.config.AllowLocalTools)
 
 	// Set input if provided
 	if req.Input != "" {
 		proc.SetLastOutput(req.Input)
 	}
 
+	// Apply the workflow parameters, including defaults when none are sent
+	if err := proc.SetParams(req.Params); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ProcessResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
 	// Check Accept header for streaming
 	if r.Header.Get("Accept") == "text/event-stream" {
 		req.Streaming = true
@@ -847,10 +849,10 @@ func (s *Server) handleYAMLProcess(w http.ResponseWriter, r *http.Request) {
 		// Set up processor with progress writer
 		proc.SetProgressWriter(progressWriter)
 
-		// Run the processor in a goroutine
-		processDone := make(chan error)
+		// Run the processor in a goroutine, cancelling it if the client disconnects
+		processDone := make(chan error, 1)
 		go func() {
-			processDone <- proc.Process()
+			processDone <- proc.ProcessWithContext(r.Context())
 		}()
 
 		// Start heartbeat ticker
@@ -862,8 +864,12 @@ func (s *Server) handleYAMLProcess(w http.ResponseWriter, r *http.Request) {
 			select {
 			case <-r.Context().Done():
 				// Client disconnected
+				drainProgress(progressChan, processDone)
 				return
 			case err := <-processDone:
+				if usage := runUsage(proc); usage != nil {
+					sseWriter.SendUsage(usage)
+				}
 				if err != nil {
 					sseWriter.SendError(err)
 				} else {
@@ -876,6 +882,8 @@ func (s *Server) handleYAMLProcess(w http.ResponseWriter, r *http.Request) {
 					sseWriter.SendSpinner(update.Message)
 				case processor.ProgressStep:
 					sseWriter.SendProgress(update.Message)
+				case processor.ProgressSkipped:
+					sseWriter.SendProgress(update.Message)
 				case processor.ProgressComplete:
 					sseWriter.SendComplete(update.Message)
 				case processor.ProgressError:
@@ -902,7 +910,7 @@ func (s *Server) handleYAMLProcess(w http.ResponseWriter, r *http.Request) {
 
 	config.DebugLog("Starting DSL processing")
 
-	err := proc.Process()
+	err = proc.ProcessWithContext(r.Context())
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -925,6 +933,7 @@ func (s *Server) handleYAMLProcess(w http.ResponseWriter, r *http.Request) {
 			Success: false,
 			Error:   fmt.Sprintf("Error processing YAML: %v", err),
 			Output:  finalOutput,
+			Usage:   runUsage(proc),
 		})
 		return
 	}
@@ -934,6 +943,7 @@ func (s *Server) handleYAMLProcess(w http.ResponseWriter, r *http.Request) {
 		Success: true,
 		Message: "YAML processed successfully",
 		Output:  finalOutput,
+		Usage:   runUsage(proc),
 	})
 }
 
@@ -69,6 +69,7 @@ func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	modelForGeneration = s.envConfig.ResolveModel(modelForGeneration)
 
 	config.VerboseLog("Generating workflow using model: %s", modelForGeneration)
 	config.DebugLog("Generate request: prompt_length=%d, model=%s", len(req.Prompt), modelForGeneration)
@@ -113,11 +114,25 @@ CRITICAL INSTRUCTION: Your entire response must be valid YAML syntax that can be
 			return
 		}
 	}
+	if ollama, ok := provider.(*models.OllamaProvider); ok {
+		hosts, routing, err := s.envConfig.OllamaHosts()
+		if err == nil {
+			err = ollama.SetHosts(hosts, routing)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(GenerateResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Failed to configure provider %s: %v", provider.Name(), err),
+			})
+			return
+		}
+	}
 	provider.SetVerbose(config.Verbose)
 
 	// Call the LLM
 	config.DebugLog("Sending prompt to LLM: model=%s, prompt_length=%d", modelForGeneration, len(fullPrompt))
-	generatedResponse, err := provider.SendPrompt(modelForGeneration, fullPrompt)
+	generatedResponse, err := provider.SendPrompt(r.Context(), modelForGeneration, fullPrompt)
 	if err != nil {
 		config.VerboseLog("LLM execution failed: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
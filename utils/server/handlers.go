@@ -17,7 +17,6 @@ import (
 	"github.com/kris-hansen/comanda/utils/config"
 	"github.com/kris-hansen/comanda/utils/fileutil"
 	"github.com/kris-hansen/comanda/utils/processor"
-	"gopkg.in/yaml.v3"
 )
 
 // No default runtime directory - use data directory by default
@@ -222,9 +221,9 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 	// Log YAML content details before parsing
 	config.DebugLog("Processing YAML content: length=%d bytes", len(yamlContent))
 
-	// First unmarshal into a map to preserve step names (same as CLI)
-	var rawConfig map[string]processor.StepConfig
-	if err := yaml.Unmarshal(yamlContent, &rawConfig); err != nil {
+	// Parse the workflow preserving step order (same as CLI)
+	dslConfig, err := processor.ParseDSL(yamlContent)
+	if err != nil {
 		config.VerboseLog("Error parsing YAML: %v", err)
 		config.DebugLog("YAML parse error: content_preview='%s' error=%v", truncateString(string(yamlContent), 200), err)
 		w.WriteHeader(http.StatusBadRequest)
@@ -249,15 +248,9 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 		return
 	}
 
-	// Convert map to ordered Steps slice (same as CLI)
-	var dslConfig processor.DSLConfig
-	config.DebugLog("Converting YAML to DSL config: step_count=%d", len(rawConfig))
-	for name, stepConfig := range rawConfig {
-		config.DebugLog("Processing step: name=%s model=%v action=%v", name, stepConfig.Model, stepConfig.Action)
-		dslConfig.Steps = append(dslConfig.Steps, processor.Step{
-			Name:   name,
-			Config: stepConfig,
-		})
+	config.DebugLog("Parsed DSL config: step_count=%d parallel_groups=%d", len(dslConfig.Steps), len(dslConfig.ParallelSteps))
+	for _, step := range dslConfig.Steps {
+		config.DebugLog("Processing step: name=%s model=%v action=%v", step.Name, step.Config.Model, step.Config.Action)
 	}
 
 	// Get runtime directory from query parameter or calculate from path
@@ -278,7 +271,8 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 
 	// Create and configure processor with runtime directory
 	config.DebugLog("Creating processor instance with validation enabled")
-	proc := processor.NewProcessor(&dslConfig, envConfig, serverConfig, true, runtimeDir)
+	proc := processor.NewProcessor(dslConfig, envConfig, serverConfig, true, runtimeDir)
+	proc.SetLocalTools(serverConfig.AllowLocalTools)
 	config.DebugLog("Processor created successfully with config: steps=%d, runtimeDir=%s", len(dslConfig.Steps), runtimeDir)
 
 	// Handle POST input with detailed logging
@@ -289,17 +283,31 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 	// First check query parameter
 	stdinInput = r.URL.Query().Get("input")
 
-	// If not in query, check JSON body
-	if stdinInput == "" && r.Body != nil {
+	// Check the JSON body for input, if not in query, and for workflow parameters
+	var params map[string]interface{}
+	if r.Body != nil {
 		var jsonBody struct {
-			Input     string `json:"input"`
-			Streaming bool   `json:"streaming"`
+			Input     string                 `json:"input"`
+			Streaming bool                   `json:"streaming"`
+			Params    map[string]interface{} `json:"params"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&jsonBody); err == nil {
-			stdinInput = jsonBody.Input
-			streaming = jsonBody.Streaming
+			if stdinInput == "" {
+				stdinInput = jsonBody.Input
+				config.DebugLog("Extracted input from JSON body")
+			}
+			streaming = streaming || jsonBody.Streaming
+			params = jsonBody.Params
 		}
-		config.DebugLog("Extracted input from JSON body")
+	}
+
+	// Apply the workflow parameters, including defaults when none are sent
+	// Invalid parameters are rejected with a JSON error before any event is sent, also when
+	// streaming was requested
+	if err := proc.SetParams(params); err != nil {
+		config.VerboseLog("Invalid workflow parameters: %v", err)
+		sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	// Always initialize the processor with input (empty string if none provided)
@@ -379,8 +387,10 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 			sw.SendProgress("Starting workflow processing")
 		}
 
-		// Run the processor in a goroutine with error context
-		processDone := make(chan error)
+		// Run the processor in a goroutine with error context. The processor shares the
+		// request context, so it stops when the client disconnects or the timeout passes.
+		// processDone is buffered so the goroutine can always deliver its result.
+		processDone := make(chan error, 1)
 		go func() {
 			defer func() {
 				if r := recover(); r != nil {
@@ -390,7 +400,7 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 			}()
 
 			config.DebugLog("Starting processor goroutine for streaming")
-			if err := proc.Process(); err != nil {
+			if err := proc.ProcessWithContext(ctx); err != nil {
 				config.DebugLog("Processor error in streaming mode: %v", err)
 				processDone <- fmt.Errorf("processing error: %w", err)
 			} else {
@@ -411,11 +421,16 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 				if sw != nil {
 					sw.SendError(fmt.Errorf("processing timed out after 5 minutes"))
 				}
+				drainProgress(progressChan, processDone)
 				return
 			case <-r.Context().Done():
 				config.DebugLog("Client connection closed: %v", r.Context().Err())
+				drainProgress(progressChan, processDone)
 				return
 			case err := <-processDone:
+				if usage := runUsage(proc); usage != nil && sw != nil {
+					sw.SendUsage(usage)
+				}
 				if err != nil {
 					errMsg := fmt.Sprintf("Processing failed: %v", err)
 					config.DebugLog("Streaming error: %s", errMsg)
@@ -452,8 +467,24 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 								"action": update.Step.Action,
 							}
 						}
+						if update.Usage != nil {
+							progressData["usage"] = update.Usage
+						}
 						sw.SendProgress(progressData)
 					}
+				case processor.ProgressSkipped:
+					progressData := map[string]interface{}{
+						"message": update.Message,
+						"skipped": true,
+					}
+					if update.Step != nil {
+						progressData["step"] = map[string]string{
+							"name":   update.Step.Name,
+							"model":  update.Step.Model,
+							"action": update.Step.Action,
+						}
+					}
+					sw.SendProgress(progressData)
 				case processor.ProgressOutput:
 					config.DebugLog("Received output event: %s", update.Stdout)
 					sw.SendOutput(update.Stdout)
@@ -488,7 +519,7 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 
 	config.DebugLog("Starting workflow processing")
 
-	err = proc.Process()
+	err = proc.ProcessWithContext(r.Context())
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -513,6 +544,7 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 			Success: false,
 			Error:   fmt.Sprintf("Error processing workflow file: %v", err),
 			Output:  finalOutput,
+			Usage:   runUsage(proc),
 		})
 		return
 	}
@@ -526,5 +558,30 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 		Success: true,
 		Message: fmt.Sprintf("Successfully processed %s", filename),
 		Output:  finalOutput,
+		Usage:   runUsage(proc),
 	})
 }
+
+// runUsage returns the token usage and cost of a processor's run, or nil if it made no model calls
+func runUsage(proc *processor.Processor) *processor.UsageReport {
+	usage := proc.Usage()
+	if usage.Calls == 0 {
+		return nil
+	}
+	return &usage
+}
+
+// drainProgress discards progress updates until the processor finishes. It is used when
+// a streaming handler stops reading early, so a cancelled processor never blocks while
+// sending progress that nobody will receive.
+func drainProgress(progressChan <-chan processor.ProgressUpdate, processDone <-chan error) {
+	go func() {
+		for {
+			select {
+			case <-progressChan:
+			case <-processDone:
+				return
+			}
+		}
+	}()
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -49,7 +50,7 @@ func (m *MockProvider) Configure(apiKey string) error {
 	return nil
 }
 
-func (m *MockProvider) SendPrompt(model, prompt string) (string, error) {
+func (m *MockProvider) SendPrompt(ctx context.Context, model, prompt string) (string, error) {
 	if !m.configured {
 		return "", fmt.Errorf("provider not configured")
 	}
@@ -60,7 +61,7 @@ func (m *MockProvider) SendPrompt(model, prompt string) (string, error) {
 	return fmt.Sprintf("mock response for prompt: %s", prompt), nil
 }
 
-func (m *MockProvider) SendPromptWithFile(model, prompt string, file models.FileInput) (string, error) {
+func (m *MockProvider) SendPromptWithFile(ctx context.Context, model, prompt string, file models.FileInput) (string, error) {
 	if !m.configured {
 		return "", fmt.Errorf("provider not configured")
 	}
@@ -71,6 +72,21 @@ func (m *MockProvider) SendPromptWithFile(model, prompt string, file models.File
 	return fmt.Sprintf("mock response for file: %s with prompt: %s", file.Path, prompt), nil
 }
 
+func (m *MockProvider) SendMessages(ctx context.Context, model string, messages []models.Message) (string, error) {
+	if !m.configured {
+		return "", fmt.Errorf("provider not configured")
+	}
+	if !m.SupportsModel(model) {
+		return "", fmt.Errorf("unsupported model: %s", model)
+	}
+	return fmt.Sprintf("mock response for %d messages", len(messages)), nil
+}
+
+func (m *MockProvider) SendMessagesWithTools(ctx context.Context, model string, messages []models.Message, tools []models.Tool) (models.Message, error) {
+	response, err := m.SendMessages(ctx, model, messages)
+	return models.Message{Role: models.RoleAssistant, Content: response}, err
+}
+
 func (m *MockProvider) SetVerbose(verbose bool) {
 	m.verbose = verbose
 }
@@ -653,3 +669,69 @@ step_one:
 		})
 	}
 }
+
+func TestHandleProcessParams(t *testing.T) {
+	tempDir := t.TempDir()
+	workflow := `
+params:
+  region:
+    type: string
+    required: true
+  max_items:
+    type: int
+    default: 10
+
+step_one:
+  model: gpt-4o
+  input: NA
+  action: "Report on $region"
+  output: STDOUT
+`
+	if err := os.WriteFile(fmt.Sprintf("%s/params.yaml", tempDir), []byte(workflow), 0644); err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &config.ServerConfig{DataDir: tempDir, Enabled: true}
+
+	tests := []struct {
+		name          string
+		params        map[string]interface{}
+		expectedError string
+	}{
+		{
+			name:          "missing required parameter",
+			params:        map[string]interface{}{"max_items": 5},
+			expectedError: "missing required parameter 'region'",
+		},
+		{
+			name:          "wrong type",
+			params:        map[string]interface{}{"region": "emea", "max_items": "many"},
+			expectedError: "parameter 'max_items': expected an integer",
+		},
+		{
+			name:          "unknown parameter",
+			params:        map[string]interface{}{"region": "emea", "colour": "blue"},
+			expectedError: "unknown parameter 'colour'",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, streaming := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s streaming=%v", tt.name, streaming), func(t *testing.T) {
+				body, _ := json.Marshal(map[string]interface{}{"params": tt.params})
+				req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/process?filename=params.yaml&streaming=%v", streaming), bytes.NewBuffer(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+
+				handleProcess(w, req, serverConfig, &config.EnvConfig{})
+
+				// Invalid parameters are rejected before any event is sent
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+				assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+				var response ProcessResponse
+				assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+				assert.False(t, response.Success)
+				assert.Contains(t, response.Error, tt.expectedError)
+			})
+		}
+	}
+}
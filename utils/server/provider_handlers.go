@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings" // Added for path splitting
 
 	"github.com/kris-hansen/comanda/utils/config"
@@ -56,6 +57,22 @@ func (s *Server) handleGetProviders(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// OpenAI-compatible endpoints, which may not need an API key
+	var endpoints []string
+	for name, provider := range s.envConfig.Providers {
+		if provider != nil && provider.Type == config.OpenAICompatible {
+			endpoints = append(endpoints, name)
+		}
+	}
+	sort.Strings(endpoints)
+	for _, name := range endpoints {
+		providers = append(providers, ProviderInfo{
+			Name:    name,
+			Models:  getModelNames(s.envConfig.Providers[name].Models),
+			Enabled: true,
+		})
+	}
+
 	json.NewEncoder(w).Encode(ProviderListResponse{
 		Success:   true,
 		Providers: providers,
@@ -110,8 +127,25 @@ func (s *Server) handleGetAvailableModels(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Fetch available models using the discovery package
-	modelNames, err := discovery.GetAvailableModels(providerName, apiKey)
+	// Fetch available models from OpenAI-compatible endpoints themselves, from the configured
+	// hosts for Ollama, and with the discovery package for the other providers
+	var modelNames []string
+	if providerConfig != nil && providerConfig.Type == config.OpenAICompatible {
+		provider := models.GetProviderByName(providerName)
+		if provider == nil {
+			err = fmt.Errorf("provider %s is not registered", providerName)
+		} else {
+			modelNames, err = provider.ListModels()
+		}
+	} else if providerName == "ollama" {
+		var hosts []config.Host
+		hosts, _, err = s.envConfig.OllamaHosts()
+		if err == nil {
+			modelNames, err = discovery.GetOllamaHostsModels(hosts)
+		}
+	} else {
+		modelNames, err = discovery.GetAvailableModels(providerName, apiKey)
+	}
 	if err != nil {
 		sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Error fetching available models for %s: %v", providerName, err))
 		return
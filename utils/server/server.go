@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
 )
 
 // Server represents the HTTP server
@@ -222,6 +223,13 @@ func New(envConfig *config.EnvConfig) (*http.Server, error) {
 		return nil, fmt.Errorf("error creating data directory: %v", err)
 	}
 
+	if err := models.RegisterOpenAICompatibleProviders(envConfig); err != nil {
+		return nil, err
+	}
+	if err := models.RegisterModelAliases(envConfig); err != nil {
+		return nil, err
+	}
+
 	s := &Server{
 		mux:       http.NewServeMux(),
 		config:    serverConfig,
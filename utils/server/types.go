@@ -10,6 +10,7 @@ import (
 	"time"
 
 	cfg "github.com/kris-hansen/comanda/utils/config" // Added alias cfg
+	"github.com/kris-hansen/comanda/utils/processor"
 )
 
 // debugLog provides local logging to avoid circular imports
@@ -19,10 +20,11 @@ func debugLog(format string, args ...interface{}) {
 
 // ProcessResponse represents the response for process operations
 type ProcessResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message,omitempty"`
-	Error   string `json:"error,omitempty"`
-	Output  string `json:"output,omitempty"`
+	Success bool                   `json:"success"`
+	Message string                 `json:"message,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+	Output  string                 `json:"output,omitempty"`
+	Usage   *processor.UsageReport `json:"usage,omitempty"` // Token usage and cost of the run
 }
 
 // HealthResponse represents the health check response
@@ -140,9 +142,10 @@ type EnvironmentResponse struct {
 
 // YAMLRequest represents a request for YAML operations
 type YAMLRequest struct {
-	Content   string `json:"content"`
-	Input     string `json:"input"`
-	Streaming bool   `json:"streaming"`
+	Content   string                 `json:"content"`
+	Input     string                 `json:"input"`
+	Streaming bool                   `json:"streaming"`
+	Params    map[string]interface{} `json:"params,omitempty"` // Values for the workflow's params section
 }
 
 // flushingResponseWriter implements http.Flusher interface
@@ -384,3 +387,22 @@ func (sw *sseWriter) SendOutput(content string) (n int, err error) {
 	debugLog("[SSE] Successfully sent output event: bytes=%d", n)
 	return
 }
+
+// SendUsage sends a usage event with the token usage and cost of the run
+func (sw *sseWriter) SendUsage(usage *processor.UsageReport) (n int, err error) {
+	debugLog("[SSE] Sending usage event")
+	jsonData, err := json.Marshal(usage)
+	if err != nil {
+		debugLog("[SSE] Error marshaling usage data: %v", err)
+		return 0, err
+	}
+	event := fmt.Sprintf("event: usage\ndata: %s\n\n", string(jsonData))
+	n, err = sw.w.Write([]byte(event))
+	if err != nil {
+		debugLog("[SSE] Error writing usage event: %v", err)
+		return
+	}
+	sw.f.Flush()
+	debugLog("[SSE] Successfully sent usage event: bytes=%d", n)
+	return
+}